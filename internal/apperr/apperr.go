@@ -0,0 +1,131 @@
+// Package apperr classifies domain errors. Every classified error has a Kind, which decides
+// the HTTP status it is answered with, and a stable Code API clients can switch on; the
+// message is for humans and may change.
+package apperr
+
+import "errors"
+
+// Kind is the category of a domain error.
+type Kind string
+
+const (
+	Invalid      Kind = "invalid"
+	Unauthorized Kind = "unauthorized"
+	Forbidden    Kind = "forbidden"
+	NotFound     Kind = "not_found"
+	Conflict     Kind = "conflict"
+	Locked       Kind = "locked"
+	RateLimited  Kind = "rate_limited"
+	// Upstream is a failure of an external service the request depended on, e.g. the SMS gateway.
+	Upstream    Kind = "upstream"
+	Unavailable Kind = "unavailable"
+	Internal    Kind = "internal"
+)
+
+// CodeInternal is the code of every unclassified error.
+const CodeInternal = "internal_error"
+
+// Typed is implemented by classified errors.
+type Typed interface {
+	error
+	Kind() Kind
+	Code() string
+}
+
+// Detailer is implemented by errors that add members to the error response, such as the
+// invalid field.
+type Detailer interface {
+	Details() map[string]any
+}
+
+// Error is a classified sentinel error; compare with errors.Is as usual.
+type Error struct {
+	kind    Kind
+	code    string
+	message string
+}
+
+func New(kind Kind, code, message string) *Error {
+	return &Error{kind: kind, code: code, message: message}
+}
+
+func (e *Error) Error() string { return e.message }
+func (e *Error) Kind() Kind    { return e.kind }
+func (e *Error) Code() string  { return e.code }
+
+// Classify returns the first classified error in err's chain, or nil if there is none.
+func Classify(err error) Typed {
+	var typed Typed
+	if errors.As(err, &typed) {
+		return typed
+	}
+	return nil
+}
+
+// KindOf returns the kind of err, Internal if it is not classified.
+func KindOf(err error) Kind {
+	if typed := Classify(err); typed != nil {
+		return typed.Kind()
+	}
+	return Internal
+}
+
+// ValidationError reports invalid input.
+type ValidationError struct {
+	// Field is the request field at fault, if any.
+	Field   string
+	Message string
+}
+
+// Validation returns a ValidationError for field; field may be empty.
+func Validation(field, message string) *ValidationError {
+	return &ValidationError{Field: field, Message: message}
+}
+
+func (e *ValidationError) Error() string { return e.Message }
+func (e *ValidationError) Kind() Kind    { return Invalid }
+func (e *ValidationError) Code() string  { return "validation_failed" }
+
+func (e *ValidationError) Details() map[string]any {
+	if e.Field == "" {
+		return nil
+	}
+	return map[string]any{"field": e.Field}
+}
+
+// WithField attributes err, typically an Invalid error from a parser, to request field.
+func WithField(field string, err error) error {
+	return &fieldError{field: field, err: err}
+}
+
+type fieldError struct {
+	field string
+	err   error
+}
+
+func (e *fieldError) Error() string           { return e.err.Error() }
+func (e *fieldError) Unwrap() error           { return e.err }
+func (e *fieldError) Details() map[string]any { return map[string]any{"field": e.field} }
+
+// WithKind reclassifies err as kind, keeping its code and message, for call sites where the
+// same domain error means something else: a wrong OTP is 401 at login but 400 for a caller
+// who is already authenticated.
+func WithKind(kind Kind, err error) error {
+	return &kindError{kind: kind, err: err}
+}
+
+type kindError struct {
+	kind Kind
+	err  error
+}
+
+func (e *kindError) Error() string { return e.err.Error() }
+func (e *kindError) Unwrap() error { return e.err }
+func (e *kindError) Kind() Kind    { return e.kind }
+
+func (e *kindError) Code() string {
+	if typed := Classify(e.err); typed != nil {
+		return typed.Code()
+	}
+	return CodeInternal
+}
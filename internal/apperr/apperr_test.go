@@ -0,0 +1,53 @@
+package apperr_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"user-go/internal/apperr"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errMissing = apperr.New(apperr.NotFound, "thing_not_found", "thing not found")
+
+func TestClassify(t *testing.T) {
+	wrapped := fmt.Errorf("load thing: %w", errMissing)
+	assert.ErrorIs(t, wrapped, errMissing)
+	assert.Equal(t, errMissing, apperr.Classify(wrapped))
+	assert.Equal(t, apperr.NotFound, apperr.KindOf(wrapped))
+
+	assert.Nil(t, apperr.Classify(errors.New("connection reset")))
+	assert.Equal(t, apperr.Internal, apperr.KindOf(errors.New("connection reset")))
+	assert.Nil(t, apperr.Classify(nil))
+}
+
+func TestValidation(t *testing.T) {
+	err := apperr.Validation("limit", "limit must be a positive integer")
+	assert.Equal(t, apperr.Invalid, apperr.KindOf(err))
+	assert.Equal(t, "validation_failed", err.Code())
+	assert.Equal(t, map[string]any{"field": "limit"}, err.Details())
+	assert.Nil(t, apperr.Validation("", "bad body").Details())
+}
+
+func TestWithField(t *testing.T) {
+	err := apperr.WithField("phone", errMissing)
+	assert.ErrorIs(t, err, errMissing)
+	assert.Equal(t, errMissing.Error(), err.Error())
+	assert.Equal(t, apperr.NotFound, apperr.KindOf(err))
+
+	var d apperr.Detailer
+	if assert.ErrorAs(t, err, &d) {
+		assert.Equal(t, map[string]any{"field": "phone"}, d.Details())
+	}
+}
+
+func TestWithKind(t *testing.T) {
+	err := apperr.WithKind(apperr.Invalid, fmt.Errorf("confirm: %w", errMissing))
+	assert.ErrorIs(t, err, errMissing)
+	typed := apperr.Classify(err)
+	assert.Equal(t, apperr.Invalid, typed.Kind())
+	assert.Equal(t, "thing_not_found", typed.Code())
+
+	assert.Equal(t, apperr.CodeInternal, apperr.Classify(apperr.WithKind(apperr.Unavailable, errors.New("down"))).Code())
+}
@@ -0,0 +1,66 @@
+// Package audit writes authentication and user-management events to a repository.AuditLog.
+package audit
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"user-go/internal/logging"
+	"user-go/internal/repository"
+)
+
+// maxUserAgent keeps a hostile User-Agent header from bloating the log.
+const maxUserAgent = 256
+
+// Client is where a request came from, as recorded on its events.
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+type clientKey struct{}
+
+// WithClient returns ctx carrying c for events recorded under it. The User-Agent is made
+// valid UTF-8 and cut to maxUserAgent characters.
+func WithClient(ctx context.Context, c Client) context.Context {
+	// هدر را کلاینت می‌فرستد؛ UTF-8 نامعتبر درج رویداد را در Postgres شکست می‌دهد
+	c.UserAgent = strings.ToValidUTF8(c.UserAgent, "")
+	if utf8.RuneCountInString(c.UserAgent) > maxUserAgent {
+		c.UserAgent = string([]rune(c.UserAgent)[:maxUserAgent])
+	}
+	return context.WithValue(ctx, clientKey{}, c)
+}
+
+// ClientFrom returns the client stored by WithClient, or the zero Client.
+func ClientFrom(ctx context.Context) Client {
+	c, _ := ctx.Value(clientKey{}).(Client)
+	return c
+}
+
+// Recorder appends events on behalf of services and handlers. A nil *Recorder records nothing.
+type Recorder struct {
+	log repository.AuditLog
+	now func() time.Time
+}
+
+func NewRecorder(log repository.AuditLog) *Recorder {
+	return &Recorder{log: log, now: time.Now}
+}
+
+// Record fills in the client and time of event and appends it. The action being audited has
+// already happened, so a failed write is logged rather than returned, and a client that hung up
+// does not cancel it.
+func (r *Recorder) Record(ctx context.Context, event repository.AuditEvent) {
+	if r == nil {
+		return
+	}
+	client := ClientFrom(ctx)
+	event.IP, event.UserAgent = client.IP, client.UserAgent
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = r.now()
+	}
+	if err := r.log.AppendAudit(context.WithoutCancel(ctx), event); err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "failed to write audit event", "action", event.Action, "error", err)
+	}
+}
@@ -0,0 +1,61 @@
+package audit_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+	"user-go/internal/audit"
+	"user-go/internal/logging"
+	"user-go/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failingLog struct{ repository.AuditLog }
+
+func (failingLog) AppendAudit(context.Context, repository.AuditEvent) error {
+	return errors.New("db down")
+}
+
+func TestRecorder_Record(t *testing.T) {
+	users := repository.NewInMemoryUserRepository()
+	rec := audit.NewRecorder(users)
+
+	ctx := audit.WithClient(context.Background(), audit.Client{IP: "203.0.113.7", UserAgent: strings.Repeat("x", 300)})
+	// قطع اتصال کلاینت نباید ثبت رویداد را لغو کند
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	rec.Record(ctx, repository.AuditEvent{Action: repository.AuditUserDeleted, TargetID: "u1", Outcome: repository.AuditSuccess})
+
+	events, err := users.AuditEvents(context.Background(), repository.AuditQuery{})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "203.0.113.7", events[0].IP)
+	assert.Len(t, events[0].UserAgent, 256)
+	assert.False(t, events[0].CreatedAt.IsZero())
+
+	var nilRecorder *audit.Recorder
+	nilRecorder.Record(ctx, repository.AuditEvent{})
+}
+
+func TestWithClient_SanitizesUserAgent(t *testing.T) {
+	ua := audit.ClientFrom(audit.WithClient(context.Background(), audit.Client{UserAgent: "app\xff/" + strings.Repeat("ب", 300)})).UserAgent
+	assert.True(t, utf8.ValidString(ua))
+	assert.Equal(t, 256, utf8.RuneCountInString(ua))
+	assert.True(t, strings.HasPrefix(ua, "app/ب"))
+}
+
+func TestRecorder_LogsFailures(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, logging.Options{})
+	require.NoError(t, err)
+
+	audit.NewRecorder(failingLog{}).Record(logging.WithLogger(context.Background(), logger),
+		repository.AuditEvent{Action: repository.AuditLogin})
+	assert.Contains(t, buf.String(), `"msg":"failed to write audit event"`)
+	assert.Contains(t, buf.String(), "db down")
+}
@@ -1,74 +1,293 @@
 package cache
 
 import (
+	"container/list"
+	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 )
 
+var ErrNotFound = errors.New("key not found or expired")
+
+// Cache stores short-lived OTP state and counters. Every call fails fast with ctx.Err()
+// once ctx is done.
 type Cache interface {
-	IncrWithExpire(key string, expireSeconds int) (int, error)
-	SetWithTTL(key string, value string, ttlSeconds int) error
-	Get(key string) (string, error)
-	Delete(key string) error
+	IncrWithExpire(ctx context.Context, key string, expireSeconds int) (int, error)
+	SetWithTTL(ctx context.Context, key string, value string, ttlSeconds int) error
+	Get(ctx context.Context, key string) (string, error)
+	Delete(ctx context.Context, key string) error
+	// CompareAndSwap sets key to value with a fresh TTL only if it currently holds old, in one
+	// atomic step, and reports whether it did. A missing key never matches.
+	CompareAndSwap(ctx context.Context, key, old, value string, ttlSeconds int) (bool, error)
+}
+
+// Pinger is implemented by caches backed by a server, so readiness probes can check it is reachable.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// BucketTaker is implemented by caches shared between instances that can update a token
+// bucket in one atomic step, so concurrent instances cannot both spend its last token.
+type BucketTaker interface {
+	// TakeToken refills the bucket at key by perSec tokens a second since it was last taken
+	// from, up to burst, and takes one token if there is one. It returns the tokens left and
+	// whether a token was taken.
+	TakeToken(ctx context.Context, key string, burst int, perSec float64, now time.Time) (tokens float64, taken bool, err error)
+}
+
+// DefaultCleanupInterval is how often the janitor sweeps expired entries unless overridden.
+const DefaultCleanupInterval = time.Minute
+
+// Stats is a point-in-time snapshot of InMemoryCache counters.
+type Stats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Expired   uint64
+	Size      int
 }
 
+// InMemoryCache is a process-local Cache. Expired entries are removed lazily on access and
+// by a background janitor; when MaxEntries is set the least recently used entry is evicted.
+// Keys under a pinned prefix are never evicted and do not count towards MaxEntries.
 type InMemoryCache struct {
-	mu   sync.RWMutex
-	data map[string]cacheItem
+	mu     sync.Mutex
+	data   map[string]*list.Element
+	lru    *list.List // front = most recently used
+	pinned *list.List // entries that are only removed when they expire
+
+	maxEntries      int
+	pinnedPrefixes  []string
+	cleanupInterval time.Duration
+	stats           Stats
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 type cacheItem struct {
+	key        string
 	value      string
 	expireTime time.Time
 }
 
-func NewInMemoryCache() *InMemoryCache {
-	return &InMemoryCache{
-		data: make(map[string]cacheItem),
+// InMemoryOption configures an InMemoryCache.
+type InMemoryOption func(*InMemoryCache)
+
+// WithCleanupInterval sets the janitor period. Zero or negative disables the janitor.
+func WithCleanupInterval(d time.Duration) InMemoryOption {
+	return func(c *InMemoryCache) { c.cleanupInterval = d }
+}
+
+// WithMaxEntries bounds the number of stored keys. Zero means unbounded.
+func WithMaxEntries(n int) InMemoryOption {
+	return func(c *InMemoryCache) { c.maxEntries = n }
+}
+
+// WithPinnedPrefixes keeps keys starting with any of prefixes out of LRU eviction, so a flood
+// of other keys cannot push them out. Use it for security state such as lockouts and
+// revocations; pinned keys must have a TTL and be bounded by whatever creates them.
+func WithPinnedPrefixes(prefixes ...string) InMemoryOption {
+	return func(c *InMemoryCache) { c.pinnedPrefixes = append(c.pinnedPrefixes, prefixes...) }
+}
+
+func NewInMemoryCache(opts ...InMemoryOption) *InMemoryCache {
+	c := &InMemoryCache{
+		data:            make(map[string]*list.Element),
+		lru:             list.New(),
+		pinned:          list.New(),
+		cleanupInterval: DefaultCleanupInterval,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.cleanupInterval > 0 {
+		c.stop = make(chan struct{})
+		c.done = make(chan struct{})
+		go c.janitor()
+	}
+	return c
+}
+
+func (c *InMemoryCache) janitor() {
+	defer close(c.done)
+	ticker := time.NewTicker(c.cleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.DeleteExpired()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// Close stops the janitor goroutine. The cache stays usable afterwards, relying on lazy expiry.
+func (c *InMemoryCache) Close() error {
+	c.closeOnce.Do(func() {
+		if c.stop != nil {
+			close(c.stop)
+			<-c.done
+		}
+	})
+	return nil
+}
+
+// DeleteExpired removes every expired entry and returns how many were dropped.
+func (c *InMemoryCache) DeleteExpired() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	removed := 0
+	for _, el := range c.data {
+		if now.After(el.Value.(*cacheItem).expireTime) {
+			c.removeElement(el)
+			c.stats.Expired++
+			removed++
+		}
+	}
+	return removed
+}
+
+// Stats returns a snapshot of the cache counters.
+func (c *InMemoryCache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Size = len(c.data)
+	return s
+}
+
+// lookup returns the live element for key, dropping it if it has expired. Caller holds mu.
+func (c *InMemoryCache) lookup(key string, now time.Time) (*list.Element, bool) {
+	el, exists := c.data[key]
+	if !exists {
+		return nil, false
+	}
+	if now.After(el.Value.(*cacheItem).expireTime) {
+		c.removeElement(el)
+		c.stats.Expired++
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return el, true
+}
+
+func (c *InMemoryCache) isPinned(key string) bool {
+	for _, p := range c.pinnedPrefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// store inserts or replaces key, evicting the least recently used entry when full. Caller holds mu.
+func (c *InMemoryCache) store(key, value string, expireTime time.Time) {
+	if el, exists := c.data[key]; exists {
+		item := el.Value.(*cacheItem)
+		item.value = value
+		item.expireTime = expireTime
+		c.lru.MoveToFront(el)
+		return
+	}
+
+	item := &cacheItem{key: key, value: value, expireTime: expireTime}
+	if c.isPinned(key) {
+		c.data[key] = c.pinned.PushFront(item)
+		return
+	}
+	if c.maxEntries > 0 && c.lru.Len() >= c.maxEntries {
+		if oldest := c.lru.Back(); oldest != nil {
+			c.removeElement(oldest)
+			c.stats.Evictions++
+		}
 	}
+	c.data[key] = c.lru.PushFront(item)
 }
 
-func (c *InMemoryCache) IncrWithExpire(key string, expireSeconds int) (int, error) {
+// removeElement drops el from whichever list holds it; List.Remove ignores foreign elements.
+func (c *InMemoryCache) removeElement(el *list.Element) {
+	c.lru.Remove(el)
+	c.pinned.Remove(el)
+	delete(c.data, el.Value.(*cacheItem).key)
+}
+
+func (c *InMemoryCache) IncrWithExpire(ctx context.Context, key string, expireSeconds int) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	item, exists := c.data[key]
-	if !exists || time.Now().After(item.expireTime) {
-		c.data[key] = cacheItem{value: "1", expireTime: time.Now().Add(time.Duration(expireSeconds) * time.Second)}
+	now := time.Now()
+	el, exists := c.lookup(key, now)
+	if !exists {
+		c.store(key, "1", now.Add(time.Duration(expireSeconds)*time.Second))
 		return 1, nil
 	}
+	item := el.Value.(*cacheItem)
 	val := 0
 	fmt.Sscanf(item.value, "%d", &val)
 	val++
-	c.data[key] = cacheItem{value: fmt.Sprintf("%d", val), expireTime: item.expireTime}
+	item.value = fmt.Sprintf("%d", val)
 	return val, nil
 }
 
-func (c *InMemoryCache) SetWithTTL(key string, value string, ttlSeconds int) error {
+func (c *InMemoryCache) SetWithTTL(ctx context.Context, key string, value string, ttlSeconds int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.data[key] = cacheItem{
-		value:      value,
-		expireTime: time.Now().Add(time.Duration(ttlSeconds) * time.Second),
-	}
+	c.store(key, value, time.Now().Add(time.Duration(ttlSeconds)*time.Second))
 	return nil
 }
 
-func (c *InMemoryCache) Get(key string) (string, error) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	item, exists := c.data[key]
-	if !exists || time.Now().After(item.expireTime) {
-		return "", errors.New("key not found or expired")
+func (c *InMemoryCache) Get(ctx context.Context, key string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, exists := c.lookup(key, time.Now())
+	if !exists {
+		c.stats.Misses++
+		return "", ErrNotFound
+	}
+	c.stats.Hits++
+	return el.Value.(*cacheItem).value, nil
+}
+
+func (c *InMemoryCache) CompareAndSwap(ctx context.Context, key, old, value string, ttlSeconds int) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	el, exists := c.lookup(key, now)
+	if !exists || el.Value.(*cacheItem).value != old {
+		return false, nil
 	}
-	return item.value, nil
+	c.store(key, value, now.Add(time.Duration(ttlSeconds)*time.Second))
+	return true, nil
 }
 
-func (c *InMemoryCache) Delete(key string) error {
+func (c *InMemoryCache) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	delete(c.data, key)
+	if el, exists := c.data[key]; exists {
+		c.removeElement(el)
+	}
 	return nil
 }
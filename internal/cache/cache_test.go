@@ -1,80 +1,243 @@
 package cache_test
 
 import (
+	"context"
+	"fmt"
 	"testing"
 	"time"
 
 	"user-go/internal/cache"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func TestInMemoryCache_SetGetDelete(t *testing.T) {
-	c := cache.NewInMemoryCache()
+var ctx = context.Background()
+
+// cacheSuite runs the same behavioural checks against every Cache implementation.
+// advance moves the backend's clock forward (a real sleep for in-memory, FastForward for miniredis).
+type cacheSuite struct {
+	newCache func(t *testing.T) cache.Cache
+	advance  func(d time.Duration)
+}
+
+func (s cacheSuite) run(t *testing.T) {
+	t.Run("SetGetDelete", s.testSetGetDelete)
+	t.Run("Expire", s.testExpire)
+	t.Run("IncrWithExpire_NewKey", s.testIncrNewKey)
+	t.Run("IncrWithExpire_ExistingKey", s.testIncrExistingKey)
+	t.Run("IncrWithExpire_Expired", s.testIncrExpired)
+	t.Run("CompareAndSwap", s.testCompareAndSwap)
+	t.Run("CanceledContext", s.testCanceledContext)
+}
+
+func (s cacheSuite) testSetGetDelete(t *testing.T) {
+	c := s.newCache(t)
 
 	// تست SetWithTTL و Get
-	err := c.SetWithTTL("key1", "value1", 1) // 1 ثانیه TTL
+	err := c.SetWithTTL(ctx, "key1", "value1", 1) // 1 ثانیه TTL
 	assert.NoError(t, err)
 
-	val, err := c.Get("key1")
+	val, err := c.Get(ctx, "key1")
 	assert.NoError(t, err)
 	assert.Equal(t, "value1", val)
 
 	// تست Delete
-	err = c.Delete("key1")
+	err = c.Delete(ctx, "key1")
 	assert.NoError(t, err)
 
-	_, err = c.Get("key1")
-	assert.Error(t, err)
+	_, err = c.Get(ctx, "key1")
+	assert.ErrorIs(t, err, cache.ErrNotFound)
 }
 
-func TestInMemoryCache_Expire(t *testing.T) {
-	c := cache.NewInMemoryCache()
+func (s cacheSuite) testExpire(t *testing.T) {
+	c := s.newCache(t)
 
-	err := c.SetWithTTL("key2", "val2", 1) // یک ثانیه TTL
+	err := c.SetWithTTL(ctx, "key2", "val2", 1) // یک ثانیه TTL
 	assert.NoError(t, err)
 
-	time.Sleep(1100 * time.Millisecond) // کمی بیشتر از 1 ثانیه صبر می‌کنیم
+	s.advance(1100 * time.Millisecond) // کمی بیشتر از 1 ثانیه صبر می‌کنیم
 
-	_, err = c.Get("key2")
+	_, err = c.Get(ctx, "key2")
 	assert.Error(t, err) // باید expired باشه و ارور بده
 }
 
-func TestInMemoryCache_IncrWithExpire_NewKey(t *testing.T) {
-	c := cache.NewInMemoryCache()
+func (s cacheSuite) testIncrNewKey(t *testing.T) {
+	c := s.newCache(t)
 
-	val, err := c.IncrWithExpire("counter", 1)
+	val, err := c.IncrWithExpire(ctx, "counter", 1)
 	assert.NoError(t, err)
 	assert.Equal(t, 1, val)
 }
 
-func TestInMemoryCache_IncrWithExpire_ExistingKey(t *testing.T) {
-	c := cache.NewInMemoryCache()
+func (s cacheSuite) testIncrExistingKey(t *testing.T) {
+	c := s.newCache(t)
 
-	val, err := c.IncrWithExpire("counter", 5)
+	val, err := c.IncrWithExpire(ctx, "counter", 5)
 	assert.NoError(t, err)
 	assert.Equal(t, 1, val)
 
-	val, err = c.IncrWithExpire("counter", 5)
+	val, err = c.IncrWithExpire(ctx, "counter", 5)
 	assert.NoError(t, err)
 	assert.Equal(t, 2, val)
 
 	// تست expire: مقدار نباید ریست شود چون هنوز TTL منقضی نشده
-	val, err = c.IncrWithExpire("counter", 5)
+	val, err = c.IncrWithExpire(ctx, "counter", 5)
 	assert.NoError(t, err)
 	assert.Equal(t, 3, val)
 }
 
-func TestInMemoryCache_IncrWithExpire_Expired(t *testing.T) {
-	c := cache.NewInMemoryCache()
+func (s cacheSuite) testIncrExpired(t *testing.T) {
+	c := s.newCache(t)
 
-	val, err := c.IncrWithExpire("counter_exp", 1)
+	val, err := c.IncrWithExpire(ctx, "counter_exp", 1)
 	assert.NoError(t, err)
 	assert.Equal(t, 1, val)
 
-	time.Sleep(1100 * time.Millisecond)
+	s.advance(1100 * time.Millisecond)
 
-	val, err = c.IncrWithExpire("counter_exp", 1)
+	val, err = c.IncrWithExpire(ctx, "counter_exp", 1)
 	assert.NoError(t, err)
 	assert.Equal(t, 1, val) // چون expired شده دوباره باید از اول بشماریم
 }
+
+func (s cacheSuite) testCompareAndSwap(t *testing.T) {
+	c := s.newCache(t)
+
+	// کلید ناموجود با هیچ مقداری برابر نیست
+	swapped, err := c.CompareAndSwap(ctx, "family", "", "a", 5)
+	require.NoError(t, err)
+	assert.False(t, swapped)
+	_, err = c.Get(ctx, "family")
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+
+	require.NoError(t, c.SetWithTTL(ctx, "family", "a", 1))
+	swapped, err = c.CompareAndSwap(ctx, "family", "b", "c", 5)
+	require.NoError(t, err)
+	assert.False(t, swapped)
+	swapped, err = c.CompareAndSwap(ctx, "family", "a", "b", 5)
+	require.NoError(t, err)
+	assert.True(t, swapped)
+
+	// TTL تازه شده و مقدار جدید بعد از TTL قبلی هنوز هست
+	s.advance(1100 * time.Millisecond)
+	val, err := c.Get(ctx, "family")
+	require.NoError(t, err)
+	assert.Equal(t, "b", val)
+}
+
+func (s cacheSuite) testCanceledContext(t *testing.T) {
+	c := s.newCache(t)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	assert.ErrorIs(t, c.SetWithTTL(canceled, "key3", "val3", 5), context.Canceled)
+	_, err := c.Get(canceled, "key3")
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = c.IncrWithExpire(canceled, "counter", 5)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, c.Delete(canceled, "key3"), context.Canceled)
+	_, err = c.CompareAndSwap(canceled, "key3", "", "val3", 5)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// چیزی نباید ذخیره شده باشد
+	_, err = c.Get(ctx, "key3")
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+}
+
+func TestInMemoryCache(t *testing.T) {
+	cacheSuite{
+		newCache: func(t *testing.T) cache.Cache {
+			c := cache.NewInMemoryCache()
+			t.Cleanup(func() { c.Close() })
+			return c
+		},
+		advance: time.Sleep,
+	}.run(t)
+}
+
+func TestInMemoryCache_JanitorRemovesExpired(t *testing.T) {
+	c := cache.NewInMemoryCache(cache.WithCleanupInterval(50 * time.Millisecond))
+	defer c.Close()
+
+	assert.NoError(t, c.SetWithTTL(ctx, "otp:+1", "123456", 1))
+	_, err := c.IncrWithExpire(ctx, "otp_req:+1", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, c.Stats().Size)
+
+	// بدون هیچ Get، janitor باید کلیدهای منقضی را پاک کند
+	assert.Eventually(t, func() bool { return c.Stats().Size == 0 }, 3*time.Second, 50*time.Millisecond)
+	assert.Equal(t, uint64(2), c.Stats().Expired)
+}
+
+func TestInMemoryCache_CloseStopsJanitor(t *testing.T) {
+	c := cache.NewInMemoryCache(cache.WithCleanupInterval(10 * time.Millisecond))
+	assert.NoError(t, c.Close())
+	assert.NoError(t, c.Close()) // idempotent
+
+	// Close فقط janitor را متوقف می‌کند؛ کش همچنان قابل استفاده است
+	assert.NoError(t, c.SetWithTTL(ctx, "k", "v", 10))
+	val, err := c.Get(ctx, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, "v", val)
+}
+
+func TestInMemoryCache_MaxEntriesEvictsLeastRecentlyUsed(t *testing.T) {
+	c := cache.NewInMemoryCache(cache.WithMaxEntries(2), cache.WithCleanupInterval(0))
+
+	assert.NoError(t, c.SetWithTTL(ctx, "a", "1", 60))
+	assert.NoError(t, c.SetWithTTL(ctx, "b", "2", 60))
+
+	// دسترسی به a باعث می‌شود b قدیمی‌ترین باشد
+	_, err := c.Get(ctx, "a")
+	assert.NoError(t, err)
+
+	assert.NoError(t, c.SetWithTTL(ctx, "c", "3", 60))
+
+	_, err = c.Get(ctx, "b")
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+	_, err = c.Get(ctx, "a")
+	assert.NoError(t, err)
+	_, err = c.Get(ctx, "c")
+	assert.NoError(t, err)
+
+	stats := c.Stats()
+	assert.Equal(t, 2, stats.Size)
+	assert.Equal(t, uint64(1), stats.Evictions)
+}
+
+func TestInMemoryCache_PinnedPrefixesAreNotEvicted(t *testing.T) {
+	c := cache.NewInMemoryCache(cache.WithMaxEntries(2), cache.WithCleanupInterval(0), cache.WithPinnedPrefixes("otp_lock:"))
+
+	assert.NoError(t, c.SetWithTTL(ctx, "otp_lock:+989121234567", "1", 60))
+	for i := range 10 {
+		_, err := c.IncrWithExpire(ctx, fmt.Sprintf("flood:%d", i), 60)
+		assert.NoError(t, err)
+	}
+
+	_, err := c.Get(ctx, "otp_lock:+989121234567")
+	assert.NoError(t, err)
+	stats := c.Stats()
+	assert.Equal(t, 3, stats.Size, "two evictable keys plus the pinned one")
+	assert.Equal(t, uint64(8), stats.Evictions)
+
+	// کلیدهای pinned همچنان با Delete حذف می‌شوند
+	assert.NoError(t, c.Delete(ctx, "otp_lock:+989121234567"))
+	_, err = c.Get(ctx, "otp_lock:+989121234567")
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+}
+
+func TestInMemoryCache_Stats(t *testing.T) {
+	c := cache.NewInMemoryCache(cache.WithCleanupInterval(0))
+
+	assert.NoError(t, c.SetWithTTL(ctx, "k", "v", 60))
+	_, _ = c.Get(ctx, "k")
+	_, _ = c.Get(ctx, "k")
+	_, _ = c.Get(ctx, "missing")
+
+	stats := c.Stats()
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, 1, stats.Size)
+}
@@ -0,0 +1,188 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// incrWithExpireScript increments a counter and sets its TTL in one step, so a crash
+// between INCR and EXPIRE can never leave a rate-limit key without expiry.
+var incrWithExpireScript = redis.NewScript(`
+local v = redis.call("INCR", KEYS[1])
+if v == 1 or redis.call("TTL", KEYS[1]) == -1 then
+	redis.call("EXPIRE", KEYS[1], ARGV[1])
+end
+return v
+`)
+
+// compareAndSwapScript replaces a value only if it is still the expected one.
+var compareAndSwapScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[2], "EX", ARGV[3])
+return 1
+`)
+
+// takeTokenScript is the token bucket of RedisCache.TakeToken. The state is "tokens,unixnano",
+// the same format the in-process bucket stores with SetWithTTL.
+var takeTokenScript = redis.NewScript(`
+local burst = tonumber(ARGV[1])
+local per_sec = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local tokens = burst
+local v = redis.call("GET", KEYS[1])
+if v then
+	local saved, at = string.match(v, "^([^,]+),(%d+)$")
+	if saved then
+		local refill = (now - tonumber(at)) / 1e9 * per_sec
+		if refill < 0 then refill = 0 end
+		tokens = math.min(burst, tonumber(saved) + refill)
+	end
+end
+local taken = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	taken = 1
+end
+local state = string.format("%.6f", tokens)
+redis.call("SET", KEYS[1], state .. "," .. ARGV[3], "EX", math.ceil((burst - tokens) / per_sec) + 1)
+return {taken, state}
+`)
+
+// RedisCache implements Cache on top of Redis so OTPs and counters survive restarts
+// and are shared between replicas.
+type RedisCache struct {
+	client    redis.UniversalClient
+	prefix    string
+	opTimeout time.Duration
+}
+
+// RedisOptions configures NewRedisCacheFromURL.
+type RedisOptions struct {
+	URL          string
+	PoolSize     int
+	MinIdleConns int
+	KeyPrefix    string
+	// OpTimeout bounds each cache call on top of the caller's context. Zero means no extra bound.
+	OpTimeout time.Duration
+}
+
+func NewRedisCache(client redis.UniversalClient, prefix string) *RedisCache {
+	return &RedisCache{client: client, prefix: prefix}
+}
+
+// NewRedisCacheFromURL parses a redis:// URL, builds a pooled client and checks connectivity.
+func NewRedisCacheFromURL(opts RedisOptions) (*RedisCache, error) {
+	redisOpts, err := redis.ParseURL(opts.URL)
+	if err != nil {
+		return nil, err
+	}
+	if opts.PoolSize > 0 {
+		redisOpts.PoolSize = opts.PoolSize
+	}
+	if opts.MinIdleConns > 0 {
+		redisOpts.MinIdleConns = opts.MinIdleConns
+	}
+
+	client := redis.NewClient(redisOpts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	c := NewRedisCache(client, opts.KeyPrefix)
+	c.opTimeout = opts.OpTimeout
+	return c, nil
+}
+
+// withTimeout applies opTimeout to ctx.
+func (c *RedisCache) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.opTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.opTimeout)
+}
+
+func (c *RedisCache) IncrWithExpire(ctx context.Context, key string, expireSeconds int) (int, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	v, err := incrWithExpireScript.Run(ctx, c.client, []string{c.prefix + key}, expireSeconds).Int()
+	if err != nil {
+		return 0, err
+	}
+	return v, nil
+}
+
+func (c *RedisCache) SetWithTTL(ctx context.Context, key string, value string, ttlSeconds int) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	return c.client.Set(ctx, c.prefix+key, value, time.Duration(ttlSeconds)*time.Second).Err()
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) (string, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	val, err := c.client.Get(ctx, c.prefix+key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrNotFound
+	}
+	return val, err
+}
+
+func (c *RedisCache) Delete(ctx context.Context, key string) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	return c.client.Del(ctx, c.prefix+key).Err()
+}
+
+func (c *RedisCache) CompareAndSwap(ctx context.Context, key, old, value string, ttlSeconds int) (bool, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	swapped, err := compareAndSwapScript.Run(ctx, c.client, []string{c.prefix + key}, old, value, ttlSeconds).Int()
+	if err != nil {
+		return false, err
+	}
+	return swapped == 1, nil
+}
+
+// TakeToken implements BucketTaker with a Lua script, so the read and the write of the bucket
+// cannot interleave with another instance's.
+func (c *RedisCache) TakeToken(ctx context.Context, key string, burst int, perSec float64, now time.Time) (float64, bool, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	res, err := takeTokenScript.Run(ctx, c.client, []string{c.prefix + key},
+		burst, strconv.FormatFloat(perSec, 'g', -1, 64), now.UnixNano()).Slice()
+	if err != nil {
+		return 0, false, err
+	}
+	if len(res) != 2 {
+		return 0, false, fmt.Errorf("unexpected token bucket reply %v", res)
+	}
+	taken, _ := res[0].(int64)
+	state, _ := res[1].(string)
+	tokens, err := strconv.ParseFloat(state, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("unexpected token bucket reply %v: %w", res, err)
+	}
+	return tokens, taken == 1, nil
+}
+
+// Ping checks that the Redis server answers.
+func (c *RedisCache) Ping(ctx context.Context) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	return c.client.Ping(ctx).Err()
+}
+
+// Close releases the underlying connection pool.
+func (c *RedisCache) Close() error {
+	return c.client.Close()
+}
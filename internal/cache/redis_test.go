@@ -0,0 +1,77 @@
+package cache_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"user-go/internal/cache"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRedisCache runs the shared suite against miniredis, an in-process Redis stand-in.
+func TestRedisCache(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	cacheSuite{
+		newCache: func(t *testing.T) cache.Cache {
+			mr.FlushAll()
+			client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			t.Cleanup(func() { client.Close() })
+			return cache.NewRedisCache(client, "test:")
+		},
+		advance: mr.FastForward,
+	}.run(t)
+}
+
+// TestRedisCache_Real runs the suite against a real server when REDIS_URL is set.
+func TestRedisCache_Real(t *testing.T) {
+	url := os.Getenv("REDIS_URL")
+	if url == "" {
+		t.Skip("REDIS_URL not set, skipping Redis integration test")
+	}
+
+	cacheSuite{
+		newCache: func(t *testing.T) cache.Cache {
+			c, err := cache.NewRedisCacheFromURL(cache.RedisOptions{URL: url, KeyPrefix: "user-go-test:" + t.Name() + ":"})
+			require.NoError(t, err)
+			t.Cleanup(func() { c.Close() })
+			return c
+		},
+		advance: time.Sleep,
+	}.run(t)
+}
+
+func TestRedisCache_IncrWithExpireSetsTTL(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	c := cache.NewRedisCache(client, "")
+
+	_, err := c.IncrWithExpire(ctx, "otp_req:+1", 600)
+	require.NoError(t, err)
+	assert.Equal(t, 600*time.Second, mr.TTL("otp_req:+1"))
+
+	// شمارنده‌ای که بدون TTL مانده باید دوباره expire بگیرد
+	require.NoError(t, client.Set(context.Background(), "orphan", "5", 0).Err())
+	val, err := c.IncrWithExpire(ctx, "orphan", 60)
+	require.NoError(t, err)
+	assert.Equal(t, 6, val)
+	assert.Equal(t, 60*time.Second, mr.TTL("orphan"))
+}
+
+func TestRedisCache_Ping(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	defer client.Close()
+	var c cache.Pinger = cache.NewRedisCache(client, "")
+
+	assert.NoError(t, c.Ping(ctx))
+	mr.Close()
+	assert.Error(t, c.Ping(ctx))
+}
@@ -0,0 +1,628 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"user-go/internal/phone"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+	EnvTest        = "test"
+
+	// InsecureDevSecret is used only outside production when JWT_SECRET is unset.
+	InsecureDevSecret = "mysecretjwtkey"
+	// InsecureDevPhoneHashSecret is used only outside production when PHONE_HASH_SECRET is unset.
+	InsecureDevPhoneHashSecret = "insecure-dev-phone-hash-secret"
+
+	minProductionSecretLen = 32
+)
+
+// Config is the complete runtime configuration of the service.
+// Values are resolved in order: defaults, config file, environment, command-line flags.
+type Config struct {
+	Env       string          `yaml:"env" toml:"env"`
+	HTTP      HTTPConfig      `yaml:"http" toml:"http"`
+	Database  DatabaseConfig  `yaml:"database" toml:"database"`
+	JWT       JWTConfig       `yaml:"jwt" toml:"jwt"`
+	OTP       OTPConfig       `yaml:"otp" toml:"otp"`
+	Cache     CacheConfig     `yaml:"cache" toml:"cache"`
+	RateLimit RateLimitConfig `yaml:"rate_limit" toml:"rate_limit"`
+	Phone     PhoneConfig     `yaml:"phone" toml:"phone"`
+	Users     UsersConfig     `yaml:"users" toml:"users"`
+	Log       LogConfig       `yaml:"log" toml:"log"`
+	Tracing   TracingConfig   `yaml:"tracing" toml:"tracing"`
+
+	// Args are the command-line arguments left after flags, e.g. ["migrate", "up"].
+	Args []string `yaml:"-" toml:"-"`
+}
+
+type HTTPConfig struct {
+	Port int `yaml:"port" toml:"port"`
+	// AdminPort serves /metrics on a listener of its own, to be kept off the public network.
+	// Zero disables it.
+	AdminPort int `yaml:"admin_port" toml:"admin_port"`
+	// ReadHeaderTimeout bounds how long a client may take to send request headers.
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout"`
+	// DrainDelay is how long /readyz reports draining after SIGTERM before the listener
+	// closes, giving load balancers time to stop routing here.
+	DrainDelay time.Duration `yaml:"drain_delay" toml:"drain_delay"`
+	// ShutdownTimeout bounds how long in-flight requests may take to finish on shutdown.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+}
+
+type DatabaseConfig struct {
+	URL string `yaml:"url" toml:"url"`
+	// AutoMigrate applies pending schema migrations when the server starts.
+	AutoMigrate bool `yaml:"auto_migrate" toml:"auto_migrate"`
+	// QueryTimeout bounds each repository call; zero leaves only the request deadline.
+	QueryTimeout time.Duration `yaml:"query_timeout" toml:"query_timeout"`
+	// ConnectTimeout is how long startup keeps retrying until the database is reachable.
+	ConnectTimeout time.Duration `yaml:"connect_timeout" toml:"connect_timeout"`
+}
+
+type JWTConfig struct {
+	Secret     string        `yaml:"secret" toml:"secret"`
+	TTL        time.Duration `yaml:"ttl" toml:"ttl"`
+	RefreshTTL time.Duration `yaml:"refresh_ttl" toml:"refresh_ttl"`
+	// Algorithm is HS256 (shared secret), RS256, ES256 or EdDSA.
+	Algorithm string `yaml:"algorithm" toml:"algorithm"`
+	// KeyDir holds PEM private keys for asymmetric algorithms; empty means keys are generated in memory.
+	KeyDir           string        `yaml:"key_dir" toml:"key_dir"`
+	RotationInterval time.Duration `yaml:"rotation_interval" toml:"rotation_interval"`
+}
+
+type OTPConfig struct {
+	TTL                 time.Duration `yaml:"ttl" toml:"ttl"`
+	RequestWindow       time.Duration `yaml:"request_window" toml:"request_window"`
+	MaxRequests         int           `yaml:"max_requests" toml:"max_requests"`
+	MaxValidateAttempts int           `yaml:"max_validate_attempts" toml:"max_validate_attempts"`
+	LockoutBase         time.Duration `yaml:"lockout_base" toml:"lockout_base"`
+	LockoutMax          time.Duration `yaml:"lockout_max" toml:"lockout_max"`
+	ValidateIPLimit     int           `yaml:"validate_ip_limit" toml:"validate_ip_limit"`
+	ValidateIPWindow    time.Duration `yaml:"validate_ip_window" toml:"validate_ip_window"`
+	DevMode             bool          `yaml:"dev_mode" toml:"dev_mode"`
+	Sender              SenderConfig  `yaml:"sender" toml:"sender"`
+}
+
+type SenderConfig struct {
+	Kind         string     `yaml:"kind" toml:"kind"`
+	FilePath     string     `yaml:"file_path" toml:"file_path"`
+	WebhookURL   string     `yaml:"webhook_url" toml:"webhook_url"`
+	WebhookToken string     `yaml:"webhook_token" toml:"webhook_token"`
+	SMPP         SMPPConfig `yaml:"smpp" toml:"smpp"`
+}
+
+type SMPPConfig struct {
+	Addr       string `yaml:"addr" toml:"addr"`
+	SystemID   string `yaml:"system_id" toml:"system_id"`
+	Password   string `yaml:"password" toml:"password"`
+	SourceAddr string `yaml:"source_addr" toml:"source_addr"`
+}
+
+type CacheConfig struct {
+	Backend       string `yaml:"backend" toml:"backend"`
+	RedisURL      string `yaml:"redis_url" toml:"redis_url"`
+	RedisPoolSize int    `yaml:"redis_pool_size" toml:"redis_pool_size"`
+	// MaxEntries bounds the memory backend so a flood of keys cannot exhaust memory; 0 is unbounded.
+	MaxEntries      int           `yaml:"max_entries" toml:"max_entries"`
+	CleanupInterval time.Duration `yaml:"cleanup_interval" toml:"cleanup_interval"`
+	// OpTimeout bounds each Redis call; zero leaves only the request deadline.
+	OpTimeout time.Duration `yaml:"op_timeout" toml:"op_timeout"`
+}
+
+type PhoneConfig struct {
+	// DefaultRegion is the ISO 3166 code used for numbers written without a country code; empty requires +.
+	DefaultRegion string `yaml:"default_region" toml:"default_region"`
+}
+
+// RateLimitConfig sets the HTTP rate limits, one per route group.
+type RateLimitConfig struct {
+	Enabled bool `yaml:"enabled" toml:"enabled"`
+	// Public limits the unauthenticated /auth endpoints, per client IP by default.
+	Public RateLimitRule `yaml:"public" toml:"public"`
+	// OTP also limits /auth/request-otp and /auth/validate-otp, per phone number by default,
+	// so rotating IPs does not multiply the attempts on one number.
+	OTP RateLimitRule `yaml:"otp" toml:"otp"`
+	// API limits the authenticated endpoints, per user by default.
+	API RateLimitRule `yaml:"api" toml:"api"`
+}
+
+type RateLimitRule struct {
+	// Key is what requests are counted against: ip, user, phone (the "phone" field of the JSON
+	// body) or route. user is only known on authenticated routes.
+	Key string `yaml:"key" toml:"key"`
+	// Algorithm is sliding_window or token_bucket.
+	Algorithm string        `yaml:"algorithm" toml:"algorithm"`
+	Limit     int           `yaml:"limit" toml:"limit"`
+	Window    time.Duration `yaml:"window" toml:"window"`
+	// Burst is the token bucket capacity; zero means Limit.
+	Burst int `yaml:"burst" toml:"burst"`
+}
+
+type UsersConfig struct {
+	// Retention is how long a deleted user can be restored; their phone stays reserved until then.
+	Retention time.Duration `yaml:"retention" toml:"retention"`
+	// PurgeInterval is how often expired users are erased; zero disables the job.
+	PurgeInterval time.Duration `yaml:"purge_interval" toml:"purge_interval"`
+	// AuditRetention is how long audit events are kept; the purge job deletes older ones.
+	// Zero keeps them forever.
+	AuditRetention time.Duration `yaml:"audit_retention" toml:"audit_retention"`
+}
+
+type LogConfig struct {
+	Level string `yaml:"level" toml:"level"`
+	// Format is json for log pipelines or text for reading in a terminal.
+	Format string `yaml:"format" toml:"format"`
+	// PhoneHashSecret keys the hashes that stand in for phone numbers in logs and audit events.
+	// Changing it breaks correlation with hashes already written.
+	PhoneHashSecret string `yaml:"phone_hash_secret" toml:"phone_hash_secret"`
+}
+
+type TracingConfig struct {
+	// Exporter is none to only propagate trace context, or otlp to send spans to a collector.
+	Exporter string `yaml:"exporter" toml:"exporter"`
+	// OTLPEndpoint is the OTLP/HTTP collector as host:port.
+	OTLPEndpoint string `yaml:"otlp_endpoint" toml:"otlp_endpoint"`
+	Insecure     bool   `yaml:"insecure" toml:"insecure"`
+	// SampleRatio is the share of new traces recorded, between 0 and 1.
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio"`
+}
+
+// Default returns the configuration used when nothing overrides it.
+func Default() Config {
+	return Config{
+		Env:      EnvDevelopment,
+		HTTP:     HTTPConfig{Port: 8080, AdminPort: 9090, ReadHeaderTimeout: 10 * time.Second, ShutdownTimeout: 15 * time.Second},
+		Database: DatabaseConfig{AutoMigrate: true, QueryTimeout: 5 * time.Second, ConnectTimeout: time.Minute},
+		JWT:      JWTConfig{TTL: 15 * time.Minute, RefreshTTL: 30 * 24 * time.Hour, Algorithm: "HS256"},
+		OTP: OTPConfig{
+			TTL:                 120 * time.Second,
+			RequestWindow:       600 * time.Second,
+			MaxRequests:         3,
+			MaxValidateAttempts: 5,
+			LockoutBase:         time.Minute,
+			LockoutMax:          time.Hour,
+			ValidateIPLimit:     30,
+			ValidateIPWindow:    600 * time.Second,
+			Sender:              SenderConfig{Kind: "console"},
+		},
+		Cache: CacheConfig{
+			Backend:         "memory",
+			RedisPoolSize:   10,
+			MaxEntries:      100_000,
+			CleanupInterval: time.Minute,
+			OpTimeout:       2 * time.Second,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			Public:  RateLimitRule{Key: "ip", Algorithm: "sliding_window", Limit: 30, Window: time.Minute},
+			OTP:     RateLimitRule{Key: "phone", Algorithm: "sliding_window", Limit: 10, Window: 10 * time.Minute},
+			API:     RateLimitRule{Key: "user", Algorithm: "token_bucket", Limit: 120, Window: time.Minute, Burst: 60},
+		},
+		Phone: PhoneConfig{DefaultRegion: "IR"},
+		Users: UsersConfig{Retention: 30 * 24 * time.Hour, PurgeInterval: time.Hour, AuditRetention: 365 * 24 * time.Hour},
+		Log:   LogConfig{Level: "info", Format: "json"},
+		Tracing: TracingConfig{
+			Exporter:     "none",
+			OTLPEndpoint: "localhost:4318",
+			SampleRatio:  1,
+		},
+	}
+}
+
+// Load builds the configuration from an optional file, the environment and args (without the program name).
+func Load(args []string) (*Config, error) {
+	fs := flag.NewFlagSet("user-go", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML config file")
+	env := fs.String("env", "", "runtime environment: development, production or test")
+	port := fs.Int("port", 0, "HTTP listen port")
+	logLevel := fs.String("log-level", "", "log level: debug, info, warn or error")
+	devMode := fs.Bool("otp-dev-mode", false, "return generated OTPs in API responses (never in production)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+	if *configPath != "" {
+		if err := loadFile(*configPath, &cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := applyEnv(&cfg); err != nil {
+		return nil, err
+	}
+
+	// فقط فلگ‌هایی که صراحتاً داده شده‌اند بر مقادیر قبلی غلبه می‌کنند
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "env":
+			cfg.Env = *env
+		case "port":
+			cfg.HTTP.Port = *port
+		case "log-level":
+			cfg.Log.Level = *logLevel
+		case "otp-dev-mode":
+			cfg.OTP.DevMode = *devMode
+		}
+	})
+
+	cfg.Args = fs.Args()
+
+	if cfg.JWT.Secret == "" && cfg.Env != EnvProduction {
+		cfg.JWT.Secret = InsecureDevSecret
+	}
+	if cfg.Log.PhoneHashSecret == "" && cfg.Env != EnvProduction {
+		cfg.Log.PhoneHashSecret = InsecureDevPhoneHashSecret
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("unsupported config file extension %q", ext)
+	}
+	if err != nil {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func applyEnv(cfg *Config) error {
+	var errs []error
+	str := func(name string, dst *string) {
+		if v, ok := os.LookupEnv(name); ok {
+			*dst = v
+		}
+	}
+	num := func(name string, dst *int) {
+		if v, ok := os.LookupEnv(name); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				return
+			}
+			*dst = n
+		}
+	}
+	seconds := func(name string, dst *time.Duration) {
+		if v, ok := os.LookupEnv(name); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				return
+			}
+			*dst = time.Duration(n) * time.Second
+		}
+	}
+	ratio := func(name string, dst *float64) {
+		if v, ok := os.LookupEnv(name); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				return
+			}
+			*dst = f
+		}
+	}
+	duration := func(name string, dst *time.Duration) {
+		if v, ok := os.LookupEnv(name); ok {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				return
+			}
+			*dst = d
+		}
+	}
+	boolean := func(name string, dst *bool) {
+		if v, ok := os.LookupEnv(name); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				return
+			}
+			*dst = b
+		}
+	}
+
+	str("APP_ENV", &cfg.Env)
+	num("PORT", &cfg.HTTP.Port)
+	num("ADMIN_PORT", &cfg.HTTP.AdminPort)
+	duration("HTTP_READ_HEADER_TIMEOUT", &cfg.HTTP.ReadHeaderTimeout)
+	duration("HTTP_DRAIN_DELAY", &cfg.HTTP.DrainDelay)
+	duration("HTTP_SHUTDOWN_TIMEOUT", &cfg.HTTP.ShutdownTimeout)
+	str("DATABASE_URL", &cfg.Database.URL)
+	boolean("DB_AUTO_MIGRATE", &cfg.Database.AutoMigrate)
+	duration("DB_QUERY_TIMEOUT", &cfg.Database.QueryTimeout)
+	duration("DB_CONNECT_TIMEOUT", &cfg.Database.ConnectTimeout)
+	str("JWT_SECRET", &cfg.JWT.Secret)
+	duration("JWT_TTL", &cfg.JWT.TTL)
+	duration("JWT_REFRESH_TTL", &cfg.JWT.RefreshTTL)
+	str("JWT_ALGORITHM", &cfg.JWT.Algorithm)
+	str("JWT_KEY_DIR", &cfg.JWT.KeyDir)
+	duration("JWT_ROTATION_INTERVAL", &cfg.JWT.RotationInterval)
+
+	seconds("OTP_EXPIRATION_SECONDS", &cfg.OTP.TTL)
+	seconds("OTP_REQUEST_WINDOW_SECONDS", &cfg.OTP.RequestWindow)
+	num("OTP_MAX_REQUESTS", &cfg.OTP.MaxRequests)
+	num("OTP_MAX_VALIDATE_ATTEMPTS", &cfg.OTP.MaxValidateAttempts)
+	duration("OTP_LOCKOUT_BASE", &cfg.OTP.LockoutBase)
+	duration("OTP_LOCKOUT_MAX", &cfg.OTP.LockoutMax)
+	num("OTP_VALIDATE_IP_LIMIT", &cfg.OTP.ValidateIPLimit)
+	duration("OTP_VALIDATE_IP_WINDOW", &cfg.OTP.ValidateIPWindow)
+	boolean("OTP_DEV_MODE", &cfg.OTP.DevMode)
+	str("OTP_SENDER", &cfg.OTP.Sender.Kind)
+	str("OTP_FILE_PATH", &cfg.OTP.Sender.FilePath)
+	str("OTP_WEBHOOK_URL", &cfg.OTP.Sender.WebhookURL)
+	str("OTP_WEBHOOK_TOKEN", &cfg.OTP.Sender.WebhookToken)
+	str("SMPP_ADDR", &cfg.OTP.Sender.SMPP.Addr)
+	str("SMPP_SYSTEM_ID", &cfg.OTP.Sender.SMPP.SystemID)
+	str("SMPP_PASSWORD", &cfg.OTP.Sender.SMPP.Password)
+	str("SMPP_SOURCE_ADDR", &cfg.OTP.Sender.SMPP.SourceAddr)
+
+	str("CACHE_BACKEND", &cfg.Cache.Backend)
+	str("REDIS_URL", &cfg.Cache.RedisURL)
+	num("REDIS_POOL_SIZE", &cfg.Cache.RedisPoolSize)
+	num("CACHE_MAX_ENTRIES", &cfg.Cache.MaxEntries)
+	duration("CACHE_CLEANUP_INTERVAL", &cfg.Cache.CleanupInterval)
+	duration("CACHE_OP_TIMEOUT", &cfg.Cache.OpTimeout)
+
+	str("PHONE_DEFAULT_REGION", &cfg.Phone.DefaultRegion)
+	duration("USER_RETENTION", &cfg.Users.Retention)
+	duration("USER_PURGE_INTERVAL", &cfg.Users.PurgeInterval)
+	duration("AUDIT_RETENTION", &cfg.Users.AuditRetention)
+
+	str("LOG_LEVEL", &cfg.Log.Level)
+	str("LOG_FORMAT", &cfg.Log.Format)
+	str("PHONE_HASH_SECRET", &cfg.Log.PhoneHashSecret)
+
+	boolean("RATE_LIMIT_ENABLED", &cfg.RateLimit.Enabled)
+	for prefix, rule := range map[string]*RateLimitRule{
+		"RATE_LIMIT_PUBLIC_": &cfg.RateLimit.Public, "RATE_LIMIT_OTP_": &cfg.RateLimit.OTP, "RATE_LIMIT_API_": &cfg.RateLimit.API,
+	} {
+		str(prefix+"KEY", &rule.Key)
+		str(prefix+"ALGORITHM", &rule.Algorithm)
+		num(prefix+"LIMIT", &rule.Limit)
+		duration(prefix+"WINDOW", &rule.Window)
+		num(prefix+"BURST", &rule.Burst)
+	}
+	str("TRACING_EXPORTER", &cfg.Tracing.Exporter)
+	str("TRACING_OTLP_ENDPOINT", &cfg.Tracing.OTLPEndpoint)
+	boolean("TRACING_INSECURE", &cfg.Tracing.Insecure)
+	ratio("TRACING_SAMPLE_RATIO", &cfg.Tracing.SampleRatio)
+
+	return errors.Join(errs...)
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	add := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	switch c.Env {
+	case EnvDevelopment, EnvProduction, EnvTest:
+	default:
+		add("env must be development, production or test, got %q", c.Env)
+	}
+	if c.HTTP.Port < 1 || c.HTTP.Port > 65535 {
+		add("http.port must be between 1 and 65535, got %d", c.HTTP.Port)
+	}
+	if c.HTTP.AdminPort < 0 || c.HTTP.AdminPort > 65535 {
+		add("http.admin_port must be between 0 and 65535, got %d", c.HTTP.AdminPort)
+	} else if c.HTTP.AdminPort == c.HTTP.Port {
+		add("http.admin_port must differ from http.port so /metrics stays off the public listener")
+	}
+	if c.HTTP.ReadHeaderTimeout < 0 || c.HTTP.DrainDelay < 0 {
+		add("http.read_header_timeout and http.drain_delay must not be negative")
+	}
+	if c.HTTP.ShutdownTimeout <= 0 {
+		add("http.shutdown_timeout must be positive")
+	}
+	if c.Database.URL == "" {
+		add("database.url (DATABASE_URL) is required")
+	}
+	if c.Database.ConnectTimeout <= 0 {
+		add("database.connect_timeout must be positive")
+	}
+	if c.Database.QueryTimeout < 0 {
+		add("database.query_timeout must not be negative")
+	}
+	if c.Cache.OpTimeout < 0 {
+		add("cache.op_timeout must not be negative")
+	}
+	if c.JWT.TTL <= 0 {
+		add("jwt.ttl must be positive")
+	}
+	if c.JWT.RefreshTTL <= c.JWT.TTL {
+		add("jwt.refresh_ttl must be longer than jwt.ttl")
+	}
+	switch c.JWT.Algorithm {
+	case "HS256", "RS256", "ES256", "EdDSA":
+	default:
+		add("jwt.algorithm must be HS256, RS256, ES256 or EdDSA, got %q", c.JWT.Algorithm)
+	}
+	if c.JWT.RotationInterval < 0 {
+		add("jwt.rotation_interval must not be negative")
+	}
+
+	if c.OTP.TTL < time.Second {
+		add("otp.ttl must be at least 1s")
+	}
+	if c.OTP.RequestWindow < time.Second || c.OTP.MaxRequests < 1 {
+		add("otp.request_window must be at least 1s and otp.max_requests at least 1")
+	}
+	if c.OTP.MaxValidateAttempts < 1 {
+		add("otp.max_validate_attempts must be at least 1")
+	}
+	if c.OTP.LockoutBase <= 0 || c.OTP.LockoutMax < c.OTP.LockoutBase {
+		add("otp.lockout_base must be positive and not above otp.lockout_max")
+	}
+	if c.OTP.ValidateIPLimit > 0 && c.OTP.ValidateIPWindow < time.Second {
+		add("otp.validate_ip_window must be at least 1s")
+	}
+	switch c.OTP.Sender.Kind {
+	case "console":
+	case "file":
+		if c.OTP.Sender.FilePath == "" {
+			add("otp.sender.file_path (OTP_FILE_PATH) is required for the file sender")
+		}
+	case "webhook":
+		if c.OTP.Sender.WebhookURL == "" {
+			add("otp.sender.webhook_url (OTP_WEBHOOK_URL) is required for the webhook sender")
+		}
+	case "smpp":
+		if c.OTP.Sender.SMPP.Addr == "" {
+			add("otp.sender.smpp.addr (SMPP_ADDR) is required for the smpp sender")
+		}
+	default:
+		add("unknown otp.sender.kind %q", c.OTP.Sender.Kind)
+	}
+
+	switch c.Cache.Backend {
+	case "memory":
+		if c.Cache.MaxEntries < 0 {
+			add("cache.max_entries must not be negative")
+		}
+	case "redis":
+		if c.Cache.RedisURL == "" {
+			add("cache.redis_url (REDIS_URL) is required for the redis cache")
+		}
+	default:
+		add("unknown cache.backend %q", c.Cache.Backend)
+	}
+
+	if _, err := phone.NewParser(c.Phone.DefaultRegion); err != nil {
+		add("phone.default_region: %v", err)
+	}
+
+	if c.Users.Retention <= 0 {
+		add("users.retention must be positive")
+	}
+	if c.Users.PurgeInterval < 0 {
+		add("users.purge_interval must not be negative")
+	}
+	if c.Users.AuditRetention < 0 {
+		add("users.audit_retention must not be negative")
+	}
+
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		add("log.level must be debug, info, warn or error, got %q", c.Log.Level)
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		add("log.format must be json or text, got %q", c.Log.Format)
+	}
+
+	if c.RateLimit.Enabled {
+		validateRule := func(name string, r RateLimitRule, authenticated bool) {
+			switch r.Key {
+			case "ip", "phone", "route":
+			case "user":
+				if !authenticated {
+					// بدون احراز هویت user_id خالی است و محدودیت هیچ‌وقت اعمال نمی‌شود
+					add("%s.key user needs an authenticated route", name)
+				}
+			default:
+				add("%s.key must be ip, user, phone or route, got %q", name, r.Key)
+			}
+			switch r.Algorithm {
+			case "sliding_window":
+				// TTL کلیدهای cache ثانیه‌ی کامل است
+				if r.Window < time.Second || r.Window%time.Second != 0 {
+					add("%s.window must be a whole number of seconds for sliding_window, got %s", name, r.Window)
+				}
+			case "token_bucket":
+				if r.Window <= 0 {
+					add("%s.window must be positive", name)
+				}
+				if r.Burst < 0 {
+					add("%s.burst must not be negative", name)
+				}
+			default:
+				add("%s.algorithm must be sliding_window or token_bucket, got %q", name, r.Algorithm)
+			}
+			if r.Limit < 1 {
+				add("%s.limit must be positive, got %d", name, r.Limit)
+			}
+		}
+		validateRule("rate_limit.public", c.RateLimit.Public, false)
+		validateRule("rate_limit.otp", c.RateLimit.OTP, false)
+		validateRule("rate_limit.api", c.RateLimit.API, true)
+	}
+
+	switch c.Tracing.Exporter {
+	case "none":
+	case "otlp":
+		if c.Tracing.OTLPEndpoint == "" {
+			add("tracing.otlp_endpoint is required for the otlp exporter")
+		}
+	default:
+		add("tracing.exporter must be none or otlp, got %q", c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		add("tracing.sample_ratio must be between 0 and 1, got %v", c.Tracing.SampleRatio)
+	}
+
+	if c.Env == EnvProduction {
+		if c.JWT.Algorithm == "HS256" {
+			if c.JWT.Secret == "" || c.JWT.Secret == InsecureDevSecret {
+				add("jwt.secret (JWT_SECRET) must be set to a real secret in production")
+			} else if len(c.JWT.Secret) < minProductionSecretLen {
+				add("jwt.secret must be at least %d bytes in production", minProductionSecretLen)
+			}
+		} else if c.JWT.KeyDir == "" {
+			// کلیدهای تولیدشده در حافظه بین replicaها مشترک نیستند
+			add("jwt.key_dir (JWT_KEY_DIR) is required for %s in production", c.JWT.Algorithm)
+		}
+		if c.OTP.DevMode {
+			add("otp.dev_mode cannot be enabled in production")
+		}
+		if c.Log.PhoneHashSecret == "" || c.Log.PhoneHashSecret == InsecureDevPhoneHashSecret {
+			add("log.phone_hash_secret (PHONE_HASH_SECRET) must be set to a real secret in production")
+		} else if len(c.Log.PhoneHashSecret) < minProductionSecretLen {
+			add("log.phone_hash_secret must be at least %d bytes in production", minProductionSecretLen)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Addr is the listen address for the HTTP server.
+func (c *Config) Addr() string {
+	return fmt.Sprintf(":%d", c.HTTP.Port)
+}
+
+// AdminAddr is the listen address for /metrics, or "" when the admin listener is disabled.
+func (c *Config) AdminAddr() string {
+	if c.HTTP.AdminPort == 0 {
+		return ""
+	}
+	return fmt.Sprintf(":%d", c.HTTP.AdminPort)
+}
@@ -0,0 +1,413 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const strongSecret = "0123456789abcdef0123456789abcdef"
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/db")
+	t.Setenv("JWT_SECRET", "")
+	os.Unsetenv("JWT_SECRET")
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, EnvDevelopment, cfg.Env)
+	assert.Equal(t, ":8080", cfg.Addr())
+	assert.Equal(t, ":9090", cfg.AdminAddr())
+	assert.Equal(t, 120*time.Second, cfg.OTP.TTL)
+	assert.Equal(t, 600*time.Second, cfg.OTP.RequestWindow)
+	assert.Equal(t, 3, cfg.OTP.MaxRequests)
+	assert.Equal(t, 15*time.Minute, cfg.JWT.TTL)
+	assert.Equal(t, 30*24*time.Hour, cfg.JWT.RefreshTTL)
+	// در development بدون JWT_SECRET از secret ناامن پیش‌فرض استفاده می‌شود
+	assert.Equal(t, InsecureDevSecret, cfg.JWT.Secret)
+	assert.Equal(t, InsecureDevPhoneHashSecret, cfg.Log.PhoneHashSecret)
+	assert.True(t, cfg.Database.AutoMigrate)
+	assert.Equal(t, 100_000, cfg.Cache.MaxEntries, "the memory cache must be bounded by default")
+}
+
+func TestLoad_PositionalArgs(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/db")
+	t.Setenv("DB_AUTO_MIGRATE", "false")
+
+	cfg, err := Load([]string{"-port", "9000", "migrate", "down", "2"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"migrate", "down", "2"}, cfg.Args)
+	assert.False(t, cfg.Database.AutoMigrate)
+}
+
+func TestLoad_Env(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/db")
+	t.Setenv("PORT", "9000")
+	t.Setenv("OTP_EXPIRATION_SECONDS", "300")
+	t.Setenv("LOG_LEVEL", "debug")
+	t.Setenv("CACHE_CLEANUP_INTERVAL", "30s")
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, 9000, cfg.HTTP.Port)
+	assert.Equal(t, 5*time.Minute, cfg.OTP.TTL)
+	assert.Equal(t, "debug", cfg.Log.Level)
+	assert.Equal(t, 30*time.Second, cfg.Cache.CleanupInterval)
+}
+
+func TestLoad_Timeouts(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/db")
+	t.Setenv("DB_QUERY_TIMEOUT", "750ms")
+	t.Setenv("CACHE_OP_TIMEOUT", "0")
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 750*time.Millisecond, cfg.Database.QueryTimeout)
+	assert.Equal(t, time.Duration(0), cfg.Cache.OpTimeout)
+
+	t.Setenv("DB_QUERY_TIMEOUT", "-1s")
+	_, err = Load(nil)
+	assert.Error(t, err)
+}
+
+func TestLoad_ServerLifecycle(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/db")
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 15*time.Second, cfg.HTTP.ShutdownTimeout)
+	assert.Equal(t, time.Duration(0), cfg.HTTP.DrainDelay)
+	assert.Equal(t, time.Minute, cfg.Database.ConnectTimeout)
+
+	t.Setenv("HTTP_DRAIN_DELAY", "5s")
+	t.Setenv("HTTP_SHUTDOWN_TIMEOUT", "30s")
+	t.Setenv("DB_CONNECT_TIMEOUT", "2m")
+	cfg, err = Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Second, cfg.HTTP.DrainDelay)
+	assert.Equal(t, 30*time.Second, cfg.HTTP.ShutdownTimeout)
+	assert.Equal(t, 2*time.Minute, cfg.Database.ConnectTimeout)
+
+	t.Setenv("HTTP_SHUTDOWN_TIMEOUT", "0")
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "http.shutdown_timeout")
+}
+
+func TestLoad_PhoneRegion(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/db")
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "IR", cfg.Phone.DefaultRegion)
+
+	t.Setenv("PHONE_DEFAULT_REGION", "")
+	cfg, err = Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "", cfg.Phone.DefaultRegion)
+
+	t.Setenv("PHONE_DEFAULT_REGION", "XX")
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "phone.default_region")
+}
+
+func TestLoad_UserRetention(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/db")
+	t.Setenv("USER_RETENTION", "168h")
+	t.Setenv("USER_PURGE_INTERVAL", "0")
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 7*24*time.Hour, cfg.Users.Retention)
+	assert.Equal(t, time.Duration(0), cfg.Users.PurgeInterval)
+
+	t.Setenv("USER_RETENTION", "0")
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "users.retention")
+}
+
+func TestLoad_AdminPort(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/db")
+
+	t.Setenv("ADMIN_PORT", "0")
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Empty(t, cfg.AdminAddr())
+
+	// متریک‌ها نباید روی listener عمومی بیایند
+	t.Setenv("ADMIN_PORT", "8080")
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "http.admin_port")
+
+	t.Setenv("ADMIN_PORT", "70000")
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "http.admin_port")
+}
+
+func TestLoad_AuditRetention(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/db")
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 365*24*time.Hour, cfg.Users.AuditRetention)
+
+	t.Setenv("AUDIT_RETENTION", "0")
+	cfg, err = Load(nil)
+	require.NoError(t, err)
+	assert.Zero(t, cfg.Users.AuditRetention)
+
+	t.Setenv("AUDIT_RETENTION", "-1h")
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "users.audit_retention")
+}
+
+func TestLoad_LogFormat(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/db")
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "json", cfg.Log.Format)
+
+	t.Setenv("LOG_FORMAT", "text")
+	cfg, err = Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "text", cfg.Log.Format)
+
+	t.Setenv("LOG_FORMAT", "xml")
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "log.format")
+}
+
+func TestLoad_Tracing(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/db")
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "none", cfg.Tracing.Exporter)
+	assert.Equal(t, 1.0, cfg.Tracing.SampleRatio)
+
+	t.Setenv("TRACING_EXPORTER", "otlp")
+	t.Setenv("TRACING_OTLP_ENDPOINT", "collector:4318")
+	t.Setenv("TRACING_SAMPLE_RATIO", "0.25")
+	cfg, err = Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "otlp", cfg.Tracing.Exporter)
+	assert.Equal(t, "collector:4318", cfg.Tracing.OTLPEndpoint)
+	assert.Equal(t, 0.25, cfg.Tracing.SampleRatio)
+
+	t.Setenv("TRACING_SAMPLE_RATIO", "2")
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "tracing.sample_ratio")
+
+	t.Setenv("TRACING_SAMPLE_RATIO", "1")
+	t.Setenv("TRACING_EXPORTER", "jaeger")
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "tracing.exporter")
+}
+
+func TestLoad_RateLimit(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/db")
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.True(t, cfg.RateLimit.Enabled)
+	assert.Equal(t, "sliding_window", cfg.RateLimit.Public.Algorithm)
+	assert.Equal(t, "token_bucket", cfg.RateLimit.API.Algorithm)
+	assert.Equal(t, "ip", cfg.RateLimit.Public.Key)
+	assert.Equal(t, "phone", cfg.RateLimit.OTP.Key)
+	assert.Equal(t, "user", cfg.RateLimit.API.Key)
+
+	t.Setenv("RATE_LIMIT_PUBLIC_ALGORITHM", "token_bucket")
+	t.Setenv("RATE_LIMIT_PUBLIC_LIMIT", "10")
+	t.Setenv("RATE_LIMIT_PUBLIC_BURST", "5")
+	t.Setenv("RATE_LIMIT_API_WINDOW", "30s")
+	t.Setenv("RATE_LIMIT_OTP_KEY", "route")
+	cfg, err = Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, RateLimitRule{Key: "ip", Algorithm: "token_bucket", Limit: 10, Window: time.Minute, Burst: 5}, cfg.RateLimit.Public)
+	assert.Equal(t, 30*time.Second, cfg.RateLimit.API.Window)
+	assert.Equal(t, "route", cfg.RateLimit.OTP.Key)
+
+	// کاربر فقط در مسیرهای احراز هویت‌شده معلوم است
+	t.Setenv("RATE_LIMIT_OTP_KEY", "user")
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "rate_limit.otp.key")
+	t.Setenv("RATE_LIMIT_OTP_KEY", "session")
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "rate_limit.otp.key")
+	t.Setenv("RATE_LIMIT_OTP_KEY", "phone")
+
+	t.Setenv("RATE_LIMIT_PUBLIC_ALGORITHM", "sliding_window")
+	t.Setenv("RATE_LIMIT_PUBLIC_WINDOW", "1500ms")
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "rate_limit.public.window")
+
+	t.Setenv("RATE_LIMIT_API_LIMIT", "0")
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "rate_limit.api.limit")
+
+	// غیرفعال بودن، قواعد را بررسی نمی‌کند
+	t.Setenv("RATE_LIMIT_ENABLED", "false")
+	_, err = Load(nil)
+	assert.NoError(t, err)
+}
+
+func TestLoad_InvalidEnvValue(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/db")
+	t.Setenv("PORT", "eighty")
+
+	_, err := Load(nil)
+	assert.ErrorContains(t, err, "PORT")
+}
+
+func TestLoad_YAMLFile(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/db")
+	path := writeFile(t, "config.yaml", `
+http:
+  port: 7070
+otp:
+  ttl: 90s
+  max_requests: 5
+cache:
+  backend: redis
+  redis_url: redis://localhost:6379/0
+`)
+
+	cfg, err := Load([]string{"-config", path})
+	require.NoError(t, err)
+
+	assert.Equal(t, 7070, cfg.HTTP.Port)
+	assert.Equal(t, 90*time.Second, cfg.OTP.TTL)
+	assert.Equal(t, 5, cfg.OTP.MaxRequests)
+	assert.Equal(t, "redis", cfg.Cache.Backend)
+	// مقادیری که در فایل نیامده‌اند پیش‌فرض می‌مانند
+	assert.Equal(t, 600*time.Second, cfg.OTP.RequestWindow)
+}
+
+func TestLoad_TOMLFile(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/db")
+	path := writeFile(t, "config.toml", `
+[jwt]
+ttl = "1h"
+
+[otp.sender]
+kind = "webhook"
+webhook_url = "https://sms.example.com/send"
+`)
+
+	cfg, err := Load([]string{"-config", path})
+	require.NoError(t, err)
+
+	assert.Equal(t, time.Hour, cfg.JWT.TTL)
+	assert.Equal(t, "webhook", cfg.OTP.Sender.Kind)
+	assert.Equal(t, "https://sms.example.com/send", cfg.OTP.Sender.WebhookURL)
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeFile(t, "config.yaml", "http:\n  port: 7070\nlog:\n  level: warn\ndatabase:\n  url: postgres://file/db\n")
+	t.Setenv("DATABASE_URL", "")
+	os.Unsetenv("DATABASE_URL")
+	t.Setenv("PORT", "9090")
+	t.Setenv("LOG_LEVEL", "error")
+
+	cfg, err := Load([]string{"-config", path, "-port", "6060"})
+	require.NoError(t, err)
+
+	assert.Equal(t, 6060, cfg.HTTP.Port)    // flag > env > file
+	assert.Equal(t, "error", cfg.Log.Level) // env > file
+	assert.Equal(t, "postgres://file/db", cfg.Database.URL)
+}
+
+func TestLoad_ProductionRequiresRealSecret(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/db")
+	t.Setenv("APP_ENV", EnvProduction)
+	t.Setenv("PHONE_HASH_SECRET", strongSecret)
+
+	os.Unsetenv("JWT_SECRET")
+	_, err := Load(nil)
+	assert.ErrorContains(t, err, "jwt.secret")
+
+	t.Setenv("JWT_SECRET", InsecureDevSecret)
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "jwt.secret")
+
+	t.Setenv("JWT_SECRET", "short")
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "at least")
+
+	t.Setenv("JWT_SECRET", strongSecret)
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, strongSecret, cfg.JWT.Secret)
+}
+
+func TestLoad_ProductionRequiresPhoneHashSecret(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/db")
+	t.Setenv("APP_ENV", EnvProduction)
+	t.Setenv("JWT_SECRET", strongSecret)
+
+	t.Setenv("PHONE_HASH_SECRET", "")
+	os.Unsetenv("PHONE_HASH_SECRET")
+	_, err := Load(nil)
+	assert.ErrorContains(t, err, "log.phone_hash_secret")
+
+	t.Setenv("PHONE_HASH_SECRET", "short")
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "at least")
+
+	t.Setenv("PHONE_HASH_SECRET", strongSecret)
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, strongSecret, cfg.Log.PhoneHashSecret)
+}
+
+func TestLoad_ProductionRejectsDevMode(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/db")
+	t.Setenv("JWT_SECRET", strongSecret)
+
+	_, err := Load([]string{"-env", EnvProduction, "-otp-dev-mode"})
+	assert.ErrorContains(t, err, "dev_mode")
+}
+
+func TestValidate_ReportsAllErrors(t *testing.T) {
+	cfg := Default()
+	cfg.HTTP.Port = 0
+	cfg.Cache.Backend = "memcached"
+	cfg.OTP.Sender.Kind = "smpp"
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "database.url")
+	assert.ErrorContains(t, err, "http.port")
+	assert.ErrorContains(t, err, "cache.backend")
+	assert.ErrorContains(t, err, "smpp.addr")
+}
+
+func TestLoad_ProductionAsymmetricNeedsKeyDir(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/db")
+	t.Setenv("APP_ENV", EnvProduction)
+	t.Setenv("JWT_ALGORITHM", "ES256")
+	t.Setenv("JWT_SECRET", "")
+	os.Unsetenv("JWT_SECRET")
+	t.Setenv("PHONE_HASH_SECRET", strongSecret)
+
+	_, err := Load(nil)
+	assert.ErrorContains(t, err, "jwt.key_dir")
+
+	t.Setenv("JWT_KEY_DIR", t.TempDir())
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "ES256", cfg.JWT.Algorithm)
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+	"user-go/internal/apperr"
+	"user-go/internal/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditHandler serves the admin endpoint that reads the audit log.
+type AuditHandler struct {
+	log repository.AuditLog
+}
+
+func NewAuditHandler(log repository.AuditLog) *AuditHandler {
+	return &AuditHandler{log: log}
+}
+
+// ListEvents returns audit events, newest first. Optional query parameters: user_id (actor or
+// target), from and until (RFC 3339, until exclusive) and limit (at most repository.MaxAuditLimit).
+func (h *AuditHandler) ListEvents(c *gin.Context) {
+	q := repository.AuditQuery{UserID: c.Query("user_id")}
+	if q.UserID != "" && !repository.ValidID(q.UserID) {
+		c.Error(apperr.Validation("user_id", "user_id must be a user id"))
+		return
+	}
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > repository.MaxAuditLimit {
+			c.Error(apperr.Validation("limit", "limit must be between 1 and "+strconv.Itoa(repository.MaxAuditLimit)))
+			return
+		}
+		q.Limit = limit
+	}
+	for param, dst := range map[string]*time.Time{"from": &q.From, "until": &q.Until} {
+		if v := c.Query(param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				c.Error(apperr.Validation(param, param+" must be an RFC 3339 timestamp"))
+				return
+			}
+			*dst = t.UTC()
+		}
+	}
+
+	events, err := h.log.AuditEvents(c.Request.Context(), q)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
@@ -0,0 +1,82 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+	"user-go/internal/audit"
+	"user-go/internal/handler"
+	"user-go/internal/middleware"
+	"user-go/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupAuditRouter(adminID string) (*gin.Engine, *repository.InMemoryUserRepository) {
+	users := repository.NewInMemoryUserRepository()
+	userHandler := handler.NewUserHandler(users, handler.WithUserAudit(audit.NewRecorder(users)))
+	auditHandler := handler.NewAuditHandler(users)
+
+	r := gin.New()
+	r.Use(middleware.AuditClient(), middleware.Errors(), func(c *gin.Context) { c.Set("user_id", adminID) })
+	r.PUT("/users/:id", userHandler.EditUser)
+	r.DELETE("/users/:id", userHandler.DeleteUser)
+	r.GET("/audit-events", auditHandler.ListEvents)
+	return r, users
+}
+
+func listAudit(t *testing.T, r *gin.Engine, query string) []repository.AuditEvent {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/audit-events"+query, nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var body struct {
+		Events []repository.AuditEvent `json:"events"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return body.Events
+}
+
+func TestUserHandler_Audit(t *testing.T) {
+	adminID := repository.NewID()
+	r, users := setupAuditRouter(adminID)
+	user, _ := users.Create(context.Background(), "+989120000111")
+
+	assert.Equal(t, http.StatusOK, doJSON(r, "PUT", "/users/"+user.ID, `{"new_phone":"+989120000222"}`).Code)
+	assert.Equal(t, http.StatusOK, doJSON(r, "DELETE", "/users/"+user.ID, "").Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(r, "DELETE", "/users/"+user.ID, "").Code)
+
+	events := listAudit(t, r, "?user_id="+user.ID)
+	require.Len(t, events, 3)
+	assert.Equal(t, repository.AuditUserDeleted, events[0].Action)
+	assert.Equal(t, repository.AuditFailure, events[0].Outcome)
+	assert.Equal(t, "not_found", events[0].Reason)
+	assert.Equal(t, repository.AuditSuccess, events[1].Outcome)
+	assert.Equal(t, adminID, events[1].ActorID)
+	assert.Equal(t, repository.AuditPhoneChanged, events[2].Action)
+	assert.Equal(t, "admin", events[2].Reason)
+
+	// کنشگر هم جزو کاربر فیلتر حساب می‌شود
+	assert.Len(t, listAudit(t, r, "?user_id="+adminID), 3)
+	assert.Len(t, listAudit(t, r, "?limit=1"), 1)
+	assert.Empty(t, listAudit(t, r, "?until="+time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)))
+
+	// بازه با هر offset همان لحظه را نشان می‌دهد
+	tehran := time.FixedZone("IRST", 3*3600+1800)
+	assert.Len(t, listAudit(t, r, "?from="+url.QueryEscape(time.Now().Add(-time.Hour).In(tehran).Format(time.RFC3339))), 3)
+	assert.Empty(t, listAudit(t, r, "?from="+url.QueryEscape(time.Now().Add(time.Hour).In(tehran).Format(time.RFC3339))))
+}
+
+func TestAuditHandler_InvalidQuery(t *testing.T) {
+	r, _ := setupAuditRouter(repository.NewID())
+	for _, query := range []string{"?user_id=+989120000111", "?limit=0", "?limit=501", "?from=yesterday"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/audit-events"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+	"user-go/internal/apperr"
+	"user-go/internal/phone"
+	"user-go/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BlockHandler serves the admin endpoints that suspend and ban users and phone prefixes.
+type BlockHandler struct {
+	blocks *service.BlockService
+}
+
+func NewBlockHandler(blocks *service.BlockService) *BlockHandler {
+	return &BlockHandler{blocks: blocks}
+}
+
+// SuspendUser blocks a user until the given time and revokes their tokens.
+func (h *BlockHandler) SuspendUser(c *gin.Context) {
+	var req struct {
+		Reason string    `json:"reason" binding:"required"`
+		Until  time.Time `json:"until" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.Validation("until", "reason and until (RFC 3339) are required"))
+		return
+	}
+
+	err := h.blocks.Suspend(c.Request.Context(), c.Param("id"), req.Reason, req.Until, c.GetString("user_id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "user suspended"})
+}
+
+// BanUser blocks a user until an admin lifts the ban, and revokes their tokens.
+func (h *BlockHandler) BanUser(c *gin.Context) {
+	var req struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.Validation("reason", "reason is required"))
+		return
+	}
+
+	if err := h.blocks.Ban(c.Request.Context(), c.Param("id"), req.Reason, c.GetString("user_id")); err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "user banned"})
+}
+
+// UnblockUser lifts a suspension or ban.
+func (h *BlockHandler) UnblockUser(c *gin.Context) {
+	if err := h.blocks.Unblock(c.Request.Context(), c.Param("id")); err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "user unblocked"})
+}
+
+// ListPhoneBans lists every banned phone prefix.
+func (h *BlockHandler) ListPhoneBans(c *gin.Context) {
+	bans, err := h.blocks.PhoneBans(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"bans": bans})
+}
+
+// BanPhonePrefix bans every number starting with prefix, e.g. "+98912" or "0098912".
+func (h *BlockHandler) BanPhonePrefix(c *gin.Context) {
+	var req struct {
+		Prefix string `json:"prefix" binding:"required"`
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.Validation("prefix", "prefix and reason are required"))
+		return
+	}
+
+	prefix, ok := normalizePrefix(c, req.Prefix)
+	if !ok {
+		return
+	}
+	if err := h.blocks.BanPrefix(c.Request.Context(), prefix, req.Reason, c.GetString("user_id")); err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "prefix banned", "prefix": prefix})
+}
+
+// UnbanPhonePrefix lifts a prefix ban. The prefix is given as digits, without the "+".
+func (h *BlockHandler) UnbanPhonePrefix(c *gin.Context) {
+	prefix, ok := normalizePrefix(c, c.Param("prefix"))
+	if !ok {
+		return
+	}
+	err := h.blocks.UnbanPrefix(c.Request.Context(), prefix)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "prefix unbanned"})
+}
+
+func normalizePrefix(c *gin.Context, raw string) (string, bool) {
+	prefix, err := phone.NormalizePrefix(raw)
+	if err != nil {
+		c.Error(apperr.WithField("prefix", err))
+		return "", false
+	}
+	return prefix, true
+}
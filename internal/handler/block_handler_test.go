@@ -0,0 +1,109 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"user-go/internal/cache"
+	"user-go/internal/handler"
+	"user-go/internal/middleware"
+	"user-go/internal/repository"
+	"user-go/internal/sender"
+	"user-go/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupBlockRouter() (*gin.Engine, *repository.InMemoryUserRepository) {
+	c := cache.NewInMemoryCache()
+	users := repository.NewInMemoryUserRepository()
+	blocks := service.NewBlockService(c, users, users, nil)
+	otp := service.NewOtpService(c, users, "testsecret",
+		service.WithSender(sender.NewConsoleSender(io.Discard)),
+		service.WithBlockService(blocks),
+	)
+	h := handler.NewBlockHandler(blocks)
+	auth := handler.NewAuthHandler(otp)
+
+	r := gin.Default()
+	r.Use(middleware.Errors())
+	r.POST("/request-otp", auth.RequestOTP)
+	r.POST("/users/:id/suspend", h.SuspendUser)
+	r.POST("/users/:id/ban", h.BanUser)
+	r.DELETE("/users/:id/block", h.UnblockUser)
+	r.GET("/phone-bans", h.ListPhoneBans)
+	r.POST("/phone-bans", h.BanPhonePrefix)
+	r.DELETE("/phone-bans/:prefix", h.UnbanPhonePrefix)
+	return r, users
+}
+
+func doJSON(r *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestSuspendAndUnblockUser(t *testing.T) {
+	r, users := setupBlockRouter()
+	user, _ := users.Create(context.Background(), "+989120000111")
+
+	until := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	assert.Equal(t, 400, doJSON(r, "POST", "/users/"+user.ID+"/suspend", `{"reason":"spam"}`).Code)
+	assert.Equal(t, 400, doJSON(r, "POST", "/users/"+user.ID+"/suspend", `{"reason":"spam","until":"2000-01-01T00:00:00Z"}`).Code)
+	assert.Equal(t, 404, doJSON(r, "POST", "/users/"+repository.NewID()+"/suspend", `{"reason":"spam","until":"`+until+`"}`).Code)
+	assert.Equal(t, 200, doJSON(r, "POST", "/users/"+user.ID+"/suspend", `{"reason":"spam","until":"`+until+`"}`).Code)
+
+	w := doJSON(r, "POST", "/request-otp", `{"phone":"+989120000111"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, middleware.ProblemContentType, w.Header().Get("Content-Type"))
+	var resp map[string]any
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "account_blocked", resp["code"])
+	assert.Equal(t, "suspended", resp["kind"])
+	assert.NotContains(t, resp, "reason", "moderation notes are not shown to whoever knows the number")
+	assert.Equal(t, until, resp["until"])
+
+	assert.Equal(t, 200, doJSON(r, "DELETE", "/users/"+user.ID+"/block", "").Code)
+	assert.Equal(t, 200, doJSON(r, "POST", "/request-otp", `{"phone":"+989120000111"}`).Code)
+
+	assert.Equal(t, 400, doJSON(r, "POST", "/users/"+user.ID+"/ban", `{}`).Code)
+	assert.Equal(t, 200, doJSON(r, "POST", "/users/"+user.ID+"/ban", `{"reason":"fraud"}`).Code)
+	got, _ := users.GetByID(context.Background(), user.ID)
+	if assert.NotNil(t, got.Block) {
+		assert.Equal(t, repository.BlockBanned, got.Block.Kind)
+		assert.Nil(t, got.Block.Until)
+	}
+}
+
+func TestPhoneBans(t *testing.T) {
+	r, _ := setupBlockRouter()
+
+	assert.Equal(t, 400, doJSON(r, "POST", "/phone-bans", `{"prefix":"0912","reason":"fraud"}`).Code)
+	w := doJSON(r, "POST", "/phone-bans", `{"prefix":"+98 912","reason":"fraud"}`)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"prefix":"+98912"`)
+
+	assert.Equal(t, http.StatusForbidden, doJSON(r, "POST", "/request-otp", `{"phone":"+989120000111"}`).Code)
+
+	w = doJSON(r, "GET", "/phone-bans", "")
+	assert.Equal(t, 200, w.Code)
+	var resp struct {
+		Bans []repository.PhoneBan `json:"bans"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	if assert.Len(t, resp.Bans, 1) {
+		assert.Equal(t, "fraud", resp.Bans[0].Reason)
+	}
+
+	assert.Equal(t, 200, doJSON(r, "DELETE", "/phone-bans/98912", "").Code)
+	assert.Equal(t, 404, doJSON(r, "DELETE", "/phone-bans/98912", "").Code)
+	assert.Equal(t, 200, doJSON(r, "POST", "/request-otp", `{"phone":"+989120000111"}`).Code)
+}
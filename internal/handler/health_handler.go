@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+	"user-go/internal/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HealthCheck reports whether a dependency the service needs to serve traffic is reachable.
+type HealthCheck func(ctx context.Context) error
+
+// HealthHandler serves the liveness and readiness probes.
+type HealthHandler struct {
+	names    []string
+	checks   map[string]HealthCheck
+	timeout  time.Duration
+	draining atomic.Bool
+}
+
+// HealthOption configures a HealthHandler.
+type HealthOption func(*HealthHandler)
+
+// WithHealthCheck makes readiness depend on check, reported under name.
+func WithHealthCheck(name string, check HealthCheck) HealthOption {
+	return func(h *HealthHandler) {
+		if _, ok := h.checks[name]; !ok {
+			h.names = append(h.names, name)
+		}
+		h.checks[name] = check
+	}
+}
+
+// WithHealthCheckTimeout bounds each readiness check. Defaults to 2 seconds.
+func WithHealthCheckTimeout(d time.Duration) HealthOption {
+	return func(h *HealthHandler) { h.timeout = d }
+}
+
+func NewHealthHandler(opts ...HealthOption) *HealthHandler {
+	h := &HealthHandler{checks: map[string]HealthCheck{}, timeout: 2 * time.Second}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Drain makes the readiness probe fail from now on so load balancers stop sending new
+// requests before the server shuts down. Liveness is unaffected.
+func (h *HealthHandler) Drain() {
+	h.draining.Store(true)
+}
+
+// Healthz answers as long as the process can serve HTTP; it never touches dependencies,
+// so a database outage does not get the pod restarted.
+func (h *HealthHandler) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz runs every check concurrently and answers 503 if any fails or the server is draining.
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	if h.draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "draining"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	results := make([]error, len(h.names))
+	var wg sync.WaitGroup
+	for i, name := range h.names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, h.timeout)
+			defer cancel()
+			results[i] = h.checks[name](checkCtx)
+		}()
+	}
+	wg.Wait()
+
+	status, code := "ok", http.StatusOK
+	checks := make(map[string]string, len(h.names))
+	for i, name := range h.names {
+		checks[name] = "ok"
+		if err := results[i]; err != nil {
+			// جزئیات خطا فقط در لاگ؛ probe ممکن است از بیرون هم در دسترس باشد
+			logging.FromContext(ctx).WarnContext(ctx, "readiness check failed", "check", name, "error", err)
+			checks[name] = "fail"
+			status, code = "unavailable", http.StatusServiceUnavailable
+		}
+	}
+	c.JSON(code, gin.H{"status": status, "checks": checks})
+}
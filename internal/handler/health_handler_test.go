@@ -0,0 +1,74 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"user-go/internal/handler"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func probe(t *testing.T, r *gin.Engine, path string) (int, map[string]interface{}) {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return w.Code, body
+}
+
+func TestHealthHandler(t *testing.T) {
+	var cacheErr error
+	h := handler.NewHealthHandler(
+		handler.WithHealthCheck("postgres", func(context.Context) error { return nil }),
+		handler.WithHealthCheck("cache", func(context.Context) error { return cacheErr }),
+	)
+	r := gin.New()
+	r.GET("/healthz", h.Healthz)
+	r.GET("/readyz", h.Readyz)
+
+	code, body := probe(t, r, "/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]interface{}{"postgres": "ok", "cache": "ok"}, body["checks"])
+
+	cacheErr = errors.New("connection refused")
+	code, body = probe(t, r, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "unavailable", body["status"])
+	assert.Equal(t, map[string]interface{}{"postgres": "ok", "cache": "fail"}, body["checks"])
+
+	// liveness به وابستگی‌ها کاری ندارد
+	code, _ = probe(t, r, "/healthz")
+	assert.Equal(t, http.StatusOK, code)
+
+	cacheErr = nil
+	h.Drain()
+	code, body = probe(t, r, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "draining", body["status"])
+	code, _ = probe(t, r, "/healthz")
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestHealthHandler_CheckTimeout(t *testing.T) {
+	h := handler.NewHealthHandler(
+		handler.WithHealthCheckTimeout(10*time.Millisecond),
+		handler.WithHealthCheck("postgres", func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}),
+	)
+	r := gin.New()
+	r.GET("/readyz", h.Readyz)
+
+	start := time.Now()
+	code, _ := probe(t, r, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Less(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,23 @@
+package handler
+
+import (
+	"net/http"
+	"user-go/internal/keys"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JWKSHandler struct {
+	keys *keys.Manager
+}
+
+func NewJWKSHandler(km *keys.Manager) *JWKSHandler {
+	return &JWKSHandler{keys: km}
+}
+
+// JWKS publishes the public signing keys so other services can verify tokens themselves
+func (h *JWKSHandler) JWKS(c *gin.Context) {
+	// کش کوتاه تا کلیدهای جدید پس از چرخش سریع دیده شوند
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.keys.JWKS())
+}
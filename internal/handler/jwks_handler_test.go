@@ -0,0 +1,38 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"user-go/internal/handler"
+	"user-go/internal/keys"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWKS(t *testing.T) {
+	km, err := keys.NewManager(keys.ES256)
+	require.NoError(t, err)
+	require.NoError(t, km.Rotate())
+
+	r := gin.Default()
+	r.GET("/.well-known/jwks.json", handler.NewJWKSHandler(km).JWKS)
+
+	req, _ := http.NewRequest("GET", "/.well-known/jwks.json", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Cache-Control"))
+
+	var set keys.JWKSet
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &set))
+	assert.Len(t, set.Keys, 2)
+	for _, k := range set.Keys {
+		assert.Equal(t, "EC", k.Kty)
+		assert.NotEmpty(t, k.Kid)
+	}
+}
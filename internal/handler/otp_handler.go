@@ -1,7 +1,11 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
+	"user-go/internal/apperr"
+	"user-go/internal/logging"
+	"user-go/internal/phone"
 	"user-go/internal/service"
 
 	"github.com/gin-gonic/gin"
@@ -9,10 +13,30 @@ import (
 
 type AuthHandler struct {
 	otpService *service.OtpService
+	devMode    bool
+	phones     *phone.Parser
 }
 
-func NewAuthHandler(otpService *service.OtpService) *AuthHandler {
-	return &AuthHandler{otpService: otpService}
+// AuthOption configures optional AuthHandler behaviour.
+type AuthOption func(*AuthHandler)
+
+// WithDevMode makes RequestOTP echo the generated code in its response.
+// Never enable it in production: anyone could log in as any phone number.
+func WithDevMode(enabled bool) AuthOption {
+	return func(h *AuthHandler) { h.devMode = enabled }
+}
+
+// WithPhoneParser sets how phone numbers in requests are read. Defaults to international format only.
+func WithPhoneParser(p *phone.Parser) AuthOption {
+	return func(h *AuthHandler) { h.phones = p }
+}
+
+func NewAuthHandler(otpService *service.OtpService, opts ...AuthOption) *AuthHandler {
+	h := &AuthHandler{otpService: otpService, phones: phone.International}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 // Request OTP
@@ -22,17 +46,26 @@ func (h *AuthHandler) RequestOTP(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "phone is required"})
+		c.Error(apperr.Validation("phone", "phone is required"))
 		return
 	}
 
-	otp, err := h.otpService.RequestOTP(req.Phone)
+	number, ok := normalizePhone(c, h.phones, "phone", req.Phone)
+	if !ok {
+		return
+	}
+
+	otp, err := h.otpService.RequestOTP(c.Request.Context(), number)
 	if err != nil {
-		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "OTP sent (printed on server)", "otp": otp})
+	if h.devMode {
+		c.JSON(http.StatusOK, gin.H{"message": "OTP sent", "otp": otp})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "OTP sent"})
 }
 
 // Validate OTP and login/register
@@ -40,18 +73,163 @@ func (h *AuthHandler) ValidateOTP(c *gin.Context) {
 	var req struct {
 		Phone string `json:"phone" binding:"required"`
 		OTP   string `json:"otp" binding:"required,len=6"`
+		// Device is an optional name for the new session, e.g. "Pixel 8".
+		Device string `json:"device"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.Validation("otp", "phone and 6-digit otp required"))
+		return
+	}
+
+	number, ok := normalizePhone(c, h.phones, "phone", req.Phone)
+	if !ok {
+		return
+	}
+
+	if err := h.otpService.AllowValidateFrom(c.Request.Context(), c.ClientIP()); err != nil {
+		c.Error(err)
+		return
+	}
+
+	ctx := service.WithDevice(c.Request.Context(), req.Device)
+	pair, err := h.otpService.ValidateOTP(ctx, number, req.OTP)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokenResponse(pair))
+}
+
+// Refresh rotates a refresh token and returns a new token pair
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.Validation("refresh_token", "refresh_token is required"))
+		return
+	}
+
+	pair, err := h.otpService.Tokens().Refresh(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokenResponse(pair))
+}
+
+// Logout revokes the current access token and, if given, its refresh token
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
 	}
+	// بدنه اختیاری است
+	_ = c.ShouldBindJSON(&req)
+
+	jti := c.GetString("jti")
+	exp := c.GetTime("token_exp")
 
+	err := h.otpService.Tokens().Logout(c.Request.Context(), req.RefreshToken, jti, exp)
+	if err != nil && !errors.Is(err, service.ErrInvalidRefreshToken) {
+		c.Error(err)
+		return
+	}
+	// بدون refresh token هم session همین توکن بسته می‌شود
+	if sid := c.GetString("session_id"); sid != "" {
+		if err := h.otpService.Tokens().EndSession(c.Request.Context(), c.GetString("user_id"), sid); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "logged out"})
+}
+
+// LogoutAll revokes every token issued to the current user
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	if err := h.otpService.Tokens().RevokeAll(c.Request.Context(), userID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "logged out from all sessions"})
+}
+
+// RequestPhoneChange sends a code to the new number; the phone only changes once it is confirmed.
+func (h *AuthHandler) RequestPhoneChange(c *gin.Context) {
+	var req struct {
+		NewPhone string `json:"new_phone" binding:"required"`
+	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "phone and 6-digit otp required"})
+		c.Error(apperr.Validation("new_phone", "new_phone is required"))
 		return
 	}
 
-	token, err := h.otpService.ValidateOTP(req.Phone, req.OTP)
+	number, ok := normalizePhone(c, h.phones, "new_phone", req.NewPhone)
+	if !ok {
+		return
+	}
+
+	otp, err := h.otpService.RequestPhoneChange(c.Request.Context(), c.GetString("user_id"), number)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	if h.devMode {
+		c.JSON(http.StatusOK, gin.H{"message": "OTP sent", "otp": otp})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "OTP sent"})
+}
+
+// ConfirmPhoneChange applies a pending phone change. All existing sessions are revoked,
+// so the response carries a new token pair for the caller.
+func (h *AuthHandler) ConfirmPhoneChange(c *gin.Context) {
+	var req struct {
+		OTP string `json:"otp" binding:"required,len=6"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.Validation("otp", "6-digit otp required"))
+		return
+	}
+
+	pair, err := h.otpService.ConfirmPhoneChange(c.Request.Context(), c.GetString("user_id"), req.OTP)
+	if err != nil {
+		// کد اشتباه اینجا به معنی نشست نامعتبر نیست، فقط ورودی غلط است
+		if errors.Is(err, service.ErrInvalidOTP) {
+			err = apperr.WithKind(apperr.Invalid, err)
+		}
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokenResponse(pair))
+}
+
+func tokenResponse(pair *service.TokenPair) gin.H {
+	return gin.H{
+		"token":         pair.AccessToken,
+		"refresh_token": pair.RefreshToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(pair.ExpiresIn.Seconds()),
+	}
+}
+
+// normalizePhone reads field as a phone number, failing the request with the field and
+// reason when it is not a plausible mobile number. It reports whether the request may continue.
+func normalizePhone(c *gin.Context, p *phone.Parser, field, raw string) (string, bool) {
+	number, err := p.Normalize(raw)
+	if err != nil {
+		c.Error(apperr.WithField(field, err))
+		return "", false
+	}
+	c.Request = c.Request.WithContext(logging.With(c.Request.Context(), field, number))
+	return number, true
 }
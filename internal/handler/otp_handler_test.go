@@ -2,35 +2,47 @@ package handler_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 	"user-go/internal/cache"
 	"user-go/internal/handler"
+	"user-go/internal/middleware"
+	"user-go/internal/phone"
 	"user-go/internal/repository"
+	"user-go/internal/sender"
 	"user-go/internal/service"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
 
-func setupRouter() (*gin.Engine, *handler.AuthHandler, *service.OtpService) {
+func setupRouter(opts ...handler.AuthOption) (*gin.Engine, *handler.AuthHandler, *service.OtpService) {
+	return setupRouterWithService(nil, opts...)
+}
+
+func setupRouterWithService(svcOpts []service.Option, opts ...handler.AuthOption) (*gin.Engine, *handler.AuthHandler, *service.OtpService) {
 	cache := cache.NewInMemoryCache()
 	users := repository.NewInMemoryUserRepository()
-	svc := service.NewOtpService(cache, users, "testsecret")
-	authHandler := handler.NewAuthHandler(svc)
+	svcOpts = append([]service.Option{service.WithSender(sender.NewConsoleSender(io.Discard))}, svcOpts...)
+	svc := service.NewOtpService(cache, users, "testsecret", svcOpts...)
+	authHandler := handler.NewAuthHandler(svc, opts...)
 
 	r := gin.Default()
+	r.Use(middleware.Errors())
 	r.POST("/request-otp", authHandler.RequestOTP)
 	r.POST("/validate-otp", authHandler.ValidateOTP)
 	return r, authHandler, svc
 }
 
 func TestRequestOTP_Success(t *testing.T) {
-	r, _, _ := setupRouter()
+	r, _, _ := setupRouter(handler.WithDevMode(true))
 
-	payload := map[string]string{"phone": "+1234567890"}
+	payload := map[string]string{"phone": "+12025550123"}
 	body, _ := json.Marshal(payload)
 
 	req, _ := http.NewRequest("POST", "/request-otp", bytes.NewBuffer(body))
@@ -48,11 +60,83 @@ func TestRequestOTP_Success(t *testing.T) {
 	assert.Len(t, resp["otp"], 6)
 }
 
+func TestRequestOTP_HidesCodeOutsideDevMode(t *testing.T) {
+	r, _, _ := setupRouter()
+
+	payload := map[string]string{"phone": "+12025550123"}
+	body, _ := json.Marshal(payload)
+
+	req, _ := http.NewRequest("POST", "/request-otp", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.NoError(t, err)
+	assert.NotContains(t, resp, "otp")
+}
+
+func TestRequestOTP_NormalizesPhone(t *testing.T) {
+	iran, err := phone.NewParser("IR")
+	assert.NoError(t, err)
+	r, _, svc := setupRouterWithService([]service.Option{service.WithRequestLimit(1, time.Minute)}, handler.WithPhoneParser(iran), handler.WithDevMode(true))
+
+	var resp map[string]interface{}
+	w := postJSON(r, "/request-otp", "", map[string]string{"phone": "0912 123 4567"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	// هر سه شکل یک شماره‌اند
+	assert.Equal(t, http.StatusOK, postValidate(r, "989121234567", resp["otp"].(string)).Code)
+	_, err = svc.RequestOTP(context.Background(), "+989121234567")
+	assert.ErrorIs(t, err, service.ErrRateLimited)
+}
+
+func TestRequestOTP_RejectsInvalidPhone(t *testing.T) {
+	r, _, _ := setupRouter()
+
+	var resp map[string]interface{}
+	w := postJSON(r, "/request-otp", "", map[string]string{"phone": "02112345678"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "invalid_phone", resp["code"])
+	assert.Equal(t, "phone", resp["field"])
+	assert.Equal(t, phone.ReasonMissingCountryCode, resp["reason"])
+
+	w = postJSON(r, "/request-otp", "", map[string]string{"phone": "+982112345678"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, phone.ReasonNotMobile, resp["reason"])
+}
+
+func TestRequestOTP_DeletedAccount(t *testing.T) {
+	users := repository.NewInMemoryUserRepository()
+	svc := service.NewOtpService(cache.NewInMemoryCache(), users, "testsecret", service.WithSender(sender.NewConsoleSender(io.Discard)))
+	r := gin.Default()
+	r.Use(middleware.Errors())
+	r.POST("/request-otp", handler.NewAuthHandler(svc).RequestOTP)
+
+	user, err := users.Create(context.Background(), "+989121234567")
+	assert.NoError(t, err)
+	assert.NoError(t, users.Delete(context.Background(), user.ID))
+
+	// حساب حذف‌شده همه‌جا با یک کد جواب می‌گیرد
+	var resp map[string]interface{}
+	w := postJSON(r, "/request-otp", "", map[string]string{"phone": "+989121234567"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "account_deleted", resp["code"])
+}
+
 func TestValidateOTP_Success(t *testing.T) {
 	r, _, svc := setupRouter()
 
-	phone := "+1234567890"
-	otp, err := svc.RequestOTP(phone)
+	phone := "+12025550123"
+	otp, err := svc.RequestOTP(context.Background(), phone)
 	assert.NoError(t, err)
 
 	payload := map[string]string{"phone": phone, "otp": otp}
@@ -75,7 +159,7 @@ func TestValidateOTP_Success(t *testing.T) {
 func TestValidateOTP_Fail(t *testing.T) {
 	r, _, _ := setupRouter()
 
-	payload := map[string]string{"phone": "+1234567890", "otp": "000000"}
+	payload := map[string]string{"phone": "+12025550123", "otp": "000000"}
 	body, _ := json.Marshal(payload)
 
 	req, _ := http.NewRequest("POST", "/validate-otp", bytes.NewBuffer(body))
@@ -86,3 +170,155 @@ func TestValidateOTP_Fail(t *testing.T) {
 
 	assert.Equal(t, http.StatusUnauthorized, w.Code)
 }
+
+func postValidate(r *gin.Engine, phone, otp string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(map[string]string{"phone": phone, "otp": otp})
+	req, _ := http.NewRequest("POST", "/validate-otp", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestValidateOTP_TooManyAttemptsThenLocked(t *testing.T) {
+	r, _, svc := setupRouterWithService([]service.Option{service.WithMaxValidateAttempts(2)})
+
+	phone := "+12025550123"
+	_, err := svc.RequestOTP(context.Background(), phone)
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusUnauthorized, postValidate(r, phone, "000000").Code)
+	assert.Equal(t, http.StatusTooManyRequests, postValidate(r, phone, "000000").Code)
+
+	w := postValidate(r, phone, "000000")
+	assert.Equal(t, http.StatusLocked, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	var resp map[string]any
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "account_locked", resp["code"])
+}
+
+func TestValidateOTP_PerIPLimit(t *testing.T) {
+	r, _, _ := setupRouterWithService([]service.Option{service.WithValidateIPLimit(2, time.Minute)})
+
+	assert.Equal(t, http.StatusUnauthorized, postValidate(r, "+989120000001", "000000").Code)
+	assert.Equal(t, http.StatusUnauthorized, postValidate(r, "+989120000002", "000000").Code)
+	assert.Equal(t, http.StatusTooManyRequests, postValidate(r, "+989120000003", "000000").Code)
+}
+
+func postJSON(r *gin.Engine, path, token string, payload interface{}) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(payload)
+	req, _ := http.NewRequest("POST", path, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRefreshAndLogout(t *testing.T) {
+	r, h, svc := setupRouter()
+	r.POST("/refresh", h.Refresh)
+	protected := r.Group("/")
+	protected.Use(middleware.JWTAuthMiddleware([]byte("testsecret"), middleware.WithRevocationCheck(svc.Tokens())))
+	protected.POST("/logout", h.Logout)
+	protected.POST("/logout-all", h.LogoutAll)
+	protected.GET("/me", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	phone := "+12025550123"
+	otp, err := svc.RequestOTP(context.Background(), phone)
+	assert.NoError(t, err)
+
+	var login map[string]interface{}
+	w := postValidate(r, phone, otp)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &login))
+	assert.Equal(t, "Bearer", login["token_type"])
+
+	// refresh
+	var refreshed map[string]interface{}
+	w = postJSON(r, "/refresh", "", map[string]string{"refresh_token": login["refresh_token"].(string)})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &refreshed))
+
+	// reuse of the rotated refresh token ends the session, access tokens included
+	w = postJSON(r, "/refresh", "", map[string]string{"refresh_token": login["refresh_token"].(string)})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	req, _ := http.NewRequest("GET", "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+refreshed["token"].(string))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// logout denies the access token immediately
+	otp, err = svc.RequestOTP(context.Background(), phone)
+	assert.NoError(t, err)
+	w = postValidate(r, phone, otp)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &login))
+	access := login["token"].(string)
+	w = postJSON(r, "/logout", access, map[string]string{})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req, _ = http.NewRequest("GET", "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+access)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestLogoutAll(t *testing.T) {
+	r, h, svc := setupRouter()
+	protected := r.Group("/")
+	protected.Use(middleware.JWTAuthMiddleware([]byte("testsecret"), middleware.WithRevocationCheck(svc.Tokens())))
+	protected.POST("/logout-all", h.LogoutAll)
+
+	user := &repository.User{ID: repository.NewID(), Phone: "+12025550123", Role: repository.RoleUser}
+	first, err := svc.Tokens().Issue(context.Background(), user)
+	assert.NoError(t, err)
+	second, err := svc.Tokens().Issue(context.Background(), user)
+	assert.NoError(t, err)
+
+	w := postJSON(r, "/logout-all", first.AccessToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = postJSON(r, "/logout-all", second.AccessToken, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestPhoneChangeFlow(t *testing.T) {
+	r, h, svc := setupRouter(handler.WithDevMode(true))
+	protected := r.Group("/")
+	protected.Use(middleware.JWTAuthMiddleware([]byte("testsecret"), middleware.WithRevocationCheck(svc.Tokens())))
+	protected.POST("/profile/phone", h.RequestPhoneChange)
+	protected.POST("/profile/phone/confirm", h.ConfirmPhoneChange)
+
+	phone := "+12025550123"
+	otp, err := svc.RequestOTP(context.Background(), phone)
+	assert.NoError(t, err)
+	var login map[string]interface{}
+	assert.NoError(t, json.Unmarshal(postValidate(r, phone, otp).Body.Bytes(), &login))
+	access := login["token"].(string)
+
+	assert.Equal(t, http.StatusBadRequest, postJSON(r, "/profile/phone", access, map[string]string{"new_phone": phone}).Code)
+	assert.Equal(t, http.StatusBadRequest, postJSON(r, "/profile/phone/confirm", access, map[string]string{"otp": "000000"}).Code)
+
+	var started map[string]interface{}
+	w := postJSON(r, "/profile/phone", access, map[string]string{"new_phone": "+12025550199"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &started))
+
+	assert.Equal(t, http.StatusBadRequest, postJSON(r, "/profile/phone/confirm", access, map[string]string{"otp": "000000"}).Code)
+
+	var confirmed map[string]interface{}
+	w = postJSON(r, "/profile/phone/confirm", access, map[string]string{"otp": started["otp"].(string)})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &confirmed))
+	assert.NotEmpty(t, confirmed["token"])
+
+	// نشست قبلی باطل شده و توکن جدید کار می‌کند
+	assert.Equal(t, http.StatusUnauthorized, postJSON(r, "/profile/phone", access, map[string]string{"new_phone": "+12025550100"}).Code)
+	assert.Equal(t, http.StatusOK, postJSON(r, "/profile/phone", confirmed["token"].(string), map[string]string{"new_phone": "+12025550100"}).Code)
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"net/http"
+	"user-go/internal/repository"
+	"user-go/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SessionHandler lets users see where they are logged in and end sessions on other devices.
+type SessionHandler struct {
+	tokens *service.TokenService
+}
+
+func NewSessionHandler(tokens *service.TokenService) *SessionHandler {
+	return &SessionHandler{tokens: tokens}
+}
+
+type sessionResponse struct {
+	repository.Session
+	// Current marks the session of the token making the request.
+	Current bool `json:"current"`
+}
+
+// ListSessions returns the caller's active sessions, most recently seen first.
+func (h *SessionHandler) ListSessions(c *gin.Context) {
+	sessions, err := h.tokens.Sessions(c.Request.Context(), c.GetString("user_id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	current := c.GetString("session_id")
+	out := make([]sessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		out = append(out, sessionResponse{Session: s, Current: s.ID == current})
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": out})
+}
+
+// RevokeSession logs the caller out of one session; its tokens stop working at once.
+func (h *SessionHandler) RevokeSession(c *gin.Context) {
+	err := h.tokens.RevokeSession(c.Request.Context(), c.GetString("user_id"), c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "session revoked"})
+}
@@ -0,0 +1,105 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"user-go/internal/cache"
+	"user-go/internal/handler"
+	"user-go/internal/middleware"
+	"user-go/internal/repository"
+	"user-go/internal/sender"
+	"user-go/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupSessionRouter() (*gin.Engine, *service.OtpService) {
+	c := cache.NewInMemoryCache()
+	users := repository.NewInMemoryUserRepository()
+	tokens := service.NewTokenService(c, "testsecret", service.WithSessions(users))
+	svc := service.NewOtpService(c, users, "testsecret",
+		service.WithSender(sender.NewConsoleSender(io.Discard)), service.WithTokenService(tokens))
+	authHandler := handler.NewAuthHandler(svc)
+	sessionHandler := handler.NewSessionHandler(tokens)
+
+	r := gin.New()
+	r.Use(middleware.AuditClient(), middleware.Errors())
+	r.POST("/validate-otp", authHandler.ValidateOTP)
+	protected := r.Group("/")
+	protected.Use(middleware.JWTAuthMiddleware([]byte("testsecret"),
+		middleware.WithRevocationCheck(tokens), middleware.WithSessionTouch(tokens)))
+	protected.POST("/logout", authHandler.Logout)
+	protected.GET("/profile/sessions", sessionHandler.ListSessions)
+	protected.DELETE("/profile/sessions/:id", sessionHandler.RevokeSession)
+	return r, svc
+}
+
+func loginWithDevice(t *testing.T, r *gin.Engine, svc *service.OtpService, phone, device string) string {
+	otp, err := svc.RequestOTP(context.Background(), phone)
+	require.NoError(t, err)
+	var login map[string]interface{}
+	w := postJSON(r, "/validate-otp", "", map[string]string{"phone": phone, "otp": otp, "device": device})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &login))
+	return login["token"].(string)
+}
+
+func authed(r *gin.Engine, method, path, token string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+type sessionList struct {
+	Sessions []struct {
+		ID      string `json:"id"`
+		Device  string `json:"device"`
+		Current bool   `json:"current"`
+	} `json:"sessions"`
+}
+
+func TestSessionHandler_ListAndRevoke(t *testing.T) {
+	r, svc := setupSessionRouter()
+	phone := "+12025550123"
+	laptop := loginWithDevice(t, r, svc, phone, "laptop")
+	lost := loginWithDevice(t, r, svc, phone, "lost phone")
+
+	var list sessionList
+	w := authed(r, http.MethodGet, "/profile/sessions", laptop)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Sessions, 2)
+	var lostID string
+	for _, s := range list.Sessions {
+		assert.Equal(t, s.Device == "laptop", s.Current)
+		if s.Device == "lost phone" {
+			lostID = s.ID
+		}
+	}
+	assert.NotContains(t, w.Body.String(), "user_id")
+
+	assert.Equal(t, http.StatusNotFound, authed(r, http.MethodDelete, "/profile/sessions/"+repository.NewID(), laptop).Code)
+	assert.Equal(t, http.StatusOK, authed(r, http.MethodDelete, "/profile/sessions/"+lostID, laptop).Code)
+	assert.Equal(t, http.StatusUnauthorized, authed(r, http.MethodGet, "/profile/sessions", lost).Code)
+
+	// کاربر دیگر نمی‌تواند session دیگران را ببندد
+	other := loginWithDevice(t, r, svc, "+12025550124", "")
+	w = authed(r, http.MethodGet, "/profile/sessions", laptop)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Sessions, 1)
+	assert.Equal(t, http.StatusNotFound, authed(r, http.MethodDelete, "/profile/sessions/"+list.Sessions[0].ID, other).Code)
+
+	// logout فقط session جاری را می‌بندد
+	assert.Equal(t, http.StatusOK, postJSON(r, "/logout", laptop, map[string]string{}).Code)
+	w = authed(r, http.MethodGet, "/profile/sessions", other)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Len(t, list.Sessions, 1)
+}
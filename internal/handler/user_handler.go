@@ -1,30 +1,148 @@
 package handler
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
+	"user-go/internal/apperr"
+	"user-go/internal/audit"
+	"user-go/internal/logging"
+	"user-go/internal/middleware"
+	"user-go/internal/phone"
 	"user-go/internal/repository"
 
 	"github.com/gin-gonic/gin"
 )
 
+// TokenRevoker invalidates every token issued to a user.
+type TokenRevoker interface {
+	RevokeAll(ctx context.Context, userID string) error
+}
+
 type UserHandler struct {
 	userRepo repository.UserRepository
+	revoker  TokenRevoker
+	phones   *phone.Parser
+	audit    *audit.Recorder
+}
+
+// UserOption configures optional UserHandler dependencies.
+type UserOption func(*UserHandler)
+
+// WithTokenRevoker makes phone changes and deletions revoke the user's existing tokens at once.
+func WithTokenRevoker(r TokenRevoker) UserOption {
+	return func(h *UserHandler) { h.revoker = r }
+}
+
+// WithUserPhoneParser sets how phone numbers in requests are read. Defaults to international format only.
+func WithUserPhoneParser(p *phone.Parser) UserOption {
+	return func(h *UserHandler) { h.phones = p }
+}
+
+// WithUserAudit records admin phone changes and deletions, restores and purges of users.
+func WithUserAudit(r *audit.Recorder) UserOption {
+	return func(h *UserHandler) { h.audit = r }
+}
+
+func NewUserHandler(userRepo repository.UserRepository, opts ...UserOption) *UserHandler {
+	h := &UserHandler{userRepo: userRepo, phones: phone.International}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
-func NewUserHandler(userRepo repository.UserRepository) *UserHandler {
-	return &UserHandler{userRepo: userRepo}
+// revokeTokens is best effort: the repository change already happened, so it
+// must also run when the client has gone away.
+func (h *UserHandler) revokeTokens(c *gin.Context, userID string) {
+	if h.revoker == nil {
+		return
+	}
+	_ = h.revoker.RevokeAll(context.WithoutCancel(c.Request.Context()), userID)
+}
+
+// record writes event with the caller as actor and the outcome of err.
+func (h *UserHandler) record(c *gin.Context, event repository.AuditEvent, err error) {
+	event.ActorID = c.GetString("user_id")
+	event.Outcome = repository.AuditSuccess
+	if err != nil {
+		event.Outcome, event.Reason = repository.AuditFailure, auditReason(err)
+	}
+	h.audit.Record(c.Request.Context(), event)
+}
+
+func auditReason(err error) string {
+	switch {
+	case errors.Is(err, repository.ErrUserNotFound):
+		return "not_found"
+	case errors.Is(err, repository.ErrPhoneTaken):
+		return "phone_taken"
+	case errors.Is(err, repository.ErrUserNotDeleted):
+		return "not_deleted"
+	}
+	return "error"
 }
 
 func (h *UserHandler) GetProfile(c *gin.Context) {
-	phone, exists := c.Get("phone")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.Error(middleware.ErrInvalidToken)
 		return
 	}
 
-	user, err := h.userRepo.GetByPhone(phone.(string))
+	user, err := h.userRepo.GetByID(c.Request.Context(), userID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// UpdateProfile applies a partial update to the caller's own profile. Omitted fields are kept.
+func (h *UserHandler) UpdateProfile(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.Error(middleware.ErrInvalidToken)
+		return
+	}
+
+	var req struct {
+		DisplayName *string         `json:"display_name"`
+		Email       *string         `json:"email"`
+		AvatarURL   *string         `json:"avatar_url"`
+		Locale      *string         `json:"locale"`
+		Timezone    *string         `json:"timezone"`
+		Metadata    json.RawMessage `json:"metadata"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.Validation("body", "invalid request body"))
+		return
+	}
+
+	upd := repository.ProfileUpdate{
+		DisplayName: req.DisplayName,
+		Email:       req.Email,
+		AvatarURL:   req.AvatarURL,
+		Locale:      req.Locale,
+		Timezone:    req.Timezone,
+		Metadata:    req.Metadata,
+	}
+	// "metadata": null پاک کردن metadata است
+	if string(upd.Metadata) == "null" {
+		upd.Metadata = json.RawMessage(`{}`)
+	}
+	if upd.Empty() {
+		c.Error(apperr.Validation("body", "no profile fields to update"))
+		return
+	}
+
+	user, err := h.userRepo.UpdateProfile(c.Request.Context(), userID, upd)
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
@@ -32,66 +150,165 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
 }
 
 func (h *UserHandler) GetUser(c *gin.Context) {
-	phone := c.Param("phone")
-	user, err := h.userRepo.GetByPhone(phone)
+	user, err := h.userRepo.GetByID(c.Request.Context(), c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, user)
 }
 
+// ListUsers returns one page of users. Query params: limit, cursor, sort, search, role,
+// registered_from and registered_before (RFC 3339), and deleted=true to list soft-deleted users.
+// Pass next_cursor back as cursor to get the next page.
 func (h *UserHandler) ListUsers(c *gin.Context) {
-	offset := 0
-	limit := 10
-	search := c.Query("search")
+	opts := repository.ListOptions{
+		Cursor: c.Query("cursor"),
+		Sort:   repository.SortOrder(c.Query("sort")),
+		Search: c.Query("search"),
+		Role:   repository.Role(c.Query("role")),
+	}
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			c.Error(apperr.Validation("limit", "limit must be a positive integer"))
+			return
+		}
+		opts.Limit = limit
+	}
+	if v := c.Query("deleted"); v != "" {
+		deleted, err := strconv.ParseBool(v)
+		if err != nil {
+			c.Error(apperr.Validation("deleted", "deleted must be true or false"))
+			return
+		}
+		opts.Deleted = deleted
+	}
+	for param, dst := range map[string]*time.Time{
+		"registered_from":   &opts.RegisteredFrom,
+		"registered_before": &opts.RegisteredBefore,
+	} {
+		if v := c.Query(param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				c.Error(apperr.Validation(param, param+" must be an RFC 3339 timestamp"))
+				return
+			}
+			*dst = t.UTC()
+		}
+	}
 
-	users, err := h.userRepo.List(offset, limit, search)
+	page, err := h.userRepo.ListPage(c.Request.Context(), opts)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list users"})
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, users)
+	c.JSON(http.StatusOK, page)
 }
 
+// EditUser is the admin override for a user's phone: it skips OTP verification and is
+// recorded in the phone history under the caller's id. Owners use the verified flow instead.
 func (h *UserHandler) EditUser(c *gin.Context) {
-	phone := c.Param("phone")
+	id := c.Param("id")
 
 	var req struct {
 		NewPhone string `json:"new_phone" binding:"required"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "new_phone is required"})
+		c.Error(apperr.Validation("new_phone", "new_phone is required"))
 		return
 	}
 
-	err := h.userRepo.UpdatePhone(phone, req.NewPhone)
+	number, ok := normalizePhone(c, h.phones, "new_phone", req.NewPhone)
+	if !ok {
+		return
+	}
+
+	err := h.userRepo.UpdatePhone(c.Request.Context(), id, number, repository.PhoneChangeAdmin, c.GetString("user_id"))
+	h.record(c, repository.AuditEvent{
+		Action: repository.AuditPhoneChanged, TargetID: id, PhoneHash: logging.PhoneHash(number),
+		Reason: string(repository.PhoneChangeAdmin),
+	}, err)
 	if err != nil {
-		if err == repository.ErrUserNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
-		} else {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		}
+		c.Error(err)
 		return
 	}
+	h.revokeTokens(c, id)
 
 	c.JSON(http.StatusOK, gin.H{"message": "user updated"})
 }
 
+// PhoneHistory lists the phone changes of a user, newest first.
+func (h *UserHandler) PhoneHistory(c *gin.Context) {
+	history, err := h.userRepo.PhoneHistory(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"history": history})
+}
+
+// DeleteUser soft-deletes a user. The account can be restored until the purge job erases it.
 func (h *UserHandler) DeleteUser(c *gin.Context) {
-	phone := c.Param("phone")
+	id := c.Param("id")
 
-	err := h.userRepo.Delete(phone)
+	err := h.userRepo.Delete(c.Request.Context(), id)
+	h.record(c, repository.AuditEvent{Action: repository.AuditUserDeleted, TargetID: id}, err)
 	if err != nil {
-		if err == repository.ErrUserNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not delete user"})
-		}
+		c.Error(err)
 		return
 	}
+	h.revokeTokens(c, id)
 
 	c.JSON(http.StatusOK, gin.H{"message": "user deleted"})
 }
+
+// RestoreUser undoes a soft delete. Tokens were revoked on delete, so the user logs in again.
+func (h *UserHandler) RestoreUser(c *gin.Context) {
+	user, err := h.userRepo.Restore(c.Request.Context(), c.Param("id"))
+	h.record(c, repository.AuditEvent{Action: repository.AuditUserRestored, TargetID: c.Param("id")}, err)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// PurgeUser erases a user and their history immediately, deleted or not, e.g. for an erasure request.
+func (h *UserHandler) PurgeUser(c *gin.Context) {
+	id := c.Param("id")
+
+	err := h.userRepo.Purge(c.Request.Context(), id)
+	h.record(c, repository.AuditEvent{Action: repository.AuditUserPurged, TargetID: id}, err)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	h.revokeTokens(c, id)
+
+	c.JSON(http.StatusOK, gin.H{"message": "user purged"})
+}
+
+// SetRole changes a user's role. Existing tokens are revoked so the new role applies on next login.
+func (h *UserHandler) SetRole(c *gin.Context) {
+	id := c.Param("id")
+
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.Validation("role", "role is required"))
+		return
+	}
+
+	err := h.userRepo.UpdateRole(c.Request.Context(), id, repository.Role(req.Role))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	h.revokeTokens(c, id)
+
+	c.JSON(http.StatusOK, gin.H{"message": "role updated"})
+}
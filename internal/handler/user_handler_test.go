@@ -2,25 +2,32 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
+	"user-go/internal/middleware"
 	"user-go/internal/repository"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func setupRouter() (*gin.Engine, *repository.InMemoryUserRepository) {
 	r := gin.Default()
+	r.Use(middleware.Errors())
 	userRepo := repository.NewInMemoryUserRepository()
 	userHandler := NewUserHandler(userRepo)
 
-	r.GET("/users/:phone", userHandler.GetUser)
+	r.GET("/users/:id", userHandler.GetUser)
 	r.GET("/users", userHandler.ListUsers)
-	r.PUT("/users/:phone", userHandler.EditUser)
-	r.DELETE("/users/:phone", userHandler.DeleteUser)
+	r.PUT("/users/:id", userHandler.EditUser)
+	r.DELETE("/users/:id", userHandler.DeleteUser)
+	r.GET("/users/:id/phone-history", userHandler.PhoneHistory)
 
 	return r, userRepo
 }
@@ -28,65 +35,316 @@ func setupRouter() (*gin.Engine, *repository.InMemoryUserRepository) {
 func TestGetUser(t *testing.T) {
 	r, repo := setupRouter()
 
-	_, _ = repo.Create("+123")
+	user, _ := repo.Create(context.Background(), "+989120000123")
 
-	req, _ := http.NewRequest("GET", "/users/+123", nil)
+	req, _ := http.NewRequest("GET", "/users/"+user.ID, nil)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 
 	assert.Equal(t, 200, w.Code)
+	var got repository.User
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, "+989120000123", got.Phone)
+
+	// شماره تلفن دیگر شناسه‌ی مسیر نیست
+	req, _ = http.NewRequest("GET", "/users/+123", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, 404, w.Code)
 }
 
 func TestListUsers(t *testing.T) {
 	r, repo := setupRouter()
 
-	_, _ = repo.Create("+111")
-	_, _ = repo.Create("+222")
+	_, _ = repo.Create(context.Background(), "+989120000111")
+	_, _ = repo.Create(context.Background(), "+989120000222")
 
-	req, _ := http.NewRequest("GET", "/users?search=+2", nil)
+	req, _ := http.NewRequest("GET", "/users?search=222", nil)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 
 	assert.Equal(t, 200, w.Code)
 
-	var users []repository.User
-	err := json.Unmarshal(w.Body.Bytes(), &users)
+	var page repository.UserPage
+	err := json.Unmarshal(w.Body.Bytes(), &page)
 	assert.NoError(t, err)
-	assert.Len(t, users, 1)
-	assert.Equal(t, "+222", users[0].Phone)
+	assert.Len(t, page.Users, 1)
+	assert.Equal(t, "+989120000222", page.Users[0].Phone)
+	assert.Equal(t, 1, page.Total)
+}
+
+func TestListUsers_Pagination(t *testing.T) {
+	r, repo := setupRouter()
+
+	for _, p := range []string{"+989120000111", "+989120000222", "+989120000333", "+989120000444", "+989120000555"} {
+		_, _ = repo.Create(context.Background(), p)
+	}
+
+	get := func(url string) (int, repository.UserPage) {
+		req, _ := http.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var page repository.UserPage
+		_ = json.Unmarshal(w.Body.Bytes(), &page)
+		return w.Code, page
+	}
+
+	var phones []string
+	url := "/users?sort=phone&limit=2"
+	for {
+		code, page := get(url)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, 5, page.Total)
+		for _, u := range page.Users {
+			phones = append(phones, u.Phone)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		url = "/users?sort=phone&limit=2&cursor=" + page.NextCursor
+	}
+	assert.Equal(t, []string{"+989120000111", "+989120000222", "+989120000333", "+989120000444", "+989120000555"}, phones)
+
+	code, _ := get("/users?limit=abc")
+	assert.Equal(t, 400, code)
+	code, _ = get("/users?sort=name")
+	assert.Equal(t, 400, code)
+	code, _ = get("/users?cursor=garbage")
+	assert.Equal(t, 400, code)
+	code, _ = get("/users?registered_from=yesterday")
+	assert.Equal(t, 400, code)
+}
+
+func TestListUsers_RegisteredRange(t *testing.T) {
+	r, repo := setupRouter()
+	_, _ = repo.Create(context.Background(), "+989120000111")
+
+	total := func(param string, at time.Time) int {
+		// بازه با هر offset همان لحظه را نشان می‌دهد
+		ts := at.In(time.FixedZone("IRST", 3*3600+1800)).Format(time.RFC3339)
+		req, _ := http.NewRequest("GET", "/users?"+param+"="+url.QueryEscape(ts), nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, 200, w.Code, w.Body.String())
+		var page repository.UserPage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		return page.Total
+	}
+
+	assert.Equal(t, 1, total("registered_from", time.Now().Add(-time.Hour)))
+	assert.Equal(t, 0, total("registered_from", time.Now().Add(time.Hour)))
+	assert.Equal(t, 1, total("registered_before", time.Now().Add(time.Hour)))
+	assert.Equal(t, 0, total("registered_before", time.Now().Add(-time.Hour)))
 }
 
 func TestEditUser(t *testing.T) {
 	r, repo := setupRouter()
 
-	_, _ = repo.Create("+111")
+	created, _ := repo.Create(context.Background(), "+989120000111")
 
-	body := map[string]string{"new_phone": "+999"}
+	body := map[string]string{"new_phone": "+989120000999"}
 	jsonValue, _ := json.Marshal(body)
 
-	req, _ := http.NewRequest("PUT", "/users/+111", bytes.NewBuffer(jsonValue))
+	req, _ := http.NewRequest("PUT", "/users/"+created.ID, bytes.NewBuffer(jsonValue))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 
 	assert.Equal(t, 200, w.Code)
 
-	user, err := repo.GetByPhone("+999")
+	user, err := repo.GetByPhone(context.Background(), "+989120000999")
 	assert.NoError(t, err)
-	assert.Equal(t, "+999", user.Phone)
+	assert.Equal(t, created.ID, user.ID, "id must survive a phone change")
+
+	other, _ := repo.Create(context.Background(), "+989120000222")
+	req, _ = http.NewRequest("PUT", "/users/"+other.ID, bytes.NewBufferString(`{"new_phone":"+989120000999"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, 409, w.Code)
+}
+
+func TestPhoneHistory(t *testing.T) {
+	r, repo := setupRouter()
+
+	created, _ := repo.Create(context.Background(), "+989120000111")
+	admin := repository.NewID()
+	assert.NoError(t, repo.UpdatePhone(context.Background(), created.ID, "+989120000999", repository.PhoneChangeAdmin, admin))
+
+	req, _ := http.NewRequest("GET", "/users/"+created.ID+"/phone-history", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	var resp struct {
+		History []repository.PhoneChange `json:"history"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	if assert.Len(t, resp.History, 1) {
+		assert.Equal(t, "+989120000111", resp.History[0].OldPhone)
+		assert.Equal(t, "+989120000999", resp.History[0].NewPhone)
+		assert.Equal(t, repository.PhoneChangeAdmin, resp.History[0].Method)
+		assert.Equal(t, admin, resp.History[0].ChangedBy)
+	}
+
+	req, _ = http.NewRequest("GET", "/users/"+repository.NewID()+"/phone-history", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, 404, w.Code)
 }
 
 func TestDeleteUser(t *testing.T) {
 	r, repo := setupRouter()
 
-	_, _ = repo.Create("+111")
+	user, _ := repo.Create(context.Background(), "+989120000111")
+
+	req, _ := http.NewRequest("DELETE", "/users/"+user.ID, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+
+	_, err := repo.GetByPhone(context.Background(), "+989120000111")
+	assert.ErrorIs(t, err, repository.ErrUserDeleted)
+}
+
+func TestRestoreAndPurgeUser(t *testing.T) {
+	revoker := &fakeRevoker{}
+	userRepo := repository.NewInMemoryUserRepository()
+	h := NewUserHandler(userRepo, WithTokenRevoker(revoker))
+	r := gin.Default()
+	r.Use(middleware.Errors())
+	r.GET("/users", h.ListUsers)
+	r.POST("/users/:id/restore", h.RestoreUser)
+	r.POST("/users/:id/purge", h.PurgeUser)
+
+	user, _ := userRepo.Create(context.Background(), "+989120000111")
+	_, _ = userRepo.Create(context.Background(), "+989120000222")
+
+	post := func(path string) int {
+		req, _ := http.NewRequest("POST", path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, 409, post("/users/"+user.ID+"/restore"))
+	assert.NoError(t, userRepo.Delete(context.Background(), user.ID))
+
+	req, _ := http.NewRequest("GET", "/users?deleted=true", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var page repository.UserPage
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	if assert.Len(t, page.Users, 1) {
+		assert.Equal(t, user.ID, page.Users[0].ID)
+	}
+
+	assert.Equal(t, 200, post("/users/"+user.ID+"/restore"))
+	_, err := userRepo.GetByID(context.Background(), user.ID)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 200, post("/users/"+user.ID+"/purge"))
+	assert.Equal(t, 404, post("/users/"+user.ID+"/restore"))
+	assert.Equal(t, []string{user.ID}, revoker.revoked)
+}
+
+type fakeRevoker struct {
+	revoked []string
+}
+
+func (f *fakeRevoker) RevokeAll(_ context.Context, phone string) error {
+	f.revoked = append(f.revoked, phone)
+	return nil
+}
+
+func TestDeleteUser_RevokesTokens(t *testing.T) {
+	revoker := &fakeRevoker{}
+	userRepo := repository.NewInMemoryUserRepository()
+	h := NewUserHandler(userRepo, WithTokenRevoker(revoker))
+	r := gin.Default()
+	r.Use(middleware.Errors())
+	r.DELETE("/users/:id", h.DeleteUser)
+
+	user, _ := userRepo.Create(context.Background(), "+989120000111")
 
-	req, _ := http.NewRequest("DELETE", "/users/+111", nil)
+	req, _ := http.NewRequest("DELETE", "/users/"+user.ID, nil)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 
 	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, []string{user.ID}, revoker.revoked)
+}
+
+func TestSetRole(t *testing.T) {
+	revoker := &fakeRevoker{}
+	userRepo := repository.NewInMemoryUserRepository()
+	h := NewUserHandler(userRepo, WithTokenRevoker(revoker))
+	r := gin.Default()
+	r.Use(middleware.Errors())
+	r.PUT("/users/:id/role", h.SetRole)
+
+	created, _ := userRepo.Create(context.Background(), "+989120000111")
+
+	put := func(id, body string) int {
+		req, _ := http.NewRequest("PUT", "/users/"+id+"/role", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, 400, put(created.ID, `{"role":"root"}`))
+	assert.Equal(t, 404, put(repository.NewID(), `{"role":"admin"}`))
+	assert.Equal(t, 200, put(created.ID, `{"role":"support"}`))
+
+	user, _ := userRepo.GetByID(context.Background(), created.ID)
+	assert.Equal(t, repository.RoleSupport, user.Role)
+	assert.Equal(t, []string{created.ID}, revoker.revoked)
+}
+
+func TestUpdateProfile(t *testing.T) {
+	userRepo := repository.NewInMemoryUserRepository()
+	h := NewUserHandler(userRepo)
+	r := gin.Default()
+	r.Use(middleware.Errors())
+	created, _ := userRepo.Create(context.Background(), "+989120000111")
+	r.PATCH("/profile", func(c *gin.Context) { c.Set("user_id", created.ID) }, h.UpdateProfile)
+
+	patch := func(body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("PATCH", "/profile", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := patch(`{"display_name":"Amin","timezone":"Asia/Tehran","metadata":{"theme":"dark"}}`)
+	assert.Equal(t, 200, w.Code)
+
+	// فیلدهای ارسال‌نشده نباید تغییر کنند
+	w = patch(`{"locale":"fa-IR"}`)
+	assert.Equal(t, 200, w.Code)
+	// کلیدهای پاسخ همان snake_case بدنه‌ی درخواست‌اند
+	var resp map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.JSONEq(t, `"Amin"`, string(resp["display_name"]))
+	assert.JSONEq(t, `"Asia/Tehran"`, string(resp["timezone"]))
+	assert.JSONEq(t, `"fa-IR"`, string(resp["locale"]))
+	assert.JSONEq(t, `{"theme":"dark"}`, string(resp["metadata"]))
+	assert.JSONEq(t, `"`+created.ID+`"`, string(resp["id"]))
+	for _, key := range []string{"phone", "role", "email", "avatar_url", "registration_date", "updated_at"} {
+		assert.Contains(t, resp, key)
+	}
+	for _, key := range []string{"DisplayName", "Metadata", "deleted_at", "block"} {
+		assert.NotContains(t, resp, key)
+	}
+
+	assert.Equal(t, 400, patch(`{"email":"not-an-email"}`).Code)
+	assert.Equal(t, 400, patch(`{"timezone":"Mars/Olympus"}`).Code)
+	assert.Equal(t, 400, patch(`{"metadata":[1,2]}`).Code)
+	assert.Equal(t, 400, patch(`{}`).Code)
 
-	_, err := repo.GetByPhone("+111")
-	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+	user, _ := userRepo.GetByPhone(context.Background(), "+989120000111")
+	assert.Equal(t, "", user.Email)
 }
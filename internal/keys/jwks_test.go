@@ -0,0 +1,52 @@
+package keys
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decode(t *testing.T, s string) []byte {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+func TestJWKS_PublishesPublicKeys(t *testing.T) {
+	for _, alg := range []Algorithm{RS256, ES256, EdDSA} {
+		t.Run(string(alg), func(t *testing.T) {
+			m, err := NewManager(alg)
+			require.NoError(t, err)
+			key := m.Keys()[0]
+
+			set := m.JWKS()
+			require.Len(t, set.Keys, 1)
+			jwk := set.Keys[0]
+			assert.Equal(t, key.ID, jwk.Kid)
+			assert.Equal(t, string(alg), jwk.Alg)
+			assert.Equal(t, "sig", jwk.Use)
+
+			switch pub := key.public.(type) {
+			case *rsa.PublicKey:
+				assert.Equal(t, "RSA", jwk.Kty)
+				assert.Equal(t, pub.N, new(big.Int).SetBytes(decode(t, jwk.N)))
+				assert.Equal(t, int64(pub.E), new(big.Int).SetBytes(decode(t, jwk.E)).Int64())
+			case *ecdsa.PublicKey:
+				assert.Equal(t, "EC", jwk.Kty)
+				assert.Equal(t, "P-256", jwk.Crv)
+				assert.Len(t, decode(t, jwk.X), 32)
+				assert.Equal(t, pub.X, new(big.Int).SetBytes(decode(t, jwk.X)))
+				assert.Equal(t, pub.Y, new(big.Int).SetBytes(decode(t, jwk.Y)))
+			case ed25519.PublicKey:
+				assert.Equal(t, "OKP", jwk.Kty)
+				assert.Equal(t, []byte(pub), decode(t, jwk.X))
+			}
+		})
+	}
+}
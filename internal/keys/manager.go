@@ -0,0 +1,320 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Algorithm is a JWS signing algorithm supported by Manager.
+type Algorithm string
+
+const (
+	HS256 Algorithm = "HS256"
+	RS256 Algorithm = "RS256"
+	ES256 Algorithm = "ES256"
+	EdDSA Algorithm = "EdDSA"
+)
+
+var (
+	ErrUnknownKey        = errors.New("unknown signing key")
+	ErrAlgorithmMismatch = errors.New("token algorithm does not match key")
+	ErrUnsupportedAlg    = errors.New("unsupported signing algorithm")
+	ErrNoSigningKey      = errors.New("no active signing key")
+)
+
+// Key is one signing key. Retired keys keep verifying tokens until NotAfter.
+type Key struct {
+	ID        string
+	Algorithm Algorithm
+	CreatedAt time.Time
+	NotAfter  time.Time // zero while the key is active
+
+	private interface{} // crypto.Signer, or []byte for HS256
+	public  interface{} // crypto.PublicKey, or []byte for HS256
+}
+
+func (k *Key) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(string(k.Algorithm))
+}
+
+// Manager owns the set of keys used to sign and verify JWTs. The newest key signs;
+// previous keys stay available for verification for the retention period, so
+// rotation never invalidates tokens that are still within their lifetime.
+type Manager struct {
+	mu        sync.RWMutex
+	alg       Algorithm
+	keys      map[string]*Key
+	signing   *Key
+	retention time.Duration
+	dir       string
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Option configures a Manager.
+type Option func(*Manager)
+
+// WithRetention sets how long a rotated-out key keeps verifying tokens.
+// It should be at least the access token lifetime. Defaults to 24 hours.
+func WithRetention(d time.Duration) Option {
+	return func(m *Manager) { m.retention = d }
+}
+
+// WithKeyDir loads PEM private keys from dir instead of generating them. The file name
+// (without extension) is the kid and the lexically last file signs, so date-prefixed
+// names like 2026-10-01.pem rotate naturally. Rotate re-reads the directory.
+func WithKeyDir(dir string) Option {
+	return func(m *Manager) { m.dir = dir }
+}
+
+// NewManager creates a manager for an asymmetric algorithm with an initial key.
+func NewManager(alg Algorithm, opts ...Option) (*Manager, error) {
+	if alg == HS256 {
+		return nil, fmt.Errorf("%w: use NewHMACManager for HS256", ErrUnsupportedAlg)
+	}
+	m := &Manager{
+		alg:       alg,
+		keys:      make(map[string]*Key),
+		retention: 24 * time.Hour,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if err := m.Rotate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// NewHMACManager wraps a shared secret. Its tokens cannot be verified by other services
+// without the secret, and JWKS stays empty.
+func NewHMACManager(secret []byte) *Manager {
+	k := &Key{ID: "hs256", Algorithm: HS256, CreatedAt: time.Now(), private: secret, public: secret}
+	return &Manager{
+		alg:     HS256,
+		keys:    map[string]*Key{k.ID: k},
+		signing: k,
+	}
+}
+
+// Algorithm reports the algorithm of the signing key.
+func (m *Manager) Algorithm() Algorithm {
+	return m.alg
+}
+
+// Sign signs claims with the current key and sets the kid header.
+func (m *Manager) Sign(claims jwt.Claims) (string, error) {
+	m.mu.RLock()
+	k := m.signing
+	m.mu.RUnlock()
+	if k == nil {
+		return "", ErrNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(k.method(), claims)
+	token.Header["kid"] = k.ID
+	return token.SignedString(k.private)
+}
+
+// Keyfunc resolves the verification key for token by its kid header.
+func (m *Manager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var k *Key
+	if kid, ok := token.Header["kid"].(string); ok {
+		k = m.keys[kid]
+	} else if m.alg == HS256 {
+		// توکن‌های قدیمی بدون kid که با secret مشترک امضا شده‌اند
+		k = m.signing
+	}
+	if k == nil || (!k.NotAfter.IsZero() && time.Now().After(k.NotAfter)) {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != string(k.Algorithm) {
+		return nil, ErrAlgorithmMismatch
+	}
+	return k.public, nil
+}
+
+// ValidMethods lists the algorithms a parser should accept for tokens from this manager.
+func (m *Manager) ValidMethods() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	seen := map[string]bool{}
+	methods := []string{}
+	for _, k := range m.keys {
+		if alg := string(k.Algorithm); !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// Keys returns a snapshot of the keys currently usable for verification, oldest first.
+func (m *Manager) Keys() []*Key {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	out := make([]*Key, 0, len(m.keys))
+	for _, k := range m.keys {
+		if k.NotAfter.IsZero() || now.Before(k.NotAfter) {
+			out = append(out, k)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+// Rotate installs a new signing key (generated, or re-read from the key directory),
+// retires the previous one and drops keys whose retention has passed.
+func (m *Manager) Rotate() error {
+	if m.alg == HS256 {
+		return nil
+	}
+	if m.dir != "" {
+		return m.reloadDir()
+	}
+
+	k, err := generateKey(m.alg)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if m.signing != nil {
+		m.signing.NotAfter = now.Add(m.retention)
+	}
+	m.keys[k.ID] = k
+	m.signing = k
+	m.pruneLocked(now)
+	return nil
+}
+
+func (m *Manager) reloadDir() error {
+	loaded, err := LoadDir(m.dir)
+	if err != nil {
+		return err
+	}
+	if len(loaded) == 0 {
+		return fmt.Errorf("%w: no keys in %s", ErrNoSigningKey, m.dir)
+	}
+	signing := loaded[len(loaded)-1]
+	if signing.Algorithm != m.alg {
+		return fmt.Errorf("%w: newest key %s is %s, configured %s", ErrAlgorithmMismatch, signing.ID, signing.Algorithm, m.alg)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	present := map[string]bool{}
+	for _, k := range loaded {
+		present[k.ID] = true
+		if _, exists := m.keys[k.ID]; !exists {
+			m.keys[k.ID] = k
+		}
+	}
+	// کلیدهایی که از دایرکتوری حذف شده‌اند تا پایان retention معتبر می‌مانند
+	for id, k := range m.keys {
+		if !present[id] && k.NotAfter.IsZero() {
+			k.NotAfter = now.Add(m.retention)
+		}
+	}
+	m.signing = m.keys[signing.ID]
+	m.pruneLocked(now)
+	return nil
+}
+
+func (m *Manager) pruneLocked(now time.Time) {
+	for id, k := range m.keys {
+		if !k.NotAfter.IsZero() && now.After(k.NotAfter) {
+			delete(m.keys, id)
+		}
+	}
+}
+
+// StartRotation rotates keys every interval until Close is called.
+func (m *Manager) StartRotation(interval time.Duration, onError func(error)) {
+	if interval <= 0 || m.stop != nil {
+		return
+	}
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := m.Rotate(); err != nil && onError != nil {
+					onError(err)
+				}
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops scheduled rotation.
+func (m *Manager) Close() error {
+	m.closeOnce.Do(func() {
+		if m.stop != nil {
+			close(m.stop)
+			<-m.done
+		}
+	})
+	return nil
+}
+
+func generateKey(alg Algorithm) (*Key, error) {
+	var priv crypto.Signer
+	var err error
+	switch alg {
+	case RS256:
+		priv, err = rsa.GenerateKey(rand.Reader, 2048)
+	case ES256:
+		priv, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case EdDSA:
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlg, alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &Key{
+		ID:        now.UTC().Format("20060102T150405") + "-" + hex.EncodeToString(id),
+		Algorithm: alg,
+		CreatedAt: now,
+		private:   priv,
+		public:    priv.Public(),
+	}, nil
+}
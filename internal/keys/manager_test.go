@@ -0,0 +1,119 @@
+package keys
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parse(m *Manager, token string) (*jwt.Token, error) {
+	return jwt.Parse(token, m.Keyfunc, jwt.WithValidMethods(m.ValidMethods()))
+}
+
+func TestManager_SignAndVerify(t *testing.T) {
+	for _, alg := range []Algorithm{RS256, ES256, EdDSA} {
+		t.Run(string(alg), func(t *testing.T) {
+			m, err := NewManager(alg)
+			require.NoError(t, err)
+
+			signed, err := m.Sign(jwt.MapClaims{"phone": "+1", "exp": time.Now().Add(time.Minute).Unix()})
+			require.NoError(t, err)
+
+			token, err := parse(m, signed)
+			require.NoError(t, err)
+			assert.Equal(t, string(alg), token.Method.Alg())
+			assert.NotEmpty(t, token.Header["kid"])
+		})
+	}
+}
+
+func TestManager_HMAC(t *testing.T) {
+	m := NewHMACManager([]byte("secret"))
+
+	signed, err := m.Sign(jwt.MapClaims{"phone": "+1"})
+	require.NoError(t, err)
+	_, err = parse(m, signed)
+	require.NoError(t, err)
+
+	// توکن قدیمی بدون kid هنوز پذیرفته می‌شود
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"phone": "+1"}).SignedString([]byte("secret"))
+	require.NoError(t, err)
+	_, err = parse(m, legacy)
+	require.NoError(t, err)
+
+	assert.Empty(t, m.JWKS().Keys)
+}
+
+func TestManager_RotationKeepsOldKeysDuringRetention(t *testing.T) {
+	m, err := NewManager(ES256, WithRetention(time.Hour))
+	require.NoError(t, err)
+
+	old, err := m.Sign(jwt.MapClaims{"phone": "+1"})
+	require.NoError(t, err)
+
+	require.NoError(t, m.Rotate())
+
+	fresh, err := m.Sign(jwt.MapClaims{"phone": "+1"})
+	require.NoError(t, err)
+
+	oldToken, err := parse(m, old)
+	require.NoError(t, err)
+	freshToken, err := parse(m, fresh)
+	require.NoError(t, err)
+	assert.NotEqual(t, oldToken.Header["kid"], freshToken.Header["kid"])
+	assert.Len(t, m.JWKS().Keys, 2)
+}
+
+func TestManager_RotationDropsExpiredKeys(t *testing.T) {
+	m, err := NewManager(EdDSA, WithRetention(time.Millisecond))
+	require.NoError(t, err)
+	oldKid := m.Keys()[0].ID
+
+	old, err := m.Sign(jwt.MapClaims{"phone": "+1"})
+	require.NoError(t, err)
+
+	require.NoError(t, m.Rotate())
+	time.Sleep(5 * time.Millisecond)
+
+	_, err = parse(m, old)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	// چرخش بعدی کلید منقضی را کاملاً حذف می‌کند
+	require.NoError(t, m.Rotate())
+	m.mu.RLock()
+	_, exists := m.keys[oldKid]
+	m.mu.RUnlock()
+	assert.False(t, exists)
+}
+
+func TestManager_RejectsAlgorithmConfusion(t *testing.T) {
+	m, err := NewManager(RS256)
+	require.NoError(t, err)
+	kid := m.Keys()[0].ID
+
+	// توکن HS256 با همان kid نباید پذیرفته شود
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"phone": "+1"})
+	forged.Header["kid"] = kid
+	signed, err := forged.SignedString([]byte("whatever"))
+	require.NoError(t, err)
+
+	_, err = jwt.Parse(signed, m.Keyfunc)
+	assert.ErrorIs(t, err, ErrAlgorithmMismatch)
+}
+
+func TestManager_ScheduledRotation(t *testing.T) {
+	m, err := NewManager(ES256)
+	require.NoError(t, err)
+	first := m.Keys()[0].ID
+
+	m.StartRotation(20*time.Millisecond, nil)
+	defer m.Close()
+
+	assert.Eventually(t, func() bool {
+		keys := m.Keys()
+		return keys[len(keys)-1].ID != first
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,86 @@
+package keys
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeKey(t *testing.T, dir, name string, key interface{}) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o600))
+}
+
+func TestLoadPEMKey_InfersAlgorithm(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	writeKey(t, dir, "a-rsa.pem", rsaKey)
+	writeKey(t, dir, "b-ec.pem", ecKey)
+	writeKey(t, dir, "c-ed.pem", edKey)
+
+	loaded, err := LoadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, loaded, 3)
+	assert.Equal(t, "a-rsa", loaded[0].ID)
+	assert.Equal(t, RS256, loaded[0].Algorithm)
+	assert.Equal(t, ES256, loaded[1].Algorithm)
+	assert.Equal(t, EdDSA, loaded[2].Algorithm)
+}
+
+func TestManager_KeyDirRotation(t *testing.T) {
+	dir := t.TempDir()
+	first, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	writeKey(t, dir, "2026-01-01.pem", first)
+
+	m, err := NewManager(ES256, WithKeyDir(dir))
+	require.NoError(t, err)
+
+	old, err := m.Sign(jwt.MapClaims{"phone": "+1"})
+	require.NoError(t, err)
+
+	second, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	writeKey(t, dir, "2026-02-01.pem", second)
+	require.NoError(t, os.Remove(filepath.Join(dir, "2026-01-01.pem")))
+	require.NoError(t, m.Rotate())
+
+	fresh, err := m.Sign(jwt.MapClaims{"phone": "+1"})
+	require.NoError(t, err)
+	token, err := parse(m, fresh)
+	require.NoError(t, err)
+	assert.Equal(t, "2026-02-01", token.Header["kid"])
+
+	// کلید حذف‌شده تا پایان retention معتبر است
+	_, err = parse(m, old)
+	assert.NoError(t, err)
+}
+
+func TestManager_KeyDirAlgorithmMismatch(t *testing.T) {
+	dir := t.TempDir()
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	writeKey(t, dir, "k.pem", edKey)
+
+	_, err = NewManager(RS256, WithKeyDir(dir))
+	assert.ErrorIs(t, err, ErrAlgorithmMismatch)
+}
@@ -0,0 +1,136 @@
+// Package logging builds the service's slog logger and carries request-scoped loggers in contexts.
+package logging
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+)
+
+// Redacted replaces the value of secret attributes.
+const Redacted = "[REDACTED]"
+
+// secretKeys are never written; matched case-insensitively against attribute keys.
+var secretKeys = map[string]bool{
+	"otp":           true,
+	"code":          true,
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"authorization": true,
+	"secret":        true,
+	"password":      true,
+}
+
+// phoneKeys are written as PhoneHash under "<key>_hash" so requests of one number can still be correlated.
+var phoneKeys = map[string]bool{
+	"phone":     true,
+	"new_phone": true,
+}
+
+// Options configures New.
+type Options struct {
+	// Level is debug, info, warn or error. Defaults to info.
+	Level string
+	// Format is json or text. Defaults to json.
+	Format string
+}
+
+// New returns a logger writing to w with OTPs, tokens and phone numbers redacted.
+func New(w io.Writer, opts Options) (*slog.Logger, error) {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	hopts := &slog.HandlerOptions{Level: level, ReplaceAttr: redact}
+
+	switch opts.Format {
+	case "", "json":
+		return slog.New(slog.NewJSONHandler(w, hopts)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(w, hopts)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", opts.Format)
+}
+
+// ParseLevel reads debug, info, warn or error. An empty string is info.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+	return level, nil
+}
+
+// phoneHashKey keys PhoneHash. Phone numbers are few enough to enumerate, so a plain hash of
+// one could be reversed by hashing every number.
+var phoneHashKey atomic.Pointer[[]byte]
+
+// SetPhoneHashKey sets the secret PhoneHash is keyed with. Call it once at startup, before
+// anything is logged or audited; hashes made under another key do not match.
+func SetPhoneHashKey(key []byte) {
+	key = append([]byte(nil), key...)
+	phoneHashKey.Store(&key)
+}
+
+// PhoneHash is a stable stand-in for a phone number in logs and the audit log: an HMAC-SHA256
+// of the number under the key from SetPhoneHashKey.
+func PhoneHash(phone string) string {
+	if phone == "" {
+		return ""
+	}
+	var key []byte
+	if k := phoneHashKey.Load(); k != nil {
+		key = *k
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(phone))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+func redact(_ []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	switch {
+	case secretKeys[key]:
+		return slog.String(a.Key, Redacted)
+	case phoneKeys[key]:
+		return slog.String(a.Key+"_hash", PhoneHash(a.Value.String()))
+	}
+	return a
+}
+
+type ctxKey struct{}
+
+// WithLogger returns a copy of ctx carrying l.
+func WithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext returns the logger stored by WithLogger, or slog.Default().
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(ctxKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// With returns a copy of ctx whose logger also carries args, e.g. With(ctx, "user_id", id).
+func With(ctx context.Context, args ...any) context.Context {
+	return WithLogger(ctx, FromContext(ctx).With(args...))
+}
+
+// Printf adapts l to printf-style loggers such as the migrations runner.
+func Printf(l *slog.Logger) func(format string, args ...any) {
+	return func(format string, args ...any) {
+		l.Info(fmt.Sprintf(format, args...))
+	}
+}
@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_RedactsSecretsAndPhones(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, Options{Level: "info"})
+	require.NoError(t, err)
+
+	logger.With("phone", "+989121234567").Info("login",
+		"otp", "123456", "refresh_token", "abc", "Authorization", "Bearer xyz", "user_id", "u1")
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, Redacted, line["otp"])
+	assert.Equal(t, Redacted, line["refresh_token"])
+	assert.Equal(t, Redacted, line["Authorization"])
+	assert.Equal(t, "u1", line["user_id"])
+	assert.Equal(t, PhoneHash("+989121234567"), line["phone_hash"])
+	assert.NotContains(t, buf.String(), "+989121234567")
+	assert.NotContains(t, buf.String(), "123456")
+}
+
+func TestNew_LevelAndFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, Options{Level: "warn", Format: "text"})
+	require.NoError(t, err)
+
+	logger.Info("hidden")
+	logger.Warn("shown")
+	assert.NotContains(t, buf.String(), "hidden")
+	assert.Contains(t, buf.String(), "msg=shown")
+
+	_, err = New(&buf, Options{Level: "loud"})
+	assert.Error(t, err)
+	_, err = New(&buf, Options{Format: "xml"})
+	assert.Error(t, err)
+}
+
+func TestPhoneHash(t *testing.T) {
+	assert.Equal(t, PhoneHash("+989121234567"), PhoneHash("+989121234567"))
+	assert.NotEqual(t, PhoneHash("+989121234567"), PhoneHash("+989121234568"))
+	assert.Len(t, PhoneHash("+989121234567"), 32)
+	assert.Equal(t, "", PhoneHash(""))
+
+	// بدون کلید نمی‌توان hash را با شمردن همه‌ی شماره‌ها برگرداند
+	before := PhoneHash("+989121234567")
+	SetPhoneHashKey([]byte("another key"))
+	t.Cleanup(func() { SetPhoneHashKey(nil) })
+	assert.NotEqual(t, before, PhoneHash("+989121234567"))
+}
+
+func TestFromContext(t *testing.T) {
+	assert.Same(t, slog.Default(), FromContext(context.Background()))
+
+	var buf bytes.Buffer
+	logger, _ := New(&buf, Options{})
+	ctx := With(WithLogger(context.Background(), logger), "request_id", "r1")
+	FromContext(ctx).Info("hello")
+	assert.Contains(t, buf.String(), `"request_id":"r1"`)
+}
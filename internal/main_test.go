@@ -49,7 +49,7 @@ func setupRouterWithPostgres(t *testing.T) *gin.Engine {
 	cache := cache.NewInMemoryCache()
 	otpService := service.NewOtpService(cache, userRepo, secretKey)
 
-	authHandler := handler.NewAuthHandler(otpService)
+	authHandler := handler.NewAuthHandler(otpService, handler.WithDevMode(true))
 	userHandler := handler.NewUserHandler(userRepo)
 
 	r.POST("/auth/request-otp", authHandler.RequestOTP)
@@ -97,11 +97,12 @@ func TestEndToEndPostgres(t *testing.T) {
 		t.Fatalf("validate-otp failed: status=%d body=%s", w.Code, w.Body.String())
 	}
 
-	var valResp map[string]string
+	var valResp map[string]interface{}
 	err = json.Unmarshal(w.Body.Bytes(), &valResp)
 	require.NoError(t, err)
-	token := valResp["token"]
+	token, _ := valResp["token"].(string)
 	require.NotEmpty(t, token)
+	require.NotEmpty(t, valResp["refresh_token"])
 
 	// 3. Request profile
 	req = httptest.NewRequest("GET", "/profile", nil)
@@ -114,7 +115,7 @@ func TestEndToEndPostgres(t *testing.T) {
 	err = json.Unmarshal(w.Body.Bytes(), &userResp)
 	require.NoError(t, err)
 
-	phoneResp, ok := userResp["Phone"].(string)
+	phoneResp, ok := userResp["phone"].(string)
 	require.True(t, ok)
 	assert.Equal(t, phone, phoneResp)
 }
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"user-go/internal/cache"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CacheStats is implemented by caches that keep their own counters, like cache.InMemoryCache.
+type CacheStats interface {
+	Stats() cache.Stats
+}
+
+// cacheCollector reads the cache counters at scrape time, so Get and Set stay free of metric calls.
+type cacheCollector struct {
+	source  CacheStats
+	hits    *prometheus.Desc
+	misses  *prometheus.Desc
+	evicted *prometheus.Desc
+	expired *prometheus.Desc
+	entries *prometheus.Desc
+}
+
+// NewCacheCollector exports the hits, misses, evictions, expirations and size of c,
+// labelled with backend.
+func NewCacheCollector(backend string, c CacheStats) prometheus.Collector {
+	labels := prometheus.Labels{"backend": backend}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "cache", name), help, nil, labels)
+	}
+	return &cacheCollector{
+		source:  c,
+		hits:    desc("hits_total", "Cache reads that found a live key."),
+		misses:  desc("misses_total", "Cache reads that found no key or an expired one."),
+		evicted: desc("evictions_total", "Keys evicted to stay within the size limit."),
+		expired: desc("expired_total", "Keys dropped after their TTL."),
+		entries: desc("entries", "Keys currently stored."),
+	}
+}
+
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.evicted
+	ch <- c.expired
+	ch <- c.entries
+}
+
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.source.Stats()
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(s.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(s.Misses))
+	ch <- prometheus.MustNewConstMetric(c.evicted, prometheus.CounterValue, float64(s.Evictions))
+	ch <- prometheus.MustNewConstMetric(c.expired, prometheus.CounterValue, float64(s.Expired))
+	ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(s.Size))
+}
@@ -0,0 +1,145 @@
+// Package metrics defines the service's Prometheus metrics. A nil *Metrics records nothing,
+// so instrumented code does not need to check whether metrics are enabled.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "user_go"
+
+// Metrics holds every collector recorded outside of scrape time.
+type Metrics struct {
+	otpRequested    prometheus.Counter
+	otpSent         *prometheus.CounterVec
+	otpDeliveryFail *prometheus.CounterVec
+	otpValidated    prometheus.Counter
+	otpFailures     *prometheus.CounterVec
+	rateLimited     *prometheus.CounterVec
+	tokensIssued    *prometheus.CounterVec
+	tokenFailures   *prometheus.CounterVec
+	queryDuration   *prometheus.HistogramVec
+	httpDuration    *prometheus.HistogramVec
+}
+
+// New creates the metrics and registers them with reg.
+func New(reg prometheus.Registerer) *Metrics {
+	f := promauto.With(reg)
+	return &Metrics{
+		otpRequested: f.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace, Name: "otp_requested_total",
+			Help: "OTP codes requested, for login or a phone change.",
+		}),
+		otpSent: f.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "otp_sent_total",
+			Help: "OTP codes handed to the sender successfully.",
+		}, []string{"channel"}),
+		otpDeliveryFail: f.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "otp_delivery_failures_total",
+			Help: "OTP codes the sender failed to deliver.",
+		}, []string{"channel"}),
+		otpValidated: f.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace, Name: "otp_validated_total",
+			Help: "OTP codes validated successfully.",
+		}),
+		otpFailures: f.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "otp_validation_failures_total",
+			Help: "OTP validations that failed, by reason.",
+		}, []string{"reason"}),
+		rateLimited: f.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "rate_limit_rejections_total",
+			Help: "Requests rejected by a rate limit or lockout, by limit.",
+		}, []string{"limit"}),
+		tokensIssued: f.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "tokens_issued_total",
+			Help: "Token pairs issued, by kind (login or refresh).",
+		}, []string{"kind"}),
+		tokenFailures: f.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "token_validation_failures_total",
+			Help: "Access and refresh tokens rejected, by reason.",
+		}, []string{"reason"}),
+		queryDuration: f.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Name: "repository_query_duration_seconds",
+			Help:    "Duration of user repository calls, by method.",
+			Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"method"}),
+		httpDuration: f.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Name: "http_request_duration_seconds",
+			Help:    "Duration of HTTP requests, by method, gin route and status.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+	}
+}
+
+// Handler serves the metrics gathered by g in the Prometheus text format.
+func Handler(g prometheus.Gatherer) http.Handler {
+	return promhttp.HandlerFor(g, promhttp.HandlerOpts{})
+}
+
+func (m *Metrics) OTPRequested() {
+	if m != nil {
+		m.otpRequested.Inc()
+	}
+}
+
+func (m *Metrics) OTPSent(channel string) {
+	if m != nil {
+		m.otpSent.WithLabelValues(channel).Inc()
+	}
+}
+
+func (m *Metrics) OTPDeliveryFailed(channel string) {
+	if m != nil {
+		m.otpDeliveryFail.WithLabelValues(channel).Inc()
+	}
+}
+
+func (m *Metrics) OTPValidated() {
+	if m != nil {
+		m.otpValidated.Inc()
+	}
+}
+
+func (m *Metrics) OTPValidationFailed(reason string) {
+	if m != nil {
+		m.otpFailures.WithLabelValues(reason).Inc()
+	}
+}
+
+func (m *Metrics) RateLimited(limit string) {
+	if m != nil {
+		m.rateLimited.WithLabelValues(limit).Inc()
+	}
+}
+
+func (m *Metrics) TokenIssued(kind string) {
+	if m != nil {
+		m.tokensIssued.WithLabelValues(kind).Inc()
+	}
+}
+
+func (m *Metrics) TokenRejected(reason string) {
+	if m != nil {
+		m.tokenFailures.WithLabelValues(reason).Inc()
+	}
+}
+
+// ObserveQuery records a repository call of method that started at start.
+func (m *Metrics) ObserveQuery(method string, start time.Time) {
+	if m != nil {
+		m.queryDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveHTTP records a request to route that took d.
+func (m *Metrics) ObserveHTTP(method, route string, status int, d time.Duration) {
+	if m != nil {
+		m.httpDuration.WithLabelValues(method, route, strconv.Itoa(status)).Observe(d.Seconds())
+	}
+}
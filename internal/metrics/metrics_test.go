@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"user-go/internal/cache"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNilMetricsRecordNothing(t *testing.T) {
+	var m *Metrics
+	assert.NotPanics(t, func() {
+		m.OTPRequested()
+		m.OTPSent("sms")
+		m.OTPDeliveryFailed("sms")
+		m.OTPValidated()
+		m.OTPValidationFailed("invalid")
+		m.RateLimited("otp_request")
+		m.TokenIssued("login")
+		m.TokenRejected("expired")
+		m.ObserveQuery("GetByID", time.Now())
+		m.ObserveHTTP("GET", "/users/:id", 200, time.Millisecond)
+	})
+}
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := New(reg)
+
+	m.OTPRequested()
+	m.OTPSent("sms")
+	m.OTPValidationFailed("invalid")
+	m.OTPValidationFailed("invalid")
+	m.TokenRejected("revoked")
+	m.ObserveQuery("GetByID", time.Now())
+	m.ObserveHTTP("GET", "/users/:id", 404, time.Millisecond)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.otpRequested))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.otpSent.WithLabelValues("sms")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.otpFailures.WithLabelValues("invalid")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.tokenFailures.WithLabelValues("revoked")))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.queryDuration, "user_go_repository_query_duration_seconds"))
+
+	rec := httptest.NewRecorder()
+	Handler(reg).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `user_go_http_request_duration_seconds_count{method="GET",route="/users/:id",status="404"} 1`)
+}
+
+func TestCacheCollector(t *testing.T) {
+	c := cache.NewInMemoryCache(cache.WithCleanupInterval(0))
+	ctx := context.Background()
+	require.NoError(t, c.SetWithTTL(ctx, "a", "1", 60))
+	_, _ = c.Get(ctx, "a")
+	_, _ = c.Get(ctx, "missing")
+
+	expected := `
+# HELP user_go_cache_entries Keys currently stored.
+# TYPE user_go_cache_entries gauge
+user_go_cache_entries{backend="memory"} 1
+# HELP user_go_cache_hits_total Cache reads that found a live key.
+# TYPE user_go_cache_hits_total counter
+user_go_cache_hits_total{backend="memory"} 1
+# HELP user_go_cache_misses_total Cache reads that found no key or an expired one.
+# TYPE user_go_cache_misses_total counter
+user_go_cache_misses_total{backend="memory"} 1
+`
+	err := testutil.CollectAndCompare(NewCacheCollector("memory", c), strings.NewReader(expected),
+		"user_go_cache_entries", "user_go_cache_hits_total", "user_go_cache_misses_total")
+	assert.NoError(t, err)
+}
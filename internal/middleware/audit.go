@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"user-go/internal/audit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditClient stores the client IP and User-Agent in the request context for audit events.
+func AuditClient() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client := audit.Client{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+		c.Request = c.Request.WithContext(audit.WithClient(c.Request.Context(), client))
+		c.Next()
+	}
+}
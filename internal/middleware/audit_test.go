@@ -0,0 +1,27 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"user-go/internal/audit"
+	"user-go/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditClient(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var got audit.Client
+	router := gin.New()
+	router.Use(middleware.AuditClient())
+	router.GET("/", func(c *gin.Context) { got = audit.ClientFrom(c.Request.Context()) })
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.7:51234"
+	req.Header.Set("User-Agent", "app/1.2")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, audit.Client{IP: "203.0.113.7", UserAgent: "app/1.2"}, got)
+}
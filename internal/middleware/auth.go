@@ -2,56 +2,182 @@
 package middleware
 
 import (
-	"net/http"
+	"context"
+	"errors"
+	"fmt"
 	"strings"
+	"user-go/internal/keys"
+	"user-go/internal/logging"
+	"user-go/internal/metrics"
+	"user-go/internal/repository"
 	"user-go/internal/service"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func JWTAuthMiddleware(jwtSecret []byte) gin.HandlerFunc {
+// RevocationChecker reports whether a validly signed token has been revoked (logout, deleted user).
+type RevocationChecker interface {
+	IsRevoked(ctx context.Context, claims jwt.MapClaims) (bool, error)
+}
+
+// AccessChecker returns the block keeping a user out, or nil if they may proceed.
+type AccessChecker interface {
+	CheckAccess(ctx context.Context, userID, phone string) (*repository.Block, error)
+}
+
+// SessionToucher records that a login session was used; implementations throttle the writes.
+type SessionToucher interface {
+	TouchSession(ctx context.Context, sessionID string) error
+}
+
+// AuthOption configures JWTAuthMiddleware.
+type AuthOption func(*authConfig)
+
+type authConfig struct {
+	revocation RevocationChecker
+	access     AccessChecker
+	sessions   SessionToucher
+	metrics    *metrics.Metrics
+}
+
+// WithRevocationCheck rejects tokens the checker reports as revoked.
+func WithRevocationCheck(r RevocationChecker) AuthOption {
+	return func(cfg *authConfig) { cfg.revocation = r }
+}
+
+// WithAccessCheck rejects tokens of suspended or banned users with 403.
+func WithAccessCheck(a AccessChecker) AuthOption {
+	return func(cfg *authConfig) { cfg.access = a }
+}
+
+// WithSessionTouch updates the last-seen time of the token's session on every accepted request.
+func WithSessionTouch(s SessionToucher) AuthOption {
+	return func(cfg *authConfig) { cfg.sessions = s }
+}
+
+// WithMetrics counts rejected tokens by reason.
+func WithMetrics(m *metrics.Metrics) AuthOption {
+	return func(cfg *authConfig) { cfg.metrics = m }
+}
+
+// JWTAuthMiddleware verifies HS256 tokens signed with jwtSecret.
+func JWTAuthMiddleware(jwtSecret []byte, opts ...AuthOption) gin.HandlerFunc {
+	return JWTAuthMiddlewareWithKeys(keys.NewHMACManager(jwtSecret), opts...)
+}
+
+// JWTAuthMiddlewareWithKeys verifies tokens against the keys of km, selected by the kid header.
+func JWTAuthMiddlewareWithKeys(km *keys.Manager, opts ...AuthOption) gin.HandlerFunc {
+	cfg := authConfig{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header missing"})
+			cfg.metrics.TokenRejected("missing")
+			AbortWithProblem(c, ErrMissingToken)
 			return
 		}
 
 		parts := strings.SplitN(authHeader, " ", 2)
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header format must be Bearer {token}"})
+			cfg.metrics.TokenRejected("malformed")
+			AbortWithProblem(c, ErrMalformedToken)
 			return
 		}
 
 		tokenStr := parts[1]
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, service.ErrInvalidToken
-			}
-			return jwtSecret, nil
-		})
+		token, err := jwt.Parse(tokenStr, km.Keyfunc, jwt.WithValidMethods(km.ValidMethods()))
 
 		if err != nil || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			reason := "invalid"
+			if errors.Is(err, jwt.ErrTokenExpired) {
+				reason = "expired"
+			}
+			cfg.metrics.TokenRejected(reason)
+			AbortWithProblem(c, ErrInvalidToken)
 			return
 		}
 
 		claims, ok := token.Claims.(jwt.MapClaims)
 		if !ok {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token claims"})
+			cfg.metrics.TokenRejected("invalid")
+			AbortWithProblem(c, ErrInvalidToken)
 			return
 		}
 
-		phone, ok := claims["phone"].(string)
-		if !ok {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token phone"})
+		userID, err := claims.GetSubject()
+		if err != nil || userID == "" {
+			cfg.metrics.TokenRejected("no_subject")
+			AbortWithProblem(c, ErrInvalidToken)
 			return
 		}
+		phone, _ := claims["phone"].(string)
+
+		// مسدود کردن توکن‌ها را هم باطل می‌کند؛ اول مسدودی را بررسی می‌کنیم تا کاربر دلیلش را ببیند
+		if cfg.access != nil {
+			block, err := cfg.access.CheckAccess(c.Request.Context(), userID, phone)
+			if err != nil {
+				AbortWithProblem(c, fmt.Errorf("%w: %w", ErrUnavailable, err))
+				return
+			}
+			if block != nil {
+				cfg.metrics.TokenRejected("blocked")
+				AbortWithProblem(c, ownBlock{&service.BlockedError{Block: block}})
+				return
+			}
+		}
+
+		if cfg.revocation != nil {
+			revoked, err := cfg.revocation.IsRevoked(c.Request.Context(), claims)
+			if err != nil {
+				AbortWithProblem(c, fmt.Errorf("%w: %w", ErrUnavailable, err))
+				return
+			}
+			if revoked {
+				cfg.metrics.TokenRejected("revoked")
+				AbortWithProblem(c, ErrTokenRevoked)
+				return
+			}
+		}
 
-		// ذخیره شماره تلفن در context برای دسترسی در هندلرها
+		// شناسه‌ی کاربر هویت اصلی است؛ شماره تلفن فقط برای نمایش و لاگ
+		c.Set("user_id", userID)
 		c.Set("phone", phone)
+		c.Request = c.Request.WithContext(logging.With(c.Request.Context(), "user_id", userID, "phone", phone))
+		role := repository.RoleUser
+		if r, ok := claims["role"].(string); ok && repository.Role(r).Valid() {
+			role = repository.Role(r)
+		}
+		c.Set("role", role)
+		if jti, ok := claims["jti"].(string); ok {
+			c.Set("jti", jti)
+		}
+		if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+			c.Set("token_exp", exp.Time)
+		}
+		if sid, ok := claims["sid"].(string); ok && sid != "" {
+			c.Set("session_id", sid)
+			if cfg.sessions != nil {
+				// last-seen فقط اطلاعاتی است؛ خطای آن نباید درخواست را رد کند
+				if err := cfg.sessions.TouchSession(c.Request.Context(), sid); err != nil {
+					logging.FromContext(c.Request.Context()).WarnContext(c.Request.Context(), "failed to update session last seen", "error", err)
+				}
+			}
+		}
 
 		c.Next()
 	}
 }
+
+// ownBlock is a block reported to the blocked user: a valid token proves who is asking, so
+// the reason is included.
+type ownBlock struct{ *service.BlockedError }
+
+func (e ownBlock) Details() map[string]any {
+	details := e.BlockedError.Details()
+	details["reason"] = e.Block.Reason
+	return details
+}
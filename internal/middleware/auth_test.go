@@ -1,14 +1,22 @@
 package middleware_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"user-go/internal/cache"
+	"user-go/internal/keys"
 	"user-go/internal/middleware"
+	"user-go/internal/repository"
+	"user-go/internal/service"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"time"
 )
 
@@ -18,6 +26,7 @@ func TestJWTAuthMiddleware_Success(t *testing.T) {
 
 	// ساخت توکن معتبر به صورت داینامیک
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":   "0190f1e2-7c3a-7b4d-8e5f-6a7b8c9d0e1f",
 		"phone": "+12345",
 		"exp":   time.Now().Add(time.Hour).Unix(),
 	})
@@ -44,3 +53,232 @@ func TestJWTAuthMiddleware_Success(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 	assert.Contains(t, w.Body.String(), "+12345")
 }
+
+type stubRevocation struct {
+	revoked bool
+}
+
+func (s stubRevocation) IsRevoked(context.Context, jwt.MapClaims) (bool, error) {
+	return s.revoked, nil
+}
+
+func TestJWTAuthMiddleware_RevokedToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	secret := []byte("testsecret")
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":   "0190f1e2-7c3a-7b4d-8e5f-6a7b8c9d0e1f",
+		"phone": "+12345",
+		"jti":   "abc",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+	tokenString, err := token.SignedString(secret)
+	assert.NoError(t, err)
+
+	for _, tc := range []struct {
+		revoked bool
+		code    int
+	}{{false, http.StatusOK}, {true, http.StatusUnauthorized}} {
+		router := gin.New()
+		router.Use(middleware.JWTAuthMiddleware(secret, middleware.WithRevocationCheck(stubRevocation{revoked: tc.revoked})))
+		router.GET("/protected", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"jti": c.GetString("jti")})
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.code, w.Code)
+	}
+}
+
+type stubAccess struct {
+	block *repository.Block
+	err   error
+}
+
+func (s stubAccess) CheckAccess(context.Context, string, string) (*repository.Block, error) {
+	return s.block, s.err
+}
+
+func TestJWTAuthMiddleware_BlockedUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	c := cache.NewInMemoryCache()
+	users := repository.NewInMemoryUserRepository()
+	tokens := service.NewTokenService(c, "testsecret")
+	blocks := service.NewBlockService(c, users, users, tokens)
+
+	router := gin.New()
+	router.Use(middleware.Errors(), middleware.JWTAuthMiddleware([]byte("testsecret"),
+		middleware.WithRevocationCheck(tokens), middleware.WithAccessCheck(blocks)))
+	router.GET("/protected", func(c *gin.Context) { c.Status(http.StatusOK) })
+	get := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	user, err := users.Create(ctx, "+989121234567")
+	require.NoError(t, err)
+	pair, err := tokens.Issue(ctx, user)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, get(pair.AccessToken).Code)
+
+	// مسدود کردن توکن را هم باطل می‌کند، ولی پاسخ باید دلیل مسدودی را نشان دهد
+	require.NoError(t, blocks.Suspend(ctx, user.ID, "spam", time.Now().Add(time.Hour), "admin"))
+	w := get(pair.AccessToken)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "account_blocked", body["code"])
+	assert.Equal(t, "suspended", body["kind"])
+	assert.Equal(t, "spam", body["reason"])
+	assert.NotEmpty(t, body["until"])
+
+	require.NoError(t, blocks.Ban(ctx, user.ID, "fraud", "admin"))
+	w = get(pair.AccessToken)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "banned", body["kind"])
+	assert.Equal(t, "fraud", body["reason"])
+
+	// رفع مسدودی توکن‌های قدیمی را زنده نمی‌کند
+	require.NoError(t, blocks.Unblock(ctx, user.ID))
+	w = get(pair.AccessToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"token_revoked"`)
+}
+
+func TestJWTAuthMiddleware_AccessCheck(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	secret := []byte("testsecret")
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":   "0190f1e2-7c3a-7b4d-8e5f-6a7b8c9d0e1f",
+		"phone": "+12345",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+	tokenString, err := token.SignedString(secret)
+	assert.NoError(t, err)
+
+	until := time.Now().Add(time.Hour)
+	for _, tc := range []struct {
+		access stubAccess
+		code   int
+	}{
+		{stubAccess{}, http.StatusOK},
+		{stubAccess{block: &repository.Block{Kind: repository.BlockSuspended, Reason: "spam", Until: &until}}, http.StatusForbidden},
+		{stubAccess{err: errors.New("cache down")}, http.StatusServiceUnavailable},
+	} {
+		router := gin.New()
+		router.Use(middleware.JWTAuthMiddleware(secret, middleware.WithAccessCheck(tc.access)))
+		router.GET("/protected", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+		req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.code, w.Code)
+	}
+}
+
+func TestJWTAuthMiddlewareWithKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	km, err := keys.NewManager(keys.RS256)
+	assert.NoError(t, err)
+
+	tokenString, err := km.Sign(jwt.MapClaims{
+		"sub":   "0190f1e2-7c3a-7b4d-8e5f-6a7b8c9d0e1f",
+		"phone": "+12345",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+	assert.NoError(t, err)
+
+	// توکن HS256 نباید توسط middleware مبتنی بر RSA پذیرفته شود
+	hmacToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":   "0190f1e2-7c3a-7b4d-8e5f-6a7b8c9d0e1f",
+		"phone": "+12345",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("testsecret"))
+	assert.NoError(t, err)
+
+	router := gin.New()
+	router.Use(middleware.JWTAuthMiddlewareWithKeys(km))
+	router.GET("/protected", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"phone": c.GetString("phone")})
+	})
+
+	for token, code := range map[string]int{tokenString: http.StatusOK, hmacToken: http.StatusUnauthorized} {
+		req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, code, w.Code)
+	}
+}
+
+func TestJWTAuthMiddleware_RequiresSubject(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	secret := []byte("testsecret")
+
+	// توکن‌های قدیمی که فقط phone داشتند دیگر پذیرفته نمی‌شوند
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"phone": "+12345",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}).SignedString(secret)
+	assert.NoError(t, err)
+
+	router := gin.New()
+	router.Use(middleware.JWTAuthMiddleware(secret))
+	router.GET("/protected", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+type stubToucher struct {
+	touched []string
+	err     error
+}
+
+func (s *stubToucher) TouchSession(_ context.Context, id string) error {
+	s.touched = append(s.touched, id)
+	return s.err
+}
+
+func TestJWTAuthMiddleware_SessionTouch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	secret := []byte("testsecret")
+	sign := func(claims jwt.MapClaims) string {
+		claims["sub"] = "0190f1e2-7c3a-7b4d-8e5f-6a7b8c9d0e1f"
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+		s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+		assert.NoError(t, err)
+		return s
+	}
+
+	// خطای ثبت آخرین استفاده نباید درخواست را رد کند
+	toucher := &stubToucher{err: errors.New("db down")}
+	router := gin.New()
+	router.Use(middleware.JWTAuthMiddleware(secret, middleware.WithSessionTouch(toucher)))
+	router.GET("/protected", func(c *gin.Context) { c.String(http.StatusOK, c.GetString("session_id")) })
+
+	for _, token := range []string{sign(jwt.MapClaims{"sid": "s1"}), sign(jwt.MapClaims{})} {
+		req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	assert.Equal(t, []string{"s1"}, toucher.touched)
+}
@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	"user-go/internal/apperr"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProblemContentType is the media type of error responses (RFC 7807).
+const ProblemContentType = "application/problem+json"
+
+var (
+	ErrMissingToken   = apperr.New(apperr.Unauthorized, "missing_token", "Authorization header missing")
+	ErrMalformedToken = apperr.New(apperr.Unauthorized, "malformed_token", "Authorization header format must be Bearer {token}")
+	ErrInvalidToken   = apperr.New(apperr.Unauthorized, "invalid_token", "invalid token")
+	ErrTokenRevoked   = apperr.New(apperr.Unauthorized, "token_revoked", "token revoked")
+	ErrForbidden      = apperr.New(apperr.Forbidden, "forbidden", "forbidden")
+	ErrRateLimited    = apperr.New(apperr.RateLimited, "rate_limited", "rate limit exceeded")
+	ErrRouteNotFound  = apperr.New(apperr.NotFound, "route_not_found", "no such endpoint")
+	// ErrUnavailable answers requests that cannot be checked because a dependency is down.
+	ErrUnavailable = apperr.New(apperr.Unavailable, "service_unavailable", "service temporarily unavailable, retry later")
+)
+
+var kindStatus = map[apperr.Kind]int{
+	apperr.Invalid:      http.StatusBadRequest,
+	apperr.Unauthorized: http.StatusUnauthorized,
+	apperr.Forbidden:    http.StatusForbidden,
+	apperr.NotFound:     http.StatusNotFound,
+	apperr.Conflict:     http.StatusConflict,
+	apperr.Locked:       http.StatusLocked,
+	apperr.RateLimited:  http.StatusTooManyRequests,
+	apperr.Upstream:     http.StatusBadGateway,
+	apperr.Unavailable:  http.StatusServiceUnavailable,
+	apperr.Internal:     http.StatusInternalServerError,
+}
+
+// Problem is an RFC 7807 problem details body. Type is always about:blank, so Title is the
+// status text; Code is the stable error code clients switch on, and Details become extra
+// members such as field or reason.
+type Problem struct {
+	Type      string
+	Title     string
+	Status    int
+	Detail    string
+	Instance  string
+	Code      string
+	RequestID string
+	Details   map[string]any
+}
+
+func (p Problem) MarshalJSON() ([]byte, error) {
+	body := make(map[string]any, len(p.Details)+7)
+	for k, v := range p.Details {
+		body[k] = v
+	}
+	body["type"] = p.Type
+	body["title"] = p.Title
+	body["status"] = p.Status
+	body["detail"] = p.Detail
+	body["code"] = p.Code
+	if p.Instance != "" {
+		body["instance"] = p.Instance
+	}
+	if p.RequestID != "" {
+		body["request_id"] = p.RequestID
+	}
+	return json.Marshal(body)
+}
+
+// NewProblem maps err to the problem sent to clients. Unclassified errors become a generic
+// 500: their text may come from the database or a dependency and stays in the logs.
+func NewProblem(err error) Problem {
+	typed := apperr.Classify(err)
+	if typed == nil {
+		typed = apperr.New(apperr.Internal, apperr.CodeInternal, "internal server error")
+	}
+	status, ok := kindStatus[typed.Kind()]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	p := Problem{Type: "about:blank", Title: http.StatusText(status), Status: status, Code: typed.Code(), Detail: typed.Error()}
+	// پیام خطاهای اعتبارسنجی را خودمان ساخته‌ایم و جزئیات آن به کار کلاینت می‌آید
+	if typed.Kind() == apperr.Invalid {
+		p.Detail = err.Error()
+	}
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if d, ok := e.(apperr.Detailer); ok {
+			for k, v := range d.Details() {
+				if p.Details == nil {
+					p.Details = map[string]any{}
+				}
+				if _, set := p.Details[k]; !set {
+					p.Details[k] = v
+				}
+			}
+		}
+	}
+	return p
+}
+
+// AbortWithProblem answers err as a problem and stops the handler chain. Errors that say
+// when to retry, such as lockouts, also set Retry-After.
+func AbortWithProblem(c *gin.Context, err error) {
+	p := NewProblem(err)
+	p.Instance = c.Request.URL.Path
+	p.RequestID = c.GetString("request_id")
+	var retry interface{ RetryAfter() time.Duration }
+	if errors.As(err, &retry) {
+		c.Header("Retry-After", strconv.Itoa(int(retry.RetryAfter().Seconds())))
+	}
+	c.Abort()
+	c.Render(p.Status, problemRender{p})
+}
+
+// Errors answers the last error a handler attached with c.Error as a problem, unless the
+// handler already wrote a response. The full error text reaches the request log through
+// c.Errors either way.
+func Errors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if err := c.Errors.Last(); err != nil && !c.Writer.Written() {
+			AbortWithProblem(c, err.Err)
+		}
+	}
+}
+
+// NotFound answers unknown routes; register it with NoRoute.
+func NotFound() gin.HandlerFunc {
+	return func(c *gin.Context) { AbortWithProblem(c, ErrRouteNotFound) }
+}
+
+type problemRender struct{ p Problem }
+
+func (r problemRender) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	return json.NewEncoder(w).Encode(r.p)
+}
+
+func (r problemRender) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", ProblemContentType)
+}
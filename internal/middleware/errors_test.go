@@ -0,0 +1,109 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"user-go/internal/apperr"
+	"user-go/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errGone = apperr.New(apperr.NotFound, "thing_not_found", "thing not found")
+
+type retryErr struct{}
+
+func (retryErr) Error() string             { return "locked" }
+func (retryErr) Kind() apperr.Kind         { return apperr.Locked }
+func (retryErr) Code() string              { return "thing_locked" }
+func (retryErr) RetryAfter() time.Duration { return 90 * time.Second }
+
+func problemOf(t *testing.T, w *httptest.ResponseRecorder) map[string]any {
+	t.Helper()
+	assert.Equal(t, middleware.ProblemContentType, w.Header().Get("Content-Type"))
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return body
+}
+
+func TestErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("request_id", "req-1") }, middleware.Errors())
+	r.NoRoute(middleware.NotFound())
+	r.GET("/missing", func(c *gin.Context) { c.Error(fmt.Errorf("load: %w", errGone)) })
+	r.GET("/invalid", func(c *gin.Context) { c.Error(apperr.Validation("limit", "limit must be a positive integer")) })
+	r.GET("/field", func(c *gin.Context) {
+		c.Error(apperr.WithField("phone", fmt.Errorf("parse: %w", apperr.New(apperr.Invalid, "invalid_phone", "invalid phone"))))
+	})
+	r.GET("/locked", func(c *gin.Context) { c.Error(retryErr{}) })
+	r.GET("/db", func(c *gin.Context) { c.Error(errors.New("pq: password authentication failed")) })
+	r.GET("/written", func(c *gin.Context) {
+		c.Error(errGone)
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := get("/missing")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, map[string]any{
+		"type": "about:blank", "title": "Not Found", "status": float64(404), "detail": "thing not found",
+		"code": "thing_not_found", "instance": "/missing", "request_id": "req-1",
+	}, problemOf(t, w))
+
+	w = get("/invalid")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	body := problemOf(t, w)
+	assert.Equal(t, "validation_failed", body["code"])
+	assert.Equal(t, "limit", body["field"])
+	assert.Equal(t, "limit must be a positive integer", body["detail"])
+
+	// جزئیات خطاهای ورودی کامل به کلاینت می‌رسد
+	body = problemOf(t, get("/field"))
+	assert.Equal(t, "invalid_phone", body["code"])
+	assert.Equal(t, "phone", body["field"])
+	assert.Equal(t, "parse: invalid phone", body["detail"])
+
+	w = get("/locked")
+	assert.Equal(t, http.StatusLocked, w.Code)
+	assert.Equal(t, "90", w.Header().Get("Retry-After"))
+
+	w = get("/db")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	body = problemOf(t, w)
+	assert.Equal(t, apperr.CodeInternal, body["code"])
+	assert.NotContains(t, w.Body.String(), "password")
+
+	w = get("/written")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"ok":true}`, w.Body.String())
+
+	w = get("/nowhere")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "route_not_found", problemOf(t, w)["code"])
+}
+
+func TestRecovery_Problem(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.Recovery())
+	r.GET("/panic", func(c *gin.Context) { panic("secret state") })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, apperr.CodeInternal, problemOf(t, w)["code"])
+	assert.NotContains(t, w.Body.String(), "secret state")
+}
@@ -0,0 +1,59 @@
+package middleware_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"user-go/internal/logging"
+	"user-go/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestLogger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, logging.Options{})
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.Use(middleware.RequestLogger(logger), middleware.Recovery())
+	router.GET("/users/:id", func(c *gin.Context) {
+		c.Request = c.Request.WithContext(logging.With(c.Request.Context(), "phone", "+989121234567"))
+		c.Status(http.StatusNotFound)
+	})
+	router.GET("/panic", func(c *gin.Context) { panic("boom") })
+
+	req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+	req.Header.Set(middleware.RequestIDHeader, "client-id-1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "client-id-1", w.Header().Get(middleware.RequestIDHeader))
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, "request", line["msg"])
+	assert.Equal(t, "WARN", line["level"])
+	assert.Equal(t, "client-id-1", line["request_id"])
+	assert.Equal(t, "/users/:id", line["route"])
+	assert.Equal(t, float64(404), line["status"])
+	assert.Equal(t, logging.PhoneHash("+989121234567"), line["phone_hash"])
+	assert.Contains(t, line, "latency_ms")
+	assert.NotContains(t, buf.String(), "+989121234567")
+
+	// شناسه‌ی نامعتبر کلاینت جایگزین می‌شود
+	buf.Reset()
+	req = httptest.NewRequest(http.MethodGet, "/panic", nil)
+	req.Header.Set(middleware.RequestIDHeader, "bad id\nwith newline")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	id := w.Header().Get(middleware.RequestIDHeader)
+	assert.Len(t, id, 16)
+	assert.Contains(t, buf.String(), `"msg":"panic recovered"`)
+	assert.Contains(t, buf.String(), `"request_id":"`+id+`"`)
+}
@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"time"
+	"user-go/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HTTPMetrics records the duration of every request per gin route. Unmatched paths share
+// one label so scanners cannot blow up the series count.
+func HTTPMetrics(m *metrics.Metrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		m.ObserveHTTP(c.Request.Method, route, c.Writer.Status(), time.Since(start))
+	}
+}
@@ -0,0 +1,78 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"user-go/internal/metrics"
+	"user-go/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	secret := []byte("testsecret")
+	reg := prometheus.NewRegistry()
+	m := metrics.New(reg)
+
+	router := gin.New()
+	router.Use(middleware.HTTPMetrics(m))
+	router.GET("/users/:id", middleware.JWTAuthMiddleware(secret, middleware.WithMetrics(m)), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	expired, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "0190f1e2-7c3a-7b4d-8e5f-6a7b8c9d0e1f",
+		"exp": time.Now().Add(-time.Minute).Unix(),
+	}).SignedString(secret)
+	require.NoError(t, err)
+
+	for _, header := range []string{"", "Token abc", "Bearer " + expired, "Bearer not-a-jwt"} {
+		req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nope", nil))
+
+	expected := `
+# HELP user_go_token_validation_failures_total Access and refresh tokens rejected, by reason.
+# TYPE user_go_token_validation_failures_total counter
+user_go_token_validation_failures_total{reason="expired"} 1
+user_go_token_validation_failures_total{reason="invalid"} 1
+user_go_token_validation_failures_total{reason="malformed"} 1
+user_go_token_validation_failures_total{reason="missing"} 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected), "user_go_token_validation_failures_total"))
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	counts := map[string]uint64{}
+	for _, f := range families {
+		if f.GetName() != "user_go_http_request_duration_seconds" {
+			continue
+		}
+		for _, metric := range f.GetMetric() {
+			var route, status string
+			for _, l := range metric.GetLabel() {
+				switch l.GetName() {
+				case "route":
+					route = l.GetValue()
+				case "status":
+					status = l.GetValue()
+				}
+			}
+			counts[route+" "+status] = metric.GetHistogram().GetSampleCount()
+		}
+	}
+	assert.Equal(t, map[string]uint64{"/users/:id 401": 4, "unmatched 404": 1}, counts)
+}
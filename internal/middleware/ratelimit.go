@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+	"user-go/internal/logging"
+	"user-go/internal/metrics"
+	"user-go/internal/phone"
+	"user-go/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxKeyBody bounds how much of a request body ByPhone reads to find the number.
+const maxKeyBody = 64 << 10
+
+// RateLimitKey returns what a request is counted against; ok false lets the request through
+// unlimited, e.g. when the key is missing and the handler will reject the request anyway.
+type RateLimitKey func(c *gin.Context) (key string, ok bool)
+
+// ByIP counts requests per client IP.
+func ByIP() RateLimitKey {
+	return func(c *gin.Context) (string, bool) { return "ip:" + c.ClientIP(), true }
+}
+
+// ByUser counts requests per authenticated user; it must run after JWTAuthMiddleware.
+func ByUser() RateLimitKey {
+	return func(c *gin.Context) (string, bool) {
+		id := c.GetString("user_id")
+		return "user:" + id, id != ""
+	}
+}
+
+// ByRoute counts all requests to a route together, whoever sends them.
+func ByRoute() RateLimitKey {
+	return func(c *gin.Context) (string, bool) {
+		return "route:" + c.Request.Method + " " + c.FullPath(), c.FullPath() != ""
+	}
+}
+
+// ByPhone counts requests per phone number taken from the JSON body field, normalized with
+// parser (international format only if nil) so different spellings of one number share a limit.
+// The body is left for the handler.
+func ByPhone(field string, parser *phone.Parser) RateLimitKey {
+	return func(c *gin.Context) (string, bool) {
+		if c.Request.Body == nil {
+			return "", false
+		}
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxKeyBody))
+		c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+		if err != nil {
+			return "", false
+		}
+		var fields map[string]json.RawMessage
+		var raw string
+		if json.Unmarshal(body, &fields) != nil || json.Unmarshal(fields[field], &raw) != nil {
+			return "", false
+		}
+		normalize := phone.Normalize
+		if parser != nil {
+			normalize = parser.Normalize
+		}
+		number, err := normalize(raw)
+		if err != nil {
+			return "", false
+		}
+		return "phone:" + number, true
+	}
+}
+
+// RateLimitOption configures RateLimit.
+type RateLimitOption func(*rateLimitConfig)
+
+type rateLimitConfig struct {
+	metrics *metrics.Metrics
+}
+
+// WithRateLimitMetrics counts rejected requests under the limit's name.
+func WithRateLimitMetrics(m *metrics.Metrics) RateLimitOption {
+	return func(cfg *rateLimitConfig) { cfg.metrics = m }
+}
+
+// RateLimit rejects requests over limiter's quota for their key with 429 and Retry-After, and
+// reports the quota in RateLimit-Policy, RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers. name scopes the counters, so route groups sharing a key kind
+// keep separate quotas. When several limits apply, the headers show the tightest one.
+// If the store fails, the request is let through.
+func RateLimit(name string, limiter ratelimit.Limiter, key RateLimitKey, opts ...RateLimitOption) gin.HandlerFunc {
+	cfg := rateLimitConfig{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return func(c *gin.Context) {
+		k, ok := key(c)
+		if !ok {
+			c.Next()
+			return
+		}
+		ctx := c.Request.Context()
+		res, err := limiter.Allow(ctx, name+":"+k)
+		if err != nil {
+			// از کار افتادن cache نباید کل API را از دسترس خارج کند
+			logging.FromContext(ctx).WarnContext(ctx, "rate limit check failed, allowing request", "limit", name, "error", err)
+			c.Next()
+			return
+		}
+
+		if res.Allowed {
+			setRateLimitHeaders(c, limiter.Policy(), res)
+			c.Next()
+			return
+		}
+		// رد شدن همیشه سرآیندهای همین محدودیت را نشان می‌دهد
+		c.Writer.Header().Del("RateLimit-Remaining")
+		setRateLimitHeaders(c, limiter.Policy(), res)
+		c.Header("Retry-After", seconds(res.RetryAfter))
+		cfg.metrics.RateLimited(name)
+		AbortWithProblem(c, ErrRateLimited)
+	}
+}
+
+// setRateLimitHeaders reports res unless an earlier limit on the request has less left.
+func setRateLimitHeaders(c *gin.Context, policy string, res ratelimit.Result) {
+	if prev, err := strconv.Atoi(c.Writer.Header().Get("RateLimit-Remaining")); err == nil && prev <= res.Remaining {
+		return
+	}
+	c.Header("RateLimit-Policy", policy)
+	c.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	c.Header("RateLimit-Reset", seconds(res.Reset))
+}
+
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(d.Seconds()))
+}
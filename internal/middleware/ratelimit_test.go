@@ -0,0 +1,138 @@
+package middleware_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"user-go/internal/cache"
+	"user-go/internal/middleware"
+	"user-go/internal/phone"
+	"user-go/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimit_ByIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := ratelimit.NewSlidingWindow(cache.NewInMemoryCache(), 2, time.Minute)
+	r := gin.New()
+	r.Use(middleware.RateLimit("public", limiter, middleware.ByIP()))
+	r.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	get := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("192.0.2.1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2;w=60", w.Header().Get("RateLimit-Policy"))
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.NotEmpty(t, w.Header().Get("RateLimit-Reset"))
+	assert.Empty(t, w.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, get("192.0.2.1").Code)
+	w = get("192.0.2.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, get("192.0.2.2").Code)
+}
+
+func TestRateLimit_ByUserAndRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c := cache.NewInMemoryCache()
+	perUser := ratelimit.NewTokenBucket(c, 1, time.Hour, 5)
+	perRoute := ratelimit.NewSlidingWindow(c, 3, time.Minute)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", c.GetHeader("X-User")) })
+	r.Use(middleware.RateLimit("api", perUser, middleware.ByUser()), middleware.RateLimit("search", perRoute, middleware.ByRoute()))
+	r.GET("/search", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	get := func(user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/search", nil)
+		req.Header.Set("X-User", user)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// سرآیندها محدودیت تنگ‌تر را نشان می‌دهند
+	w := get("alice")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "3", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Remaining"))
+
+	assert.Equal(t, http.StatusOK, get("bob").Code)
+	// کاربر ناشناس فقط با محدودیت route شمرده می‌شود
+	assert.Equal(t, http.StatusOK, get("").Code)
+	w = get("carol")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "3;w=60", w.Header().Get("RateLimit-Policy"))
+}
+
+func TestRateLimit_ByPhone(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	iran, err := phone.NewParser("IR")
+	require.NoError(t, err)
+	limiter := ratelimit.NewSlidingWindow(cache.NewInMemoryCache(), 1, time.Minute)
+
+	r := gin.New()
+	r.Use(middleware.RateLimit("otp", limiter, middleware.ByPhone("phone", iran)))
+	r.POST("/otp", func(c *gin.Context) {
+		var body struct{ Phone string }
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		c.String(http.StatusOK, body.Phone)
+	})
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/otp", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post(`{"phone":"09121234567"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "09121234567", w.Body.String(), "handler must still see the body")
+	// همان شماره با شکل دیگر
+	assert.Equal(t, http.StatusTooManyRequests, post(`{"phone":"+98 912 123 4567"}`).Code)
+	assert.Equal(t, http.StatusOK, post(`{"phone":"09121234568"}`).Code)
+	// بدنه‌ی نامعتبر به handler می‌رسد تا 400 بدهد
+	assert.Equal(t, http.StatusBadRequest, post(`not json`).Code)
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(context.Context, string) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("cache down")
+}
+func (failingLimiter) Policy() string { return "1;w=1" }
+
+func TestRateLimit_FailsOpen(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.RateLimit("public", failingLimiter{}, middleware.ByIP()))
+	r.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"user-go/internal/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Permission is a single action on the user management API.
+type Permission string
+
+const (
+	PermUsersRead   Permission = "users:read"
+	PermUsersWrite  Permission = "users:write"
+	PermUsersDelete Permission = "users:delete"
+	PermRolesManage Permission = "roles:manage"
+	PermUsersBlock  Permission = "users:block"
+	PermAuditRead   Permission = "audit:read"
+)
+
+// rolePermissions lists what each role may do on records other than its own.
+var rolePermissions = map[repository.Role][]Permission{
+	repository.RoleUser:    {},
+	repository.RoleSupport: {PermUsersRead},
+	repository.RoleAdmin:   {PermUsersRead, PermUsersWrite, PermUsersDelete, PermRolesManage, PermUsersBlock, PermAuditRead},
+}
+
+// HasPermission reports whether role grants perm.
+func HasPermission(role repository.Role, perm Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// currentRole reads the role JWTAuthMiddleware stored in the context.
+func currentRole(c *gin.Context) repository.Role {
+	if role, ok := c.Get("role"); ok {
+		if r, ok := role.(repository.Role); ok {
+			return r
+		}
+	}
+	return repository.RoleUser
+}
+
+// RequireRole allows the request only if the caller has one of roles. Must run after JWTAuthMiddleware.
+func RequireRole(roles ...repository.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := currentRole(c)
+		for _, r := range roles {
+			if r == role {
+				c.Next()
+				return
+			}
+		}
+		AbortWithProblem(c, ErrForbidden)
+	}
+}
+
+// RequirePermission allows the request only if the caller's role grants every perm.
+func RequirePermission(perms ...Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := currentRole(c)
+		for _, p := range perms {
+			if !HasPermission(role, p) {
+				AbortWithProblem(c, ErrForbidden)
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// RequireSelfOrPermission lets callers act on their own record (the route param equals
+// their user id) and otherwise requires perm.
+func RequireSelfOrPermission(param string, perm Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Param(param) != "" && c.Param(param) == c.GetString("user_id") {
+			c.Next()
+			return
+		}
+		if !HasPermission(currentRole(c), perm) {
+			AbortWithProblem(c, ErrForbidden)
+			return
+		}
+		c.Next()
+	}
+}
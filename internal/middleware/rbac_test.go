@@ -0,0 +1,79 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"user-go/internal/middleware"
+	"user-go/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// withIdentity fakes what JWTAuthMiddleware puts in the context.
+func withIdentity(userID string, role repository.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("user_id", userID)
+		c.Set("role", role)
+		c.Next()
+	}
+}
+
+func serve(r *gin.Engine, method, path string) int {
+	req := httptest.NewRequest(method, path, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestRequireRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for role, code := range map[repository.Role]int{
+		repository.RoleUser:    http.StatusForbidden,
+		repository.RoleSupport: http.StatusOK,
+		repository.RoleAdmin:   http.StatusOK,
+	} {
+		r := gin.New()
+		r.Use(withIdentity("+1", role))
+		r.GET("/", middleware.RequireRole(repository.RoleSupport, repository.RoleAdmin), func(c *gin.Context) { c.Status(http.StatusOK) })
+		assert.Equal(t, code, serve(r, http.MethodGet, "/"), role)
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for role, code := range map[repository.Role]int{
+		repository.RoleUser:    http.StatusForbidden,
+		repository.RoleSupport: http.StatusForbidden,
+		repository.RoleAdmin:   http.StatusOK,
+	} {
+		r := gin.New()
+		r.Use(withIdentity("+1", role))
+		r.DELETE("/users/:phone", middleware.RequirePermission(middleware.PermUsersDelete), func(c *gin.Context) { c.Status(http.StatusOK) })
+		assert.Equal(t, code, serve(r, http.MethodDelete, "/users/+2"), role)
+	}
+}
+
+func TestRequireSelfOrPermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		role repository.Role
+		path string
+		code int
+	}{
+		{repository.RoleUser, "/users/+1", http.StatusOK},        // own record
+		{repository.RoleUser, "/users/+2", http.StatusForbidden}, // someone else
+		{repository.RoleSupport, "/users/+2", http.StatusForbidden},
+		{repository.RoleAdmin, "/users/+2", http.StatusOK},
+	}
+	for _, tc := range cases {
+		r := gin.New()
+		r.Use(withIdentity("+1", tc.role))
+		r.PUT("/users/:phone", middleware.RequireSelfOrPermission("phone", middleware.PermUsersWrite), func(c *gin.Context) { c.Status(http.StatusOK) })
+		assert.Equal(t, tc.code, serve(r, http.MethodPut, tc.path), "%s %s", tc.role, tc.path)
+	}
+}
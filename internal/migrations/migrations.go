@@ -0,0 +1,358 @@
+// Package migrations applies the versioned SQL schema embedded in the binary.
+//
+// Files live in sql/ as NNNN_name.up.sql and NNNN_name.down.sql. Applied versions are
+// recorded in schema_migrations with a checksum of the up script, so editing a migration
+// that already ran is detected instead of silently ignored.
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// lockKey is the pg_advisory_lock id that serializes migrations across replicas.
+const lockKey int64 = 0x75736572676f // "usergo"
+
+var (
+	ErrChecksumMismatch = errors.New("applied migration was modified")
+	ErrUnknownVersion   = errors.New("database has a migration this binary does not know")
+	ErrIrreversible     = errors.New("migration has no down script")
+)
+
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is one schema version.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Checksum identifies the up script; it is stored when the migration is applied.
+func (m Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+// Status describes one migration known to the binary or the database.
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// Modified means the file changed after it was applied.
+	Modified bool
+	// Missing means the database has the version but the binary does not.
+	Missing bool
+}
+
+type appliedRow struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// Embedded returns the migrations compiled into the binary.
+func Embedded() ([]Migration, error) {
+	sub, err := fs.Sub(files, "sql")
+	if err != nil {
+		return nil, err
+	}
+	return Load(sub)
+}
+
+// Load reads migrations from the top level of fsys, ordered by version.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		match := fileName.FindStringSubmatch(e.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration %s: name must look like 0001_name.up.sql", e.Name())
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		body, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d: conflicting names %q and %q", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	result := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s: missing up script", m.Version, m.Name)
+		}
+		result = append(result, *m)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	return result, nil
+}
+
+// verify refuses to touch a database whose history does not match the migrations.
+func verify(migrations []Migration, applied map[int64]appliedRow) error {
+	known := map[int64]Migration{}
+	for _, m := range migrations {
+		known[m.Version] = m
+	}
+	for version, row := range applied {
+		m, ok := known[version]
+		if !ok {
+			return fmt.Errorf("%w: %d_%s", ErrUnknownVersion, version, row.name)
+		}
+		if m.Checksum() != row.checksum {
+			return fmt.Errorf("%w: %d_%s", ErrChecksumMismatch, version, m.Name)
+		}
+	}
+	return nil
+}
+
+// pending returns the migrations not applied yet, lowest version first.
+func pending(migrations []Migration, applied map[int64]appliedRow) []Migration {
+	var result []Migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; !ok {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// rollback returns the last steps applied migrations, highest version first.
+func rollback(migrations []Migration, applied map[int64]appliedRow, steps int) ([]Migration, error) {
+	var result []Migration
+	for i := len(migrations) - 1; i >= 0 && len(result) < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == "" {
+			return nil, fmt.Errorf("%w: %d_%s", ErrIrreversible, m.Version, m.Name)
+		}
+		result = append(result, m)
+	}
+	return result, nil
+}
+
+func status(migrations []Migration, applied map[int64]appliedRow) []Status {
+	var result []Status
+	seen := map[int64]bool{}
+	for _, m := range migrations {
+		seen[m.Version] = true
+		s := Status{Version: m.Version, Name: m.Name}
+		if row, ok := applied[m.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = row.appliedAt
+			s.Modified = row.checksum != m.Checksum()
+		}
+		result = append(result, s)
+	}
+	for version, row := range applied {
+		if !seen[version] {
+			result = append(result, Status{Version: version, Name: row.name, Applied: true, AppliedAt: row.appliedAt, Missing: true})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	return result
+}
+
+// Migrator applies migrations to a Postgres database.
+type Migrator struct {
+	pool       *pgxpool.Pool
+	migrations []Migration
+	logf       func(format string, args ...any)
+}
+
+// Option configures a Migrator.
+type Option func(*Migrator)
+
+// WithMigrations replaces the embedded migrations, mainly for tests.
+func WithMigrations(ms []Migration) Option {
+	return func(m *Migrator) { m.migrations = ms }
+}
+
+// WithLogger reports each applied or rolled back migration.
+func WithLogger(logf func(format string, args ...any)) Option {
+	return func(m *Migrator) { m.logf = logf }
+}
+
+// New builds a Migrator for the embedded migrations.
+func New(pool *pgxpool.Pool, opts ...Option) (*Migrator, error) {
+	m := &Migrator{pool: pool, logf: func(string, ...any) {}}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.migrations == nil {
+		ms, err := Embedded()
+		if err != nil {
+			return nil, err
+		}
+		m.migrations = ms
+	}
+	return m, nil
+}
+
+// Up applies every pending migration, each in its own transaction, and returns what ran.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *pgxpool.Conn, applied map[int64]appliedRow) error {
+		for _, mig := range pending(m.migrations, applied) {
+			if err := m.run(ctx, conn, mig.Up,
+				"INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)",
+				mig.Version, mig.Name, mig.Checksum()); err != nil {
+				return fmt.Errorf("apply %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			m.logf("migrations: applied %d_%s", mig.Version, mig.Name)
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back the last steps applied migrations and returns what ran.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *pgxpool.Conn, applied map[int64]appliedRow) error {
+		plan, err := rollback(m.migrations, applied, steps)
+		if err != nil {
+			return err
+		}
+		for _, mig := range plan {
+			if err := m.run(ctx, conn, mig.Down,
+				"DELETE FROM schema_migrations WHERE version = $1", mig.Version); err != nil {
+				return fmt.Errorf("roll back %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			m.logf("migrations: rolled back %d_%s", mig.Version, mig.Name)
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status lists every migration and whether it has been applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	if err := ensureTable(ctx, conn); err != nil {
+		return nil, err
+	}
+	applied, err := loadApplied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	return status(m.migrations, applied), nil
+}
+
+// locked runs fn on one connection holding the advisory lock, so replicas starting
+// together apply each migration exactly once.
+func (m *Migrator) locked(ctx context.Context, fn func(*pgxpool.Conn, map[int64]appliedRow) error) error {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	// قفل باید حتی اگر ctx لغو شده باشد آزاد شود
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+
+	if err := ensureTable(ctx, conn); err != nil {
+		return err
+	}
+	applied, err := loadApplied(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if err := verify(m.migrations, applied); err != nil {
+		return err
+	}
+	return fn(conn, applied)
+}
+
+// run executes a migration script and its bookkeeping statement in one transaction.
+func (m *Migrator) run(ctx context.Context, conn *pgxpool.Conn, script, record string, args ...any) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func ensureTable(ctx context.Context, conn *pgxpool.Conn) error {
+	_, err := conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    BIGINT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		checksum   TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	return err
+}
+
+func loadApplied(ctx context.Context, conn *pgxpool.Conn) (map[int64]appliedRow, error) {
+	rows, err := conn.Query(ctx, "SELECT version, name, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int64]appliedRow{}
+	for rows.Next() {
+		var version int64
+		var row appliedRow
+		if err := rows.Scan(&version, &row.name, &row.checksum, &row.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = row
+	}
+	return applied, rows.Err()
+}
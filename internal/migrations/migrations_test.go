@@ -0,0 +1,217 @@
+package migrations
+
+import (
+	"context"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testMigrations() []Migration {
+	return []Migration{
+		{Version: 1, Name: "a", Up: "CREATE TABLE a (id INT);", Down: "DROP TABLE a;"},
+		{Version: 2, Name: "b", Up: "CREATE TABLE b (id INT);", Down: "DROP TABLE b;"},
+		{Version: 3, Name: "c", Up: "CREATE TABLE c (id INT);"},
+	}
+}
+
+func appliedFor(ms ...Migration) map[int64]appliedRow {
+	applied := map[int64]appliedRow{}
+	for _, m := range ms {
+		applied[m.Version] = appliedRow{name: m.Name, checksum: m.Checksum(), appliedAt: time.Now()}
+	}
+	return applied
+}
+
+func TestEmbedded(t *testing.T) {
+	ms, err := Embedded()
+	require.NoError(t, err)
+	require.NotEmpty(t, ms)
+	for i, m := range ms {
+		assert.Equal(t, int64(i+1), m.Version, "versions must be contiguous")
+		assert.NotEmpty(t, m.Down, "%d_%s has no down script", m.Version, m.Name)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	ms, err := Load(fstest.MapFS{
+		"0002_second.up.sql":  {Data: []byte("B")},
+		"0001_first.up.sql":   {Data: []byte("A")},
+		"0001_first.down.sql": {Data: []byte("-A")},
+	})
+	require.NoError(t, err)
+	require.Len(t, ms, 2)
+	assert.Equal(t, Migration{Version: 1, Name: "first", Up: "A", Down: "-A"}, ms[0])
+	assert.Equal(t, Migration{Version: 2, Name: "second", Up: "B"}, ms[1])
+
+	_, err = Load(fstest.MapFS{"init.sql": {Data: []byte("A")}})
+	assert.Error(t, err, "unversioned file")
+
+	_, err = Load(fstest.MapFS{"0001_first.down.sql": {Data: []byte("-A")}})
+	assert.Error(t, err, "down without up")
+
+	_, err = Load(fstest.MapFS{
+		"0001_first.up.sql":   {Data: []byte("A")},
+		"0001_other.down.sql": {Data: []byte("-A")},
+	})
+	assert.Error(t, err, "conflicting names")
+}
+
+func TestVerify(t *testing.T) {
+	ms := testMigrations()
+	assert.NoError(t, verify(ms, appliedFor(ms[0], ms[1])))
+
+	edited := ms[0]
+	edited.Up = "CREATE TABLE a (id BIGINT);"
+	assert.ErrorIs(t, verify(ms, appliedFor(edited)), ErrChecksumMismatch)
+
+	future := Migration{Version: 9, Name: "future", Up: "x"}
+	assert.ErrorIs(t, verify(ms, appliedFor(ms[0], future)), ErrUnknownVersion)
+}
+
+func TestPendingAndRollback(t *testing.T) {
+	ms := testMigrations()
+	applied := appliedFor(ms[0], ms[1])
+
+	next := pending(ms, applied)
+	require.Len(t, next, 1)
+	assert.Equal(t, int64(3), next[0].Version)
+
+	plan, err := rollback(ms, applied, 1)
+	require.NoError(t, err)
+	require.Len(t, plan, 1)
+	assert.Equal(t, int64(2), plan[0].Version)
+
+	plan, err = rollback(ms, applied, 10)
+	require.NoError(t, err)
+	require.Len(t, plan, 2)
+	assert.Equal(t, []int64{2, 1}, []int64{plan[0].Version, plan[1].Version})
+
+	_, err = rollback(ms, appliedFor(ms...), 1)
+	assert.ErrorIs(t, err, ErrIrreversible)
+}
+
+func TestStatus(t *testing.T) {
+	ms := testMigrations()
+	gone := Migration{Version: 7, Name: "gone", Up: "x"}
+	list := status(ms, appliedFor(ms[0], gone))
+
+	require.Len(t, list, 4)
+	assert.True(t, list[0].Applied)
+	assert.False(t, list[1].Applied)
+	assert.False(t, list[2].Applied)
+	assert.True(t, list[3].Missing)
+}
+
+// TestMigrator_Postgres runs the embedded migrations up and down against DATABASE_URL.
+func TestMigrator_Postgres(t *testing.T) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, dsn)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	m, err := New(pool)
+	require.NoError(t, err)
+
+	_, err = m.Up(ctx)
+	require.NoError(t, err)
+	again, err := m.Up(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, again, "second run must be a no-op")
+
+	rolled, err := m.Down(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, rolled, 1)
+	_, err = m.Up(ctx)
+	require.NoError(t, err)
+
+	list, err := m.Status(ctx)
+	require.NoError(t, err)
+	for _, s := range list {
+		assert.True(t, s.Applied && !s.Modified && !s.Missing, "%+v", s)
+	}
+
+	// applying concurrently must not fail on the advisory lock
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() { _, err := m.Up(ctx); errs <- err }()
+	}
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, <-errs)
+	}
+}
+
+// TestNormalizePhones_Postgres reruns the E.164 migration over phones stored in legacy formats.
+func TestNormalizePhones_Postgres(t *testing.T) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, dsn)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	m, err := New(pool)
+	require.NoError(t, err)
+	_, err = m.Up(ctx)
+	require.NoError(t, err)
+	list, err := m.Status(ctx)
+	require.NoError(t, err)
+	steps := 0
+	for i, st := range list {
+		if st.Name == "normalize_phones" {
+			steps = len(list) - i
+		}
+	}
+	require.NotZero(t, steps)
+
+	legacy := map[string]string{
+		"09127770001":        "+989127770001",
+		"98 912 777 0002":    "+989127770002",
+		"۰۹۱۲۷۷۷۰۰۰۳":        "+989127770003",
+		"+98 0912 777 0004":  "+989127770004",
+		"0044 7911 777 0005": "+4479117770005",
+	}
+	cleanup := func() {
+		_, _ = pool.Exec(ctx, `DELETE FROM users WHERE phone LIKE '%7770%'`)
+	}
+	cleanup()
+	defer cleanup()
+
+	_, err = m.Down(ctx, steps)
+	require.NoError(t, err)
+	for raw := range legacy {
+		_, err := pool.Exec(ctx, `INSERT INTO users (phone) VALUES ($1)`, raw)
+		require.NoError(t, err)
+	}
+	_, err = m.Up(ctx)
+	require.NoError(t, err)
+	for _, want := range legacy {
+		var n int
+		require.NoError(t, pool.QueryRow(ctx, `SELECT count(*) FROM users WHERE phone = $1`, want).Scan(&n))
+		assert.Equal(t, 1, n, want)
+	}
+
+	// دو شماره که به یک مقدار می‌رسند نباید بی‌صدا ادغام شوند
+	_, err = m.Down(ctx, steps)
+	require.NoError(t, err)
+	_, err = pool.Exec(ctx, `INSERT INTO users (phone) VALUES ('0912 777 0001')`)
+	require.NoError(t, err)
+	_, err = m.Up(ctx)
+	assert.ErrorContains(t, err, "share a phone")
+
+	_, err = pool.Exec(ctx, `DELETE FROM users WHERE phone = '0912 777 0001'`)
+	require.NoError(t, err)
+	_, err = m.Up(ctx)
+	require.NoError(t, err)
+}
@@ -0,0 +1,2 @@
+-- roles: user | support | admin
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(32) NOT NULL DEFAULT 'user';
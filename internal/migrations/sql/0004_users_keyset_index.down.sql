@@ -0,0 +1 @@
+DROP INDEX IF EXISTS users_registration_date_phone_idx;
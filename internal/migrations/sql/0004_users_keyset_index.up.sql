@@ -0,0 +1,2 @@
+-- keyset pagination for GET /users
+CREATE INDEX IF NOT EXISTS users_registration_date_phone_idx ON users (registration_date, phone);
@@ -0,0 +1,4 @@
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_phone_key;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_pkey;
+ALTER TABLE users ADD CONSTRAINT users_pkey PRIMARY KEY (phone);
+ALTER TABLE users DROP COLUMN IF EXISTS id;
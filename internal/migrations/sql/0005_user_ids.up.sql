@@ -0,0 +1,9 @@
+-- stable user ids: phone stays unique but is no longer the primary key.
+-- gen_random_uuid() is built in since PostgreSQL 13; new rows get UUIDv7 ids from the application.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS id UUID;
+UPDATE users SET id = gen_random_uuid() WHERE id IS NULL;
+ALTER TABLE users ALTER COLUMN id SET NOT NULL;
+ALTER TABLE users ALTER COLUMN id SET DEFAULT gen_random_uuid();
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_pkey;
+ALTER TABLE users ADD CONSTRAINT users_pkey PRIMARY KEY (id);
+ALTER TABLE users ADD CONSTRAINT users_phone_key UNIQUE (phone);
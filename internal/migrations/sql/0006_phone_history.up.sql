@@ -0,0 +1,12 @@
+-- every phone number change, verified by the owner or overridden by an admin.
+-- changed_by has no foreign key so history survives the actor's deletion.
+CREATE TABLE IF NOT EXISTS phone_history (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    old_phone VARCHAR(255) NOT NULL,
+    new_phone VARCHAR(255) NOT NULL,
+    method VARCHAR(16) NOT NULL,
+    changed_by UUID,
+    changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS phone_history_user_idx ON phone_history (user_id, changed_at DESC, id DESC);
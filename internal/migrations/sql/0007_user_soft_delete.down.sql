@@ -0,0 +1,3 @@
+-- soft-deleted users become live again; purge them first if that is not wanted.
+DROP INDEX IF EXISTS users_deleted_at_idx;
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS phone_bans;
+ALTER TABLE users DROP COLUMN IF EXISTS blocked_at;
+ALTER TABLE users DROP COLUMN IF EXISTS blocked_by;
+ALTER TABLE users DROP COLUMN IF EXISTS block_until;
+ALTER TABLE users DROP COLUMN IF EXISTS block_reason;
+ALTER TABLE users DROP COLUMN IF EXISTS block_kind;
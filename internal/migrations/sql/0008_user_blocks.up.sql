@@ -0,0 +1,14 @@
+-- suspensions (block_until set) and bans (block_until NULL); block_kind NULL means not blocked.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS block_kind VARCHAR(16);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS block_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS block_until TIMESTAMP;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS blocked_by UUID;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS blocked_at TIMESTAMP;
+
+-- bans on every number starting with prefix, e.g. '+98912'.
+CREATE TABLE IF NOT EXISTS phone_bans (
+    prefix VARCHAR(16) PRIMARY KEY,
+    reason TEXT NOT NULL DEFAULT '',
+    created_by UUID,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
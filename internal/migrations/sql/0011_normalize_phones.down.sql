@@ -0,0 +1,2 @@
+-- the original formatting is not kept; numbers stay in E.164.
+SELECT 1;
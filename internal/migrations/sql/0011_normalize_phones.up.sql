@@ -0,0 +1,65 @@
+-- rewrites phones stored before numbers were normalized to E.164 ("09121234567",
+-- "98 912 123 4567", ...). Numbers without a country code are read as Iranian, the default
+-- PHONE_DEFAULT_REGION. If a number cannot be read or two users end up with the same number
+-- the migration fails and names the users; fix or merge them by hand and run it again.
+CREATE FUNCTION pg_temp.e164(raw TEXT) RETURNS TEXT AS $$
+DECLARE
+    digits TEXT := btrim(translate(raw, '۰۱۲۳۴۵۶۷۸۹٠١٢٣٤٥٦٧٨٩', '01234567890123456789'));
+    international BOOLEAN := left(digits, 1) = '+';
+BEGIN
+    IF international THEN
+        digits := substr(digits, 2);
+    END IF;
+    digits := regexp_replace(digits, '[ .()' || chr(160) || '-]', '', 'g');
+    IF digits !~ '^[0-9]+$' THEN
+        RETURN NULL;
+    END IF;
+    IF NOT international AND left(digits, 2) = '00' THEN
+        digits := substr(digits, 3);
+        international := TRUE;
+    END IF;
+    IF NOT international THEN
+        IF left(digits, 1) = '0' THEN
+            digits := '98' || substr(digits, 2);
+        ELSIF digits !~ '^989[0-9]{9}$' THEN
+            digits := '98' || digits;
+        END IF;
+    END IF;
+    -- "+98 0912..." شماره‌ی ملی با پیش‌شماره‌ی صفر بعد از کد کشور است
+    IF digits ~ '^9809[0-9]{9}$' THEN
+        digits := '98' || substr(digits, 4);
+    END IF;
+    IF digits !~ '^[1-9][0-9]{7,14}$' THEN
+        RETURN NULL;
+    END IF;
+    RETURN '+' || digits;
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+CREATE TEMP TABLE phone_e164 ON COMMIT DROP AS
+    SELECT id, phone, pg_temp.e164(phone) AS e164 FROM users;
+
+DO $$
+DECLARE
+    bad TEXT;
+BEGIN
+    SELECT string_agg(id::TEXT, ', ') INTO bad FROM phone_e164 WHERE e164 IS NULL;
+    IF bad IS NOT NULL THEN
+        RAISE EXCEPTION 'phones of users % cannot be normalized to E.164', bad;
+    END IF;
+    SELECT string_agg(ids, '; ') INTO bad FROM (
+        SELECT string_agg(id::TEXT, ', ') AS ids FROM phone_e164 GROUP BY e164 HAVING count(*) > 1
+    ) dup;
+    IF bad IS NOT NULL THEN
+        RAISE EXCEPTION 'users share a phone once normalized to E.164: %', bad;
+    END IF;
+END;
+$$;
+
+UPDATE users u SET phone = p.e164 FROM phone_e164 p WHERE u.id = p.id AND u.phone <> p.e164;
+
+-- history keeps numbers it cannot read as they were
+UPDATE phone_history SET
+    old_phone = coalesce(pg_temp.e164(old_phone), old_phone),
+    new_phone = coalesce(pg_temp.e164(new_phone), new_phone)
+WHERE old_phone !~ '^\+[1-9][0-9]{7,14}$' OR new_phone !~ '^\+[1-9][0-9]{7,14}$';
@@ -0,0 +1,2 @@
+ALTER TABLE users ALTER COLUMN block_until TYPE TIMESTAMP USING block_until AT TIME ZONE 'UTC';
+ALTER TABLE users ALTER COLUMN blocked_at TYPE TIMESTAMP USING blocked_at AT TIME ZONE 'UTC';
@@ -0,0 +1,4 @@
+-- block times carry their offset: a TIMESTAMP column keeps the wall clock of whatever offset
+-- the suspension was given in and compares it as UTC. Existing values were written as UTC.
+ALTER TABLE users ALTER COLUMN block_until TYPE TIMESTAMPTZ USING block_until AT TIME ZONE 'UTC';
+ALTER TABLE users ALTER COLUMN blocked_at TYPE TIMESTAMPTZ USING blocked_at AT TIME ZONE 'UTC';
@@ -0,0 +1,3 @@
+-- from/until filters may carry any offset; against a TIMESTAMP column the driver drops it and
+-- compares the wall clock. Existing values were written as UTC.
+ALTER TABLE audit_events ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'UTC';
@@ -0,0 +1,3 @@
+ALTER TABLE users ALTER COLUMN registration_date TYPE TIMESTAMP USING registration_date AT TIME ZONE 'UTC';
+ALTER TABLE users ALTER COLUMN updated_at TYPE TIMESTAMP USING updated_at AT TIME ZONE 'UTC';
+ALTER TABLE users ALTER COLUMN deleted_at TYPE TIMESTAMP USING deleted_at AT TIME ZONE 'UTC';
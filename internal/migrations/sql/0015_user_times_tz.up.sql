@@ -0,0 +1,5 @@
+-- registration and deletion times are filtered and purged against instants that may carry any
+-- offset; a TIMESTAMP column compares them by wall clock. Existing values were written as UTC.
+ALTER TABLE users ALTER COLUMN registration_date TYPE TIMESTAMPTZ USING registration_date AT TIME ZONE 'UTC';
+ALTER TABLE users ALTER COLUMN updated_at TYPE TIMESTAMPTZ USING updated_at AT TIME ZONE 'UTC';
+ALTER TABLE users ALTER COLUMN deleted_at TYPE TIMESTAMPTZ USING deleted_at AT TIME ZONE 'UTC';
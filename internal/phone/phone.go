@@ -0,0 +1,191 @@
+// Package phone parses user-supplied phone numbers and normalizes them to E.164.
+//
+// Only mobile numbers are accepted: they are the only ones that can receive an OTP.
+// Numbers whose country calling code has no metadata here are checked against the
+// generic E.164 length bounds only.
+package phone
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"user-go/internal/apperr"
+)
+
+var ErrInvalid = apperr.New(apperr.Invalid, "invalid_phone", "invalid phone number")
+
+// Reasons reported by ValidationError.
+const (
+	ReasonEmpty              = "empty"
+	ReasonInvalidCharacters  = "invalid_characters"
+	ReasonMissingCountryCode = "missing_country_code"
+	ReasonInvalidCountryCode = "invalid_country_code"
+	ReasonInvalidLength      = "invalid_length"
+	ReasonNotMobile          = "not_mobile"
+)
+
+var reasonText = map[string]string{
+	ReasonEmpty:              "number is empty",
+	ReasonInvalidCharacters:  "number may only contain digits, spaces, dashes, dots, parentheses and a leading +",
+	ReasonMissingCountryCode: "number must start with + and a country code",
+	ReasonInvalidCountryCode: "country code is not valid",
+	ReasonInvalidLength:      "number has the wrong length",
+	ReasonNotMobile:          "number is not a mobile number",
+}
+
+// ValidationError explains why a number was rejected. It matches ErrInvalid with errors.Is.
+type ValidationError struct {
+	Input  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrInvalid, reasonText[e.Reason])
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalid
+}
+
+func (e *ValidationError) Kind() apperr.Kind { return ErrInvalid.Kind() }
+func (e *ValidationError) Code() string      { return ErrInvalid.Code() }
+
+// Details reports the reason, one of the Reason constants.
+func (e *ValidationError) Details() map[string]any {
+	return map[string]any{"reason": e.Reason}
+}
+
+// E.164 allows at most 15 digits; no mobile number anywhere is shorter than 8.
+const (
+	minDigits = 8
+	maxDigits = 15
+)
+
+// Parser normalizes numbers written in international format or, when it has a
+// default region, in that region's national format.
+type Parser struct {
+	region *region
+}
+
+// International accepts numbers in international format only.
+var International = &Parser{}
+
+// NewParser returns a parser that reads national numbers as belonging to defaultRegion,
+// an ISO 3166 code such as "IR". An empty region gives International.
+func NewParser(defaultRegion string) (*Parser, error) {
+	if defaultRegion == "" {
+		return International, nil
+	}
+	r, ok := regions[strings.ToUpper(defaultRegion)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported phone region %q (supported: %s)", defaultRegion, strings.Join(Regions(), ", "))
+	}
+	return &Parser{region: r}, nil
+}
+
+// Normalize returns raw in E.164 form, e.g. "+989121234567", or a *ValidationError.
+func (p *Parser) Normalize(raw string) (string, error) {
+	invalid := func(reason string) (string, error) {
+		return "", &ValidationError{Input: raw, Reason: reason}
+	}
+
+	digits, international, ok := clean(raw)
+	if !ok {
+		return invalid(ReasonInvalidCharacters)
+	}
+	if digits == "" {
+		return invalid(ReasonEmpty)
+	}
+
+	if !international {
+		if p.region == nil {
+			return invalid(ReasonMissingCountryCode)
+		}
+		digits = p.region.international(digits)
+	}
+
+	if digits[0] == '0' {
+		return invalid(ReasonInvalidCountryCode)
+	}
+	if len(digits) < minDigits || len(digits) > maxDigits {
+		return invalid(ReasonInvalidLength)
+	}
+
+	r, national := lookup(digits)
+	if r == nil {
+		return "+" + digits, nil
+	}
+	// "+98 0912..." شماره‌ی ملی با پیش‌شماره‌ی صفر بعد از کد کشور است
+	if r.trunk != "" && strings.HasPrefix(national, r.trunk) && !r.mobile.MatchString(national) {
+		national = strings.TrimPrefix(national, r.trunk)
+	}
+	if !r.mobile.MatchString(national) {
+		return invalid(ReasonNotMobile)
+	}
+	return "+" + r.callingCode + national, nil
+}
+
+// Normalize parses raw in international format only. Repositories use it to make sure
+// every stored number is already E.164.
+func Normalize(raw string) (string, error) {
+	return International.Normalize(raw)
+}
+
+// Regions lists the region codes NewParser accepts.
+func Regions() []string {
+	out := make([]string, 0, len(regions))
+	for code := range regions {
+		out = append(out, code)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// clean strips formatting and reports whether the number was written in international form.
+// Persian and Arabic-Indic digits are read as their ASCII equivalents.
+func clean(raw string) (digits string, international bool, ok bool) {
+	s := strings.TrimSpace(raw)
+	if strings.HasPrefix(s, "+") {
+		s = s[1:]
+		international = true
+	}
+
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r >= '۰' && r <= '۹':
+			b.WriteRune('0' + (r - '۰'))
+		case r >= '٠' && r <= '٩':
+			b.WriteRune('0' + (r - '٠'))
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')' || r == '\u00a0':
+		default:
+			return "", false, false
+		}
+	}
+
+	digits = b.String()
+	if !international && strings.HasPrefix(digits, "00") {
+		digits = digits[2:]
+		international = true
+	}
+	return digits, international, true
+}
+
+// NormalizePrefix reads the leading digits of international numbers, e.g. "+98 912" or
+// "98912", and returns them with a leading +. It is used for prefix bans.
+func NormalizePrefix(raw string) (string, error) {
+	digits, _, ok := clean(raw)
+	switch {
+	case !ok:
+		return "", &ValidationError{Input: raw, Reason: ReasonInvalidCharacters}
+	case digits == "":
+		return "", &ValidationError{Input: raw, Reason: ReasonEmpty}
+	case digits[0] == '0':
+		return "", &ValidationError{Input: raw, Reason: ReasonInvalidCountryCode}
+	case len(digits) > maxDigits:
+		return "", &ValidationError{Input: raw, Reason: ReasonInvalidLength}
+	}
+	return "+" + digits, nil
+}
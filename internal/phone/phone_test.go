@@ -0,0 +1,105 @@
+package phone
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParser_Normalize(t *testing.T) {
+	iran, err := NewParser("IR")
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		in   string
+		want string
+	}{
+		{"+989121234567", "+989121234567"},
+		{"09121234567", "+989121234567"},
+		{"989121234567", "+989121234567"},
+		{"9121234567", "+989121234567"},
+		{"00989121234567", "+989121234567"},
+		{"+98 912 123 4567", "+989121234567"},
+		{"+98 (0)912-123-4567", "+989121234567"},
+		{"۰۹۱۲۱۲۳۴۵۶۷", "+989121234567"},
+		{"٠٩١٢١٢٣٤٥٦٧", "+989121234567"},
+		{" +1 (202) 555-0123 ", "+12025550123"},
+		{"+447911123456", "+447911123456"},
+		{"+56912345678", "+56912345678"},
+		// کد کشور بدون metadata فقط از نظر طول بررسی می‌شود
+		{"+380501234567", "+380501234567"},
+	} {
+		got, err := iran.Normalize(tc.in)
+		if assert.NoError(t, err, tc.in) {
+			assert.Equal(t, tc.want, got, tc.in)
+		}
+	}
+}
+
+func TestParser_Rejects(t *testing.T) {
+	iran, err := NewParser("IR")
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		in     string
+		reason string
+	}{
+		{"", ReasonEmpty},
+		{"  ", ReasonEmpty},
+		{"+98912abc4567", ReasonInvalidCharacters},
+		{"+98+9121234567", ReasonInvalidCharacters},
+		{"+0989121234567", ReasonInvalidCountryCode},
+		{"+1234", ReasonInvalidLength},
+		{"+1234567890123456", ReasonInvalidLength},
+		{"02112345678", ReasonNotMobile},   // تلفن ثابت تهران
+		{"+98912123456", ReasonNotMobile},  // یک رقم کم
+		{"+11345678901", ReasonNotMobile},  // کد منطقه‌ی NANP با 2-9 شروع می‌شود
+		{"+442071234567", ReasonNotMobile}, // تلفن ثابت لندن
+	} {
+		_, err := iran.Normalize(tc.in)
+		var verr *ValidationError
+		if assert.ErrorAs(t, err, &verr, tc.in) {
+			assert.Equal(t, tc.reason, verr.Reason, tc.in)
+			assert.Equal(t, tc.in, verr.Input)
+		}
+		assert.True(t, errors.Is(err, ErrInvalid), tc.in)
+	}
+}
+
+func TestNormalize_InternationalOnly(t *testing.T) {
+	got, err := Normalize("+989121234567")
+	require.NoError(t, err)
+	assert.Equal(t, "+989121234567", got)
+
+	_, err = Normalize("09121234567")
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+	assert.Equal(t, ReasonMissingCountryCode, verr.Reason)
+}
+
+func TestNewParser(t *testing.T) {
+	p, err := NewParser("")
+	require.NoError(t, err)
+	assert.Same(t, International, p)
+
+	_, err = NewParser("gb")
+	assert.NoError(t, err)
+
+	_, err = NewParser("XX")
+	assert.Error(t, err)
+}
+
+func TestNormalizePrefix(t *testing.T) {
+	for in, want := range map[string]string{"+98 912": "+98912", "98912": "+98912", "0098": "+98", "+1": "+1"} {
+		got, err := NormalizePrefix(in)
+		if assert.NoError(t, err, in) {
+			assert.Equal(t, want, got, in)
+		}
+	}
+	for _, in := range []string{"", "+", "+0912", "+98a", "+1234567890123456"} {
+		_, err := NormalizePrefix(in)
+		assert.ErrorIs(t, err, ErrInvalid, in)
+	}
+}
@@ -0,0 +1,63 @@
+package phone
+
+import (
+	"regexp"
+	"strings"
+)
+
+// region is the metadata needed to read and check mobile numbers of one country.
+type region struct {
+	callingCode string
+	// trunk is the prefix dialled before national numbers inside the country, if any.
+	trunk string
+	// mobile matches the national significant number of a mobile line.
+	mobile *regexp.Regexp
+}
+
+// international turns digits written in national format into calling code + national number.
+func (r *region) international(digits string) string {
+	if r.trunk != "" && strings.HasPrefix(digits, r.trunk) {
+		return r.callingCode + strings.TrimPrefix(digits, r.trunk)
+	}
+	// "98912..." بدون + ولی با کد کشور
+	if strings.HasPrefix(digits, r.callingCode) && r.mobile.MatchString(strings.TrimPrefix(digits, r.callingCode)) {
+		return digits
+	}
+	return r.callingCode + digits
+}
+
+var nanp = &region{callingCode: "1", trunk: "1", mobile: regexp.MustCompile(`^[2-9]\d{2}[2-9]\d{6}$`)}
+
+// regions is keyed by ISO 3166 code. NANP numbers do not tell mobile and landline
+// apart, so any valid US/CA number is accepted.
+var regions = map[string]*region{
+	"IR": {callingCode: "98", trunk: "0", mobile: regexp.MustCompile(`^9\d{9}$`)},
+	"US": nanp,
+	"CA": nanp,
+	"GB": {callingCode: "44", trunk: "0", mobile: regexp.MustCompile(`^7[1-57-9]\d{8}$`)},
+	"DE": {callingCode: "49", trunk: "0", mobile: regexp.MustCompile(`^1[5-7]\d{8,9}$`)},
+	"FR": {callingCode: "33", trunk: "0", mobile: regexp.MustCompile(`^[67]\d{8}$`)},
+	"TR": {callingCode: "90", trunk: "0", mobile: regexp.MustCompile(`^5\d{9}$`)},
+	"AE": {callingCode: "971", trunk: "0", mobile: regexp.MustCompile(`^5[024568]\d{7}$`)},
+	"IN": {callingCode: "91", trunk: "0", mobile: regexp.MustCompile(`^[6-9]\d{9}$`)},
+	"CL": {callingCode: "56", mobile: regexp.MustCompile(`^9\d{8}$`)},
+}
+
+// byCallingCode indexes regions by calling code; codes are one to three digits long.
+var byCallingCode = func() map[string]*region {
+	m := make(map[string]*region, len(regions))
+	for _, r := range regions {
+		m[r.callingCode] = r
+	}
+	return m
+}()
+
+// lookup finds the region of an international number and splits off its national part.
+func lookup(digits string) (*region, string) {
+	for n := 1; n <= 3 && n < len(digits); n++ {
+		if r, ok := byCallingCode[digits[:n]]; ok {
+			return r, digits[n:]
+		}
+	}
+	return nil, ""
+}
@@ -0,0 +1,106 @@
+// Package ratelimit implements request rate limits whose state lives in a cache.Cache, so
+// limits hold across instances when the cache is shared (Redis) and per process otherwise.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"user-go/internal/cache"
+)
+
+// Algorithm selects how a Limiter counts requests.
+type Algorithm string
+
+const (
+	// SlidingWindow allows Limit requests in any Window, estimated from two fixed windows.
+	SlidingWindow Algorithm = "sliding_window"
+	// TokenBucket refills Limit tokens per Window up to Burst; each request takes one.
+	TokenBucket Algorithm = "token_bucket"
+)
+
+// keyPrefix namespaces every rate limit key in the cache.
+const keyPrefix = "ratelimit:"
+
+// Result is the outcome of one Allow call.
+type Result struct {
+	Allowed bool
+	// Limit is the number of requests allowed in a burst.
+	Limit int
+	// Remaining is how many more requests would be allowed right now.
+	Remaining int
+	// Reset is when the quota is fully available again.
+	Reset time.Duration
+	// RetryAfter is how long a rejected caller should wait; zero when allowed.
+	RetryAfter time.Duration
+}
+
+// Limiter decides whether one more request for key is allowed.
+type Limiter interface {
+	Allow(ctx context.Context, key string) (Result, error)
+	// Policy describes the limit as an IETF RateLimit-Policy item, e.g. `60;w=60`.
+	Policy() string
+}
+
+// Rule configures a Limiter.
+type Rule struct {
+	Algorithm Algorithm
+	Limit     int
+	Window    time.Duration
+	// Burst is the token bucket capacity; defaults to Limit. Ignored by sliding windows.
+	Burst int
+}
+
+// Option configures a Limiter.
+type Option func(*options)
+
+type options struct {
+	now func() time.Time
+}
+
+// WithClock replaces time.Now, for tests.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) { o.now = now }
+}
+
+// New builds the limiter described by rule on c.
+func New(c cache.Cache, rule Rule, opts ...Option) (Limiter, error) {
+	if rule.Limit < 1 {
+		return nil, fmt.Errorf("rate limit must be positive, got %d", rule.Limit)
+	}
+	switch rule.Algorithm {
+	case SlidingWindow:
+		// TTL کلیدهای cache ثانیه‌ی کامل است
+		if rule.Window < time.Second || rule.Window%time.Second != 0 {
+			return nil, fmt.Errorf("sliding window must be a whole number of seconds, got %s", rule.Window)
+		}
+		return NewSlidingWindow(c, rule.Limit, rule.Window, opts...), nil
+	case TokenBucket:
+		if rule.Window <= 0 {
+			return nil, fmt.Errorf("token bucket window must be positive, got %s", rule.Window)
+		}
+		burst := rule.Burst
+		if burst <= 0 {
+			burst = rule.Limit
+		}
+		return NewTokenBucket(c, rule.Limit, rule.Window, burst, opts...), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit algorithm %q", rule.Algorithm)
+	}
+}
+
+func buildOptions(opts []Option) options {
+	o := options{now: time.Now}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// ceilSeconds rounds d up to whole seconds, the unit of the RateLimit and Retry-After headers.
+func ceilSeconds(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return (d + time.Second - 1).Truncate(time.Second)
+}
@@ -0,0 +1,185 @@
+package ratelimit_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"user-go/internal/cache"
+	"user-go/internal/ratelimit"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var ctx = context.Background()
+
+// clock is a manually advanced time source.
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time          { return c.now }
+func (c *clock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newClock() *clock {
+	// شروع دقیق یک پنجره‌ی یک‌دقیقه‌ای
+	return &clock{now: time.Unix(1_800_000_000, 0).Truncate(time.Minute)}
+}
+
+func allowN(t *testing.T, l ratelimit.Limiter, key string, n int) (allowed int, last ratelimit.Result) {
+	for range n {
+		res, err := l.Allow(ctx, key)
+		require.NoError(t, err)
+		if res.Allowed {
+			allowed++
+		}
+		last = res
+	}
+	return allowed, last
+}
+
+func TestNew_Validates(t *testing.T) {
+	c := cache.NewInMemoryCache()
+	for _, rule := range []ratelimit.Rule{
+		{Algorithm: ratelimit.SlidingWindow, Limit: 0, Window: time.Minute},
+		{Algorithm: ratelimit.SlidingWindow, Limit: 5, Window: 1500 * time.Millisecond},
+		{Algorithm: ratelimit.TokenBucket, Limit: 5},
+		{Algorithm: "leaky_bucket", Limit: 5, Window: time.Minute},
+	} {
+		_, err := ratelimit.New(c, rule)
+		assert.Error(t, err, "%+v", rule)
+	}
+	l, err := ratelimit.New(c, ratelimit.Rule{Algorithm: ratelimit.TokenBucket, Limit: 10, Window: time.Minute})
+	require.NoError(t, err)
+	assert.Equal(t, "10;w=60;burst=10", l.Policy())
+}
+
+func TestSlidingWindow(t *testing.T) {
+	clk := newClock()
+	l := ratelimit.NewSlidingWindow(cache.NewInMemoryCache(), 10, time.Minute, ratelimit.WithClock(clk.Now))
+	assert.Equal(t, "10;w=60", l.Policy())
+
+	allowed, last := allowN(t, l, "ip:1", 10)
+	assert.Equal(t, 10, allowed)
+	assert.Equal(t, 0, last.Remaining)
+	assert.Equal(t, time.Minute, last.Reset)
+
+	res, err := l.Allow(ctx, "ip:1")
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Minute, res.RetryAfter)
+
+	// کلیدها مستقل‌اند
+	allowed, _ = allowN(t, l, "ip:2", 1)
+	assert.Equal(t, 1, allowed)
+
+	// یک پنجره‌ی ثابت جلوتر، پنجره‌ی قبلی (11 درخواست) هنوز کاملاً حساب می‌شود
+	clk.Advance(time.Minute)
+	res, err = l.Allow(ctx, "ip:1")
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+
+	// در نیمه‌ی پنجره، نصف درخواست‌های قبلی باقی مانده‌اند: 11*0.5 + 1 (ردشده) + n ≤ 10
+	clk.Advance(30 * time.Second)
+	allowed, _ = allowN(t, l, "ip:1", 5)
+	assert.Equal(t, 3, allowed)
+
+	clk.Advance(2 * time.Minute)
+	allowed, _ = allowN(t, l, "ip:1", 10)
+	assert.Equal(t, 10, allowed)
+}
+
+func TestSlidingWindow_RetryAfterWithRoomInCurrentWindow(t *testing.T) {
+	clk := newClock()
+	l := ratelimit.NewSlidingWindow(cache.NewInMemoryCache(), 10, time.Minute, ratelimit.WithClock(clk.Now))
+	allowN(t, l, "k", 10)
+
+	// 15 ثانیه بعد: 10*0.75 + 3 > 10، اما پنجره‌ی جاری جا دارد
+	clk.Advance(time.Minute + 15*time.Second)
+	allowed, last := allowN(t, l, "k", 3)
+	assert.Equal(t, 2, allowed)
+	assert.False(t, last.Allowed)
+	assert.Greater(t, last.RetryAfter, time.Duration(0))
+	assert.Less(t, last.RetryAfter, 45*time.Second)
+
+	clk.Advance(last.RetryAfter)
+	res, err := l.Allow(ctx, "k")
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+}
+
+// newRedisCache returns a cache on a fresh miniredis, which implements cache.BucketTaker.
+func newRedisCache(t *testing.T) *cache.RedisCache {
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { client.Close() })
+	return cache.NewRedisCache(client, "test:")
+}
+
+func TestTokenBucket(t *testing.T) {
+	t.Run("memory", func(t *testing.T) { testTokenBucket(t, cache.NewInMemoryCache()) })
+	t.Run("redis", func(t *testing.T) { testTokenBucket(t, newRedisCache(t)) })
+}
+
+func testTokenBucket(t *testing.T, c cache.Cache) {
+	clk := newClock()
+	// 6 توکن در دقیقه (یکی هر 10 ثانیه)، حداکثر 3
+	l := ratelimit.NewTokenBucket(c, 6, time.Minute, 3, ratelimit.WithClock(clk.Now))
+
+	allowed, last := allowN(t, l, "user:1", 4)
+	assert.Equal(t, 3, allowed)
+	assert.False(t, last.Allowed)
+	assert.Equal(t, 3, last.Limit)
+	assert.Equal(t, 10*time.Second, last.RetryAfter)
+	assert.Equal(t, 30*time.Second, last.Reset)
+
+	clk.Advance(10 * time.Second)
+	allowed, _ = allowN(t, l, "user:1", 2)
+	assert.Equal(t, 1, allowed)
+
+	// بعد از مدت طولانی سطل فقط تا ظرفیت پر می‌شود
+	clk.Advance(time.Hour)
+	allowed, last = allowN(t, l, "user:1", 5)
+	assert.Equal(t, 3, allowed)
+	assert.Equal(t, 0, last.Remaining)
+}
+
+func TestTokenBucket_Concurrent(t *testing.T) {
+	l := ratelimit.NewTokenBucket(cache.NewInMemoryCache(), 1, time.Hour, 20)
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for range 100 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if res, err := l.Allow(ctx, "k"); err == nil && res.Allowed {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(20), allowed.Load())
+}
+
+func TestTokenBucket_SharedAcrossInstances(t *testing.T) {
+	c := newRedisCache(t)
+	// دو نمونه‌ی سرویس با یک Redis مشترک
+	limiters := []ratelimit.Limiter{
+		ratelimit.NewTokenBucket(c, 1, time.Hour, 20),
+		ratelimit.NewTokenBucket(c, 1, time.Hour, 20),
+	}
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for i := range 100 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if res, err := limiters[i%2].Allow(ctx, "k"); err == nil && res.Allowed {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(20), allowed.Load())
+}
@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+	"user-go/internal/cache"
+)
+
+type slidingWindow struct {
+	cache  cache.Cache
+	limit  int
+	window time.Duration
+	now    func() time.Time
+}
+
+// NewSlidingWindow allows limit requests per window. The count is the current fixed window
+// plus the previous one weighted by how much of it still overlaps the sliding window, so the
+// only cache operation that must be atomic is IncrWithExpire. Rejected requests count too,
+// so a client that keeps hammering stays limited.
+func NewSlidingWindow(c cache.Cache, limit int, window time.Duration, opts ...Option) Limiter {
+	o := buildOptions(opts)
+	return &slidingWindow{cache: c, limit: limit, window: window, now: o.now}
+}
+
+func (l *slidingWindow) Policy() string {
+	return fmt.Sprintf("%d;w=%d", l.limit, int(l.window.Seconds()))
+}
+
+func (l *slidingWindow) Allow(ctx context.Context, key string) (Result, error) {
+	now := l.now()
+	index := now.UnixNano() / int64(l.window)
+	elapsed := time.Duration(now.UnixNano() - index*int64(l.window))
+	base := keyPrefix + key + ":"
+
+	// پنجره‌ی جاری تا پایان پنجره‌ی بعدی به‌عنوان «قبلی» لازم است
+	current, err := l.cache.IncrWithExpire(ctx, base+strconv.FormatInt(index, 10), 2*int(l.window.Seconds()))
+	if err != nil {
+		return Result{}, err
+	}
+	previous := 0
+	val, err := l.cache.Get(ctx, base+strconv.FormatInt(index-1, 10))
+	switch {
+	case err == nil:
+		previous, _ = strconv.Atoi(val)
+	case !errors.Is(err, cache.ErrNotFound):
+		return Result{}, err
+	}
+
+	weight := 1 - float64(elapsed)/float64(l.window)
+	estimate := float64(previous)*weight + float64(current)
+	toWindowEnd := l.window - elapsed
+
+	res := Result{
+		Allowed:   estimate <= float64(l.limit),
+		Limit:     l.limit,
+		Remaining: max(0, l.limit-int(math.Ceil(estimate))),
+		// همه‌ی سهمیه حداکثر بعد از یک پنجره‌ی کامل از پایان پنجره‌ی جاری برمی‌گردد
+		Reset: ceilSeconds(toWindowEnd),
+	}
+	if !res.Allowed {
+		res.RetryAfter = ceilSeconds(toWindowEnd)
+		// اگر پنجره‌ی جاری هنوز جا دارد، کافی است سهم پنجره‌ی قبلی به اندازه‌ی کافی کم شود
+		if room := float64(l.limit - current - 1); room > 0 && previous > 0 {
+			wait := time.Duration((weight - room/float64(previous)) * float64(l.window))
+			res.RetryAfter = ceilSeconds(max(wait, time.Second))
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,120 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"user-go/internal/cache"
+)
+
+// bucketLocks stripes the in-process lock of token buckets by key.
+const bucketLocks = 64
+
+type tokenBucket struct {
+	cache  cache.Cache
+	rate   int
+	burst  int
+	perSec float64
+	period time.Duration
+	now    func() time.Time
+	locks  [bucketLocks]sync.Mutex
+}
+
+// NewTokenBucket refills rate tokens per period up to burst, and each request takes one.
+// A cache.BucketTaker (Redis) updates the bucket atomically, so instances sharing it agree.
+// Any other cache is read and written back under a per-process lock, which is exact only
+// while that cache is not shared between processes.
+func NewTokenBucket(c cache.Cache, rate int, period time.Duration, burst int, opts ...Option) Limiter {
+	o := buildOptions(opts)
+	return &tokenBucket{cache: c, rate: rate, burst: burst, perSec: float64(rate) / period.Seconds(), period: period, now: o.now}
+}
+
+func (l *tokenBucket) Policy() string {
+	return fmt.Sprintf("%d;w=%d;burst=%d", l.rate, int(ceilSeconds(l.period).Seconds()), l.burst)
+}
+
+func (l *tokenBucket) Allow(ctx context.Context, key string) (Result, error) {
+	if b, ok := l.cache.(cache.BucketTaker); ok {
+		tokens, taken, err := b.TakeToken(ctx, keyPrefix+key, l.burst, l.perSec, l.now())
+		if err != nil {
+			return Result{}, err
+		}
+		return l.result(tokens, taken), nil
+	}
+
+	mu := &l.locks[stripe(key)]
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := l.now()
+	cacheKey := keyPrefix + key
+	tokens := float64(l.burst)
+	val, err := l.cache.Get(ctx, cacheKey)
+	switch {
+	case err == nil:
+		if saved, at, ok := parseBucket(val); ok {
+			refill := now.Sub(at).Seconds() * l.perSec
+			tokens = math.Min(float64(l.burst), saved+max(refill, 0))
+		}
+	case !errors.Is(err, cache.ErrNotFound):
+		return Result{}, err
+	}
+
+	taken := tokens >= 1
+	if taken {
+		tokens--
+	}
+	res := l.result(tokens, taken)
+
+	// سطل پر نیازی به نگهداری ندارد؛ TTL تا پر شدن دوباره کافی است
+	ttl := int(res.Reset.Seconds()) + 1
+	state := strconv.FormatFloat(tokens, 'f', 6, 64) + "," + strconv.FormatInt(now.UnixNano(), 10)
+	if err := l.cache.SetWithTTL(ctx, cacheKey, state, ttl); err != nil {
+		return Result{}, err
+	}
+	return res, nil
+}
+
+// result reports a bucket left with tokens after a request that took one if taken.
+func (l *tokenBucket) result(tokens float64, taken bool) Result {
+	res := Result{Allowed: taken, Limit: l.burst, Remaining: int(math.Floor(tokens))}
+	if !taken {
+		res.RetryAfter = ceilSeconds(l.secondsUntil(1 - tokens))
+	}
+	res.Reset = ceilSeconds(l.secondsUntil(float64(l.burst) - tokens))
+	return res
+}
+
+// secondsUntil is how long refilling n tokens takes.
+func (l *tokenBucket) secondsUntil(n float64) time.Duration {
+	return time.Duration(n / l.perSec * float64(time.Second))
+}
+
+// parseBucket reads the "tokens,unixnano" state written by Allow.
+func parseBucket(val string) (float64, time.Time, bool) {
+	tokensStr, atStr, ok := strings.Cut(val, ",")
+	if !ok {
+		return 0, time.Time{}, false
+	}
+	tokens, err := strconv.ParseFloat(tokensStr, 64)
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+	at, err := strconv.ParseInt(atStr, 10, 64)
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+	return tokens, time.Unix(0, at), true
+}
+
+func stripe(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32() % bucketLocks
+}
@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// AuditAction names what happened in an AuditEvent.
+type AuditAction string
+
+const (
+	AuditOTPRequested AuditAction = "otp_requested"
+	AuditOTPValidated AuditAction = "otp_validated"
+	AuditLogin        AuditAction = "login"
+	AuditUserCreated  AuditAction = "user_created"
+	AuditPhoneChanged AuditAction = "phone_changed"
+	AuditUserDeleted  AuditAction = "user_deleted"
+	AuditUserRestored AuditAction = "user_restored"
+	AuditUserPurged   AuditAction = "user_purged"
+)
+
+// AuditOutcome says whether the audited action went through.
+type AuditOutcome string
+
+const (
+	AuditSuccess AuditOutcome = "success"
+	AuditFailure AuditOutcome = "failure"
+)
+
+// AuditEvent is one append-only audit record.
+type AuditEvent struct {
+	ID     int64       `json:"id"`
+	Action AuditAction `json:"action"`
+	// ActorID is the user who acted; empty before login.
+	ActorID string `json:"actor_id,omitempty"`
+	// TargetID is the user acted on, when known.
+	TargetID string `json:"target_id,omitempty"`
+	// PhoneHash identifies the phone involved without storing it, so a purged user leaves no number behind.
+	PhoneHash string       `json:"phone_hash,omitempty"`
+	IP        string       `json:"ip,omitempty"`
+	UserAgent string       `json:"user_agent,omitempty"`
+	Outcome   AuditOutcome `json:"outcome"`
+	// Reason is why the action failed, or how it was done, e.g. "admin" for a phone change.
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const (
+	DefaultAuditLimit = 100
+	MaxAuditLimit     = 500
+)
+
+// AuditQuery selects audit events. Zero fields do not filter.
+type AuditQuery struct {
+	// UserID matches events where the user is the actor or the target.
+	UserID string
+	// From is inclusive, Until exclusive.
+	From, Until time.Time
+	// Limit caps the result; zero means DefaultAuditLimit, and it never exceeds MaxAuditLimit.
+	Limit int
+}
+
+func (q AuditQuery) limit() int {
+	switch {
+	case q.Limit <= 0:
+		return DefaultAuditLimit
+	case q.Limit > MaxAuditLimit:
+		return MaxAuditLimit
+	}
+	return q.Limit
+}
+
+func (q AuditQuery) matches(e AuditEvent) bool {
+	if q.UserID != "" && e.ActorID != q.UserID && e.TargetID != q.UserID {
+		return false
+	}
+	if !q.From.IsZero() && e.CreatedAt.Before(q.From) {
+		return false
+	}
+	return q.Until.IsZero() || e.CreatedAt.Before(q.Until)
+}
+
+// AuditLog stores audit events. Events are never updated and outlive the users they name;
+// only the retention job deletes them, once they are old enough.
+type AuditLog interface {
+	AppendAudit(ctx context.Context, event AuditEvent) error
+	// AuditEvents returns the events matching q, newest first.
+	AuditEvents(ctx context.Context, q AuditQuery) ([]AuditEvent, error)
+	// PruneAudit deletes the events created before cutoff and returns how many.
+	PruneAudit(ctx context.Context, cutoff time.Time) (int, error)
+}
+
+func (r *InMemoryUserRepository) AppendAudit(ctx context.Context, event AuditEvent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	event.ID = int64(len(r.audit) + 1)
+	r.audit = append(r.audit, event)
+	return nil
+}
+
+func (r *InMemoryUserRepository) AuditEvents(ctx context.Context, q AuditQuery) ([]AuditEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	events := []AuditEvent{}
+	for i := len(r.audit) - 1; i >= 0 && len(events) < q.limit(); i-- {
+		if q.matches(r.audit[i]) {
+			events = append(events, r.audit[i])
+		}
+	}
+	return events, nil
+}
+
+func (r *InMemoryUserRepository) PruneAudit(ctx context.Context, cutoff time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.audit[:0]
+	for _, e := range r.audit {
+		if !e.CreatedAt.Before(cutoff) {
+			kept = append(kept, e)
+		}
+	}
+	pruned := len(r.audit) - len(kept)
+	r.audit = kept
+	return pruned, nil
+}
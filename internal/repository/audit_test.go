@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestInMemoryAuditLog(t *testing.T) {
+	repo := NewInMemoryUserRepository()
+	ctx := context.Background()
+	alice, bob := NewID(), NewID()
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	for i, e := range []AuditEvent{
+		{Action: AuditOTPRequested, PhoneHash: "abc", Outcome: AuditSuccess},
+		{Action: AuditLogin, ActorID: alice, TargetID: alice, Outcome: AuditSuccess},
+		{Action: AuditUserDeleted, ActorID: bob, TargetID: alice, Outcome: AuditSuccess},
+		{Action: AuditLogin, ActorID: bob, TargetID: bob, Outcome: AuditSuccess},
+	} {
+		e.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+		if err := repo.AppendAudit(ctx, e); err != nil {
+			t.Fatalf("AppendAudit failed: %v", err)
+		}
+	}
+
+	events, err := repo.AuditEvents(ctx, AuditQuery{UserID: alice})
+	if err != nil || len(events) != 2 {
+		t.Fatalf("expected 2 events for alice, got %+v, %v", events, err)
+	}
+	if events[0].Action != AuditUserDeleted || events[1].Action != AuditLogin {
+		t.Errorf("expected newest first, got %+v", events)
+	}
+
+	events, _ = repo.AuditEvents(ctx, AuditQuery{From: base.Add(time.Minute), Until: base.Add(3 * time.Minute)})
+	if len(events) != 2 || events[0].ID != 3 || events[1].ID != 2 {
+		t.Errorf("expected events 3 and 2 in range, got %+v", events)
+	}
+
+	events, _ = repo.AuditEvents(ctx, AuditQuery{Limit: 1})
+	if len(events) != 1 || events[0].ActorID != bob {
+		t.Errorf("expected only the latest event, got %+v", events)
+	}
+
+	// حذف کاربر رویدادهایش را پاک نمی‌کند
+	user, _ := repo.Create(ctx, "+989120000000")
+	_ = repo.AppendAudit(ctx, AuditEvent{Action: AuditUserCreated, TargetID: user.ID, Outcome: AuditSuccess})
+	if err := repo.Purge(ctx, user.ID); err != nil {
+		t.Fatalf("Purge failed: %v", err)
+	}
+	if events, _ := repo.AuditEvents(ctx, AuditQuery{UserID: user.ID}); len(events) != 1 {
+		t.Errorf("expected audit events to outlive the user, got %+v", events)
+	}
+
+	// فقط رویدادهای قدیمی‌تر از cutoff حذف می‌شوند
+	if n, err := repo.PruneAudit(ctx, base.Add(2*time.Minute)); err != nil || n != 2 {
+		t.Fatalf("expected 2 pruned events, got %d, %v", n, err)
+	}
+	if events, _ := repo.AuditEvents(ctx, AuditQuery{Until: base.Add(2 * time.Minute)}); len(events) != 0 {
+		t.Errorf("expected old events to be pruned, got %+v", events)
+	}
+	if events, _ := repo.AuditEvents(ctx, AuditQuery{}); len(events) != 3 {
+		t.Errorf("expected 3 events to remain, got %+v", events)
+	}
+}
+
+func TestAuditQuery_Limit(t *testing.T) {
+	for in, want := range map[int]int{0: DefaultAuditLimit, -1: DefaultAuditLimit, 10: 10, MaxAuditLimit + 1: MaxAuditLimit} {
+		if got := (AuditQuery{Limit: in}).limit(); got != want {
+			t.Errorf("limit(%d) = %d, want %d", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+	"user-go/internal/apperr"
+)
+
+// BlockKind says how a user is blocked.
+type BlockKind string
+
+const (
+	// BlockSuspended lasts until Block.Until.
+	BlockSuspended BlockKind = "suspended"
+	// BlockBanned lasts until an admin lifts it.
+	BlockBanned BlockKind = "banned"
+)
+
+// Block keeps a user from logging in or using existing tokens.
+type Block struct {
+	Kind      BlockKind  `json:"kind"`
+	Reason    string     `json:"reason"`
+	Until     *time.Time `json:"until,omitempty"`
+	BlockedBy string     `json:"blocked_by,omitempty"`
+	BlockedAt time.Time  `json:"blocked_at"`
+}
+
+// Active reports whether b still applies at now. A nil block never does.
+func (b *Block) Active(now time.Time) bool {
+	return b != nil && (b.Until == nil || now.Before(*b.Until))
+}
+
+// PhoneBan blocks every number starting with Prefix, registered or not.
+type PhoneBan struct {
+	Prefix    string    `json:"prefix"`
+	Reason    string    `json:"reason"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+var ErrBanNotFound = apperr.New(apperr.NotFound, "phone_ban_not_found", "phone ban not found")
+
+// PhoneBanRepository stores phone prefix bans. Prefixes are normalized by the caller.
+type PhoneBanRepository interface {
+	// AddPhoneBan creates the ban or replaces the one with the same prefix.
+	AddPhoneBan(ctx context.Context, ban PhoneBan) error
+	RemovePhoneBan(ctx context.Context, prefix string) error
+	// ListPhoneBans returns every ban ordered by prefix.
+	ListPhoneBans(ctx context.Context) ([]PhoneBan, error)
+}
+
+// MatchPhoneBan returns the longest ban whose prefix starts phone, or nil.
+func MatchPhoneBan(bans []PhoneBan, phone string) *PhoneBan {
+	var match *PhoneBan
+	for i := range bans {
+		if strings.HasPrefix(phone, bans[i].Prefix) && (match == nil || len(bans[i].Prefix) > len(match.Prefix)) {
+			match = &bans[i]
+		}
+	}
+	return match
+}
+
+// SetBlock blocks the user, or unblocks them when block is nil.
+func (r *InMemoryUserRepository) SetBlock(ctx context.Context, id string, block *Block) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, exists := r.live(id)
+	if !exists {
+		return ErrUserNotFound
+	}
+	if block != nil {
+		b := *block
+		block = &b
+	}
+	user.Block = block
+	user.UpdatedAt = time.Now()
+	r.users[id] = user
+	return nil
+}
+
+func (r *InMemoryUserRepository) AddPhoneBan(ctx context.Context, ban PhoneBan) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if ban.CreatedAt.IsZero() {
+		ban.CreatedAt = time.Now()
+	}
+	r.bans[ban.Prefix] = ban
+	return nil
+}
+
+func (r *InMemoryUserRepository) RemovePhoneBan(ctx context.Context, prefix string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.bans[prefix]; !exists {
+		return ErrBanNotFound
+	}
+	delete(r.bans, prefix)
+	return nil
+}
+
+func (r *InMemoryUserRepository) ListPhoneBans(ctx context.Context) ([]PhoneBan, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	bans := make([]PhoneBan, 0, len(r.bans))
+	for _, ban := range r.bans {
+		bans = append(bans, ban)
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].Prefix < bans[j].Prefix })
+	return bans, nil
+}
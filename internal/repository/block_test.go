@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBlock_Active(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+
+	var none *Block
+	if none.Active(now) {
+		t.Error("nil block must not be active")
+	}
+	if !(&Block{Kind: BlockBanned}).Active(now) {
+		t.Error("ban without end must be active")
+	}
+	if !(&Block{Kind: BlockSuspended, Until: &future}).Active(now) {
+		t.Error("suspension must be active until it ends")
+	}
+	if (&Block{Kind: BlockSuspended, Until: &past}).Active(now) {
+		t.Error("expired suspension must not be active")
+	}
+}
+
+func TestMatchPhoneBan(t *testing.T) {
+	bans := []PhoneBan{{Prefix: "+98"}, {Prefix: "+98912", Reason: "fraud"}, {Prefix: "+1"}}
+
+	if ban := MatchPhoneBan(bans, "+989121234567"); ban == nil || ban.Prefix != "+98912" {
+		t.Errorf("expected longest prefix +98912, got %+v", ban)
+	}
+	if ban := MatchPhoneBan(bans, "+989351234567"); ban == nil || ban.Prefix != "+98" {
+		t.Errorf("expected +98, got %+v", ban)
+	}
+	if ban := MatchPhoneBan(bans, "+447700900123"); ban != nil {
+		t.Errorf("expected no match, got %+v", ban)
+	}
+}
+
+func TestInMemoryUserRepository_SetBlock(t *testing.T) {
+	repo := NewInMemoryUserRepository()
+	user, _ := repo.Create(ctx, "+989120000111")
+
+	block := &Block{Kind: BlockBanned, Reason: "spam"}
+	if err := repo.SetBlock(ctx, user.ID, block); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	block.Reason = "changed"
+	got, _ := repo.GetByID(ctx, user.ID)
+	if got.Block == nil || got.Block.Reason != "spam" {
+		t.Errorf("expected stored copy of the block, got %+v", got.Block)
+	}
+
+	if err := repo.SetBlock(ctx, user.ID, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, _ := repo.GetByID(ctx, user.ID); got.Block != nil {
+		t.Errorf("expected block to be cleared, got %+v", got.Block)
+	}
+
+	_ = repo.Delete(ctx, user.ID)
+	if err := repo.SetBlock(ctx, user.ID, block); err != ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound for deleted user, got %v", err)
+	}
+}
+
+func TestInMemoryUserRepository_PhoneBans(t *testing.T) {
+	repo := NewInMemoryUserRepository()
+
+	_ = repo.AddPhoneBan(ctx, PhoneBan{Prefix: "+98912", Reason: "fraud"})
+	_ = repo.AddPhoneBan(ctx, PhoneBan{Prefix: "+1", Reason: "spam"})
+	_ = repo.AddPhoneBan(ctx, PhoneBan{Prefix: "+98912", Reason: "updated"})
+
+	bans, err := repo.ListPhoneBans(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(bans) != 2 || bans[0].Prefix != "+1" || bans[1].Reason != "updated" {
+		t.Errorf("unexpected bans: %+v", bans)
+	}
+
+	if err := repo.RemovePhoneBan(ctx, "+1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := repo.RemovePhoneBan(ctx, "+1"); err != ErrBanNotFound {
+		t.Errorf("expected ErrBanNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Backoff bounds of WaitForPostgres.
+const (
+	connectRetryMin = 500 * time.Millisecond
+	connectRetryMax = 10 * time.Second
+)
+
+// WaitForPostgres pings pool until the database answers or ctx is done, backing off between
+// attempts. onRetry, if not nil, is called after each failed attempt with the wait before the
+// next one. It returns the last ping error once ctx ends.
+func WaitForPostgres(ctx context.Context, pool *pgxpool.Pool, onRetry func(attempt int, err error, wait time.Duration)) error {
+	wait := connectRetryMin
+	for attempt := 1; ; attempt++ {
+		err := pool.Ping(ctx)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		if onRetry != nil {
+			onRetry(attempt, err, wait)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		// دیتابیس هنگام deploy معمولاً چند ثانیه بعد از اپ بالا می‌آید
+		wait = min(wait*2, connectRetryMax)
+	}
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestWaitForPostgres_GivesUp(t *testing.T) {
+	// پورتی که کسی روی آن گوش نمی‌دهد
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	pool, err := pgxpool.New(context.Background(), "postgres://user:pass@"+addr+"/db?connect_timeout=1")
+	if err != nil {
+		t.Fatalf("pgxpool.New: %v", err)
+	}
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1200*time.Millisecond)
+	defer cancel()
+	var waits []time.Duration
+	err = WaitForPostgres(ctx, pool, func(attempt int, err error, wait time.Duration) {
+		if attempt != len(waits)+1 {
+			t.Errorf("expected attempt %d, got %d", len(waits)+1, attempt)
+		}
+		waits = append(waits, wait)
+	})
+	if err == nil {
+		t.Fatal("expected an error once the context ended")
+	}
+	if len(waits) < 2 || waits[0] != connectRetryMin || waits[1] != 2*connectRetryMin {
+		t.Errorf("expected doubling backoff, got %v", waits)
+	}
+}
+
+func TestWaitForPostgres_Connects(t *testing.T) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL not set, skipping DB test")
+	}
+	pool, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		t.Fatalf("pgxpool.New: %v", err)
+	}
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := WaitForPostgres(ctx, pool, nil); err != nil {
+		t.Fatalf("WaitForPostgres failed: %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package repository
+
+import "testing"
+
+func TestNewID(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		id := NewID()
+		if !ValidID(id) {
+			t.Fatalf("NewID returned invalid id %q", id)
+		}
+		if id[14] != '7' {
+			t.Fatalf("expected version 7, got %q", id)
+		}
+		if seen[id] {
+			t.Fatalf("duplicate id %q", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestValidID(t *testing.T) {
+	for _, id := range []string{"", "+989121111111", "0190f1e2-7c3a-7b4d-8e5f-6a7b8c9d0e1", "0190F1E2-7C3A-7B4D-8E5F-6A7B8C9D0E1F", "0190f1e2x7c3a-7b4d-8e5f-6a7b8c9d0e1f"} {
+		if ValidID(id) {
+			t.Errorf("ValidID(%q) = true", id)
+		}
+	}
+	if !ValidID("0190f1e2-7c3a-7b4d-8e5f-6a7b8c9d0e1f") {
+		t.Error("expected canonical uuid to be valid")
+	}
+}
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+	"user-go/internal/apperr"
+)
+
+// Ordering contract shared by every UserRepository:
+//
+//   - SortNewest (default): registration_date DESC, phone DESC
+//   - SortOldest:           registration_date ASC,  phone ASC
+//   - SortPhoneAsc:         phone ASC
+//   - SortPhoneDesc:        phone DESC
+//
+// phone is unique, so each order is total and a cursor (the sort key of the last
+// row returned) identifies exactly where the next page starts.
+type SortOrder string
+
+const (
+	SortNewest    SortOrder = "-registration_date"
+	SortOldest    SortOrder = "registration_date"
+	SortPhoneAsc  SortOrder = "phone"
+	SortPhoneDesc SortOrder = "-phone"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+var (
+	ErrInvalidCursor = apperr.New(apperr.Invalid, "invalid_cursor", "invalid cursor")
+	ErrInvalidSort   = apperr.New(apperr.Invalid, "invalid_sort", "invalid sort order")
+)
+
+// Valid reports whether s is one of the supported orders.
+func (s SortOrder) Valid() bool {
+	switch s {
+	case SortNewest, SortOldest, SortPhoneAsc, SortPhoneDesc:
+		return true
+	}
+	return false
+}
+
+func (s SortOrder) descending() bool { return strings.HasPrefix(string(s), "-") }
+
+func (s SortOrder) byPhone() bool { return s == SortPhoneAsc || s == SortPhoneDesc }
+
+// ListOptions selects one page of users. Zero values mean "no filter".
+type ListOptions struct {
+	Limit  int
+	Cursor string
+	Sort   SortOrder
+
+	Search           string    // substring of phone
+	Role             Role      // exact role
+	RegisteredFrom   time.Time // inclusive
+	RegisteredBefore time.Time // exclusive
+	Deleted          bool      // only soft-deleted users instead of live ones
+}
+
+// UserPage is one page of List results. NextCursor is empty on the last page;
+// Total counts every user matching the filters, not just this page.
+type UserPage struct {
+	Users      []User `json:"users"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Total      int    `json:"total"`
+}
+
+// cursor is the sort key of the last row on a page. Sort is kept so a cursor
+// cannot be replayed against a different order.
+type cursor struct {
+	Sort  SortOrder `json:"s"`
+	Phone string    `json:"p"`
+	Date  time.Time `json:"d,omitempty"`
+}
+
+func encodeCursor(sort SortOrder, u User) string {
+	b, _ := json.Marshal(cursor{Sort: sort, Phone: u.Phone, Date: u.RegistrationDate})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string, sort SortOrder) (*cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.Sort != sort || c.Phone == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// normalize applies defaults and validates opts, returning the decoded cursor if any.
+func (o *ListOptions) normalize() (*cursor, error) {
+	if o.Sort == "" {
+		o.Sort = SortNewest
+	}
+	if !o.Sort.Valid() {
+		return nil, ErrInvalidSort
+	}
+	if o.Role != "" && !o.Role.Valid() {
+		return nil, ErrInvalidRole
+	}
+	if o.Limit <= 0 {
+		o.Limit = DefaultPageSize
+	}
+	if o.Limit > MaxPageSize {
+		o.Limit = MaxPageSize
+	}
+	o.Search = strings.TrimSpace(o.Search)
+	if o.Cursor == "" {
+		return nil, nil
+	}
+	return decodeCursor(o.Cursor, o.Sort)
+}
+
+// before reports whether a comes before b under sort.
+func (s SortOrder) before(a, b cursor) bool {
+	if s.descending() {
+		a, b = b, a
+	}
+	if s.byPhone() || a.Date.Equal(b.Date) {
+		return a.Phone < b.Phone
+	}
+	return a.Date.Before(b.Date)
+}
+
+func keyOf(u User) cursor { return cursor{Phone: u.Phone, Date: u.RegistrationDate} }
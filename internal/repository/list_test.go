@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// seedUsers creates users whose registration dates are set explicitly; two share a date to exercise the phone tie-break.
+func seedUsers(t *testing.T) *InMemoryUserRepository {
+	t.Helper()
+	repo := NewInMemoryUserRepository()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	dates := map[string]time.Time{
+		"+989120000111": base,
+		"+989120000222": base.Add(time.Hour),
+		"+989120000333": base.Add(time.Hour),
+		"+989120000444": base.Add(2 * time.Hour),
+		"+989120000555": base.Add(3 * time.Hour),
+	}
+	for phone, d := range dates {
+		if _, err := repo.Create(ctx, phone); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		id := repo.byPhone[phone]
+		u := repo.users[id]
+		u.RegistrationDate = d
+		repo.users[id] = u
+	}
+	return repo
+}
+
+func collect(t *testing.T, repo UserRepository, opts ListOptions) []string {
+	t.Helper()
+	var phones []string
+	for {
+		page, err := repo.ListPage(ctx, opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, u := range page.Users {
+			phones = append(phones, u.Phone)
+		}
+		if page.NextCursor == "" {
+			return phones
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
+
+// checkSearchIsLiteral is shared by the in-memory and Postgres tests: search is a plain
+// substring of the phone, so LIKE wildcards in it must match only themselves. phone must
+// belong to a user of repo.
+func checkSearchIsLiteral(t *testing.T, repo UserRepository, phone string) {
+	t.Helper()
+	wildcard := phone[:len(phone)-2] + "_" + phone[len(phone)-1:]
+	for _, search := range []string{phone[len(phone)-4:], wildcard, "%", "_", `\`} {
+		want := 0
+		if strings.Contains(phone, search) {
+			want = 1
+		}
+		users, err := repo.List(ctx, 0, 100, search)
+		if err != nil {
+			t.Fatalf("List(%q) failed: %v", search, err)
+		}
+		if len(users) != want {
+			t.Errorf("List(%q) returned %d users, want %d", search, len(users), want)
+		}
+		if got := collect(t, repo, ListOptions{Search: search}); len(got) != want {
+			t.Errorf("ListPage(%q) returned %v, want %d users", search, got, want)
+		}
+	}
+}
+
+func TestInMemoryUserRepository_SearchIsLiteral(t *testing.T) {
+	checkSearchIsLiteral(t, seedUsers(t), "+989120000111")
+}
+
+func TestInMemoryUserRepository_ListPageOrdering(t *testing.T) {
+	repo := seedUsers(t)
+
+	cases := map[SortOrder][]string{
+		SortNewest:    {"+989120000555", "+989120000444", "+989120000333", "+989120000222", "+989120000111"},
+		SortOldest:    {"+989120000111", "+989120000222", "+989120000333", "+989120000444", "+989120000555"},
+		SortPhoneAsc:  {"+989120000111", "+989120000222", "+989120000333", "+989120000444", "+989120000555"},
+		SortPhoneDesc: {"+989120000555", "+989120000444", "+989120000333", "+989120000222", "+989120000111"},
+	}
+	for order, want := range cases {
+		for _, limit := range []int{1, 2, 10} {
+			got := collect(t, repo, ListOptions{Sort: order, Limit: limit})
+			if len(got) != len(want) {
+				t.Fatalf("%s limit=%d: got %v, want %v", order, limit, got, want)
+			}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Errorf("%s limit=%d: got %v, want %v", order, limit, got, want)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestInMemoryUserRepository_ListPageFilters(t *testing.T) {
+	repo := seedUsers(t)
+	_ = repo.UpdateRole(ctx, repo.byPhone["+989120000444"], RoleAdmin)
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	page, err := repo.ListPage(ctx, ListOptions{RegisteredFrom: base.Add(time.Hour), RegisteredBefore: base.Add(3 * time.Hour), Limit: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if page.Total != 3 || len(page.Users) != 1 || page.NextCursor == "" {
+		t.Errorf("unexpected page: %+v", page)
+	}
+
+	page, _ = repo.ListPage(ctx, ListOptions{Role: RoleAdmin})
+	if page.Total != 1 || page.Users[0].Phone != "+989120000444" {
+		t.Errorf("role filter: unexpected page %+v", page)
+	}
+}
+
+func TestInMemoryUserRepository_ListPageRejectsBadInput(t *testing.T) {
+	repo := seedUsers(t)
+	page, _ := repo.ListPage(ctx, ListOptions{Limit: 1})
+
+	if _, err := repo.ListPage(ctx, ListOptions{Sort: "name"}); err != ErrInvalidSort {
+		t.Errorf("expected ErrInvalidSort, got %v", err)
+	}
+	if _, err := repo.ListPage(ctx, ListOptions{Cursor: "!!"}); err != ErrInvalidCursor {
+		t.Errorf("expected ErrInvalidCursor, got %v", err)
+	}
+	// cursor from a different sort order
+	if _, err := repo.ListPage(ctx, ListOptions{Cursor: page.NextCursor, Sort: SortPhoneAsc}); err != ErrInvalidCursor {
+		t.Errorf("expected ErrInvalidCursor for mismatched sort, got %v", err)
+	}
+	if _, err := repo.ListPage(ctx, ListOptions{Role: "root"}); err != ErrInvalidRole {
+		t.Errorf("expected ErrInvalidRole, got %v", err)
+	}
+}
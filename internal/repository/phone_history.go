@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// PhoneChangeMethod records how a phone number was changed.
+type PhoneChangeMethod string
+
+const (
+	// PhoneChangeVerified means the owner proved the new number with an OTP.
+	PhoneChangeVerified PhoneChangeMethod = "verified"
+	// PhoneChangeAdmin is an administrator override without verification.
+	PhoneChangeAdmin PhoneChangeMethod = "admin"
+)
+
+// PhoneChange is one entry of a user's phone history.
+type PhoneChange struct {
+	OldPhone  string            `json:"old_phone"`
+	NewPhone  string            `json:"new_phone"`
+	Method    PhoneChangeMethod `json:"method"`
+	ChangedBy string            `json:"changed_by,omitempty"`
+	ChangedAt time.Time         `json:"changed_at"`
+}
+
+// PhoneHistory returns the phone changes of a user, newest first.
+func (r *InMemoryUserRepository) PhoneHistory(ctx context.Context, id string) ([]PhoneChange, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, exists := r.live(id); !exists {
+		return nil, ErrUserNotFound
+	}
+	entries := r.history[id]
+	out := make([]PhoneChange, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		out = append(out, entries[i])
+	}
+	return out, nil
+}
@@ -2,26 +2,126 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
+	"user-go/internal/metrics"
+	"user-go/internal/tracing"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// DefaultQueryTimeout bounds each repository call unless overridden.
+const DefaultQueryTimeout = 5 * time.Second
+
 type PostgresUserRepository struct {
-	pool *pgxpool.Pool
+	pool         *pgxpool.Pool
+	queryTimeout time.Duration
+	metrics      *metrics.Metrics
+}
+
+// PostgresOption configures a PostgresUserRepository.
+type PostgresOption func(*PostgresUserRepository)
+
+// WithQueryTimeout bounds every repository call on top of the caller's context. Zero disables the bound.
+func WithQueryTimeout(d time.Duration) PostgresOption {
+	return func(r *PostgresUserRepository) { r.queryTimeout = d }
+}
+
+// WithMetrics records the latency of every repository call per method.
+func WithMetrics(m *metrics.Metrics) PostgresOption {
+	return func(r *PostgresUserRepository) { r.metrics = m }
 }
 
-func NewPostgresUserRepository(pool *pgxpool.Pool) *PostgresUserRepository {
-	return &PostgresUserRepository{pool: pool}
+func NewPostgresUserRepository(pool *pgxpool.Pool, opts ...PostgresOption) *PostgresUserRepository {
+	r := &PostgresUserRepository{pool: pool, queryTimeout: DefaultQueryTimeout}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// begin opens a span for method and applies the per-operation query timeout to ctx.
+// The returned func cancels it, ends the span and records how long method took.
+func (r *PostgresUserRepository) begin(ctx context.Context, method string) (context.Context, context.CancelFunc) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "UserRepository."+method)
+	cancel := context.CancelFunc(func() {})
+	if r.queryTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, r.queryTimeout)
+	}
+	return ctx, func() {
+		cancel()
+		span.End()
+		r.metrics.ObserveQuery(method, start)
+	}
 }
 
-func (r *PostgresUserRepository) GetByPhone(phone string) (*User, error) {
+// uniqueViolation is the Postgres SQLSTATE for a unique constraint failure.
+const uniqueViolation = "23505"
+
+// foreignKeyViolation is the Postgres SQLSTATE for a row referencing a missing one.
+const foreignKeyViolation = "23503"
+
+// userColumns is the column list scanUser expects, in order.
+const userColumns = "id, phone, role, display_name, email, avatar_url, locale, timezone, metadata, registration_date, updated_at, deleted_at, " +
+	"block_kind, block_reason, block_until, COALESCE(blocked_by::text, ''), blocked_at"
+
+func scanUser(row pgx.Row) (*User, error) {
 	var user User
-	err := r.pool.QueryRow(context.Background(),
-		"SELECT phone, registration_date FROM users WHERE phone=$1", phone).
-		Scan(&user.Phone, &user.RegistrationDate)
+	var metadata []byte
+	var block Block
+	var blockKind *string
+	var blockedAt *time.Time
+	err := row.Scan(&user.ID, &user.Phone, &user.Role, &user.DisplayName, &user.Email, &user.AvatarURL,
+		&user.Locale, &user.Timezone, &metadata, &user.RegistrationDate, &user.UpdatedAt, &user.DeletedAt,
+		&blockKind, &block.Reason, &block.Until, &block.BlockedBy, &blockedAt)
+	if err != nil {
+		return nil, err
+	}
+	user.Metadata = json.RawMessage(metadata)
+	if blockKind != nil {
+		block.Kind = BlockKind(*blockKind)
+		if blockedAt != nil {
+			block.BlockedAt = *blockedAt
+		}
+		user.Block = &block
+	}
+	return &user, nil
+}
+
+func (r *PostgresUserRepository) GetByID(ctx context.Context, id string) (*User, error) {
+	if !ValidID(id) {
+		return nil, ErrUserNotFound
+	}
+	ctx, cancel := r.begin(ctx, "GetByID")
+	defer cancel()
+
+	user, err := scanUser(r.pool.QueryRow(ctx,
+		"SELECT "+userColumns+" FROM users WHERE id=$1 AND deleted_at IS NULL", id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *PostgresUserRepository) GetByPhone(ctx context.Context, phone string) (*User, error) {
+	phone, err := normalizePhone(phone)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	ctx, cancel := r.begin(ctx, "GetByPhone")
+	defer cancel()
+
+	user, err := scanUser(r.pool.QueryRow(ctx,
+		"SELECT "+userColumns+" FROM users WHERE phone=$1", phone))
 
 	if err != nil {
 		// اگر ردیف پیدا نشد، ارور استاندارد repository.ErrUserNotFound را بازگردان
@@ -30,23 +130,50 @@ func (r *PostgresUserRepository) GetByPhone(phone string) (*User, error) {
 		}
 		return nil, err
 	}
-	return &user, nil
+	if user.DeletedAt != nil {
+		return nil, ErrUserDeleted
+	}
+	return user, nil
 }
 
-func (r *PostgresUserRepository) Create(phone string) (*User, error) {
+func (r *PostgresUserRepository) Create(ctx context.Context, phone string) (*User, error) {
+	phone, err := normalizePhone(phone)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := r.begin(ctx, "Create")
+	defer cancel()
+
+	id := NewID()
 	now := time.Now()
-	_, err := r.pool.Exec(context.Background(),
-		"INSERT INTO users (phone, registration_date) VALUES ($1, $2)", phone, now)
+	_, err = r.pool.Exec(ctx,
+		"INSERT INTO users (id, phone, role, registration_date, updated_at) VALUES ($1, $2, $3, $4, $4)", id, phone, RoleUser, now)
 	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return nil, ErrUserExists
+		}
 		return nil, err
 	}
-	return &User{Phone: phone, RegistrationDate: now}, nil
+	return &User{ID: id, Phone: phone, Role: RoleUser, Metadata: emptyMetadata, RegistrationDate: now, UpdatedAt: now}, nil
+}
+
+// likeEscaper escapes LIKE wildcards so search terms match literally, like strings.Contains
+// in the in-memory repository.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// containsPattern is the LIKE pattern matching values that contain s.
+func containsPattern(s string) string {
+	return "%" + likeEscaper.Replace(s) + "%"
 }
 
-func (r *PostgresUserRepository) List(offset, limit int, search string) ([]User, error) {
-	rows, err := r.pool.Query(context.Background(),
-		"SELECT phone, registration_date FROM users WHERE phone ILIKE $1 ORDER BY registration_date DESC OFFSET $2 LIMIT $3",
-		"%"+search+"%", offset, limit)
+func (r *PostgresUserRepository) List(ctx context.Context, offset, limit int, search string) ([]User, error) {
+	ctx, cancel := r.begin(ctx, "List")
+	defer cancel()
+
+	rows, err := r.pool.Query(ctx,
+		"SELECT "+userColumns+` FROM users WHERE deleted_at IS NULL AND phone ILIKE $1 ESCAPE '\' ORDER BY registration_date DESC, phone DESC OFFSET $2 LIMIT $3`,
+		containsPattern(search), offset, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -54,18 +181,202 @@ func (r *PostgresUserRepository) List(offset, limit int, search string) ([]User,
 
 	users := []User{}
 	for rows.Next() {
-		var u User
-		if err := rows.Scan(&u.Phone, &u.RegistrationDate); err != nil {
+		u, err := scanUser(rows)
+		if err != nil {
 			return nil, err
 		}
-		users = append(users, u)
+		users = append(users, *u)
 	}
 	return users, nil
 }
 
-func (r *PostgresUserRepository) UpdatePhone(oldPhone string, newPhone string) error {
-	cmdTag, err := r.pool.Exec(context.Background(),
-		"UPDATE users SET phone=$1 WHERE phone=$2", newPhone, oldPhone)
+// ListPage returns one page of users in the order documented on SortOrder, using
+// keyset pagination so deep pages cost the same as the first one.
+func (r *PostgresUserRepository) ListPage(ctx context.Context, opts ListOptions) (*UserPage, error) {
+	ctx, cancel := r.begin(ctx, "ListPage")
+	defer cancel()
+
+	after, err := opts.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	where := []string{"deleted_at IS NULL"}
+	if opts.Deleted {
+		where[0] = "deleted_at IS NOT NULL"
+	}
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if opts.Search != "" {
+		where = append(where, "phone ILIKE "+arg(containsPattern(opts.Search))+` ESCAPE '\'`)
+	}
+	if opts.Role != "" {
+		where = append(where, "role = "+arg(opts.Role))
+	}
+	if !opts.RegisteredFrom.IsZero() {
+		where = append(where, "registration_date >= "+arg(opts.RegisteredFrom))
+	}
+	if !opts.RegisteredBefore.IsZero() {
+		where = append(where, "registration_date < "+arg(opts.RegisteredBefore))
+	}
+
+	page := &UserPage{Users: []User{}}
+	countSQL := "SELECT count(*) FROM users" + whereClause(where)
+	if err := r.pool.QueryRow(ctx, countSQL, args...).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+
+	dir, cmp := "ASC", ">"
+	if opts.Sort.descending() {
+		dir, cmp = "DESC", "<"
+	}
+	orderBy := "registration_date " + dir + ", phone " + dir
+	if opts.Sort.byPhone() {
+		orderBy = "phone " + dir
+	}
+	if after != nil {
+		if opts.Sort.byPhone() {
+			where = append(where, "phone "+cmp+" "+arg(after.Phone))
+		} else {
+			where = append(where, "(registration_date, phone) "+cmp+" ("+arg(after.Date)+", "+arg(after.Phone)+")")
+		}
+	}
+
+	// یک ردیف اضافه می‌خوانیم تا بفهمیم صفحه بعدی وجود دارد یا نه
+	query := "SELECT " + userColumns + " FROM users" + whereClause(where) +
+		" ORDER BY " + orderBy + " LIMIT " + arg(opts.Limit+1)
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		page.Users = append(page.Users, *u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(page.Users) > opts.Limit {
+		page.Users = page.Users[:opts.Limit]
+		page.NextCursor = encodeCursor(opts.Sort, page.Users[opts.Limit-1])
+	}
+	return page, nil
+}
+
+func whereClause(conds []string) string {
+	if len(conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conds, " AND ")
+}
+
+func (r *PostgresUserRepository) UpdatePhone(ctx context.Context, id, newPhone string, method PhoneChangeMethod, changedBy string) error {
+	if !ValidID(id) {
+		return ErrUserNotFound
+	}
+	newPhone, err := normalizePhone(newPhone)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := r.begin(ctx, "UpdatePhone")
+	defer cancel()
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	// بعد از Commit بی‌اثر است
+	defer tx.Rollback(ctx)
+
+	var oldPhone string
+	err = tx.QueryRow(ctx, "SELECT phone FROM users WHERE id=$1 AND deleted_at IS NULL FOR UPDATE", id).Scan(&oldPhone)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE users SET phone=$1, updated_at=now() WHERE id=$2", newPhone, id)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return ErrPhoneTaken
+		}
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		"INSERT INTO phone_history (user_id, old_phone, new_phone, method, changed_by) VALUES ($1, $2, $3, $4, $5)",
+		id, oldPhone, newPhone, method, nullableID(changedBy))
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (r *PostgresUserRepository) PhoneHistory(ctx context.Context, id string) ([]PhoneChange, error) {
+	if !ValidID(id) {
+		return nil, ErrUserNotFound
+	}
+	ctx, cancel := r.begin(ctx, "PhoneHistory")
+	defer cancel()
+
+	var exists bool
+	if err := r.pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id=$1 AND deleted_at IS NULL)", id).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	rows, err := r.pool.Query(ctx,
+		`SELECT old_phone, new_phone, method, COALESCE(changed_by::text, ''), changed_at
+		FROM phone_history WHERE user_id=$1 ORDER BY changed_at DESC, id DESC`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []PhoneChange{}
+	for rows.Next() {
+		var change PhoneChange
+		if err := rows.Scan(&change.OldPhone, &change.NewPhone, &change.Method, &change.ChangedBy, &change.ChangedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, change)
+	}
+	return history, rows.Err()
+}
+
+// nullableID stores an empty actor id as NULL.
+func nullableID(id string) any {
+	if id == "" {
+		return nil
+	}
+	return id
+}
+
+func (r *PostgresUserRepository) UpdateRole(ctx context.Context, id string, role Role) error {
+	if !ValidID(id) {
+		return ErrUserNotFound
+	}
+	ctx, cancel := r.begin(ctx, "UpdateRole")
+	defer cancel()
+
+	if !role.Valid() {
+		return ErrInvalidRole
+	}
+	cmdTag, err := r.pool.Exec(ctx,
+		"UPDATE users SET role=$1, updated_at=now() WHERE id=$2 AND deleted_at IS NULL", role, id)
 	if err != nil {
 		return err
 	}
@@ -75,9 +386,53 @@ func (r *PostgresUserRepository) UpdatePhone(oldPhone string, newPhone string) e
 	return nil
 }
 
-func (r *PostgresUserRepository) Delete(phone string) error {
-	cmdTag, err := r.pool.Exec(context.Background(),
-		"DELETE FROM users WHERE phone=$1", phone)
+// UpdateProfile writes only the fields set in upd; NULL parameters keep the current value.
+func (r *PostgresUserRepository) UpdateProfile(ctx context.Context, id string, upd ProfileUpdate) (*User, error) {
+	if !ValidID(id) {
+		return nil, ErrUserNotFound
+	}
+	ctx, cancel := r.begin(ctx, "UpdateProfile")
+	defer cancel()
+
+	if err := upd.Validate(); err != nil {
+		return nil, err
+	}
+	var metadata *string
+	if upd.Metadata != nil {
+		m := string(upd.Metadata)
+		metadata = &m
+	}
+
+	user, err := scanUser(r.pool.QueryRow(ctx,
+		`UPDATE users SET
+			display_name = COALESCE($2, display_name),
+			email        = COALESCE($3, email),
+			avatar_url   = COALESCE($4, avatar_url),
+			locale       = COALESCE($5, locale),
+			timezone     = COALESCE($6, timezone),
+			metadata     = COALESCE($7::jsonb, metadata),
+			updated_at   = now()
+		WHERE id=$1 AND deleted_at IS NULL
+		RETURNING `+userColumns,
+		id, upd.DisplayName, upd.Email, upd.AvatarURL, upd.Locale, upd.Timezone, metadata))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *PostgresUserRepository) Delete(ctx context.Context, id string) error {
+	if !ValidID(id) {
+		return ErrUserNotFound
+	}
+	ctx, cancel := r.begin(ctx, "Delete")
+	defer cancel()
+
+	cmdTag, err := r.pool.Exec(ctx,
+		"UPDATE users SET deleted_at=now(), updated_at=now() WHERE id=$1 AND deleted_at IS NULL", id)
 	if err != nil {
 		return err
 	}
@@ -86,3 +441,353 @@ func (r *PostgresUserRepository) Delete(phone string) error {
 	}
 	return nil
 }
+
+func (r *PostgresUserRepository) Restore(ctx context.Context, id string) (*User, error) {
+	if !ValidID(id) {
+		return nil, ErrUserNotFound
+	}
+	ctx, cancel := r.begin(ctx, "Restore")
+	defer cancel()
+
+	user, err := scanUser(r.pool.QueryRow(ctx,
+		"UPDATE users SET deleted_at=NULL, updated_at=now() WHERE id=$1 AND deleted_at IS NOT NULL RETURNING "+userColumns, id))
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	// کاربر وجود ندارد یا حذف نشده است
+	var exists bool
+	if err := r.pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id=$1)", id).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrUserNotDeleted
+	}
+	return nil, ErrUserNotFound
+}
+
+// Purge relies on ON DELETE CASCADE to erase the user's phone history too.
+func (r *PostgresUserRepository) Purge(ctx context.Context, id string) error {
+	if !ValidID(id) {
+		return ErrUserNotFound
+	}
+	ctx, cancel := r.begin(ctx, "Purge")
+	defer cancel()
+
+	cmdTag, err := r.pool.Exec(ctx, "DELETE FROM users WHERE id=$1", id)
+	if err != nil {
+		return err
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *PostgresUserRepository) PurgeDeleted(ctx context.Context, cutoff time.Time) (int, error) {
+	ctx, cancel := r.begin(ctx, "PurgeDeleted")
+	defer cancel()
+
+	cmdTag, err := r.pool.Exec(ctx, "DELETE FROM users WHERE deleted_at < $1", cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return int(cmdTag.RowsAffected()), nil
+}
+
+// SetBlock blocks the user, or unblocks them when block is nil.
+func (r *PostgresUserRepository) SetBlock(ctx context.Context, id string, block *Block) error {
+	if !ValidID(id) {
+		return ErrUserNotFound
+	}
+	ctx, cancel := r.begin(ctx, "SetBlock")
+	defer cancel()
+
+	var b Block
+	var kind any
+	if block != nil {
+		b = *block
+		kind = b.Kind
+		if b.BlockedAt.IsZero() {
+			b.BlockedAt = time.Now()
+		}
+	}
+	var blockedAt any
+	if block != nil {
+		blockedAt = b.BlockedAt
+	}
+
+	cmdTag, err := r.pool.Exec(ctx,
+		`UPDATE users SET block_kind=$2, block_reason=$3, block_until=$4, blocked_by=$5, blocked_at=$6, updated_at=now()
+		WHERE id=$1 AND deleted_at IS NULL`,
+		id, kind, b.Reason, b.Until, nullableID(b.BlockedBy), blockedAt)
+	if err != nil {
+		return err
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *PostgresUserRepository) AddPhoneBan(ctx context.Context, ban PhoneBan) error {
+	ctx, cancel := r.begin(ctx, "AddPhoneBan")
+	defer cancel()
+
+	if ban.CreatedAt.IsZero() {
+		ban.CreatedAt = time.Now()
+	}
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO phone_bans (prefix, reason, created_by, created_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (prefix) DO UPDATE SET reason=EXCLUDED.reason, created_by=EXCLUDED.created_by, created_at=EXCLUDED.created_at`,
+		ban.Prefix, ban.Reason, nullableID(ban.CreatedBy), ban.CreatedAt)
+	return err
+}
+
+func (r *PostgresUserRepository) RemovePhoneBan(ctx context.Context, prefix string) error {
+	ctx, cancel := r.begin(ctx, "RemovePhoneBan")
+	defer cancel()
+
+	cmdTag, err := r.pool.Exec(ctx, "DELETE FROM phone_bans WHERE prefix=$1", prefix)
+	if err != nil {
+		return err
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return ErrBanNotFound
+	}
+	return nil
+}
+
+func (r *PostgresUserRepository) ListPhoneBans(ctx context.Context) ([]PhoneBan, error) {
+	ctx, cancel := r.begin(ctx, "ListPhoneBans")
+	defer cancel()
+
+	rows, err := r.pool.Query(ctx,
+		"SELECT prefix, reason, COALESCE(created_by::text, ''), created_at FROM phone_bans ORDER BY prefix")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bans := []PhoneBan{}
+	for rows.Next() {
+		var ban PhoneBan
+		if err := rows.Scan(&ban.Prefix, &ban.Reason, &ban.CreatedBy, &ban.CreatedAt); err != nil {
+			return nil, err
+		}
+		bans = append(bans, ban)
+	}
+	return bans, rows.Err()
+}
+
+func (r *PostgresUserRepository) AppendAudit(ctx context.Context, event AuditEvent) error {
+	ctx, cancel := r.begin(ctx, "AppendAudit")
+	defer cancel()
+
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO audit_events (action, actor_id, target_id, phone_hash, ip, user_agent, outcome, reason, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		event.Action, auditID(event.ActorID), auditID(event.TargetID), event.PhoneHash, event.IP, event.UserAgent,
+		event.Outcome, event.Reason, event.CreatedAt)
+	return err
+}
+
+func (r *PostgresUserRepository) PruneAudit(ctx context.Context, cutoff time.Time) (int, error) {
+	ctx, cancel := r.begin(ctx, "PruneAudit")
+	defer cancel()
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// trigger فقط‌افزودنی حذف را فقط در همین تراکنش اجازه می‌دهد
+	if _, err := tx.Exec(ctx, "SET LOCAL user_go.audit_prune = 'on'"); err != nil {
+		return 0, err
+	}
+	cmdTag, err := tx.Exec(ctx, "DELETE FROM audit_events WHERE created_at < $1", cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return int(cmdTag.RowsAffected()), tx.Commit(ctx)
+}
+
+// auditID stores ids that are not UUIDs as NULL rather than failing the insert; the event still counts.
+func auditID(id string) any {
+	if !ValidID(id) {
+		return nil
+	}
+	return id
+}
+
+func (r *PostgresUserRepository) AuditEvents(ctx context.Context, q AuditQuery) ([]AuditEvent, error) {
+	if q.UserID != "" && !ValidID(q.UserID) {
+		return []AuditEvent{}, nil
+	}
+	ctx, cancel := r.begin(ctx, "AuditEvents")
+	defer cancel()
+
+	var conds []string
+	var args []any
+	if q.UserID != "" {
+		args = append(args, q.UserID)
+		conds = append(conds, fmt.Sprintf("(actor_id=$%d OR target_id=$%[1]d)", len(args)))
+	}
+	if !q.From.IsZero() {
+		args = append(args, q.From)
+		conds = append(conds, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+	if !q.Until.IsZero() {
+		args = append(args, q.Until)
+		conds = append(conds, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+	query := `SELECT id, action, COALESCE(actor_id::text, ''), COALESCE(target_id::text, ''), phone_hash, ip, user_agent,
+		outcome, reason, created_at FROM audit_events`
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	args = append(args, q.limit())
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d", len(args))
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []AuditEvent{}
+	for rows.Next() {
+		var e AuditEvent
+		if err := rows.Scan(&e.ID, &e.Action, &e.ActorID, &e.TargetID, &e.PhoneHash, &e.IP, &e.UserAgent,
+			&e.Outcome, &e.Reason, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (r *PostgresUserRepository) CreateSession(ctx context.Context, s Session) error {
+	if !ValidID(s.UserID) {
+		return ErrUserNotFound
+	}
+	ctx, cancel := r.begin(ctx, "CreateSession")
+	defer cancel()
+
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = time.Now()
+	}
+	if s.LastSeenAt.IsZero() {
+		s.LastSeenAt = s.CreatedAt
+	}
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO sessions (id, user_id, device, ip, user_agent, created_at, last_seen_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		s.ID, s.UserID, s.Device, s.IP, s.UserAgent, s.CreatedAt, s.LastSeenAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+func (r *PostgresUserRepository) GetSession(ctx context.Context, id string) (*Session, error) {
+	if !ValidID(id) {
+		return nil, ErrSessionNotFound
+	}
+	ctx, cancel := r.begin(ctx, "GetSession")
+	defer cancel()
+
+	var s Session
+	err := r.pool.QueryRow(ctx,
+		`SELECT id::text, user_id::text, device, ip, user_agent, created_at, last_seen_at, revoked_at
+		FROM sessions WHERE id=$1`, id).
+		Scan(&s.ID, &s.UserID, &s.Device, &s.IP, &s.UserAgent, &s.CreatedAt, &s.LastSeenAt, &s.RevokedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *PostgresUserRepository) ListSessions(ctx context.Context, userID string) ([]Session, error) {
+	if !ValidID(userID) {
+		return []Session{}, nil
+	}
+	ctx, cancel := r.begin(ctx, "ListSessions")
+	defer cancel()
+
+	rows, err := r.pool.Query(ctx,
+		`SELECT id::text, user_id::text, device, ip, user_agent, created_at, last_seen_at
+		FROM sessions WHERE user_id=$1 AND revoked_at IS NULL ORDER BY last_seen_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.ID, &s.UserID, &s.Device, &s.IP, &s.UserAgent, &s.CreatedAt, &s.LastSeenAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *PostgresUserRepository) TouchSession(ctx context.Context, id string, at time.Time) error {
+	if !ValidID(id) {
+		return ErrSessionNotFound
+	}
+	ctx, cancel := r.begin(ctx, "TouchSession")
+	defer cancel()
+
+	cmdTag, err := r.pool.Exec(ctx,
+		"UPDATE sessions SET last_seen_at=GREATEST(last_seen_at, $2) WHERE id=$1 AND revoked_at IS NULL", id, at)
+	if err != nil {
+		return err
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (r *PostgresUserRepository) RevokeSession(ctx context.Context, userID, id string, at time.Time) error {
+	if !ValidID(userID) || !ValidID(id) {
+		return ErrSessionNotFound
+	}
+	ctx, cancel := r.begin(ctx, "RevokeSession")
+	defer cancel()
+
+	cmdTag, err := r.pool.Exec(ctx,
+		"UPDATE sessions SET revoked_at=$3 WHERE id=$1 AND user_id=$2 AND revoked_at IS NULL", id, userID, at)
+	if err != nil {
+		return err
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (r *PostgresUserRepository) RevokeAllSessions(ctx context.Context, userID string, at time.Time) error {
+	if !ValidID(userID) {
+		return nil
+	}
+	ctx, cancel := r.begin(ctx, "RevokeAllSessions")
+	defer cancel()
+
+	_, err := r.pool.Exec(ctx, "UPDATE sessions SET revoked_at=$2 WHERE user_id=$1 AND revoked_at IS NULL", userID, at)
+	return err
+}
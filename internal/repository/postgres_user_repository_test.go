@@ -6,6 +6,7 @@ import (
 	"os"
 	"testing"
 	"time"
+	"user-go/internal/migrations"
 )
 
 var testRepo *PostgresUserRepository
@@ -21,8 +22,15 @@ func setupTestDB(t *testing.T) *pgxpool.Pool {
 	if err != nil {
 		t.Fatalf("unable to connect to db: %v", err)
 	}
+	m, err := migrations.New(pool)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
 	// پاک کردن جدول و آماده سازی داده تست
-	_, err = pool.Exec(context.Background(), "TRUNCATE users")
+	_, err = pool.Exec(context.Background(), "TRUNCATE users, phone_bans, audit_events CASCADE")
 	if err != nil {
 		t.Fatalf("failed to truncate users table: %v", err)
 	}
@@ -36,35 +44,35 @@ func TestPostgresUserRepository(t *testing.T) {
 	repo := NewPostgresUserRepository(pool)
 
 	// Create
-	user, err := repo.Create("+1234567890")
+	user, err := repo.Create(ctx, "+12025550123")
 	if err != nil {
 		t.Fatalf("Create failed: %v", err)
 	}
-	if user.Phone != "+1234567890" {
-		t.Errorf("expected phone +1234567890, got %s", user.Phone)
+	if user.Phone != "+12025550123" {
+		t.Errorf("expected phone +12025550123, got %s", user.Phone)
 	}
 
 	// GetByPhone (exists)
-	got, err := repo.GetByPhone("+1234567890")
+	got, err := repo.GetByPhone(ctx, "+12025550123")
 	if err != nil {
 		t.Fatalf("GetByPhone failed: %v", err)
 	}
-	if got.Phone != "+1234567890" {
-		t.Errorf("expected phone +1234567890, got %s", got.Phone)
+	if got.Phone != "+12025550123" {
+		t.Errorf("expected phone +12025550123, got %s", got.Phone)
 	}
 
 	// GetByPhone (not exists)
-	_, err = repo.GetByPhone("+0000000000")
+	_, err = repo.GetByPhone(ctx, "+0000000000")
 	if err == nil {
 		t.Error("expected error for non-existent user")
 	}
 
 	// List
-	_, err = repo.Create("+1987654321")
+	_, err = repo.Create(ctx, "+12025550199")
 	if err != nil {
 		t.Fatalf("Create second user failed: %v", err)
 	}
-	users, err := repo.List(0, 10, "")
+	users, err := repo.List(ctx, 0, 10, "")
 	if err != nil {
 		t.Fatalf("List failed: %v", err)
 	}
@@ -72,26 +80,179 @@ func TestPostgresUserRepository(t *testing.T) {
 		t.Errorf("expected at least 2 users, got %d", len(users))
 	}
 
+	// ListPage باید همان ترتیب in-memory را رعایت کند
+	phones := collect(t, repo, ListOptions{Sort: SortPhoneAsc, Limit: 1})
+	if len(phones) != 2 || phones[0] != "+12025550123" || phones[1] != "+12025550199" {
+		t.Errorf("unexpected keyset order: %v", phones)
+	}
+	checkSearchIsLiteral(t, repo, "+12025550123")
+
+	// UpdateProfile
+	displayName, tz := "Amin", "Asia/Tehran"
+	profile, err := repo.UpdateProfile(ctx, user.ID, ProfileUpdate{DisplayName: &displayName, Timezone: &tz, Metadata: []byte(`{"theme":"dark"}`)})
+	if err != nil {
+		t.Fatalf("UpdateProfile failed: %v", err)
+	}
+	if profile.DisplayName != displayName || profile.Timezone != tz {
+		t.Errorf("unexpected profile after update: %+v", profile)
+	}
+	locale := "fa-IR"
+	profile, err = repo.UpdateProfile(ctx, user.ID, ProfileUpdate{Locale: &locale})
+	if err != nil {
+		t.Fatalf("partial UpdateProfile failed: %v", err)
+	}
+	if profile.DisplayName != displayName || profile.Locale != locale {
+		t.Errorf("partial update lost fields: %+v", profile)
+	}
+
 	// UpdatePhone
-	err = repo.UpdatePhone("+1234567890", "+1111111111")
+	err = repo.UpdatePhone(ctx, user.ID, "+12025550111", PhoneChangeVerified, user.ID)
 	if err != nil {
 		t.Fatalf("UpdatePhone failed: %v", err)
 	}
-	updatedUser, err := repo.GetByPhone("+1111111111")
+	updatedUser, err := repo.GetByPhone(ctx, "+12025550111")
 	if err != nil {
 		t.Fatalf("GetByPhone after update failed: %v", err)
 	}
-	if updatedUser.Phone != "+1111111111" {
-		t.Errorf("expected phone +1111111111, got %s", updatedUser.Phone)
+	if updatedUser.Phone != "+12025550111" {
+		t.Errorf("expected phone +9891200001111111111, got %s", updatedUser.Phone)
+	}
+	if updatedUser.ID != user.ID {
+		t.Errorf("expected id %s to survive the phone change, got %s", user.ID, updatedUser.ID)
+	}
+	if byID, err := repo.GetByID(ctx, user.ID); err != nil || byID.Phone != "+12025550111" {
+		t.Errorf("GetByID after update: %+v, %v", byID, err)
+	}
+	history, err := repo.PhoneHistory(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("PhoneHistory failed: %v", err)
+	}
+	if len(history) != 1 || history[0].NewPhone != "+12025550111" || history[0].ChangedBy != user.ID {
+		t.Errorf("unexpected phone history: %+v", history)
+	}
+
+	// Block
+	until := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	block := &Block{Kind: BlockSuspended, Reason: "spam", Until: &until, BlockedBy: user.ID}
+	if err := repo.SetBlock(ctx, user.ID, block); err != nil {
+		t.Fatalf("SetBlock failed: %v", err)
+	}
+	if got, _ := repo.GetByID(ctx, user.ID); got == nil || got.Block == nil || got.Block.Kind != BlockSuspended ||
+		got.Block.Reason != "spam" || got.Block.BlockedBy != user.ID || !got.Block.Until.Equal(until) {
+		t.Errorf("unexpected block after SetBlock: %+v", got)
+	}
+	if err := repo.SetBlock(ctx, user.ID, nil); err != nil {
+		t.Fatalf("clearing block failed: %v", err)
+	}
+	if got, _ := repo.GetByID(ctx, user.ID); got == nil || got.Block != nil {
+		t.Errorf("expected block to be cleared: %+v", got)
+	}
+	if err := repo.AddPhoneBan(ctx, PhoneBan{Prefix: "+98912", Reason: "fraud"}); err != nil {
+		t.Fatalf("AddPhoneBan failed: %v", err)
+	}
+	if err := repo.AddPhoneBan(ctx, PhoneBan{Prefix: "+98912", Reason: "spam", CreatedBy: user.ID}); err != nil {
+		t.Fatalf("AddPhoneBan upsert failed: %v", err)
+	}
+	if bans, err := repo.ListPhoneBans(ctx); err != nil || len(bans) != 1 || bans[0].Reason != "spam" {
+		t.Errorf("unexpected phone bans: %+v, %v", bans, err)
+	}
+	if err := repo.RemovePhoneBan(ctx, "+98912"); err != nil {
+		t.Fatalf("RemovePhoneBan failed: %v", err)
+	}
+	if err := repo.RemovePhoneBan(ctx, "+98912"); err != ErrBanNotFound {
+		t.Errorf("expected ErrBanNotFound, got %v", err)
 	}
 
 	// Delete
-	err = repo.Delete("+1111111111")
+	err = repo.Delete(ctx, user.ID)
 	if err != nil {
 		t.Fatalf("Delete failed: %v", err)
 	}
-	_, err = repo.GetByPhone("+1111111111")
-	if err == nil {
-		t.Error("expected error after delete")
+	_, err = repo.GetByPhone(ctx, "+12025550111")
+	if err != ErrUserDeleted {
+		t.Errorf("expected ErrUserDeleted after delete, got %v", err)
+	}
+	if _, err := repo.Restore(ctx, user.ID); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if _, err := repo.Restore(ctx, user.ID); err != ErrUserNotDeleted {
+		t.Errorf("expected ErrUserNotDeleted, got %v", err)
+	}
+
+	// Purge
+	_ = repo.Delete(ctx, user.ID)
+	purged, err := repo.PurgeDeleted(ctx, time.Now().Add(time.Minute))
+	if err != nil || purged != 1 {
+		t.Fatalf("PurgeDeleted: %d, %v", purged, err)
+	}
+	if _, err := repo.Create(ctx, "+12025550111"); err != nil {
+		t.Errorf("expected phone to be free after purge, got %v", err)
+	}
+
+	// Sessions
+	owner, err := repo.Create(ctx, "+12025550144")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	session := Session{ID: NewID(), UserID: owner.ID, Device: "phone", IP: "203.0.113.7"}
+	if err := repo.CreateSession(ctx, session); err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	if err := repo.CreateSession(ctx, Session{ID: NewID(), UserID: NewID()}); err != ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound for unknown user, got %v", err)
+	}
+	if err := repo.TouchSession(ctx, session.ID, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("TouchSession failed: %v", err)
+	}
+	if sessions, err := repo.ListSessions(ctx, owner.ID); err != nil || len(sessions) != 1 || sessions[0].Device != "phone" {
+		t.Errorf("unexpected sessions: %+v, %v", sessions, err)
+	}
+	if err := repo.RevokeSession(ctx, owner.ID, session.ID, time.Now()); err != nil {
+		t.Fatalf("RevokeSession failed: %v", err)
+	}
+	if err := repo.RevokeSession(ctx, owner.ID, session.ID, time.Now()); err != ErrSessionNotFound {
+		t.Errorf("expected ErrSessionNotFound, got %v", err)
+	}
+	if got, err := repo.GetSession(ctx, session.ID); err != nil || got.RevokedAt == nil || got.Device != "phone" {
+		t.Errorf("expected revoked session, got %+v, %v", got, err)
+	}
+	if _, err := repo.GetSession(ctx, NewID()); err != ErrSessionNotFound {
+		t.Errorf("expected ErrSessionNotFound, got %v", err)
+	}
+	if err := repo.RevokeAllSessions(ctx, owner.ID, time.Now()); err != nil {
+		t.Errorf("RevokeAllSessions failed: %v", err)
+	}
+	if sessions, _ := repo.ListSessions(ctx, owner.ID); len(sessions) != 0 {
+		t.Errorf("expected no active sessions, got %+v", sessions)
+	}
+
+	// Audit events outlive the purged user and cannot be changed
+	start := time.Now().Add(-time.Second)
+	for _, e := range []AuditEvent{
+		{Action: AuditLogin, ActorID: user.ID, TargetID: user.ID, Outcome: AuditSuccess},
+		{Action: AuditUserDeleted, ActorID: NewID(), TargetID: user.ID, Outcome: AuditSuccess},
+		{Action: AuditOTPRequested, PhoneHash: "abc", IP: "203.0.113.7", Outcome: AuditFailure, Reason: "rate_limited"},
+	} {
+		if err := repo.AppendAudit(ctx, e); err != nil {
+			t.Fatalf("AppendAudit failed: %v", err)
+		}
+	}
+	events, err := repo.AuditEvents(ctx, AuditQuery{UserID: user.ID, From: start})
+	if err != nil || len(events) != 2 || events[0].Action != AuditUserDeleted || events[1].ActorID != user.ID {
+		t.Errorf("unexpected audit events for user: %+v, %v", events, err)
+	}
+	if events, err := repo.AuditEvents(ctx, AuditQuery{Limit: 1}); err != nil || len(events) != 1 || events[0].Reason != "rate_limited" {
+		t.Errorf("unexpected latest audit event: %+v, %v", events, err)
+	}
+	if _, err := pool.Exec(ctx, "DELETE FROM audit_events"); err == nil {
+		t.Error("expected audit_events to reject DELETE")
+	}
+	if n, err := repo.PruneAudit(ctx, start); err != nil {
+		t.Errorf("PruneAudit failed: %v", err)
+	} else if events, _ := repo.AuditEvents(ctx, AuditQuery{UserID: user.ID, From: start}); len(events) != 2 {
+		t.Errorf("expected PruneAudit to keep newer events, pruned %d, left %+v", n, events)
+	}
+	if _, err := pool.Exec(ctx, "DELETE FROM audit_events"); err == nil {
+		t.Error("expected audit_events to reject DELETE after PruneAudit")
 	}
 }
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"time"
+	_ "time/tzdata" // timezone validation must not depend on the host's zoneinfo
+	"unicode/utf8"
+	"user-go/internal/apperr"
+)
+
+const (
+	maxDisplayNameLen = 100
+	maxEmailLen       = 254
+	maxAvatarURLLen   = 2048
+	maxMetadataBytes  = 4096
+)
+
+// ErrInvalidProfile is wrapped by every ProfileUpdate validation error.
+var ErrInvalidProfile = apperr.New(apperr.Invalid, "invalid_profile", "invalid profile")
+
+// BCP 47 shape only (en, fa-IR, zh-Hant-TW); the tag itself is not checked against a registry.
+var localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// ProfileUpdate is a partial update of the self-service profile fields.
+// Nil fields are left unchanged; an empty string clears the field.
+type ProfileUpdate struct {
+	DisplayName *string
+	Email       *string
+	AvatarURL   *string
+	Locale      *string
+	Timezone    *string
+	Metadata    json.RawMessage // must be a JSON object when set
+}
+
+// Empty reports whether the update changes nothing.
+func (u ProfileUpdate) Empty() bool {
+	return u.DisplayName == nil && u.Email == nil && u.AvatarURL == nil &&
+		u.Locale == nil && u.Timezone == nil && u.Metadata == nil
+}
+
+// Validate checks every set field.
+func (u ProfileUpdate) Validate() error {
+	var errs []error
+	invalid := func(field, reason string) {
+		errs = append(errs, fmt.Errorf("%w: %s %s", ErrInvalidProfile, field, reason))
+	}
+
+	if u.DisplayName != nil {
+		if !utf8.ValidString(*u.DisplayName) || utf8.RuneCountInString(*u.DisplayName) > maxDisplayNameLen {
+			invalid("display_name", fmt.Sprintf("must be at most %d characters", maxDisplayNameLen))
+		}
+	}
+	if u.Email != nil && *u.Email != "" {
+		addr, err := mail.ParseAddress(*u.Email)
+		if err != nil || addr.Address != *u.Email || len(*u.Email) > maxEmailLen {
+			invalid("email", "is not a valid address")
+		}
+	}
+	if u.AvatarURL != nil && *u.AvatarURL != "" {
+		parsed, err := url.Parse(*u.AvatarURL)
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" || len(*u.AvatarURL) > maxAvatarURLLen {
+			invalid("avatar_url", "must be an absolute http(s) URL")
+		}
+	}
+	if u.Locale != nil && *u.Locale != "" && !localePattern.MatchString(*u.Locale) {
+		invalid("locale", "must be a BCP 47 language tag")
+	}
+	if u.Timezone != nil && *u.Timezone != "" {
+		if _, err := time.LoadLocation(*u.Timezone); err != nil || *u.Timezone == "Local" {
+			invalid("timezone", "must be an IANA time zone name")
+		}
+	}
+	if u.Metadata != nil {
+		var obj map[string]json.RawMessage
+		if len(u.Metadata) > maxMetadataBytes {
+			invalid("metadata", fmt.Sprintf("must be at most %d bytes", maxMetadataBytes))
+		} else if err := json.Unmarshal(u.Metadata, &obj); err != nil || obj == nil {
+			invalid("metadata", "must be a JSON object")
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// apply copies the set fields onto user.
+func (u ProfileUpdate) apply(user *User) {
+	if u.DisplayName != nil {
+		user.DisplayName = *u.DisplayName
+	}
+	if u.Email != nil {
+		user.Email = *u.Email
+	}
+	if u.AvatarURL != nil {
+		user.AvatarURL = *u.AvatarURL
+	}
+	if u.Locale != nil {
+		user.Locale = *u.Locale
+	}
+	if u.Timezone != nil {
+		user.Timezone = *u.Timezone
+	}
+	if u.Metadata != nil {
+		user.Metadata = append(json.RawMessage(nil), u.Metadata...)
+	}
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func str(s string) *string { return &s }
+
+func TestProfileUpdate_Validate(t *testing.T) {
+	valid := []ProfileUpdate{
+		{},
+		{DisplayName: str("Amin"), Email: str("amin@example.com"), AvatarURL: str("https://cdn.example.com/a.png")},
+		{Locale: str("fa-IR"), Timezone: str("Asia/Tehran"), Metadata: json.RawMessage(`{"a":1}`)},
+		{Email: str(""), AvatarURL: str(""), Locale: str(""), Timezone: str("")}, // پاک کردن فیلدها
+	}
+	for i, u := range valid {
+		if err := u.Validate(); err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		}
+	}
+
+	invalid := []ProfileUpdate{
+		{DisplayName: str(strings.Repeat("x", maxDisplayNameLen+1))},
+		{Email: str("Amin <amin@example.com>")},
+		{Email: str("nope")},
+		{AvatarURL: str("javascript:alert(1)")},
+		{AvatarURL: str("/relative.png")},
+		{Locale: str("english please")},
+		{Timezone: str("Mars/Olympus")},
+		{Timezone: str("Local")},
+		{Metadata: json.RawMessage(`[1,2]`)},
+		{Metadata: json.RawMessage(`null`)},
+		{Metadata: json.RawMessage(`{"k":"` + strings.Repeat("x", maxMetadataBytes) + `"}`)},
+	}
+	for i, u := range invalid {
+		if err := u.Validate(); !errors.Is(err, ErrInvalidProfile) {
+			t.Errorf("case %d: expected ErrInvalidProfile, got %v", i, err)
+		}
+	}
+}
+
+func TestInMemoryUserRepository_UpdateProfile(t *testing.T) {
+	repo := NewInMemoryUserRepository()
+	created, _ := repo.Create(ctx, "+989120000111")
+
+	if _, err := repo.UpdateProfile(ctx, NewID(), ProfileUpdate{DisplayName: str("x")}); err != ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+
+	if _, err := repo.UpdateProfile(ctx, created.ID, ProfileUpdate{DisplayName: str("Amin"), Email: str("a@example.com")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := repo.UpdateProfile(ctx, created.ID, ProfileUpdate{Email: str("")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.DisplayName != "Amin" || got.Email != "" {
+		t.Errorf("partial update lost fields: %+v", got)
+	}
+	if got.UpdatedAt.Before(created.UpdatedAt) {
+		t.Errorf("updated_at went backwards")
+	}
+	if string(got.Metadata) != "{}" {
+		t.Errorf("expected empty metadata object, got %s", got.Metadata)
+	}
+
+	if _, err := repo.UpdateProfile(ctx, created.ID, ProfileUpdate{Email: str("bad")}); !errors.Is(err, ErrInvalidProfile) {
+		t.Errorf("expected ErrInvalidProfile, got %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+	"user-go/internal/apperr"
+)
+
+// Session is one login of a user on a device. Its id is the refresh token family and the
+// sid claim of every access token issued in it.
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"-"`
+	Device     string     `json:"device,omitempty"`
+	IP         string     `json:"ip,omitempty"`
+	UserAgent  string     `json:"user_agent,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+var ErrSessionNotFound = apperr.New(apperr.NotFound, "session_not_found", "session not found")
+
+// SessionRepository stores login sessions. Purging a user removes their sessions.
+type SessionRepository interface {
+	CreateSession(ctx context.Context, s Session) error
+	// GetSession returns session id, revoked or not; ErrSessionNotFound if there is none.
+	GetSession(ctx context.Context, id string) (*Session, error)
+	// ListSessions returns the sessions of userID that are not revoked, most recently seen first.
+	ListSessions(ctx context.Context, userID string) ([]Session, error)
+	// TouchSession moves LastSeenAt of an active session forward to at.
+	TouchSession(ctx context.Context, id string, at time.Time) error
+	// RevokeSession ends an active session of userID; ErrSessionNotFound if there is none with id.
+	RevokeSession(ctx context.Context, userID, id string, at time.Time) error
+	RevokeAllSessions(ctx context.Context, userID string, at time.Time) error
+}
+
+func (r *InMemoryUserRepository) CreateSession(ctx context.Context, s Session) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.users[s.UserID]; !exists {
+		return ErrUserNotFound
+	}
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = time.Now()
+	}
+	if s.LastSeenAt.IsZero() {
+		s.LastSeenAt = s.CreatedAt
+	}
+	r.sessions[s.ID] = s
+	return nil
+}
+
+func (r *InMemoryUserRepository) GetSession(ctx context.Context, id string) (*Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, exists := r.sessions[id]
+	if !exists {
+		return nil, ErrSessionNotFound
+	}
+	return &s, nil
+}
+
+func (r *InMemoryUserRepository) ListSessions(ctx context.Context, userID string) ([]Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sessions := []Session{}
+	for _, s := range r.sessions {
+		if s.UserID == userID && s.RevokedAt == nil {
+			sessions = append(sessions, s)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt) })
+	return sessions, nil
+}
+
+func (r *InMemoryUserRepository) TouchSession(ctx context.Context, id string, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, exists := r.sessions[id]
+	if !exists || s.RevokedAt != nil {
+		return ErrSessionNotFound
+	}
+	if at.After(s.LastSeenAt) {
+		s.LastSeenAt = at
+		r.sessions[id] = s
+	}
+	return nil
+}
+
+func (r *InMemoryUserRepository) RevokeSession(ctx context.Context, userID, id string, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, exists := r.sessions[id]
+	if !exists || s.UserID != userID || s.RevokedAt != nil {
+		return ErrSessionNotFound
+	}
+	s.RevokedAt = &at
+	r.sessions[id] = s
+	return nil
+}
+
+func (r *InMemoryUserRepository) RevokeAllSessions(ctx context.Context, userID string, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, s := range r.sessions {
+		if s.UserID == userID && s.RevokedAt == nil {
+			s.RevokedAt = &at
+			r.sessions[id] = s
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestInMemorySessions(t *testing.T) {
+	repo := NewInMemoryUserRepository()
+	ctx := context.Background()
+	user, _ := repo.Create(ctx, "+989120000000")
+	other, _ := repo.Create(ctx, "+989120000001")
+	base := time.Now().Add(-time.Hour)
+
+	if err := repo.CreateSession(ctx, Session{ID: NewID(), UserID: NewID()}); err != ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound for unknown user, got %v", err)
+	}
+	phone := Session{ID: NewID(), UserID: user.ID, Device: "phone", CreatedAt: base}
+	laptop := Session{ID: NewID(), UserID: user.ID, Device: "laptop", CreatedAt: base.Add(time.Minute)}
+	for _, s := range []Session{phone, laptop, {ID: NewID(), UserID: other.ID, CreatedAt: base}} {
+		if err := repo.CreateSession(ctx, s); err != nil {
+			t.Fatalf("CreateSession failed: %v", err)
+		}
+	}
+
+	sessions, err := repo.ListSessions(ctx, user.ID)
+	if err != nil || len(sessions) != 2 || sessions[0].ID != laptop.ID {
+		t.Fatalf("expected laptop first, got %+v, %v", sessions, err)
+	}
+	if !sessions[0].LastSeenAt.Equal(laptop.CreatedAt) {
+		t.Errorf("expected last seen to default to creation, got %v", sessions[0].LastSeenAt)
+	}
+
+	if err := repo.TouchSession(ctx, phone.ID, base.Add(time.Hour)); err != nil {
+		t.Fatalf("TouchSession failed: %v", err)
+	}
+	if err := repo.TouchSession(ctx, phone.ID, base); err != nil {
+		t.Fatalf("TouchSession with an older time failed: %v", err)
+	}
+	if sessions, _ := repo.ListSessions(ctx, user.ID); sessions[0].ID != phone.ID || !sessions[0].LastSeenAt.Equal(base.Add(time.Hour)) {
+		t.Errorf("expected touched phone first and last seen never moving back, got %+v", sessions)
+	}
+
+	if err := repo.RevokeSession(ctx, other.ID, phone.ID, time.Now()); err != ErrSessionNotFound {
+		t.Errorf("expected ErrSessionNotFound for another user's session, got %v", err)
+	}
+	if err := repo.RevokeSession(ctx, user.ID, phone.ID, time.Now()); err != nil {
+		t.Fatalf("RevokeSession failed: %v", err)
+	}
+	if err := repo.RevokeSession(ctx, user.ID, phone.ID, time.Now()); err != ErrSessionNotFound {
+		t.Errorf("expected ErrSessionNotFound when revoking twice, got %v", err)
+	}
+	if err := repo.TouchSession(ctx, phone.ID, time.Now()); err != ErrSessionNotFound {
+		t.Errorf("expected revoked session to stay revoked, got %v", err)
+	}
+	if got, err := repo.GetSession(ctx, phone.ID); err != nil || got.RevokedAt == nil {
+		t.Errorf("expected revoked session to be returned, got %+v, %v", got, err)
+	}
+	if _, err := repo.GetSession(ctx, NewID()); err != ErrSessionNotFound {
+		t.Errorf("expected ErrSessionNotFound, got %v", err)
+	}
+
+	if err := repo.RevokeAllSessions(ctx, user.ID, time.Now()); err != nil {
+		t.Fatalf("RevokeAllSessions failed: %v", err)
+	}
+	if sessions, _ := repo.ListSessions(ctx, user.ID); len(sessions) != 0 {
+		t.Errorf("expected no active sessions, got %+v", sessions)
+	}
+	if sessions, _ := repo.ListSessions(ctx, other.ID); len(sessions) != 1 {
+		t.Errorf("expected other user's session to stay, got %+v", sessions)
+	}
+
+	if err := repo.Purge(ctx, other.ID); err != nil {
+		t.Fatalf("Purge failed: %v", err)
+	}
+	if len(repo.sessions) != 2 {
+		t.Errorf("expected purge to remove the user's sessions, %d left", len(repo.sessions))
+	}
+}
@@ -1,67 +1,198 @@
 package repository
 
 import (
-	"errors"
+	"context"
+	"encoding/json"
+	"sort"
 	"strings"
 	"sync"
 	"time"
+	"user-go/internal/apperr"
+	"user-go/internal/phone"
 )
 
+// Role decides what a user may do beyond managing their own record.
+type Role string
+
+const (
+	RoleUser    Role = "user"
+	RoleSupport Role = "support"
+	RoleAdmin   Role = "admin"
+)
+
+// Valid reports whether r is one of the known roles.
+func (r Role) Valid() bool {
+	switch r {
+	case RoleUser, RoleSupport, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+// emptyMetadata is stored for users that never set metadata.
+var emptyMetadata = json.RawMessage(`{}`)
+
+// User is keyed by ID; Phone is a unique attribute that may change.
 type User struct {
-	Phone            string
-	RegistrationDate time.Time
+	ID               string          `json:"id"`
+	Phone            string          `json:"phone"`
+	Role             Role            `json:"role"`
+	DisplayName      string          `json:"display_name"`
+	Email            string          `json:"email"`
+	AvatarURL        string          `json:"avatar_url"`
+	Locale           string          `json:"locale"`
+	Timezone         string          `json:"timezone"`
+	Metadata         json.RawMessage `json:"metadata"`
+	RegistrationDate time.Time       `json:"registration_date"`
+	UpdatedAt        time.Time       `json:"updated_at"`
+	// DeletedAt is set while the user is soft-deleted and waiting to be purged.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Block is set while the user is suspended or banned; check it with Active.
+	Block *Block `json:"block,omitempty"`
 }
 
+// UserRepository stores users. Implementations stop and return ctx.Err() once ctx is done.
+// Malformed ids are reported as ErrUserNotFound. Phones are stored in E.164: Create and
+// UpdatePhone reject anything else with a *phone.ValidationError, GetByPhone reports it as not found.
+//
+// Delete is a soft delete: the user disappears from every read and update except GetByPhone,
+// which reports ErrUserDeleted, and the phone stays reserved until the user is purged.
 type UserRepository interface {
-	GetByPhone(phone string) (*User, error)
-	Create(phone string) (*User, error)
-	List(offset, limit int, search string) ([]User, error)
-	UpdatePhone(oldPhone, newPhone string) error
-	Delete(phone string) error
+	GetByID(ctx context.Context, id string) (*User, error)
+	GetByPhone(ctx context.Context, phone string) (*User, error)
+	Create(ctx context.Context, phone string) (*User, error)
+	List(ctx context.Context, offset, limit int, search string) ([]User, error)
+	ListPage(ctx context.Context, opts ListOptions) (*UserPage, error)
+	// UpdatePhone switches the phone and records the change in the user's history atomically.
+	UpdatePhone(ctx context.Context, id, newPhone string, method PhoneChangeMethod, changedBy string) error
+	PhoneHistory(ctx context.Context, id string) ([]PhoneChange, error)
+	UpdateRole(ctx context.Context, id string, role Role) error
+	UpdateProfile(ctx context.Context, id string, upd ProfileUpdate) (*User, error)
+	// SetBlock blocks the user, or unblocks them when block is nil.
+	SetBlock(ctx context.Context, id string, block *Block) error
+	Delete(ctx context.Context, id string) error
+	// Restore undoes Delete; ErrUserNotDeleted if the user is live.
+	Restore(ctx context.Context, id string) (*User, error)
+	// Purge erases the user and their history at once, deleted or not.
+	Purge(ctx context.Context, id string) error
+	// PurgeDeleted erases every user soft-deleted before cutoff and returns how many.
+	PurgeDeleted(ctx context.Context, cutoff time.Time) (int, error)
 }
 
-var ErrUserNotFound = errors.New("user not found")
+var (
+	ErrUserNotFound = apperr.New(apperr.NotFound, "user_not_found", "user not found")
+	ErrUserExists   = apperr.New(apperr.Conflict, "user_exists", "user already exists")
+	ErrInvalidRole  = apperr.New(apperr.Invalid, "invalid_role", "invalid role")
+	ErrPhoneTaken   = apperr.New(apperr.Conflict, "phone_taken", "new phone already exists")
+	// ErrUserDeleted is returned by GetByPhone for a soft-deleted user.
+	ErrUserDeleted    = apperr.New(apperr.Forbidden, "account_deleted", "account is deleted")
+	ErrUserNotDeleted = apperr.New(apperr.Conflict, "user_not_deleted", "user is not deleted")
+)
+
+// normalizePhone makes sure only E.164 numbers reach storage.
+func normalizePhone(number string) (string, error) {
+	return phone.Normalize(number)
+}
 
 type InMemoryUserRepository struct {
-	mu    sync.RWMutex
-	users map[string]User
+	mu       sync.RWMutex
+	users    map[string]User   // by id
+	byPhone  map[string]string // phone -> id
+	history  map[string][]PhoneChange
+	bans     map[string]PhoneBan // by prefix
+	audit    []AuditEvent        // in append order
+	sessions map[string]Session  // by id
 }
 
 func NewInMemoryUserRepository() *InMemoryUserRepository {
 	return &InMemoryUserRepository{
-		users: make(map[string]User),
+		users:    make(map[string]User),
+		byPhone:  make(map[string]string),
+		history:  make(map[string][]PhoneChange),
+		bans:     make(map[string]PhoneBan),
+		sessions: make(map[string]Session),
 	}
 }
 
-func (r *InMemoryUserRepository) Create(phone string) (*User, error) {
+// live returns the user with id unless it is missing or soft-deleted. Callers hold r.mu.
+func (r *InMemoryUserRepository) live(id string) (User, bool) {
+	user, exists := r.users[id]
+	if !exists || user.DeletedAt != nil {
+		return User{}, false
+	}
+	return user, true
+}
+
+func (r *InMemoryUserRepository) Create(ctx context.Context, phone string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	phone, err := normalizePhone(phone)
+	if err != nil {
+		return nil, err
+	}
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if _, exists := r.users[phone]; exists {
-		return nil, errors.New("user already exists")
+	if _, exists := r.byPhone[phone]; exists {
+		return nil, ErrUserExists
 	}
 
+	now := time.Now()
 	user := User{
+		ID:               NewID(),
 		Phone:            phone,
-		RegistrationDate: time.Now(),
+		Role:             RoleUser,
+		Metadata:         emptyMetadata,
+		RegistrationDate: now,
+		UpdatedAt:        now,
 	}
 
-	r.users[phone] = user
+	r.users[user.ID] = user
+	r.byPhone[phone] = user.ID
 	return &user, nil
 }
 
-func (r *InMemoryUserRepository) GetByPhone(phone string) (*User, error) {
+func (r *InMemoryUserRepository) GetByID(ctx context.Context, id string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, exists := r.live(id)
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+	return &user, nil
+}
+
+func (r *InMemoryUserRepository) GetByPhone(ctx context.Context, phone string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	phone, err := normalizePhone(phone)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	user, exists := r.users[phone]
+	id, exists := r.byPhone[phone]
 	if !exists {
 		return nil, ErrUserNotFound
 	}
+	user := r.users[id]
+	if user.DeletedAt != nil {
+		return nil, ErrUserDeleted
+	}
 	return &user, nil
 }
 
-func (r *InMemoryUserRepository) List(offset, limit int, search string) ([]User, error) {
+func (r *InMemoryUserRepository) List(ctx context.Context, offset, limit int, search string) ([]User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
@@ -69,10 +200,11 @@ func (r *InMemoryUserRepository) List(offset, limit int, search string) ([]User,
 	search = strings.TrimSpace(search)
 
 	for _, user := range r.users {
-		if search == "" || strings.Contains(user.Phone, search) {
+		if user.DeletedAt == nil && (search == "" || strings.Contains(user.Phone, search)) {
 			result = append(result, user)
 		}
 	}
+	sortUsers(result, SortNewest)
 
 	// صفحه‌بندی
 	start := offset
@@ -87,33 +219,223 @@ func (r *InMemoryUserRepository) List(offset, limit int, search string) ([]User,
 	return result[start:end], nil
 }
 
-func (r *InMemoryUserRepository) UpdatePhone(oldPhone, newPhone string) error {
+// ListPage returns one page of users in the order documented on SortOrder.
+func (r *InMemoryUserRepository) ListPage(ctx context.Context, opts ListOptions) (*UserPage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	after, err := opts.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	matched := []User{}
+	for _, user := range r.users {
+		if opts.matches(user) {
+			matched = append(matched, user)
+		}
+	}
+	r.mu.RUnlock()
+
+	sortUsers(matched, opts.Sort)
+	page := &UserPage{Users: []User{}, Total: len(matched)}
+	for _, user := range matched {
+		if after != nil && !opts.Sort.before(*after, keyOf(user)) {
+			continue
+		}
+		if len(page.Users) == opts.Limit {
+			page.NextCursor = encodeCursor(opts.Sort, page.Users[len(page.Users)-1])
+			break
+		}
+		page.Users = append(page.Users, user)
+	}
+	return page, nil
+}
+
+func (o ListOptions) matches(u User) bool {
+	if (u.DeletedAt != nil) != o.Deleted {
+		return false
+	}
+	if o.Search != "" && !strings.Contains(u.Phone, o.Search) {
+		return false
+	}
+	if o.Role != "" && u.Role != o.Role {
+		return false
+	}
+	if !o.RegisteredFrom.IsZero() && u.RegistrationDate.Before(o.RegisteredFrom) {
+		return false
+	}
+	if !o.RegisteredBefore.IsZero() && !u.RegistrationDate.Before(o.RegisteredBefore) {
+		return false
+	}
+	return true
+}
+
+func sortUsers(users []User, order SortOrder) {
+	sort.Slice(users, func(i, j int) bool { return order.before(keyOf(users[i]), keyOf(users[j])) })
+}
+
+func (r *InMemoryUserRepository) UpdatePhone(ctx context.Context, id, newPhone string, method PhoneChangeMethod, changedBy string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	newPhone, err := normalizePhone(newPhone)
+	if err != nil {
+		return err
+	}
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	user, exists := r.users[oldPhone]
+	user, exists := r.live(id)
 	if !exists {
 		return ErrUserNotFound
 	}
 
-	if _, exists := r.users[newPhone]; exists {
-		return errors.New("new phone already exists")
+	if _, exists := r.byPhone[newPhone]; exists {
+		return ErrPhoneTaken
 	}
 
-	delete(r.users, oldPhone)
+	now := time.Now()
+	r.history[id] = append(r.history[id], PhoneChange{
+		OldPhone:  user.Phone,
+		NewPhone:  newPhone,
+		Method:    method,
+		ChangedBy: changedBy,
+		ChangedAt: now,
+	})
+
+	delete(r.byPhone, user.Phone)
 	user.Phone = newPhone
-	r.users[newPhone] = user
+	user.UpdatedAt = now
+	r.users[id] = user
+	r.byPhone[newPhone] = id
+	return nil
+}
+
+func (r *InMemoryUserRepository) UpdateRole(ctx context.Context, id string, role Role) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !role.Valid() {
+		return ErrInvalidRole
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, exists := r.live(id)
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	user.Role = role
+	user.UpdatedAt = time.Now()
+	r.users[id] = user
 	return nil
 }
 
-func (r *InMemoryUserRepository) Delete(phone string) error {
+func (r *InMemoryUserRepository) UpdateProfile(ctx context.Context, id string, upd ProfileUpdate) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := upd.Validate(); err != nil {
+		return nil, err
+	}
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if _, exists := r.users[phone]; !exists {
+	user, exists := r.live(id)
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	upd.apply(&user)
+	user.UpdatedAt = time.Now()
+	r.users[id] = user
+	return &user, nil
+}
+
+func (r *InMemoryUserRepository) Delete(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, exists := r.live(id)
+	if !exists {
 		return ErrUserNotFound
 	}
 
-	delete(r.users, phone)
+	now := time.Now()
+	user.DeletedAt = &now
+	user.UpdatedAt = now
+	r.users[id] = user
+	return nil
+}
+
+func (r *InMemoryUserRepository) Restore(ctx context.Context, id string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, exists := r.users[id]
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+	if user.DeletedAt == nil {
+		return nil, ErrUserNotDeleted
+	}
+
+	user.DeletedAt = nil
+	user.UpdatedAt = time.Now()
+	r.users[id] = user
+	return &user, nil
+}
+
+func (r *InMemoryUserRepository) Purge(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.users[id]; !exists {
+		return ErrUserNotFound
+	}
+	r.erase(id)
 	return nil
 }
+
+func (r *InMemoryUserRepository) PurgeDeleted(ctx context.Context, cutoff time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	purged := 0
+	for id, user := range r.users {
+		if user.DeletedAt != nil && user.DeletedAt.Before(cutoff) {
+			r.erase(id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// erase removes every trace of a user. Callers hold r.mu.
+func (r *InMemoryUserRepository) erase(id string) {
+	delete(r.byPhone, r.users[id].Phone)
+	delete(r.users, id)
+	delete(r.history, id)
+	for sid, s := range r.sessions {
+		if s.UserID == id {
+			delete(r.sessions, sid)
+		}
+	}
+}
@@ -1,15 +1,21 @@
 package repository
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
+	"user-go/internal/phone"
 )
 
+var ctx = context.Background()
+
 func TestInMemoryUserRepository_CreateAndGet(t *testing.T) {
 	repo := NewInMemoryUserRepository()
 
-	phone := "+1234567890"
+	phone := "+12025550123"
 
-	user, err := repo.Create(phone)
+	user, err := repo.Create(ctx, phone)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -17,94 +23,299 @@ func TestInMemoryUserRepository_CreateAndGet(t *testing.T) {
 		t.Errorf("expected phone %s, got %s", phone, user.Phone)
 	}
 
-	gotUser, err := repo.GetByPhone(phone)
+	gotUser, err := repo.GetByPhone(ctx, phone)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	if gotUser.Phone != phone {
 		t.Errorf("expected phone %s, got %s", phone, gotUser.Phone)
 	}
+
+	byID, err := repo.GetByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if byID.Phone != phone || !ValidID(byID.ID) {
+		t.Errorf("unexpected user by id: %+v", byID)
+	}
+	if _, err := repo.GetByID(ctx, phone); err != ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound for a phone used as id, got %v", err)
+	}
+	if _, err := repo.Create(ctx, phone); !errors.Is(err, ErrUserExists) {
+		t.Errorf("expected ErrUserExists for a second create, got %v", err)
+	}
 }
 
 func TestInMemoryUserRepository_List(t *testing.T) {
 	repo := NewInMemoryUserRepository()
 
-	phones := []string{"+111", "+222", "+333"}
+	phones := []string{"+989120000111", "+989120000222", "+989120000333"}
 	for _, p := range phones {
-		_, err := repo.Create(p)
+		_, err := repo.Create(ctx, p)
 		if err != nil {
 			t.Fatalf("unexpected error creating user: %v", err)
 		}
 	}
 
-	users, err := repo.List(0, 10, "+2")
+	users, err := repo.List(ctx, 0, 10, "222")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	if len(users) != 1 {
 		t.Errorf("expected 1 user, got %d", len(users))
 	}
-	if users[0].Phone != "+222" {
-		t.Errorf("expected phone +222, got %s", users[0].Phone)
+	if users[0].Phone != "+989120000222" {
+		t.Errorf("expected phone +989120000222, got %s", users[0].Phone)
 	}
 }
 
 func TestInMemoryUserRepository_UpdatePhone(t *testing.T) {
 	repo := NewInMemoryUserRepository()
 
-	_, _ = repo.Create("+111")
-	_, _ = repo.Create("+222")
+	first, _ := repo.Create(ctx, "+989120000111")
+	second, _ := repo.Create(ctx, "+989120000222")
 
 	// تغییر شماره معتبر
-	err := repo.UpdatePhone("+111", "+333")
+	err := repo.UpdatePhone(ctx, first.ID, "+989120000333", PhoneChangeVerified, first.ID)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	_, err = repo.GetByPhone("+111")
+	_, err = repo.GetByPhone(ctx, "+989120000111")
 	if err != ErrUserNotFound {
 		t.Errorf("expected ErrUserNotFound, got %v", err)
 	}
 
-	user, err := repo.GetByPhone("+333")
+	user, err := repo.GetByPhone(ctx, "+989120000333")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if user.Phone != "+333" {
-		t.Errorf("expected phone +333, got %s", user.Phone)
+	if user.Phone != "+989120000333" {
+		t.Errorf("expected phone +989120000333, got %s", user.Phone)
+	}
+	if user.ID != first.ID {
+		t.Errorf("expected id %s to survive the phone change, got %s", first.ID, user.ID)
 	}
 
 	// تغییر به شماره تکراری
-	err = repo.UpdatePhone("+222", "+333")
-	if err == nil {
-		t.Errorf("expected error for duplicate new phone")
+	err = repo.UpdatePhone(ctx, second.ID, "+989120000333", PhoneChangeVerified, second.ID)
+	if err != ErrPhoneTaken {
+		t.Errorf("expected ErrPhoneTaken, got %v", err)
 	}
 
 	// تغییر شماره غیر موجود
-	err = repo.UpdatePhone("+999", "+444")
+	err = repo.UpdatePhone(ctx, NewID(), "+989120000444", PhoneChangeAdmin, "")
 	if err != ErrUserNotFound {
 		t.Errorf("expected ErrUserNotFound, got %v", err)
 	}
 }
 
+func TestInMemoryUserRepository_RequiresE164(t *testing.T) {
+	repo := NewInMemoryUserRepository()
+
+	if _, err := repo.Create(ctx, "09121234567"); !errors.Is(err, phone.ErrInvalid) {
+		t.Fatalf("expected phone.ErrInvalid, got %v", err)
+	}
+
+	user, err := repo.Create(ctx, "+98 912 123 4567")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if user.Phone != "+989121234567" {
+		t.Errorf("expected normalized phone, got %s", user.Phone)
+	}
+	if _, err := repo.GetByPhone(ctx, "+98-912-123-4567"); err != nil {
+		t.Errorf("lookup with formatting failed: %v", err)
+	}
+	if _, err := repo.GetByPhone(ctx, "not a phone"); err != ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+	if err := repo.UpdatePhone(ctx, user.ID, "12345", PhoneChangeAdmin, ""); !errors.Is(err, phone.ErrInvalid) {
+		t.Errorf("expected phone.ErrInvalid, got %v", err)
+	}
+}
+
+func TestInMemoryUserRepository_PhoneHistory(t *testing.T) {
+	repo := NewInMemoryUserRepository()
+
+	user, _ := repo.Create(ctx, "+989120000111")
+	admin := NewID()
+
+	history, err := repo.PhoneHistory(ctx, user.ID)
+	if err != nil || len(history) != 0 {
+		t.Fatalf("expected empty history, got %+v, %v", history, err)
+	}
+
+	if err := repo.UpdatePhone(ctx, user.ID, "+989120000222", PhoneChangeVerified, user.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := repo.UpdatePhone(ctx, user.ID, "+989120000333", PhoneChangeAdmin, admin); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// شماره‌ی تکراری در تاریخچه ثبت نمی‌شود
+	other, _ := repo.Create(ctx, "+989120000444")
+	if err := repo.UpdatePhone(ctx, user.ID, other.Phone, PhoneChangeAdmin, admin); err != ErrPhoneTaken {
+		t.Fatalf("expected ErrPhoneTaken, got %v", err)
+	}
+
+	history, err = repo.PhoneHistory(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("expected 2 entries, got %+v", history)
+	}
+	if history[0].OldPhone != "+989120000222" || history[0].NewPhone != "+989120000333" || history[0].Method != PhoneChangeAdmin || history[0].ChangedBy != admin {
+		t.Errorf("unexpected newest entry: %+v", history[0])
+	}
+	if history[1].OldPhone != "+989120000111" || history[1].Method != PhoneChangeVerified {
+		t.Errorf("unexpected oldest entry: %+v", history[1])
+	}
+
+	if _, err := repo.PhoneHistory(ctx, NewID()); err != ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+}
+
 func TestInMemoryUserRepository_Delete(t *testing.T) {
 	repo := NewInMemoryUserRepository()
 
-	_, _ = repo.Create("+111")
+	user, _ := repo.Create(ctx, "+989120000111")
 
-	err := repo.Delete("+111")
+	err := repo.Delete(ctx, user.ID)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	_, err = repo.GetByPhone("+111")
-	if err != ErrUserNotFound {
+	// حذف نرم: کاربر دیده نمی‌شود ولی شماره رزرو می‌ماند
+	_, err = repo.GetByPhone(ctx, "+989120000111")
+	if err != ErrUserDeleted {
+		t.Errorf("expected ErrUserDeleted, got %v", err)
+	}
+	if _, err := repo.GetByID(ctx, user.ID); err != ErrUserNotFound {
 		t.Errorf("expected ErrUserNotFound, got %v", err)
 	}
+	if _, err := repo.Create(ctx, "+989120000111"); err == nil {
+		t.Error("expected the phone of a deleted user to stay reserved")
+	}
+	if err := repo.UpdateRole(ctx, user.ID, RoleAdmin); err != ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+	if users, _ := repo.List(ctx, 0, 10, ""); len(users) != 0 {
+		t.Errorf("expected deleted user to be hidden, got %+v", users)
+	}
 
-	// حذف شماره غیر موجود
-	err = repo.Delete("+222")
+	// حذف دوباره
+	err = repo.Delete(ctx, user.ID)
 	if err != ErrUserNotFound {
 		t.Errorf("expected ErrUserNotFound, got %v", err)
 	}
 }
+
+func TestInMemoryUserRepository_Restore(t *testing.T) {
+	repo := NewInMemoryUserRepository()
+
+	user, _ := repo.Create(ctx, "+989120000111")
+
+	if _, err := repo.Restore(ctx, user.ID); err != ErrUserNotDeleted {
+		t.Errorf("expected ErrUserNotDeleted, got %v", err)
+	}
+	if _, err := repo.Restore(ctx, NewID()); err != ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+
+	_ = repo.Delete(ctx, user.ID)
+	restored, err := repo.Restore(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if restored.DeletedAt != nil || restored.ID != user.ID {
+		t.Errorf("unexpected restored user: %+v", restored)
+	}
+	if _, err := repo.GetByPhone(ctx, "+989120000111"); err != nil {
+		t.Errorf("expected restored user to be found, got %v", err)
+	}
+}
+
+func TestInMemoryUserRepository_Purge(t *testing.T) {
+	repo := NewInMemoryUserRepository()
+
+	old, _ := repo.Create(ctx, "+989120000111")
+	recent, _ := repo.Create(ctx, "+989120000222")
+	live, _ := repo.Create(ctx, "+989120000333")
+	_ = repo.UpdatePhone(ctx, old.ID, "+989120000444", PhoneChangeVerified, old.ID)
+
+	_ = repo.Delete(ctx, old.ID)
+	cutoff := time.Now()
+	_ = repo.Delete(ctx, recent.ID)
+
+	purged, err := repo.PurgeDeleted(ctx, cutoff)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("expected 1 purged user, got %d", purged)
+	}
+
+	// بعد از purge شماره آزاد است و تاریخچه پاک شده
+	if _, err := repo.GetByPhone(ctx, "+989120000444"); err != ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+	if _, exists := repo.history[old.ID]; exists {
+		t.Error("expected phone history to be erased")
+	}
+	if _, err := repo.Restore(ctx, recent.ID); err != nil {
+		t.Errorf("recently deleted user should still be restorable, got %v", err)
+	}
+
+	if err := repo.Purge(ctx, live.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := repo.Create(ctx, "+989120000333"); err != nil {
+		t.Errorf("expected phone to be free after purge, got %v", err)
+	}
+	if err := repo.Purge(ctx, live.ID); err != ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestInMemoryUserRepository_UpdateRole(t *testing.T) {
+	repo := NewInMemoryUserRepository()
+
+	user, _ := repo.Create(ctx, "+989120000111")
+	if user.Role != RoleUser {
+		t.Errorf("expected default role %s, got %s", RoleUser, user.Role)
+	}
+
+	if err := repo.UpdateRole(ctx, user.ID, Role("root")); err != ErrInvalidRole {
+		t.Errorf("expected ErrInvalidRole, got %v", err)
+	}
+	if err := repo.UpdateRole(ctx, NewID(), RoleAdmin); err != ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+	if err := repo.UpdateRole(ctx, user.ID, RoleAdmin); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, _ := repo.GetByPhone(ctx, "+989120000111")
+	if got.Role != RoleAdmin {
+		t.Errorf("expected role %s, got %s", RoleAdmin, got.Role)
+	}
+}
+
+func TestInMemoryUserRepository_CanceledContext(t *testing.T) {
+	repo := NewInMemoryUserRepository()
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if _, err := repo.Create(canceled, "+989120000111"); err != context.Canceled {
+		t.Errorf("Create: expected context.Canceled, got %v", err)
+	}
+	if _, err := repo.GetByPhone(ctx, "+989120000111"); err != ErrUserNotFound {
+		t.Errorf("user must not be created with a canceled context, got %v", err)
+	}
+	if _, err := repo.ListPage(canceled, ListOptions{}); err != context.Canceled {
+		t.Errorf("ListPage: expected context.Canceled, got %v", err)
+	}
+}
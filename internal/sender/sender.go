@@ -0,0 +1,73 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Channel is the medium an OTP is delivered through.
+type Channel string
+
+const (
+	ChannelSMS     Channel = "sms"
+	ChannelVoice   Channel = "voice"
+	ChannelEmail   Channel = "email"
+	ChannelWebhook Channel = "webhook"
+)
+
+var ErrUnsupportedChannel = errors.New("channel not supported by sender")
+
+// Message is a single OTP delivery request.
+type Message struct {
+	Channel Channel
+	To      string
+	Code    string
+	TTL     time.Duration
+}
+
+// Body renders the human-readable text sent to the recipient.
+func (m Message) Body() string {
+	return fmt.Sprintf("Your verification code is %s. It expires in %d minutes.", m.Code, int(m.TTL.Minutes()))
+}
+
+// Sender delivers OTP codes to users. Implementations must be safe for concurrent use.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// ConsoleSender writes messages to a writer (stdout or a file). Intended for local development only.
+type ConsoleSender struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewConsoleSender(w io.Writer) *ConsoleSender {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &ConsoleSender{w: w}
+}
+
+// NewFileSender appends messages to the file at path, creating it if needed.
+func NewFileSender(path string) (*ConsoleSender, io.Closer, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, nil, err
+	}
+	return NewConsoleSender(f), f, nil
+}
+
+func (s *ConsoleSender) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := fmt.Fprintf(s.w, "[%s] OTP for %s: %s (expires in %s)\n", msg.Channel, msg.To, msg.Code, msg.TTL)
+	return err
+}
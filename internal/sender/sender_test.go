@@ -0,0 +1,32 @@
+package sender
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsoleSender_Send(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewConsoleSender(&buf)
+
+	err := s.Send(context.Background(), Message{Channel: ChannelSMS, To: "+123", Code: "654321", TTL: 2 * time.Minute})
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "+123")
+	assert.Contains(t, buf.String(), "654321")
+}
+
+func TestConsoleSender_CanceledContext(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewConsoleSender(&buf)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := s.Send(ctx, Message{To: "+123", Code: "654321"})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, buf.String())
+}
@@ -0,0 +1,172 @@
+package sender
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// SMPP 3.4 command ids used by SMPPSender.
+const (
+	smppBindTransmitter     uint32 = 0x00000002
+	smppBindTransmitterResp uint32 = 0x80000002
+	smppSubmitSM            uint32 = 0x00000004
+	smppSubmitSMResp        uint32 = 0x80000004
+	smppUnbind              uint32 = 0x00000006
+	smppUnbindResp          uint32 = 0x80000006
+
+	smppHeaderLen = 16
+	smppMaxPDULen = 64 * 1024
+)
+
+var ErrSMPPStatus = errors.New("smpp: non-zero command status")
+
+// SMPPConfig holds the connection settings of an SMSC.
+type SMPPConfig struct {
+	Addr       string
+	SystemID   string
+	Password   string
+	SystemType string
+	SourceAddr string
+	Timeout    time.Duration
+}
+
+// SMPPSender delivers SMS through an SMPP 3.4 SMSC as a transmitter. Every Send opens
+// a short-lived session (bind, submit_sm, unbind), which is enough for OTP volumes.
+type SMPPSender struct {
+	cfg SMPPConfig
+	seq atomic.Uint32
+}
+
+func NewSMPPSender(cfg SMPPConfig) *SMPPSender {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &SMPPSender{cfg: cfg}
+}
+
+type smppPDU struct {
+	commandID uint32
+	status    uint32
+	sequence  uint32
+	body      []byte
+}
+
+func (s *SMPPSender) Send(ctx context.Context, msg Message) error {
+	if msg.Channel != "" && msg.Channel != ChannelSMS {
+		return ErrUnsupportedChannel
+	}
+
+	dialer := net.Dialer{Timeout: s.cfg.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("smpp: dial: %w", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(s.cfg.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(conn)
+
+	bind := new(bytes.Buffer)
+	writeCString(bind, s.cfg.SystemID)
+	writeCString(bind, s.cfg.Password)
+	writeCString(bind, s.cfg.SystemType)
+	bind.Write([]byte{0x34, 0x00, 0x00}) // interface_version, addr_ton, addr_npi
+	writeCString(bind, "")               // address_range
+	if _, err := s.roundTrip(conn, r, smppBindTransmitter, smppBindTransmitterResp, bind.Bytes()); err != nil {
+		return fmt.Errorf("smpp: bind: %w", err)
+	}
+
+	text := []byte(msg.Body())
+	if len(text) > 254 {
+		return errors.New("smpp: message too long for a single submit_sm")
+	}
+	submit := new(bytes.Buffer)
+	writeCString(submit, "")                    // service_type
+	submit.Write([]byte{0x05, 0x00})            // source_addr_ton (alphanumeric), source_addr_npi
+	writeCString(submit, s.cfg.SourceAddr)      // source_addr
+	submit.Write([]byte{0x01, 0x01})            // dest_addr_ton (international), dest_addr_npi (E.164)
+	writeCString(submit, msg.To)                // destination_addr
+	submit.Write([]byte{0x00, 0x00, 0x00})      // esm_class, protocol_id, priority_flag
+	writeCString(submit, "")                    // schedule_delivery_time
+	writeCString(submit, "")                    // validity_period
+	submit.Write([]byte{0x00, 0x00, 0x00})      // registered_delivery, replace_if_present_flag, data_coding
+	submit.Write([]byte{0x00, byte(len(text))}) // sm_default_msg_id, sm_length
+	submit.Write(text)
+	if _, err := s.roundTrip(conn, r, smppSubmitSM, smppSubmitSMResp, submit.Bytes()); err != nil {
+		return fmt.Errorf("smpp: submit_sm: %w", err)
+	}
+
+	// The message is already accepted; a failed unbind only affects the session.
+	_, _ = s.roundTrip(conn, r, smppUnbind, smppUnbindResp, nil)
+	return nil
+}
+
+func (s *SMPPSender) roundTrip(w io.Writer, r io.Reader, commandID, respID uint32, body []byte) (*smppPDU, error) {
+	seq := s.seq.Add(1)
+	if err := writePDU(w, smppPDU{commandID: commandID, sequence: seq, body: body}); err != nil {
+		return nil, err
+	}
+	resp, err := readPDU(r)
+	if err != nil {
+		return nil, err
+	}
+	if resp.commandID != respID || resp.sequence != seq {
+		return nil, fmt.Errorf("unexpected response 0x%08x seq %d", resp.commandID, resp.sequence)
+	}
+	if resp.status != 0 {
+		return nil, fmt.Errorf("%w 0x%08x", ErrSMPPStatus, resp.status)
+	}
+	return resp, nil
+}
+
+func writeCString(b *bytes.Buffer, s string) {
+	b.WriteString(s)
+	b.WriteByte(0)
+}
+
+func writePDU(w io.Writer, p smppPDU) error {
+	buf := make([]byte, smppHeaderLen+len(p.body))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(buf)))
+	binary.BigEndian.PutUint32(buf[4:8], p.commandID)
+	binary.BigEndian.PutUint32(buf[8:12], p.status)
+	binary.BigEndian.PutUint32(buf[12:16], p.sequence)
+	copy(buf[smppHeaderLen:], p.body)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readPDU(r io.Reader) (*smppPDU, error) {
+	header := make([]byte, smppHeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length < smppHeaderLen || length > smppMaxPDULen {
+		return nil, fmt.Errorf("invalid pdu length %d", length)
+	}
+	p := &smppPDU{
+		commandID: binary.BigEndian.Uint32(header[4:8]),
+		status:    binary.BigEndian.Uint32(header[8:12]),
+		sequence:  binary.BigEndian.Uint32(header[12:16]),
+		body:      make([]byte, length-smppHeaderLen),
+	}
+	if _, err := io.ReadFull(r, p.body); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
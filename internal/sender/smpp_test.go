@@ -0,0 +1,105 @@
+package sender
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSMSC is a minimal SMPP server that accepts binds and records submit_sm bodies.
+type fakeSMSC struct {
+	ln         net.Listener
+	bindStatus uint32
+
+	mu        sync.Mutex
+	submitted [][]byte
+	commands  []uint32
+}
+
+func newFakeSMSC(t *testing.T, bindStatus uint32) *fakeSMSC {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	f := &fakeSMSC{ln: ln, bindStatus: bindStatus}
+	go f.serve()
+	t.Cleanup(func() { ln.Close() })
+	return f
+}
+
+func (f *fakeSMSC) serve() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeSMSC) handle(conn net.Conn) {
+	defer conn.Close()
+	for {
+		p, err := readPDU(conn)
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.commands = append(f.commands, p.commandID)
+		f.mu.Unlock()
+
+		resp := smppPDU{sequence: p.sequence}
+		switch p.commandID {
+		case smppBindTransmitter:
+			resp.commandID = smppBindTransmitterResp
+			resp.status = f.bindStatus
+			resp.body = []byte("fake\x00")
+		case smppSubmitSM:
+			f.mu.Lock()
+			f.submitted = append(f.submitted, p.body)
+			f.mu.Unlock()
+			resp.commandID = smppSubmitSMResp
+			resp.body = []byte("msg-1\x00")
+		case smppUnbind:
+			resp.commandID = smppUnbindResp
+		default:
+			return
+		}
+		if err := writePDU(conn, resp); err != nil {
+			return
+		}
+	}
+}
+
+func TestSMPPSender_Send(t *testing.T) {
+	smsc := newFakeSMSC(t, 0)
+
+	s := NewSMPPSender(SMPPConfig{Addr: smsc.ln.Addr().String(), SystemID: "user", Password: "pass", SourceAddr: "UserGo", Timeout: time.Second})
+	err := s.Send(context.Background(), Message{Channel: ChannelSMS, To: "+989121234567", Code: "123456", TTL: 2 * time.Minute})
+	require.NoError(t, err)
+
+	smsc.mu.Lock()
+	defer smsc.mu.Unlock()
+	assert.Equal(t, []uint32{smppBindTransmitter, smppSubmitSM, smppUnbind}, smsc.commands)
+	require.Len(t, smsc.submitted, 1)
+	assert.True(t, bytes.Contains(smsc.submitted[0], []byte("+989121234567\x00")))
+	assert.True(t, bytes.Contains(smsc.submitted[0], []byte("123456")))
+}
+
+func TestSMPPSender_BindRejected(t *testing.T) {
+	smsc := newFakeSMSC(t, 0x0000000E) // ESME_RINVPASWD
+
+	s := NewSMPPSender(SMPPConfig{Addr: smsc.ln.Addr().String(), SystemID: "user", Password: "wrong", Timeout: time.Second})
+	err := s.Send(context.Background(), Message{Channel: ChannelSMS, To: "+1", Code: "123456"})
+	assert.ErrorIs(t, err, ErrSMPPStatus)
+}
+
+func TestSMPPSender_UnsupportedChannel(t *testing.T) {
+	s := NewSMPPSender(SMPPConfig{Addr: "127.0.0.1:1"})
+	err := s.Send(context.Background(), Message{Channel: ChannelEmail, To: "a@b.c", Code: "123456"})
+	assert.ErrorIs(t, err, ErrUnsupportedChannel)
+}
@@ -0,0 +1,66 @@
+package sender
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WebhookSender POSTs each message as JSON to a configured URL. It can front any
+// provider (SMS gateway, voice, email relay) that accepts an HTTP callback.
+type WebhookSender struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func NewWebhookSender(url string, headers map[string]string, client *http.Client) *WebhookSender {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &WebhookSender{url: url, headers: headers, client: client}
+}
+
+type webhookPayload struct {
+	Channel    Channel `json:"channel"`
+	To         string  `json:"to"`
+	Code       string  `json:"code"`
+	Body       string  `json:"body"`
+	TTLSeconds int     `json:"ttl_seconds"`
+}
+
+func (s *WebhookSender) Send(ctx context.Context, msg Message) error {
+	payload, err := json.Marshal(webhookPayload{
+		Channel:    msg.Channel,
+		To:         msg.To,
+		Code:       msg.Code,
+		Body:       msg.Body(),
+		TTLSeconds: int(msg.TTL.Seconds()),
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
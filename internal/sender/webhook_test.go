@@ -0,0 +1,44 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookSender_Send(t *testing.T) {
+	var got webhookPayload
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	s := NewWebhookSender(srv.URL, map[string]string{"Authorization": "Bearer key"}, nil)
+	err := s.Send(context.Background(), Message{Channel: ChannelSMS, To: "+123", Code: "111222", TTL: 2 * time.Minute})
+	require.NoError(t, err)
+
+	assert.Equal(t, "Bearer key", auth)
+	assert.Equal(t, "+123", got.To)
+	assert.Equal(t, "111222", got.Code)
+	assert.Equal(t, 120, got.TTLSeconds)
+}
+
+func TestWebhookSender_ErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	s := NewWebhookSender(srv.URL, nil, nil)
+	err := s.Send(context.Background(), Message{To: "+123", Code: "111222"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+	"user-go/internal/apperr"
+	"user-go/internal/cache"
+	"user-go/internal/repository"
+)
+
+var (
+	ErrAccountBlocked = apperr.New(apperr.Forbidden, "account_blocked", "account is blocked")
+	ErrInvalidBlock   = apperr.New(apperr.Invalid, "invalid_block", "suspension must end in the future")
+)
+
+// BlockedError is returned for a suspended or banned account or a banned phone prefix.
+// It matches ErrAccountBlocked with errors.Is.
+type BlockedError struct {
+	Block *repository.Block
+}
+
+func (e *BlockedError) Error() string {
+	if e.Block.Until != nil {
+		return fmt.Sprintf("%s: %s until %s", ErrAccountBlocked, e.Block.Kind, e.Block.Until.UTC().Format(time.RFC3339))
+	}
+	return fmt.Sprintf("%s: %s", ErrAccountBlocked, e.Block.Kind)
+}
+
+func (e *BlockedError) Is(target error) bool {
+	return target == ErrAccountBlocked
+}
+
+func (e *BlockedError) Kind() apperr.Kind { return ErrAccountBlocked.Kind() }
+func (e *BlockedError) Code() string      { return ErrAccountBlocked.Code() }
+
+// Details tells the client what kind of block applies and until when. The reason is an
+// admin's note and is left out: login endpoints answer anyone who knows the phone number.
+func (e *BlockedError) Details() map[string]any {
+	details := map[string]any{"kind": e.Block.Kind}
+	if e.Block.Until != nil {
+		details["until"] = e.Block.Until.UTC().Format(time.RFC3339)
+	}
+	return details
+}
+
+// defaultStatusTTL bounds how long a block change made on another cache can go unnoticed.
+const defaultStatusTTL = 30 * time.Second
+
+// BlockService suspends and bans users and phone prefixes, and answers the hot-path
+// question "may this user or phone proceed?" from the cache.
+type BlockService struct {
+	cache     cache.Cache
+	users     repository.UserRepository
+	bans      repository.PhoneBanRepository
+	tokens    *TokenService
+	statusTTL time.Duration
+	now       func() time.Time
+}
+
+// NewBlockService builds a BlockService. tokens may be nil, in which case blocking
+// relies on CheckAccess alone to reject existing tokens.
+func NewBlockService(c cache.Cache, users repository.UserRepository, bans repository.PhoneBanRepository, tokens *TokenService) *BlockService {
+	return &BlockService{
+		cache:     c,
+		users:     users,
+		bans:      bans,
+		tokens:    tokens,
+		statusTTL: defaultStatusTTL,
+		now:       time.Now,
+	}
+}
+
+func statusKey(userID string) string { return "user_status:" + userID }
+
+const phoneBansKey = "phone_bans"
+
+// Suspend blocks the user until the given time.
+func (s *BlockService) Suspend(ctx context.Context, userID, reason string, until time.Time, by string) error {
+	now := s.now()
+	if !until.After(now) {
+		return ErrInvalidBlock
+	}
+	until = until.UTC()
+	return s.setBlock(ctx, userID, &repository.Block{
+		Kind: repository.BlockSuspended, Reason: reason, Until: &until, BlockedBy: by, BlockedAt: now,
+	})
+}
+
+// Ban blocks the user until Unblock is called.
+func (s *BlockService) Ban(ctx context.Context, userID, reason, by string) error {
+	return s.setBlock(ctx, userID, &repository.Block{
+		Kind: repository.BlockBanned, Reason: reason, BlockedBy: by, BlockedAt: s.now(),
+	})
+}
+
+// Unblock lifts a suspension or ban.
+func (s *BlockService) Unblock(ctx context.Context, userID string) error {
+	return s.setBlock(ctx, userID, nil)
+}
+
+func (s *BlockService) setBlock(ctx context.Context, userID string, block *repository.Block) error {
+	if err := s.users.SetBlock(ctx, userID, block); err != nil {
+		return err
+	}
+	// وضعیت کش‌شده باید فوراً از بین برود، حتی اگر کلاینت قطع شده باشد
+	bookkeeping := context.WithoutCancel(ctx)
+	if err := s.cache.Delete(bookkeeping, statusKey(userID)); err != nil {
+		return err
+	}
+	if block != nil && s.tokens != nil {
+		return s.tokens.RevokeAll(bookkeeping, userID)
+	}
+	return nil
+}
+
+// BanPrefix blocks every phone starting with prefix, which must already be normalized.
+func (s *BlockService) BanPrefix(ctx context.Context, prefix, reason, by string) error {
+	err := s.bans.AddPhoneBan(ctx, repository.PhoneBan{Prefix: prefix, Reason: reason, CreatedBy: by, CreatedAt: s.now()})
+	if err != nil {
+		return err
+	}
+	return s.cache.Delete(context.WithoutCancel(ctx), phoneBansKey)
+}
+
+// UnbanPrefix lifts a prefix ban; repository.ErrBanNotFound if there is none.
+func (s *BlockService) UnbanPrefix(ctx context.Context, prefix string) error {
+	if err := s.bans.RemovePhoneBan(ctx, prefix); err != nil {
+		return err
+	}
+	return s.cache.Delete(context.WithoutCancel(ctx), phoneBansKey)
+}
+
+// PhoneBans lists every prefix ban, read through the cache.
+func (s *BlockService) PhoneBans(ctx context.Context) ([]repository.PhoneBan, error) {
+	if raw, err := s.cache.Get(ctx, phoneBansKey); err == nil {
+		var bans []repository.PhoneBan
+		if json.Unmarshal([]byte(raw), &bans) == nil {
+			return bans, nil
+		}
+	} else if !errors.Is(err, cache.ErrNotFound) {
+		return nil, err
+	}
+
+	bans, err := s.bans.ListPhoneBans(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if payload, err := json.Marshal(bans); err == nil {
+		_ = s.cache.SetWithTTL(ctx, phoneBansKey, string(payload), int(s.statusTTL.Seconds()))
+	}
+	return bans, nil
+}
+
+// CheckAccess returns the block keeping a token holder out, or nil if there is none.
+// The user's status is cached for a short while so the middleware stays cheap.
+func (s *BlockService) CheckAccess(ctx context.Context, userID, phone string) (*repository.Block, error) {
+	block, err := s.status(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if block.Active(s.now()) {
+		return block, nil
+	}
+	return s.prefixBlock(ctx, phone)
+}
+
+// CheckPhone refuses phones under a prefix ban and phones of blocked users with a *BlockedError.
+func (s *BlockService) CheckPhone(ctx context.Context, phone string) error {
+	block, err := s.prefixBlock(ctx, phone)
+	if err != nil {
+		return err
+	}
+	if block == nil {
+		user, err := s.users.GetByPhone(ctx, phone)
+		if err == nil {
+			block = user.Block
+		} else if !errors.Is(err, repository.ErrUserNotFound) && !errors.Is(err, repository.ErrUserDeleted) {
+			return err
+		}
+	}
+	if block.Active(s.now()) {
+		return &BlockedError{Block: block}
+	}
+	return nil
+}
+
+func (s *BlockService) prefixBlock(ctx context.Context, phone string) (*repository.Block, error) {
+	if phone == "" {
+		return nil, nil
+	}
+	bans, err := s.PhoneBans(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ban := repository.MatchPhoneBan(bans, phone)
+	if ban == nil {
+		return nil, nil
+	}
+	return &repository.Block{Kind: repository.BlockBanned, Reason: ban.Reason, BlockedBy: ban.CreatedBy, BlockedAt: ban.CreatedAt}, nil
+}
+
+// status returns the user's block, nil if none or the user is gone.
+func (s *BlockService) status(ctx context.Context, userID string) (*repository.Block, error) {
+	key := statusKey(userID)
+	if raw, err := s.cache.Get(ctx, key); err == nil {
+		var block *repository.Block
+		if json.Unmarshal([]byte(raw), &block) == nil {
+			return block, nil
+		}
+	} else if !errors.Is(err, cache.ErrNotFound) {
+		return nil, err
+	}
+
+	var block *repository.Block
+	user, err := s.users.GetByID(ctx, userID)
+	if err == nil {
+		block = user.Block
+	} else if !errors.Is(err, repository.ErrUserNotFound) {
+		return nil, err
+	}
+	// "null" هم کش می‌شود تا کاربران عادی هر بار به دیتابیس نروند
+	if payload, err := json.Marshal(block); err == nil {
+		_ = s.cache.SetWithTTL(ctx, key, string(payload), int(s.statusTTL.Seconds()))
+	}
+	return block, nil
+}
@@ -0,0 +1,134 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+	"user-go/internal/cache"
+	"user-go/internal/repository"
+	"user-go/internal/sender"
+	"user-go/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBlockService(t *testing.T) (*service.BlockService, *service.OtpService, *repository.InMemoryUserRepository, *repository.User) {
+	c := cache.NewInMemoryCache()
+	users := repository.NewInMemoryUserRepository()
+	tokens := service.NewTokenService(c, "testsecret")
+	blocks := service.NewBlockService(c, users, users, tokens)
+	otp := service.NewOtpService(c, users, "testsecret",
+		service.WithSender(sender.NewConsoleSender(io.Discard)),
+		service.WithTokenService(tokens),
+		service.WithBlockService(blocks),
+	)
+	user, err := users.Create(context.Background(), "+989121111111")
+	require.NoError(t, err)
+	return blocks, otp, users, user
+}
+
+func TestBlockService_SuspendRejectsTokensAndLogin(t *testing.T) {
+	blocks, otp, _, user := newBlockService(t)
+	ctx := context.Background()
+
+	pair, err := otp.Tokens().Issue(ctx, user)
+	require.NoError(t, err)
+
+	// وضعیت «مسدود نیست» کش می‌شود؛ Suspend باید آن را باطل کند
+	block, err := blocks.CheckAccess(ctx, user.ID, user.Phone)
+	require.NoError(t, err)
+	assert.Nil(t, block)
+
+	until := time.Now().Add(time.Hour)
+	require.NoError(t, blocks.Suspend(ctx, user.ID, "spam", until, "admin-id"))
+
+	block, err = blocks.CheckAccess(ctx, user.ID, user.Phone)
+	require.NoError(t, err)
+	require.NotNil(t, block)
+	assert.Equal(t, repository.BlockSuspended, block.Kind)
+	assert.Equal(t, "spam", block.Reason)
+
+	revoked, err := otp.Tokens().IsRevoked(ctx, parseClaims(t, pair.AccessToken))
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	_, err = otp.RequestOTP(ctx, user.Phone)
+	var blocked *service.BlockedError
+	require.True(t, errors.As(err, &blocked))
+	assert.ErrorIs(t, err, service.ErrAccountBlocked)
+	assert.Equal(t, repository.BlockSuspended, blocked.Block.Kind)
+
+	require.NoError(t, blocks.Unblock(ctx, user.ID))
+	block, err = blocks.CheckAccess(ctx, user.ID, user.Phone)
+	require.NoError(t, err)
+	assert.Nil(t, block)
+	_, err = otp.RequestOTP(ctx, user.Phone)
+	assert.NoError(t, err)
+}
+
+func TestBlockService_BanStopsValidation(t *testing.T) {
+	blocks, otp, _, user := newBlockService(t)
+	ctx := context.Background()
+
+	code, err := otp.RequestOTP(ctx, user.Phone)
+	require.NoError(t, err)
+	require.NoError(t, blocks.Ban(ctx, user.ID, "fraud", "admin-id"))
+
+	_, err = otp.ValidateOTP(ctx, user.Phone, code)
+	assert.ErrorIs(t, err, service.ErrAccountBlocked)
+}
+
+func TestBlockService_SuspendStoresUTC(t *testing.T) {
+	blocks, _, users, user := newBlockService(t)
+	ctx := context.Background()
+
+	tehran := time.FixedZone("IRST", 3*3600+1800)
+	until := time.Now().Add(time.Hour).In(tehran).Truncate(time.Second)
+	require.NoError(t, blocks.Suspend(ctx, user.ID, "spam", until, ""))
+	got, err := users.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	require.NotNil(t, got.Block)
+	assert.Equal(t, time.UTC, got.Block.Until.Location())
+	assert.True(t, until.Equal(*got.Block.Until))
+}
+
+func TestBlockService_SuspendValidation(t *testing.T) {
+	blocks, _, _, user := newBlockService(t)
+	ctx := context.Background()
+
+	assert.ErrorIs(t, blocks.Suspend(ctx, user.ID, "spam", time.Now().Add(-time.Minute), ""), service.ErrInvalidBlock)
+	assert.ErrorIs(t, blocks.Suspend(ctx, repository.NewID(), "spam", time.Now().Add(time.Hour), ""), repository.ErrUserNotFound)
+	assert.ErrorIs(t, blocks.Ban(ctx, repository.NewID(), "spam", ""), repository.ErrUserNotFound)
+}
+
+func TestBlockService_PrefixBan(t *testing.T) {
+	blocks, otp, _, user := newBlockService(t)
+	ctx := context.Background()
+
+	_, err := blocks.PhoneBans(ctx)
+	require.NoError(t, err)
+	require.NoError(t, blocks.BanPrefix(ctx, "+98912", "fraud", "admin-id"))
+
+	// شماره‌های ثبت‌نشده هم مسدود می‌شوند
+	_, err = otp.RequestOTP(ctx, "+989122222222")
+	assert.ErrorIs(t, err, service.ErrAccountBlocked)
+	_, err = otp.RequestOTP(ctx, "+989352222222")
+	assert.NoError(t, err)
+
+	block, err := blocks.CheckAccess(ctx, user.ID, user.Phone)
+	require.NoError(t, err)
+	require.NotNil(t, block)
+	assert.Equal(t, repository.BlockBanned, block.Kind)
+	assert.Equal(t, "fraud", block.Reason)
+
+	_, err = otp.RequestPhoneChange(ctx, user.ID, "+989123333333")
+	assert.ErrorIs(t, err, service.ErrAccountBlocked)
+
+	require.NoError(t, blocks.UnbanPrefix(ctx, "+98912"))
+	assert.ErrorIs(t, blocks.UnbanPrefix(ctx, "+98912"), repository.ErrBanNotFound)
+	_, err = otp.RequestOTP(ctx, "+989122222222")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+	"user-go/internal/apperr"
+)
+
+var (
+	ErrTooManyAttempts     = apperr.New(apperr.RateLimited, "too_many_attempts", "too many invalid OTP attempts, request a new code later")
+	ErrValidateRateLimited = apperr.New(apperr.RateLimited, "otp_validate_rate_limited", "too many OTP validation requests from this address")
+	ErrAccountLocked       = apperr.New(apperr.Locked, "account_locked", "phone is temporarily locked after repeated invalid OTPs")
+)
+
+// LockedError is returned while a phone is locked out. It matches ErrAccountLocked with errors.Is.
+type LockedError struct {
+	Until time.Time
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s (retry after %s)", ErrAccountLocked, e.Until.UTC().Format(time.RFC3339))
+}
+
+func (e *LockedError) Is(target error) bool {
+	return target == ErrAccountLocked
+}
+
+func (e *LockedError) Kind() apperr.Kind { return ErrAccountLocked.Kind() }
+func (e *LockedError) Code() string      { return ErrAccountLocked.Code() }
+
+// RetryAfter is the remaining lockout duration, rounded up to whole seconds.
+func (e *LockedError) RetryAfter() time.Duration {
+	d := time.Until(e.Until)
+	if d < 0 {
+		return 0
+	}
+	return d.Truncate(time.Second) + time.Second
+}
+
+// bruteForcePolicy holds the limits applied to OTP validation.
+type bruteForcePolicy struct {
+	maxAttempts     int
+	lockoutBase     time.Duration
+	lockoutMax      time.Duration
+	lockoutMemory   time.Duration
+	ipMaxAttempts   int
+	ipWindowSeconds int
+}
+
+var defaultBruteForcePolicy = bruteForcePolicy{
+	maxAttempts:     5,
+	lockoutBase:     time.Minute,
+	lockoutMax:      time.Hour,
+	lockoutMemory:   24 * time.Hour,
+	ipMaxAttempts:   30,
+	ipWindowSeconds: 600,
+}
+
+// WithMaxValidateAttempts sets how many wrong guesses invalidate an OTP.
+func WithMaxValidateAttempts(n int) Option {
+	return func(s *OtpService) { s.guard.maxAttempts = n }
+}
+
+// WithLockout sets the exponential lockout applied each time an OTP is burned:
+// base, 2*base, 4*base ... capped at max.
+func WithLockout(base, max time.Duration) Option {
+	return func(s *OtpService) {
+		s.guard.lockoutBase = base
+		s.guard.lockoutMax = max
+	}
+}
+
+// WithValidateIPLimit limits validation requests per client IP within window.
+func WithValidateIPLimit(n int, window time.Duration) Option {
+	return func(s *OtpService) {
+		s.guard.ipMaxAttempts = n
+		s.guard.ipWindowSeconds = int(window.Seconds())
+	}
+}
+
+// AllowValidateFrom counts a validation request from ip and rejects it once the per-IP limit is hit.
+func (s *OtpService) AllowValidateFrom(ctx context.Context, ip string) error {
+	if s.guard.ipMaxAttempts <= 0 {
+		return nil
+	}
+	count, err := s.cache.IncrWithExpire(ctx, "otp_val_ip:"+ip, s.guard.ipWindowSeconds)
+	if err != nil {
+		return err
+	}
+	if count > s.guard.ipMaxAttempts {
+		s.metrics.RateLimited("otp_validate_ip")
+		return ErrValidateRateLimited
+	}
+	return nil
+}
+
+// checkLocked returns a *LockedError if subject, a phone or a userLock, is currently locked out.
+func (s *OtpService) checkLocked(ctx context.Context, subject string) error {
+	val, err := s.cache.Get(ctx, "otp_lock:"+subject)
+	if err != nil {
+		// کلید وجود ندارد یعنی قفل نیست
+		return nil
+	}
+	unix, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return nil
+	}
+	until := time.Unix(unix, 0)
+	if time.Now().After(until) {
+		return nil
+	}
+	return &LockedError{Until: until}
+}
+
+// reserveAttempt counts a validation attempt for phone before its code is read and returns
+// its number. Counting first means concurrent guesses cannot all be compared before any of
+// them is counted: past maxAttempts it returns ErrTooManyAttempts without a comparison.
+func (s *OtpService) reserveAttempt(ctx context.Context, phone string) (int, error) {
+	attempt, err := s.cache.IncrWithExpire(ctx, "otp_fail:"+phone, int(s.otpTTL.Seconds()))
+	if err != nil {
+		return 0, err
+	}
+	if attempt > s.guard.maxAttempts {
+		return attempt, ErrTooManyAttempts
+	}
+	return attempt, nil
+}
+
+// recordFailure handles a wrong guess made as the given attempt. The last allowed attempt
+// burns the OTP and locks the phone for an exponentially growing period.
+func (s *OtpService) recordFailure(ctx context.Context, phone string, attempt int) error {
+	if attempt < s.guard.maxAttempts {
+		return nil
+	}
+
+	_ = s.cache.Delete(ctx, "otp:"+phone)
+	_ = s.cache.Delete(ctx, "otp_fail:"+phone)
+
+	if err := s.lockOut(ctx, phone); err != nil {
+		return err
+	}
+	return ErrTooManyAttempts
+}
+
+// userLock is the lockout subject of a user's phone changes. User ids never start with "+",
+// so it cannot collide with a phone.
+func userLock(userID string) string {
+	return "user:" + userID
+}
+
+// lockOut locks subject for an exponentially growing period: each lockout within
+// lockoutMemory doubles the next one.
+func (s *OtpService) lockOut(ctx context.Context, subject string) error {
+	lockouts, err := s.cache.IncrWithExpire(ctx, "otp_lockouts:"+subject, int(s.guard.lockoutMemory.Seconds()))
+	if err != nil {
+		return err
+	}
+	d := s.lockoutDuration(lockouts)
+	until := time.Now().Add(d)
+	return s.cache.SetWithTTL(ctx, "otp_lock:"+subject, strconv.FormatInt(until.Unix(), 10), int(d.Seconds()))
+}
+
+func (s *OtpService) lockoutDuration(lockouts int) time.Duration {
+	d := s.guard.lockoutBase
+	for i := 1; i < lockouts && d < s.guard.lockoutMax; i++ {
+		d *= 2
+	}
+	if d > s.guard.lockoutMax {
+		d = s.guard.lockoutMax
+	}
+	return d
+}
@@ -0,0 +1,174 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"user-go/internal/cache"
+	"user-go/internal/repository"
+	"user-go/internal/sender"
+	"user-go/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newGuardedService(opts ...service.Option) *service.OtpService {
+	opts = append([]service.Option{service.WithSender(sender.NewConsoleSender(io.Discard))}, opts...)
+	return service.NewOtpService(cache.NewInMemoryCache(), repository.NewInMemoryUserRepository(), "testsecret", opts...)
+}
+
+func TestValidateOTP_BurnsCodeAfterMaxAttempts(t *testing.T) {
+	svc := newGuardedService(service.WithMaxValidateAttempts(3))
+	phone := "+989121111111"
+
+	otp, err := svc.RequestOTP(context.Background(), phone)
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, err = svc.ValidateOTP(context.Background(), phone, "000000")
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, service.ErrTooManyAttempts)
+	}
+
+	_, err = svc.ValidateOTP(context.Background(), phone, "000000")
+	assert.ErrorIs(t, err, service.ErrTooManyAttempts)
+
+	// حتی کد درست هم دیگر پذیرفته نمی‌شود
+	_, err = svc.ValidateOTP(context.Background(), phone, otp)
+	assert.ErrorIs(t, err, service.ErrAccountLocked)
+}
+
+// codeReads counts reads of pending OTPs: every comparison needs one, so it bounds how many
+// guesses were compared.
+type codeReads struct {
+	slowCache
+	n *atomic.Int32
+}
+
+func (c codeReads) Get(ctx context.Context, key string) (string, error) {
+	if strings.HasPrefix(key, "otp:") {
+		c.n.Add(1)
+	}
+	return c.slowCache.Get(ctx, key)
+}
+
+func TestValidateOTP_ConcurrentGuessesStayWithinMaxAttempts(t *testing.T) {
+	reads := codeReads{slowCache{cache.NewInMemoryCache()}, new(atomic.Int32)}
+	svc := service.NewOtpService(reads, repository.NewInMemoryUserRepository(), "testsecret",
+		service.WithSender(sender.NewConsoleSender(io.Discard)), service.WithMaxValidateAttempts(3))
+	phone := "+989124444444"
+
+	_, err := svc.RequestOTP(context.Background(), phone)
+	require.NoError(t, err)
+
+	// حدس‌های هم‌زمان نباید پیش از شمارش شدن با کد مقایسه شوند
+	var wg sync.WaitGroup
+	for range 30 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := svc.ValidateOTP(context.Background(), phone, "000000")
+			assert.Error(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, int(reads.n.Load()), 3)
+}
+
+func TestValidateOTP_LockoutSurvivesCacheFlood(t *testing.T) {
+	c := cache.NewInMemoryCache(cache.WithMaxEntries(8), cache.WithCleanupInterval(0), cache.WithPinnedPrefixes(service.SecurityKeyPrefixes...))
+	svc := service.NewOtpService(c, repository.NewInMemoryUserRepository(), "testsecret",
+		service.WithSender(sender.NewConsoleSender(io.Discard)), service.WithMaxValidateAttempts(1))
+	phone := "+989123333333"
+
+	_, err := svc.RequestOTP(context.Background(), phone)
+	require.NoError(t, err)
+	_, err = svc.ValidateOTP(context.Background(), phone, "000000")
+	require.ErrorIs(t, err, service.ErrTooManyAttempts)
+
+	// سیل شماره‌های تصادفی نباید قفل را از cache بیرون کند
+	for i := range 50 {
+		_, err := svc.RequestOTP(context.Background(), fmt.Sprintf("+98912%07d", i))
+		require.NoError(t, err)
+	}
+	_, err = svc.ValidateOTP(context.Background(), phone, "000000")
+	assert.ErrorIs(t, err, service.ErrAccountLocked)
+}
+
+func TestValidateOTP_LockoutGrowsExponentially(t *testing.T) {
+	svc := newGuardedService(service.WithMaxValidateAttempts(1), service.WithLockout(time.Second, 10*time.Second))
+	phone := "+989122222222"
+
+	burn := func() *service.LockedError {
+		_, err := svc.RequestOTP(context.Background(), phone)
+		require.NoError(t, err)
+		_, err = svc.ValidateOTP(context.Background(), phone, "000000")
+		require.ErrorIs(t, err, service.ErrTooManyAttempts)
+
+		_, err = svc.ValidateOTP(context.Background(), phone, "000000")
+		var locked *service.LockedError
+		require.ErrorAs(t, err, &locked)
+		return locked
+	}
+
+	first := burn()
+	assert.LessOrEqual(t, first.RetryAfter(), 2*time.Second)
+
+	time.Sleep(first.RetryAfter())
+
+	// قفل دوم باید دو برابر قفل اول باشد
+	second := burn()
+	assert.Greater(t, second.RetryAfter(), first.RetryAfter())
+	assert.LessOrEqual(t, second.RetryAfter(), 3*time.Second)
+}
+
+func TestValidateOTP_SuccessResetsFailures(t *testing.T) {
+	svc := newGuardedService(service.WithMaxValidateAttempts(2))
+	phone := "+989123333333"
+
+	otp, err := svc.RequestOTP(context.Background(), phone)
+	require.NoError(t, err)
+
+	_, err = svc.ValidateOTP(context.Background(), phone, "000000")
+	require.Error(t, err)
+	_, err = svc.ValidateOTP(context.Background(), phone, otp)
+	require.NoError(t, err)
+
+	otp, err = svc.RequestOTP(context.Background(), phone)
+	require.NoError(t, err)
+	_, err = svc.ValidateOTP(context.Background(), phone, "000000")
+	assert.NotErrorIs(t, err, service.ErrTooManyAttempts)
+	_, err = svc.ValidateOTP(context.Background(), phone, otp)
+	assert.NoError(t, err)
+}
+
+func TestRequestOTP_RefusedWhileLocked(t *testing.T) {
+	svc := newGuardedService(service.WithMaxValidateAttempts(1))
+	phone := "+989124444444"
+
+	_, err := svc.RequestOTP(context.Background(), phone)
+	require.NoError(t, err)
+	_, err = svc.ValidateOTP(context.Background(), phone, "000000")
+	require.ErrorIs(t, err, service.ErrTooManyAttempts)
+
+	_, err = svc.RequestOTP(context.Background(), phone)
+	assert.ErrorIs(t, err, service.ErrAccountLocked)
+}
+
+func TestAllowValidateFrom_LimitsPerIP(t *testing.T) {
+	svc := newGuardedService(service.WithValidateIPLimit(2, time.Minute))
+
+	assert.NoError(t, svc.AllowValidateFrom(context.Background(), "10.0.0.1"))
+	assert.NoError(t, svc.AllowValidateFrom(context.Background(), "10.0.0.1"))
+	assert.ErrorIs(t, svc.AllowValidateFrom(context.Background(), "10.0.0.1"), service.ErrValidateRateLimited)
+
+	// IP دیگر محدود نشده
+	assert.NoError(t, svc.AllowValidateFrom(context.Background(), "10.0.0.2"))
+}
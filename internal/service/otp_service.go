@@ -1,84 +1,258 @@
 package service
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/subtle"
 	"errors"
 	"fmt"
-	"github.com/golang-jwt/jwt/v5"
 	"math/big"
+	"os"
 	"time"
+	"user-go/internal/apperr"
+	"user-go/internal/audit"
 	"user-go/internal/cache"
+	"user-go/internal/logging"
+	"user-go/internal/metrics"
 	"user-go/internal/repository"
+	"user-go/internal/sender"
+	"user-go/internal/tracing"
 )
 
 var (
-	ErrRateLimited  = errors.New("too many OTP requests, please wait")
-	ErrInvalidToken = errors.New("invalid token")
+	ErrRateLimited = apperr.New(apperr.RateLimited, "otp_rate_limited", "too many OTP requests, please wait")
+	ErrOTPDelivery = apperr.New(apperr.Upstream, "otp_delivery_failed", "failed to deliver OTP")
+	ErrInvalidOTP  = apperr.New(apperr.Unauthorized, "invalid_otp", "invalid OTP")
+	ErrOTPExpired  = apperr.New(apperr.Unauthorized, "otp_expired", "OTP not found or expired")
+	// ErrAccountDeleted blocks logging in, and so re-registering, until the account is restored or
+	// purged. It is the repository's ErrUserDeleted, so the state has a single code.
+	ErrAccountDeleted = repository.ErrUserDeleted
 )
 
 type OtpService struct {
-	cache     cache.Cache
-	users     repository.UserRepository
-	jwtSecret []byte
+	cache   cache.Cache
+	users   repository.UserRepository
+	tokens  *TokenService
+	sender  sender.Sender
+	channel sender.Channel
+	guard   bruteForcePolicy
+	blocks  *BlockService
+	metrics *metrics.Metrics
+	audit   *audit.Recorder
+
+	otpTTL        time.Duration
+	requestWindow time.Duration
+	maxRequests   int
 }
 
-func NewOtpService(c cache.Cache, u repository.UserRepository, secret string) *OtpService {
-	return &OtpService{
-		cache:     c,
-		users:     u,
-		jwtSecret: []byte(secret),
+// Option configures optional OtpService dependencies.
+type Option func(*OtpService)
+
+// WithSender sets the transport used to deliver codes. Defaults to a console sender on stdout.
+func WithSender(snd sender.Sender) Option {
+	return func(s *OtpService) { s.sender = snd }
+}
+
+// WithChannel sets the delivery channel requested from the sender. Defaults to SMS.
+func WithChannel(ch sender.Channel) Option {
+	return func(s *OtpService) { s.channel = ch }
+}
+
+// WithOTPTTL sets how long a generated code stays valid. Defaults to 2 minutes.
+func WithOTPTTL(d time.Duration) Option {
+	return func(s *OtpService) { s.otpTTL = d }
+}
+
+// WithRequestLimit allows at most max OTP requests per phone within window. Defaults to 3 per 10 minutes.
+func WithRequestLimit(max int, window time.Duration) Option {
+	return func(s *OtpService) {
+		s.maxRequests = max
+		s.requestWindow = window
 	}
 }
 
-// ValidateOTP reads OTP from cache, compares, creates user if needed and returns signed JWT.
-// Added diagnostic logs to help debug integration tests.
-func (s *OtpService) ValidateOTP(phone, otp string) (string, error) {
-	otpKey := "otp:" + phone
-	stored, err := s.cache.Get(otpKey)
+// WithTokenService sets the issuer of access/refresh tokens. Defaults to one built on
+// the same cache and secret with default lifetimes.
+func WithTokenService(t *TokenService) Option {
+	return func(s *OtpService) { s.tokens = t }
+}
+
+// WithBlockService refuses to send or validate codes for blocked accounts and banned prefixes.
+func WithBlockService(b *BlockService) Option {
+	return func(s *OtpService) { s.blocks = b }
+}
+
+// WithMetrics counts OTP requests, deliveries, validations and rate-limit rejections.
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(s *OtpService) { s.metrics = m }
+}
+
+// WithAudit records OTP requests and validations, sign-ups, logins and phone changes.
+func WithAudit(r *audit.Recorder) Option {
+	return func(s *OtpService) { s.audit = r }
+}
+
+func NewOtpService(c cache.Cache, u repository.UserRepository, secret string, opts ...Option) *OtpService {
+	s := &OtpService{
+		cache:   c,
+		users:   u,
+		sender:  sender.NewConsoleSender(os.Stdout),
+		channel: sender.ChannelSMS,
+		guard:   defaultBruteForcePolicy,
+
+		otpTTL:        120 * time.Second,
+		requestWindow: 600 * time.Second,
+		maxRequests:   3,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.tokens == nil {
+		s.tokens = NewTokenService(c, secret)
+	}
+	return s
+}
+
+// Tokens exposes the token service used for login so handlers can refresh and revoke.
+func (s *OtpService) Tokens() *TokenService {
+	return s.tokens
+}
+
+// ValidateOTP reads OTP from cache, compares, creates user if needed and returns a token pair.
+// Wrong guesses are counted per phone; see recordFailure for the lockout rules.
+func (s *OtpService) ValidateOTP(ctx context.Context, phone, otp string) (*TokenPair, error) {
+	ctx, span := tracing.Start(ctx, "OtpService.ValidateOTP")
+	pair, user, err := s.validateOTP(ctx, phone, otp)
+	s.recordValidation(err)
+
+	event := repository.AuditEvent{Action: repository.AuditOTPValidated, PhoneHash: logging.PhoneHash(phone), Outcome: repository.AuditSuccess}
+	if err != nil {
+		event.Outcome, event.Reason = repository.AuditFailure, validationReason(err)
+	} else {
+		event.TargetID = user.ID
+	}
+	s.audit.Record(ctx, event)
+	if err == nil {
+		s.audit.Record(ctx, repository.AuditEvent{
+			Action: repository.AuditLogin, ActorID: user.ID, TargetID: user.ID,
+			PhoneHash: event.PhoneHash, Outcome: repository.AuditSuccess,
+		})
+	}
+
+	tracing.End(span, err)
+	return pair, err
+}
+
+// recordValidation counts the outcome of an OTP check.
+func (s *OtpService) recordValidation(err error) {
+	if err == nil {
+		s.metrics.OTPValidated()
+		return
+	}
+	s.metrics.OTPValidationFailed(validationReason(err))
+}
+
+// validationReason labels why an OTP check failed, for metrics and the audit log.
+func validationReason(err error) string {
+	reason := "error"
+	switch {
+	case errors.Is(err, ErrInvalidOTP):
+		reason = "invalid"
+	case errors.Is(err, ErrOTPExpired), errors.Is(err, ErrNoPendingPhoneChange):
+		reason = "expired"
+	case errors.Is(err, ErrTooManyAttempts):
+		reason = "too_many_attempts"
+	case errors.Is(err, ErrAccountLocked):
+		reason = "locked"
+	case errors.Is(err, ErrAccountBlocked):
+		reason = "blocked"
+	case errors.Is(err, ErrAccountDeleted):
+		reason = "deleted"
+	}
+	return reason
+}
+
+// validateOTP returns the logged-in user along with the tokens.
+func (s *OtpService) validateOTP(ctx context.Context, phone, otp string) (*TokenPair, *repository.User, error) {
+	if err := s.checkLocked(ctx, phone); err != nil {
+		return nil, nil, err
+	}
+	if err := s.checkBlocked(ctx, phone); err != nil {
+		return nil, nil, err
+	}
+
+	// ثبت تلاش و نتیجه‌ی آن نباید با قطع اتصال کلاینت لغو شود؛
+	// وگرنه حدس اشتباه بدون شمارش می‌ماند یا OTP مصرف‌شده باقی می‌ماند
+	bookkeeping := context.WithoutCancel(ctx)
+
+	// تلاش پیش از خواندن کد رزرو می‌شود تا حدس‌های هم‌زمان از سقف عبور نکنند
+	attempt, err := s.reserveAttempt(bookkeeping, phone)
 	if err != nil {
-		// واضح و قابل تشخیص در لاگ‌ها
-		fmt.Printf("[OtpService] cache.Get error for key=%s: %v\n", otpKey, err)
-		return "", errors.New("OTP not found or expired")
+		return nil, nil, err
 	}
 
-	// لاگ مقدار ذخیره‌شده و مقدار دریافتی برای دیباگ
-	fmt.Printf("[OtpService] stored OTP=%q for phone=%s, provided OTP=%q\n", stored, phone, otp)
+	log := logging.FromContext(ctx)
+	otpKey := "otp:" + phone
+	stored, err := s.cache.Get(ctx, otpKey)
+	if err != nil {
+		log.DebugContext(ctx, "otp not found", "phone", phone, "error", err)
+		return nil, nil, ErrOTPExpired
+	}
 
-	if stored != otp {
-		fmt.Printf("[OtpService] invalid otp: stored=%q provided=%q\n", stored, otp)
-		return "", errors.New("invalid OTP")
+	if subtle.ConstantTimeCompare([]byte(stored), []byte(otp)) != 1 {
+		log.InfoContext(ctx, "invalid otp", "phone", phone)
+		if err := s.recordFailure(bookkeeping, phone, attempt); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrInvalidOTP
 	}
 
 	// حذف OTP بعد از استفاده (لاگ در صورت خطا)
-	if err := s.cache.Delete(otpKey); err != nil {
-		fmt.Printf("[OtpService] warning: failed to delete otp key %s: %v\n", otpKey, err)
+	if err := s.cache.Delete(bookkeeping, otpKey); err != nil {
+		log.WarnContext(ctx, "failed to delete used otp", "phone", phone, "error", err)
 	}
+	_ = s.cache.Delete(bookkeeping, "otp_fail:"+phone)
 
 	// ثبت‌نام یا فراخوانی یوزر
-	user, err := s.users.GetByPhone(phone)
-	if err == repository.ErrUserNotFound {
-		user, err = s.users.Create(phone)
+	user, err := s.users.GetByPhone(ctx, phone)
+	if errors.Is(err, repository.ErrUserDeleted) {
+		return nil, nil, ErrAccountDeleted
+	} else if errors.Is(err, repository.ErrUserNotFound) {
+		user, err = s.users.Create(ctx, phone)
+		if errors.Is(err, repository.ErrUserExists) {
+			// اولین ورود همزمان از دو درخواست؛ کاربری که دیگری ساخت را برمی‌داریم
+			user, err = s.users.GetByPhone(ctx, phone)
+		} else if err == nil {
+			s.audit.Record(ctx, repository.AuditEvent{
+				Action: repository.AuditUserCreated, ActorID: user.ID, TargetID: user.ID,
+				PhoneHash: logging.PhoneHash(phone), Outcome: repository.AuditSuccess,
+			})
+		}
 		if err != nil {
-			fmt.Printf("[OtpService] users.Create error for phone=%s: %v\n", phone, err)
-			return "", err
+			log.ErrorContext(ctx, "failed to create user", "phone", phone, "error", err)
+			return nil, nil, err
 		}
 	} else if err != nil {
-		fmt.Printf("[OtpService] users.GetByPhone error for phone=%s: %v\n", phone, err)
-		return "", err
+		log.ErrorContext(ctx, "failed to load user", "phone", phone, "error", err)
+		return nil, nil, err
 	}
 
-	// ساخت JWT
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"phone": user.Phone,
-		"exp":   time.Now().Add(time.Hour * 24).Unix(),
-	})
-	signed, err := token.SignedString(s.jwtSecret)
+	// ساخت access token و refresh token
+	pair, err := s.tokens.Issue(ctx, user)
 	if err != nil {
-		fmt.Printf("[OtpService] token.SignedString error: %v\n", err)
-		return "", err
+		log.ErrorContext(ctx, "failed to issue tokens", "user_id", user.ID, "error", err)
+		return nil, nil, err
 	}
-	fmt.Printf("[OtpService] token generated for phone=%s\n", phone)
-	return signed, nil
+	log.InfoContext(ctx, "user logged in", "user_id", user.ID, "phone", phone)
+	return pair, user, nil
+}
+
+// checkBlocked returns a *BlockedError if phone may not log in.
+func (s *OtpService) checkBlocked(ctx context.Context, phone string) error {
+	if s.blocks == nil {
+		return nil
+	}
+	return s.blocks.CheckPhone(ctx, phone)
 }
 
 func generateOTP() (string, error) {
@@ -90,32 +264,108 @@ func generateOTP() (string, error) {
 	return fmt.Sprintf("%06d", n.Int64()), nil
 }
 
-// RequestOTP generates OTP, rate-limits and stores it in cache
-func (s *OtpService) RequestOTP(phone string) (string, error) {
+// RequestOTP generates OTP, rate-limits, stores it in cache and hands it to the sender.
+// The code is returned so callers running in dev mode can echo it; it must not reach clients otherwise.
+func (s *OtpService) RequestOTP(ctx context.Context, phone string) (string, error) {
+	ctx, span := tracing.Start(ctx, "OtpService.RequestOTP")
+	otp, err := s.requestOTP(ctx, phone)
+	event := requestEvent(phone, err)
+	if s.auditable(ctx, phone, event) {
+		s.audit.Record(ctx, event)
+	}
+	tracing.End(span, err)
+	return otp, err
+}
+
+// auditable reports whether event should be written to the audit log. Requests refused
+// by the rate limit, a lockout or a block are recorded once per phone, reason and request
+// window; the rest are counted by metrics only, so a flood does not become a flood of INSERTs.
+func (s *OtpService) auditable(ctx context.Context, phone string, event repository.AuditEvent) bool {
+	if s.audit == nil {
+		return false
+	}
+	switch event.Reason {
+	case "rate_limited", "locked", "blocked":
+	default:
+		return true
+	}
+	n, err := s.cache.IncrWithExpire(ctx, "otp_rejected:"+event.Reason+":"+phone, int(s.requestWindow.Seconds()))
+	return err != nil || n == 1
+}
+
+// requestEvent is the audit record of sending a code to phone.
+func requestEvent(phone string, err error) repository.AuditEvent {
+	event := repository.AuditEvent{Action: repository.AuditOTPRequested, PhoneHash: logging.PhoneHash(phone), Outcome: repository.AuditSuccess}
+	if err == nil {
+		return event
+	}
+	event.Outcome, event.Reason = repository.AuditFailure, "error"
+	switch {
+	case errors.Is(err, ErrRateLimited):
+		event.Reason = "rate_limited"
+	case errors.Is(err, ErrAccountLocked):
+		event.Reason = "locked"
+	case errors.Is(err, ErrAccountBlocked):
+		event.Reason = "blocked"
+	case errors.Is(err, ErrOTPDelivery):
+		event.Reason = "delivery_failed"
+	case errors.Is(err, repository.ErrPhoneTaken), errors.Is(err, ErrSamePhone):
+		event.Reason = "phone_unavailable"
+	case errors.Is(err, ErrAccountDeleted):
+		event.Reason = "deleted"
+	}
+	return event
+}
+
+func (s *OtpService) requestOTP(ctx context.Context, phone string) (string, error) {
+	s.metrics.OTPRequested()
+	if err := s.checkLocked(ctx, phone); err != nil {
+		s.metrics.RateLimited("otp_lockout")
+		return "", err
+	}
+	if err := s.checkBlocked(ctx, phone); err != nil {
+		return "", err
+	}
+
 	reqKey := "otp_req:" + phone
-	count, err := s.cache.IncrWithExpire(reqKey, 600)
+	count, err := s.cache.IncrWithExpire(ctx, reqKey, int(s.requestWindow.Seconds()))
 	if err != nil {
-		fmt.Printf("[OtpService] IncrWithExpire error for key=%s: %v\n", reqKey, err)
+		logging.FromContext(ctx).ErrorContext(ctx, "failed to count otp request", "phone", phone, "error", err)
 		return "", err
 	}
 
-	if count > 3 {
+	if count > s.maxRequests {
+		s.metrics.RateLimited("otp_request")
 		return "", ErrRateLimited
 	}
 
+	// حساب حذف‌شده تا بازگردانی وارد نمی‌شود؛ ارسال کد برایش فقط هزینه‌ی پیامک است
+	if _, err := s.users.GetByPhone(ctx, phone); errors.Is(err, repository.ErrUserDeleted) {
+		return "", ErrAccountDeleted
+	} else if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+		return "", err
+	}
+
 	otp, err := generateOTP()
 	if err != nil {
 		return "", err
 	}
 
 	otpKey := "otp:" + phone
-	if err := s.cache.SetWithTTL(otpKey, otp, 120); err != nil {
-		fmt.Printf("[OtpService] SetWithTTL error for key=%s: %v\n", otpKey, err)
+	if err := s.cache.SetWithTTL(ctx, otpKey, otp, int(s.otpTTL.Seconds())); err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "failed to store otp", "phone", phone, "error", err)
 		return "", err
 	}
 
-	// Show OTP in stdout for tests/debug (no SMS)
-	fmt.Printf("Generated OTP for %s: %s (expires in 2 min)\n", phone, otp)
+	msg := sender.Message{Channel: s.channel, To: phone, Code: otp, TTL: s.otpTTL}
+	if err := s.sender.Send(ctx, msg); err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "failed to deliver otp", "phone", phone, "channel", s.channel, "error", err)
+		s.metrics.OTPDeliveryFailed(string(s.channel))
+		// کد ارسال نشده، پس نباید قابل استفاده بماند
+		_ = s.cache.Delete(context.WithoutCancel(ctx), otpKey)
+		return "", fmt.Errorf("%w: %v", ErrOTPDelivery, err)
+	}
+	s.metrics.OTPSent(string(s.channel))
 
 	return otp, nil
 }
@@ -1,45 +1,84 @@
 package service_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"regexp"
+	"strings"
 	"testing"
+	"time"
+	"user-go/internal/audit"
 	"user-go/internal/cache"
+	"user-go/internal/logging"
+	"user-go/internal/metrics"
 	"user-go/internal/repository"
+	"user-go/internal/sender"
 	"user-go/internal/service"
+	"user-go/internal/tracing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// MockCache implements cache.Cache for testing with testify mock
+// fakeSender records delivered messages and optionally fails.
+type fakeSender struct {
+	sent []sender.Message
+	err  error
+}
+
+func (f *fakeSender) Send(_ context.Context, msg sender.Message) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+// MockCache implements cache.Cache for testing with testify mock.
+// The context is not recorded, so expectations only name the cache arguments.
 type MockCache struct {
 	mock.Mock
 }
 
-func (m *MockCache) IncrWithExpire(key string, expireSeconds int) (int, error) {
+func (m *MockCache) IncrWithExpire(_ context.Context, key string, expireSeconds int) (int, error) {
 	args := m.Called(key, expireSeconds)
 	return args.Int(0), args.Error(1)
 }
 
-func (m *MockCache) SetWithTTL(key string, value string, ttlSeconds int) error {
+func (m *MockCache) SetWithTTL(_ context.Context, key string, value string, ttlSeconds int) error {
 	args := m.Called(key, value, ttlSeconds)
 	return args.Error(0)
 }
 
-func (m *MockCache) Get(key string) (string, error) {
+func (m *MockCache) Get(_ context.Context, key string) (string, error) {
 	args := m.Called(key)
 	return args.String(0), args.Error(1)
 }
 
-func (m *MockCache) Delete(key string) error {
+func (m *MockCache) Delete(_ context.Context, key string) error {
 	args := m.Called(key)
 	return args.Error(0)
 }
 
+func (m *MockCache) CompareAndSwap(_ context.Context, key, old, value string, ttlSeconds int) (bool, error) {
+	args := m.Called(key, old, value, ttlSeconds)
+	return args.Bool(0), args.Error(1)
+}
+
 func TestRequestOTP_SucceedsWhenUnderLimit(t *testing.T) {
 	mc := new(MockCache)
 	phone := "+56912345678"
 
+	mc.On("Get", "otp_lock:"+phone).Return("", cache.ErrNotFound)
 	mc.On("IncrWithExpire", "otp_req:"+phone, 600).Return(1, nil)
 	mc.On("SetWithTTL", mock.MatchedBy(func(key string) bool { return key == "otp:"+phone }),
 		mock.MatchedBy(func(val string) bool {
@@ -47,23 +86,49 @@ func TestRequestOTP_SucceedsWhenUnderLimit(t *testing.T) {
 			return matched
 		}), 120).Return(nil)
 
-	svc := service.NewOtpService(mc, nil, "testsecret")
+	svc := service.NewOtpService(mc, repository.NewInMemoryUserRepository(), "testsecret")
 
-	otp, err := svc.RequestOTP(phone)
+	otp, err := svc.RequestOTP(context.Background(), phone)
 	assert.NoError(t, err)
 	assert.Regexp(t, `^\d{6}$`, otp)
 
 	mc.AssertExpectations(t)
 }
 
+func TestRequestOTP_DeliversThroughSender(t *testing.T) {
+	fs := &fakeSender{}
+	svc := service.NewOtpService(cache.NewInMemoryCache(), repository.NewInMemoryUserRepository(), "testsecret", service.WithSender(fs))
+
+	otp, err := svc.RequestOTP(context.Background(), "+56912345678")
+	require.NoError(t, err)
+
+	require.Len(t, fs.sent, 1)
+	assert.Equal(t, sender.ChannelSMS, fs.sent[0].Channel)
+	assert.Equal(t, "+56912345678", fs.sent[0].To)
+	assert.Equal(t, otp, fs.sent[0].Code)
+}
+
+func TestRequestOTP_DeliveryFailureDiscardsCode(t *testing.T) {
+	c := cache.NewInMemoryCache()
+	fs := &fakeSender{err: errors.New("gateway down")}
+	svc := service.NewOtpService(c, repository.NewInMemoryUserRepository(), "testsecret", service.WithSender(fs))
+
+	_, err := svc.RequestOTP(context.Background(), "+56912345678")
+	assert.ErrorIs(t, err, service.ErrOTPDelivery)
+
+	_, err = c.Get(context.Background(), "otp:+56912345678")
+	assert.Error(t, err)
+}
+
 func TestRequestOTP_RateLimited(t *testing.T) {
 	mc := new(MockCache)
 	phone := "+56912345678"
 
+	mc.On("Get", "otp_lock:"+phone).Return("", cache.ErrNotFound)
 	mc.On("IncrWithExpire", "otp_req:"+phone, 600).Return(4, nil)
 
-	svc := service.NewOtpService(mc, nil, "mysecretjwtkey")
-	_, err := svc.RequestOTP(phone)
+	svc := service.NewOtpService(mc, repository.NewInMemoryUserRepository(), "mysecretjwtkey")
+	_, err := svc.RequestOTP(context.Background(), phone)
 	assert.Error(t, err)
 	assert.Equal(t, service.ErrRateLimited, err)
 
@@ -73,19 +138,24 @@ func TestRequestOTP_RateLimited(t *testing.T) {
 func TestValidateOTP_NewUser(t *testing.T) {
 	mc := new(MockCache)
 	users := repository.NewInMemoryUserRepository()
-	phone := "09120000000"
+	phone := "+989120000000"
 	otpKey := "otp:" + phone
 
+	mc.On("Get", "otp_lock:"+phone).Return("", cache.ErrNotFound)
 	mc.On("Get", otpKey).Return("123456", nil)
+	mc.On("IncrWithExpire", "otp_fail:"+phone, 120).Return(1, nil)
 	mc.On("Delete", otpKey).Return(nil)
+	mc.On("Delete", "otp_fail:"+phone).Return(nil)
+	mc.On("Get", mock.MatchedBy(func(key string) bool { return strings.HasPrefix(key, "token_gen:") })).Return("", cache.ErrNotFound)
+	mc.On("SetWithTTL", mock.MatchedBy(func(key string) bool { return strings.HasPrefix(key, "refresh") }), mock.Anything, mock.Anything).Return(nil)
 
 	service := service.NewOtpService(mc, users, "mysecretjwtkey")
 
-	token, err := service.ValidateOTP(phone, "123456")
+	token, err := service.ValidateOTP(context.Background(), phone, "123456")
 	require.NoError(t, err)
 	require.NotEmpty(t, token)
 
-	user, err := users.GetByPhone(phone)
+	user, err := users.GetByPhone(context.Background(), phone)
 	require.NoError(t, err)
 	assert.Equal(t, phone, user.Phone)
 
@@ -98,8 +168,237 @@ func TestValidateOTP_Invalid(t *testing.T) {
 
 	service := service.NewOtpService(cache, users, "mysecretjwtkey")
 
-	phone := "09120000000"
-	_, _ = service.RequestOTP(phone)
-	_, err := service.ValidateOTP(phone, "wrongotp")
+	phone := "+989120000000"
+	_, _ = service.RequestOTP(context.Background(), phone)
+	_, err := service.ValidateOTP(context.Background(), phone, "wrongotp")
 	assert.Error(t, err)
 }
+
+func TestRequestOTP_CanceledContext(t *testing.T) {
+	c := cache.NewInMemoryCache()
+	defer c.Close()
+	snd := &fakeSender{}
+	svc := service.NewOtpService(c, repository.NewInMemoryUserRepository(), "testsecret", service.WithSender(snd))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := svc.RequestOTP(ctx, "+56912345678")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, snd.sent, "nothing must be sent for an abandoned request")
+}
+
+func TestRequestOTP_DeletedAccountCannotReRegister(t *testing.T) {
+	users := repository.NewInMemoryUserRepository()
+	snd := &fakeSender{}
+	svc := service.NewOtpService(cache.NewInMemoryCache(), users, "testsecret", service.WithSender(snd))
+	ctx := context.Background()
+	phone := "+989121111111"
+
+	user, err := users.Create(ctx, phone)
+	require.NoError(t, err)
+	require.NoError(t, users.Delete(ctx, user.ID))
+
+	// هیچ کدی برای حساب حذف‌شده ساخته یا فرستاده نمی‌شود
+	_, err = svc.RequestOTP(ctx, phone)
+	assert.ErrorIs(t, err, service.ErrAccountDeleted)
+	assert.Empty(t, snd.sent)
+	_, err = svc.ValidateOTP(ctx, phone, "000000")
+	assert.ErrorIs(t, err, service.ErrOTPExpired)
+
+	// بعد از بازگردانی، ورود دوباره کار می‌کند
+	_, err = users.Restore(ctx, user.ID)
+	require.NoError(t, err)
+	otp, err := svc.RequestOTP(ctx, phone)
+	require.NoError(t, err)
+	pair, err := svc.ValidateOTP(ctx, phone, otp)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, parseClaims(t, pair.AccessToken)["sub"])
+}
+
+func TestOtpService_LogsWithoutSecrets(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, logging.Options{Level: "debug"})
+	require.NoError(t, err)
+	ctx := logging.WithLogger(context.Background(), logger)
+
+	svc := service.NewOtpService(cache.NewInMemoryCache(), repository.NewInMemoryUserRepository(), "testsecret",
+		service.WithSender(&fakeSender{}))
+	phone := "+989120000000"
+
+	code, err := svc.RequestOTP(ctx, phone)
+	require.NoError(t, err)
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	_, err = svc.ValidateOTP(ctx, phone, wrong)
+	require.ErrorIs(t, err, service.ErrInvalidOTP)
+	pair, err := svc.ValidateOTP(ctx, phone, code)
+	require.NoError(t, err)
+
+	out := buf.String()
+	assert.Contains(t, out, `"msg":"invalid otp"`)
+	assert.Contains(t, out, `"msg":"user logged in"`)
+	assert.Contains(t, out, logging.PhoneHash(phone))
+	// کدها به‌صورت رشته‌ی JSON جستجو می‌شوند تا با ارقام timestamp اشتباه نشوند
+	for _, secret := range []string{`"` + code + `"`, `"` + wrong + `"`, phone, pair.AccessToken, pair.RefreshToken} {
+		assert.NotContains(t, out, secret)
+	}
+}
+
+func TestOtpService_Metrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := metrics.New(reg)
+	snd := &fakeSender{}
+	svc := service.NewOtpService(cache.NewInMemoryCache(), repository.NewInMemoryUserRepository(), "testsecret",
+		service.WithSender(snd),
+		service.WithMetrics(m),
+		service.WithRequestLimit(1, time.Minute),
+		service.WithTokenService(service.NewTokenService(cache.NewInMemoryCache(), "testsecret", service.WithTokenMetrics(m))),
+	)
+	ctx := context.Background()
+	phone := "+989120000000"
+
+	code, err := svc.RequestOTP(ctx, phone)
+	require.NoError(t, err)
+	_, err = svc.RequestOTP(ctx, phone)
+	require.ErrorIs(t, err, service.ErrRateLimited)
+	_, err = svc.ValidateOTP(ctx, "+989120000001", "123456")
+	require.ErrorIs(t, err, service.ErrOTPExpired)
+	_, err = svc.ValidateOTP(ctx, phone, code)
+	require.NoError(t, err)
+
+	expected := `
+# HELP user_go_otp_requested_total OTP codes requested, for login or a phone change.
+# TYPE user_go_otp_requested_total counter
+user_go_otp_requested_total 2
+# HELP user_go_otp_sent_total OTP codes handed to the sender successfully.
+# TYPE user_go_otp_sent_total counter
+user_go_otp_sent_total{channel="sms"} 1
+# HELP user_go_otp_validated_total OTP codes validated successfully.
+# TYPE user_go_otp_validated_total counter
+user_go_otp_validated_total 1
+# HELP user_go_otp_validation_failures_total OTP validations that failed, by reason.
+# TYPE user_go_otp_validation_failures_total counter
+user_go_otp_validation_failures_total{reason="expired"} 1
+# HELP user_go_rate_limit_rejections_total Requests rejected by a rate limit or lockout, by limit.
+# TYPE user_go_rate_limit_rejections_total counter
+user_go_rate_limit_rejections_total{limit="otp_request"} 1
+# HELP user_go_tokens_issued_total Token pairs issued, by kind (login or refresh).
+# TYPE user_go_tokens_issued_total counter
+user_go_tokens_issued_total{kind="login"} 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"user_go_otp_requested_total", "user_go_otp_sent_total", "user_go_otp_validated_total",
+		"user_go_otp_validation_failures_total", "user_go_rate_limit_rejections_total", "user_go_tokens_issued_total"))
+}
+
+func TestOtpService_Tracing(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	svc := service.NewOtpService(tracing.NewCache(cache.NewInMemoryCache()), repository.NewInMemoryUserRepository(), "testsecret",
+		service.WithSender(&fakeSender{}))
+	ctx := context.Background()
+	phone := "+989120000000"
+
+	_, err := svc.RequestOTP(ctx, phone)
+	require.NoError(t, err)
+	_, err = svc.ValidateOTP(ctx, phone, "not-a-code")
+	require.ErrorIs(t, err, service.ErrInvalidOTP)
+
+	byID := map[trace.SpanID]sdktrace.ReadOnlySpan{}
+	var roots []sdktrace.ReadOnlySpan
+	for _, span := range rec.Ended() {
+		byID[span.SpanContext().SpanID()] = span
+		if !span.Parent().IsValid() {
+			roots = append(roots, span)
+		}
+	}
+	require.Len(t, roots, 2)
+	assert.Equal(t, "OtpService.RequestOTP", roots[0].Name())
+	assert.Equal(t, "OtpService.ValidateOTP", roots[1].Name())
+	assert.Equal(t, codes.Error, roots[1].Status().Code)
+
+	children := map[string][]string{}
+	for _, span := range rec.Ended() {
+		if parent, ok := byID[span.Parent().SpanID()]; ok {
+			children[parent.Name()] = append(children[parent.Name()], span.Name())
+		}
+	}
+	assert.Contains(t, children["OtpService.RequestOTP"], "Cache.IncrWithExpire")
+	assert.Contains(t, children["OtpService.RequestOTP"], "Cache.SetWithTTL")
+	assert.Contains(t, children["OtpService.ValidateOTP"], "Cache.Get")
+}
+
+func TestOtpService_Audit(t *testing.T) {
+	users := repository.NewInMemoryUserRepository()
+	svc := service.NewOtpService(cache.NewInMemoryCache(), users, "testsecret",
+		service.WithSender(&fakeSender{}),
+		service.WithAudit(audit.NewRecorder(users)),
+		service.WithRequestLimit(1, time.Minute),
+	)
+	ctx := audit.WithClient(context.Background(), audit.Client{IP: "203.0.113.7", UserAgent: "app/1.0"})
+	phone := "+989120000000"
+
+	code, err := svc.RequestOTP(ctx, phone)
+	require.NoError(t, err)
+	_, err = svc.RequestOTP(ctx, phone)
+	require.ErrorIs(t, err, service.ErrRateLimited)
+	_, err = svc.ValidateOTP(ctx, phone, "not-a-code")
+	require.ErrorIs(t, err, service.ErrInvalidOTP)
+	_, err = svc.ValidateOTP(ctx, phone, code)
+	require.NoError(t, err)
+	user, err := users.GetByPhone(ctx, phone)
+	require.NoError(t, err)
+
+	events, err := users.AuditEvents(ctx, repository.AuditQuery{})
+	require.NoError(t, err)
+	type summary struct {
+		Action   repository.AuditAction
+		Outcome  repository.AuditOutcome
+		Reason   string
+		TargetID string
+	}
+	var got []summary
+	for i := len(events) - 1; i >= 0; i-- {
+		e := events[i]
+		got = append(got, summary{e.Action, e.Outcome, e.Reason, e.TargetID})
+		assert.Equal(t, logging.PhoneHash(phone), e.PhoneHash)
+		assert.Equal(t, "203.0.113.7", e.IP)
+		assert.Equal(t, "app/1.0", e.UserAgent)
+	}
+	assert.Equal(t, []summary{
+		{repository.AuditOTPRequested, repository.AuditSuccess, "", ""},
+		{repository.AuditOTPRequested, repository.AuditFailure, "rate_limited", ""},
+		{repository.AuditOTPValidated, repository.AuditFailure, "invalid", ""},
+		{repository.AuditUserCreated, repository.AuditSuccess, "", user.ID},
+		{repository.AuditOTPValidated, repository.AuditSuccess, "", user.ID},
+		{repository.AuditLogin, repository.AuditSuccess, "", user.ID},
+	}, got)
+}
+
+func TestOtpService_AuditRecordsRejectionOncePerWindow(t *testing.T) {
+	users := repository.NewInMemoryUserRepository()
+	svc := service.NewOtpService(cache.NewInMemoryCache(), users, "testsecret",
+		service.WithSender(&fakeSender{}),
+		service.WithAudit(audit.NewRecorder(users)),
+		service.WithRequestLimit(1, time.Minute),
+	)
+	phone := "+989120000001"
+
+	_, err := svc.RequestOTP(context.Background(), phone)
+	require.NoError(t, err)
+	for range 20 {
+		_, err = svc.RequestOTP(context.Background(), phone)
+		require.ErrorIs(t, err, service.ErrRateLimited)
+	}
+
+	events, err := users.AuditEvents(context.Background(), repository.AuditQuery{})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, "rate_limited", events[0].Reason)
+}
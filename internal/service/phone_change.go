@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"user-go/internal/apperr"
+	"user-go/internal/logging"
+	"user-go/internal/repository"
+	"user-go/internal/sender"
+)
+
+var (
+	ErrNoPendingPhoneChange = apperr.New(apperr.Invalid, "no_pending_phone_change", "no pending phone change or code expired")
+	ErrSamePhone            = apperr.New(apperr.Invalid, "same_phone", "new phone is the current phone")
+)
+
+// pendingPhoneChange is cached under phone_change:<userID> until confirmed or expired.
+type pendingPhoneChange struct {
+	Phone string `json:"phone"`
+	Code  string `json:"code"`
+}
+
+func phoneChangeKey(userID string) string {
+	return "phone_change:" + userID
+}
+
+func phoneChangeFailKey(userID string) string {
+	return "phone_change_fail:" + userID
+}
+
+// RequestPhoneChange sends a code to newPhone that userID must confirm before the number changes.
+// Requests share the per-phone limit of RequestOTP so the flow cannot be used to flood a number,
+// and the same limit applies per user so it cannot be used to probe which numbers are registered.
+// A new request replaces any pending one. The code is returned for dev mode only.
+func (s *OtpService) RequestPhoneChange(ctx context.Context, userID, newPhone string) (string, error) {
+	code, err := s.requestPhoneChange(ctx, userID, newPhone)
+	event := requestEvent(newPhone, err)
+	event.ActorID, event.TargetID = userID, userID
+	s.audit.Record(ctx, event)
+	return code, err
+}
+
+func (s *OtpService) requestPhoneChange(ctx context.Context, userID, newPhone string) (string, error) {
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if user.Phone == newPhone {
+		return "", ErrSamePhone
+	}
+	if err := s.checkLocked(ctx, userLock(userID)); err != nil {
+		s.metrics.RateLimited("otp_lockout")
+		return "", err
+	}
+	// سقف درخواست‌ها پیش از بررسی ثبت بودن شماره اعمال می‌شود تا این مسیر برای
+	// آزمودن شماره‌های ثبت‌شده بی‌حد نباشد
+	s.metrics.OTPRequested()
+	for _, key := range []string{"phone_change_req:" + userID, "otp_req:" + newPhone} {
+		count, err := s.cache.IncrWithExpire(ctx, key, int(s.requestWindow.Seconds()))
+		if err != nil {
+			return "", err
+		}
+		if count > s.maxRequests {
+			s.metrics.RateLimited("otp_request")
+			return "", ErrRateLimited
+		}
+	}
+	// شماره‌ی کاربر حذف‌شده تا purge شدن رزرو می‌ماند
+	if _, err := s.users.GetByPhone(ctx, newPhone); err == nil || errors.Is(err, repository.ErrUserDeleted) {
+		return "", repository.ErrPhoneTaken
+	} else if !errors.Is(err, repository.ErrUserNotFound) {
+		return "", err
+	}
+	// شماره‌ای که با حدس اشتباه قفل شده نباید از این مسیر کد تازه بگیرد
+	if err := s.checkLocked(ctx, newPhone); err != nil {
+		s.metrics.RateLimited("otp_lockout")
+		return "", err
+	}
+	// مسدود بودن کاربر را middleware بررسی می‌کند؛ اینجا فقط پیشوندهای ممنوع
+	if err := s.checkBlocked(ctx, newPhone); err != nil {
+		return "", err
+	}
+
+
+	code, err := generateOTP()
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(pendingPhoneChange{Phone: newPhone, Code: code})
+	if err != nil {
+		return "", err
+	}
+	key := phoneChangeKey(userID)
+	if err := s.cache.SetWithTTL(ctx, key, string(payload), int(s.otpTTL.Seconds())); err != nil {
+		return "", err
+	}
+	msg := sender.Message{Channel: s.channel, To: newPhone, Code: code, TTL: s.otpTTL}
+	if err := s.sender.Send(ctx, msg); err != nil {
+		_ = s.cache.Delete(context.WithoutCancel(ctx), key)
+		s.metrics.OTPDeliveryFailed(string(s.channel))
+		return "", fmt.Errorf("%w: %v", ErrOTPDelivery, err)
+	}
+	s.metrics.OTPSent(string(s.channel))
+	return code, nil
+}
+
+// ConfirmPhoneChange checks code against the pending change of userID. On success the phone
+// is switched and recorded in the history in one step, every existing token of the user is
+// revoked, and a fresh token pair is returned for the caller.
+// Wrong codes are counted across requests within the request window; reaching the configured
+// number drops the pending change and locks the user's phone changes like a burned OTP.
+func (s *OtpService) ConfirmPhoneChange(ctx context.Context, userID, code string) (*TokenPair, error) {
+	pair, newPhone, err := s.confirmPhoneChange(ctx, userID, code)
+	s.recordValidation(err)
+
+	event := repository.AuditEvent{
+		Action: repository.AuditPhoneChanged, ActorID: userID, TargetID: userID,
+		Outcome: repository.AuditSuccess, Reason: string(repository.PhoneChangeVerified),
+	}
+	if newPhone != "" {
+		event.PhoneHash = logging.PhoneHash(newPhone)
+	}
+	if err != nil {
+		event.Outcome, event.Reason = repository.AuditFailure, validationReason(err)
+	}
+	s.audit.Record(ctx, event)
+	return pair, err
+}
+
+// confirmPhoneChange also returns the pending new phone once it is known.
+func (s *OtpService) confirmPhoneChange(ctx context.Context, userID, code string) (*TokenPair, string, error) {
+	bookkeeping := context.WithoutCancel(ctx)
+
+	// مثل ورود، تلاش پیش از خواندن کد رزرو می‌شود؛ شمارنده با درخواست کد تازه صفر نمی‌شود
+	attempt, err := s.cache.IncrWithExpire(bookkeeping, phoneChangeFailKey(userID), int(s.requestWindow.Seconds()))
+	if err != nil {
+		return nil, "", err
+	}
+	if attempt > s.guard.maxAttempts {
+		return nil, "", ErrTooManyAttempts
+	}
+
+	key := phoneChangeKey(userID)
+	raw, err := s.cache.Get(ctx, key)
+	if err != nil {
+		return nil, "", ErrNoPendingPhoneChange
+	}
+	var pending pendingPhoneChange
+	if err := json.Unmarshal([]byte(raw), &pending); err != nil {
+		return nil, "", ErrNoPendingPhoneChange
+	}
+
+	if subtle.ConstantTimeCompare([]byte(pending.Code), []byte(code)) != 1 {
+		if attempt < s.guard.maxAttempts {
+			return nil, pending.Phone, ErrInvalidOTP
+		}
+		_ = s.cache.Delete(bookkeeping, key)
+		_ = s.cache.Delete(bookkeeping, phoneChangeFailKey(userID))
+		if err := s.lockOut(bookkeeping, userLock(userID)); err != nil {
+			return nil, pending.Phone, err
+		}
+		return nil, pending.Phone, ErrTooManyAttempts
+	}
+
+	err = s.users.UpdatePhone(ctx, userID, pending.Phone, repository.PhoneChangeVerified, userID)
+	if err != nil {
+		return nil, pending.Phone, err
+	}
+	_ = s.cache.Delete(bookkeeping, key)
+	_ = s.cache.Delete(bookkeeping, phoneChangeFailKey(userID))
+
+	// توکن‌های قبلی شماره‌ی قدیمی را در claim دارند
+	if err := s.tokens.RevokeAll(bookkeeping, userID); err != nil {
+		return nil, pending.Phone, err
+	}
+
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, pending.Phone, err
+	}
+	pair, err := s.tokens.Issue(ctx, user)
+	return pair, pending.Phone, err
+}
@@ -0,0 +1,214 @@
+package service_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+	"user-go/internal/audit"
+	"user-go/internal/cache"
+	"user-go/internal/logging"
+	"user-go/internal/repository"
+	"user-go/internal/sender"
+	"user-go/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPhoneChangeService(t *testing.T, opts ...service.Option) (*service.OtpService, *repository.InMemoryUserRepository, *repository.User) {
+	users := repository.NewInMemoryUserRepository()
+	opts = append([]service.Option{service.WithSender(sender.NewConsoleSender(io.Discard))}, opts...)
+	svc := service.NewOtpService(cache.NewInMemoryCache(), users, "testsecret", opts...)
+	user, err := users.Create(context.Background(), "+989121111111")
+	require.NoError(t, err)
+	return svc, users, user
+}
+
+func TestPhoneChange_ConfirmSwitchesPhoneAndRevokesTokens(t *testing.T) {
+	svc, users, user := newPhoneChangeService(t)
+	ctx := context.Background()
+
+	old, err := svc.Tokens().Issue(ctx, user)
+	require.NoError(t, err)
+
+	code, err := svc.RequestPhoneChange(ctx, user.ID, "+989122222222")
+	require.NoError(t, err)
+
+	// تا تأیید نشود شماره تغییر نمی‌کند
+	current, err := users.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "+989121111111", current.Phone)
+
+	pair, err := svc.ConfirmPhoneChange(ctx, user.ID, code)
+	require.NoError(t, err)
+	assert.Equal(t, "+989122222222", parseClaims(t, pair.AccessToken)["phone"])
+
+	current, err = users.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "+989122222222", current.Phone)
+
+	history, err := users.PhoneHistory(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, repository.PhoneChangeVerified, history[0].Method)
+	assert.Equal(t, user.ID, history[0].ChangedBy)
+
+	revoked, err := svc.Tokens().IsRevoked(ctx, parseClaims(t, old.AccessToken))
+	require.NoError(t, err)
+	assert.True(t, revoked)
+	_, err = svc.Tokens().Refresh(ctx, old.RefreshToken)
+	assert.ErrorIs(t, err, service.ErrInvalidRefreshToken)
+
+	// کد یک‌بار مصرف است
+	_, err = svc.ConfirmPhoneChange(ctx, user.ID, code)
+	assert.ErrorIs(t, err, service.ErrNoPendingPhoneChange)
+}
+
+func TestPhoneChange_RejectsTakenAndSamePhone(t *testing.T) {
+	svc, users, user := newPhoneChangeService(t)
+	ctx := context.Background()
+
+	_, err := users.Create(ctx, "+989123333333")
+	require.NoError(t, err)
+
+	_, err = svc.RequestPhoneChange(ctx, user.ID, "+989123333333")
+	assert.ErrorIs(t, err, repository.ErrPhoneTaken)
+
+	_, err = svc.RequestPhoneChange(ctx, user.ID, user.Phone)
+	assert.ErrorIs(t, err, service.ErrSamePhone)
+
+	_, err = svc.RequestPhoneChange(ctx, repository.NewID(), "+989124444444")
+	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+}
+
+func TestPhoneChange_NumberTakenBeforeConfirm(t *testing.T) {
+	svc, users, user := newPhoneChangeService(t)
+	ctx := context.Background()
+
+	code, err := svc.RequestPhoneChange(ctx, user.ID, "+989125555555")
+	require.NoError(t, err)
+	_, err = users.Create(ctx, "+989125555555")
+	require.NoError(t, err)
+
+	_, err = svc.ConfirmPhoneChange(ctx, user.ID, code)
+	assert.ErrorIs(t, err, repository.ErrPhoneTaken)
+}
+
+func TestPhoneChange_DroppedAfterMaxAttempts(t *testing.T) {
+	svc, users, user := newPhoneChangeService(t, service.WithMaxValidateAttempts(2))
+	ctx := context.Background()
+
+	code, err := svc.RequestPhoneChange(ctx, user.ID, "+989126666666")
+	require.NoError(t, err)
+
+	_, err = svc.ConfirmPhoneChange(ctx, user.ID, "000000")
+	assert.ErrorIs(t, err, service.ErrInvalidOTP)
+	_, err = svc.ConfirmPhoneChange(ctx, user.ID, "000000")
+	assert.ErrorIs(t, err, service.ErrTooManyAttempts)
+
+	_, err = svc.ConfirmPhoneChange(ctx, user.ID, code)
+	assert.ErrorIs(t, err, service.ErrNoPendingPhoneChange)
+
+	current, err := users.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "+989121111111", current.Phone)
+}
+
+func TestPhoneChange_FailuresSurviveNewRequestsAndLock(t *testing.T) {
+	svc, _, user := newPhoneChangeService(t, service.WithMaxValidateAttempts(2))
+	ctx := context.Background()
+
+	_, err := svc.RequestPhoneChange(ctx, user.ID, "+989126666666")
+	require.NoError(t, err)
+	_, err = svc.ConfirmPhoneChange(ctx, user.ID, "000000")
+	assert.ErrorIs(t, err, service.ErrInvalidOTP)
+
+	// درخواست کد تازه شمارش حدس‌های اشتباه را صفر نمی‌کند
+	code, err := svc.RequestPhoneChange(ctx, user.ID, "+989126666666")
+	require.NoError(t, err)
+	_, err = svc.ConfirmPhoneChange(ctx, user.ID, "000000")
+	assert.ErrorIs(t, err, service.ErrTooManyAttempts)
+	_, err = svc.ConfirmPhoneChange(ctx, user.ID, code)
+	assert.ErrorIs(t, err, service.ErrNoPendingPhoneChange)
+
+	_, err = svc.RequestPhoneChange(ctx, user.ID, "+989127777777")
+	var locked *service.LockedError
+	require.ErrorAs(t, err, &locked)
+	assert.True(t, locked.Until.After(time.Now()))
+}
+
+func TestPhoneChange_SharesRequestLimit(t *testing.T) {
+	svc, _, user := newPhoneChangeService(t, service.WithRequestLimit(1, time.Minute))
+	ctx := context.Background()
+
+	_, err := svc.RequestPhoneChange(ctx, user.ID, "+989127777777")
+	require.NoError(t, err)
+
+	_, err = svc.RequestOTP(ctx, "+989127777777")
+	assert.ErrorIs(t, err, service.ErrRateLimited)
+}
+
+func TestPhoneChange_LimitsProbingRegisteredNumbers(t *testing.T) {
+	svc, users, user := newPhoneChangeService(t, service.WithRequestLimit(2, time.Minute))
+	ctx := context.Background()
+
+	for _, phone := range []string{"+989123333333", "+989124444444", "+989125555555"} {
+		_, err := users.Create(ctx, phone)
+		require.NoError(t, err)
+	}
+
+	// پس از سقف، پاسخ برای شماره‌ی ثبت‌شده هم همان محدودیت است
+	_, err := svc.RequestPhoneChange(ctx, user.ID, "+989123333333")
+	assert.ErrorIs(t, err, repository.ErrPhoneTaken)
+	_, err = svc.RequestPhoneChange(ctx, user.ID, "+989124444444")
+	assert.ErrorIs(t, err, repository.ErrPhoneTaken)
+	_, err = svc.RequestPhoneChange(ctx, user.ID, "+989125555555")
+	assert.ErrorIs(t, err, service.ErrRateLimited)
+}
+
+func TestPhoneChange_RefusedWhileNewPhoneLocked(t *testing.T) {
+	svc, _, user := newPhoneChangeService(t, service.WithMaxValidateAttempts(1))
+	ctx := context.Background()
+	locked := "+989126666666"
+
+	_, err := svc.RequestOTP(ctx, locked)
+	require.NoError(t, err)
+	_, err = svc.ValidateOTP(ctx, locked, "000000")
+	require.ErrorIs(t, err, service.ErrTooManyAttempts)
+
+	// قفل شماره با درخواست تغییر شماره دور زده نمی‌شود
+	_, err = svc.RequestPhoneChange(ctx, user.ID, locked)
+	assert.ErrorIs(t, err, service.ErrAccountLocked)
+}
+
+func TestPhoneChange_Audit(t *testing.T) {
+	users := repository.NewInMemoryUserRepository()
+	svc := service.NewOtpService(cache.NewInMemoryCache(), users, "testsecret",
+		service.WithSender(sender.NewConsoleSender(io.Discard)),
+		service.WithAudit(audit.NewRecorder(users)),
+	)
+	ctx := context.Background()
+	user, err := users.Create(ctx, "+989121111111")
+	require.NoError(t, err)
+
+	_, err = svc.RequestPhoneChange(ctx, user.ID, "+989121111111")
+	require.ErrorIs(t, err, service.ErrSamePhone)
+	code, err := svc.RequestPhoneChange(ctx, user.ID, "+989128888888")
+	require.NoError(t, err)
+	_, err = svc.ConfirmPhoneChange(ctx, user.ID, code)
+	require.NoError(t, err)
+
+	events, err := users.AuditEvents(ctx, repository.AuditQuery{UserID: user.ID})
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	changed := events[0]
+	assert.Equal(t, repository.AuditPhoneChanged, changed.Action)
+	assert.Equal(t, repository.AuditSuccess, changed.Outcome)
+	assert.Equal(t, "verified", changed.Reason)
+	assert.Equal(t, user.ID, changed.ActorID)
+	assert.Equal(t, logging.PhoneHash("+989128888888"), changed.PhoneHash)
+	assert.Equal(t, repository.AuditOTPRequested, events[1].Action)
+	assert.Equal(t, repository.AuditSuccess, events[1].Outcome)
+	assert.Equal(t, "phone_unavailable", events[2].Reason)
+}
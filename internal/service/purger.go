@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+	"user-go/internal/repository"
+)
+
+// Purger permanently erases users whose soft delete is older than the retention window and,
+// when configured, audit events past their own retention.
+type Purger struct {
+	users          repository.UserRepository
+	retention      time.Duration
+	audit          repository.AuditLog
+	auditRetention time.Duration
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// PurgerOption configures optional Purger jobs.
+type PurgerOption func(*Purger)
+
+// WithAuditRetention deletes audit events older than retention on every run.
+// Zero keeps them forever.
+func WithAuditRetention(log repository.AuditLog, retention time.Duration) PurgerOption {
+	return func(p *Purger) { p.audit, p.auditRetention = log, retention }
+}
+
+// PurgeResult counts what one run erased.
+type PurgeResult struct {
+	Users       int
+	AuditEvents int
+}
+
+func NewPurger(users repository.UserRepository, retention time.Duration, opts ...PurgerOption) *Purger {
+	p := &Purger{users: users, retention: retention}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// PurgeExpired erases every user deleted more than the retention window ago and returns how many.
+func (p *Purger) PurgeExpired(ctx context.Context) (int, error) {
+	return p.users.PurgeDeleted(ctx, time.Now().Add(-p.retention))
+}
+
+// PruneAudit deletes audit events past their retention and returns how many.
+func (p *Purger) PruneAudit(ctx context.Context) (int, error) {
+	if p.audit == nil || p.auditRetention <= 0 {
+		return 0, nil
+	}
+	return p.audit.PruneAudit(ctx, time.Now().Add(-p.auditRetention))
+}
+
+// Run purges expired users and prunes old audit events. A failure of one does not skip the other.
+func (p *Purger) Run(ctx context.Context) (PurgeResult, error) {
+	var res PurgeResult
+	var userErr, auditErr error
+	res.Users, userErr = p.PurgeExpired(ctx)
+	res.AuditEvents, auditErr = p.PruneAudit(ctx)
+	return res, errors.Join(userErr, auditErr)
+}
+
+// Start calls Run every interval until Close is called. report receives the outcome of each run.
+func (p *Purger) Start(interval time.Duration, report func(PurgeResult, error)) {
+	if interval <= 0 || p.stop != nil {
+		return
+	}
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				res, err := p.Run(context.Background())
+				if report != nil {
+					report(res, err)
+				}
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the scheduled purge, waiting for a run in progress.
+func (p *Purger) Close() error {
+	p.closeOnce.Do(func() {
+		if p.stop != nil {
+			close(p.stop)
+			<-p.done
+		}
+	})
+	return nil
+}
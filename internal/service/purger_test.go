@@ -0,0 +1,61 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+	"user-go/internal/repository"
+	"user-go/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPurger_PurgeExpired(t *testing.T) {
+	users := repository.NewInMemoryUserRepository()
+	ctx := context.Background()
+
+	user, err := users.Create(ctx, "+989121111111")
+	require.NoError(t, err)
+	require.NoError(t, users.Delete(ctx, user.ID))
+
+	// هنوز در بازه‌ی نگهداری است
+	n, err := service.NewPurger(users, time.Hour).PurgeExpired(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = service.NewPurger(users, 0).PurgeExpired(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	_, err = users.GetByPhone(ctx, "+989121111111")
+	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+}
+
+func TestPurger_Start(t *testing.T) {
+	users := repository.NewInMemoryUserRepository()
+	ctx := context.Background()
+
+	user, err := users.Create(ctx, "+989121111111")
+	require.NoError(t, err)
+	require.NoError(t, users.Delete(ctx, user.ID))
+
+	require.NoError(t, users.AppendAudit(ctx, repository.AuditEvent{Action: repository.AuditLogin, CreatedAt: time.Now().Add(-2 * time.Hour)}))
+	require.NoError(t, users.AppendAudit(ctx, repository.AuditEvent{Action: repository.AuditLogin}))
+
+	purged := make(chan service.PurgeResult, 10)
+	p := service.NewPurger(users, 0, service.WithAuditRetention(users, time.Hour))
+	p.Start(10*time.Millisecond, func(res service.PurgeResult, err error) {
+		assert.NoError(t, err)
+		purged <- res
+	})
+	defer p.Close()
+
+	select {
+	case res := <-purged:
+		assert.Equal(t, service.PurgeResult{Users: 1, AuditEvents: 1}, res)
+	case <-time.After(time.Second):
+		t.Fatal("purge job did not run")
+	}
+	require.NoError(t, p.Close())
+}
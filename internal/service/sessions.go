@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"user-go/internal/audit"
+	"user-go/internal/logging"
+	"user-go/internal/repository"
+)
+
+// maxDeviceName keeps client-reported device names short enough to list.
+const maxDeviceName = 64
+
+// WithSessions records a session for every login in store so users can list and end them.
+func WithSessions(store repository.SessionRepository) TokenOption {
+	return func(t *TokenService) { t.sessions = store }
+}
+
+// WithSessionTouchInterval sets how often a session's last-seen time is written at most.
+// Defaults to 5 minutes.
+func WithSessionTouchInterval(d time.Duration) TokenOption {
+	return func(t *TokenService) { t.touchInterval = d }
+}
+
+type deviceKey struct{}
+
+// WithDevice returns ctx carrying the device name the client reported when logging in.
+func WithDevice(ctx context.Context, name string) context.Context {
+	// ستون device بر حسب کاراکتر محدود است و Postgres رشته‌ی UTF-8 نامعتبر را نمی‌پذیرد
+	name = strings.TrimSpace(strings.ToValidUTF8(name, ""))
+	if utf8.RuneCountInString(name) > maxDeviceName {
+		name = string([]rune(name)[:maxDeviceName])
+	}
+	return context.WithValue(ctx, deviceKey{}, name)
+}
+
+// startSession records the login that started refresh token family id.
+func (t *TokenService) startSession(ctx context.Context, userID, id string) error {
+	if t.sessions == nil {
+		return nil
+	}
+	client := audit.ClientFrom(ctx)
+	device, _ := ctx.Value(deviceKey{}).(string)
+	return t.sessions.CreateSession(ctx, repository.Session{
+		ID: id, UserID: userID, Device: device, IP: client.IP, UserAgent: client.UserAgent, CreatedAt: time.Now(),
+	})
+}
+
+// Sessions returns the active sessions of userID, most recently seen first.
+func (t *TokenService) Sessions(ctx context.Context, userID string) ([]repository.Session, error) {
+	if t.sessions == nil {
+		return []repository.Session{}, nil
+	}
+	all, err := t.sessions.ListSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	// sessionی که refresh tokenش بدون استفاده منقضی شده، بدون ابطال هم تمام شده است
+	cutoff := time.Now().Add(-t.refreshTTL)
+	active := all[:0]
+	for _, s := range all {
+		if s.LastSeenAt.After(cutoff) {
+			active = append(active, s)
+		}
+	}
+	return active, nil
+}
+
+// RevokeSession ends session id of userID, e.g. a lost device: its refresh token stops working
+// and its access tokens are rejected at once. repository.ErrSessionNotFound if userID has no
+// such active session.
+func (t *TokenService) RevokeSession(ctx context.Context, userID, id string) error {
+	if t.sessions == nil {
+		return repository.ErrSessionNotFound
+	}
+	if err := t.sessions.RevokeSession(ctx, userID, id, time.Now()); err != nil {
+		return err
+	}
+	return t.cache.Delete(context.WithoutCancel(ctx), familyKey(id))
+}
+
+// EndSession ends session id taken from a verified token, as on logout.
+func (t *TokenService) EndSession(ctx context.Context, userID, id string) error {
+	// اول خانواده حذف می‌شود تا حتی اگر ثبت در پایگاه‌داده شکست بخورد، session از کار بیفتد
+	if err := t.cache.Delete(ctx, familyKey(id)); err != nil {
+		return err
+	}
+	if t.sessions == nil {
+		return nil
+	}
+	err := t.sessions.RevokeSession(context.WithoutCancel(ctx), userID, id, time.Now())
+	if err != nil && !errors.Is(err, repository.ErrSessionNotFound) {
+		return err
+	}
+	return nil
+}
+
+// TouchSession records that session id was just used. The store is written at most once per
+// touch interval; the cache absorbs the rest.
+func (t *TokenService) TouchSession(ctx context.Context, id string) error {
+	if t.sessions == nil || id == "" {
+		return nil
+	}
+	interval := int(t.touchInterval.Seconds())
+	if interval < 1 {
+		interval = 1
+	}
+	n, err := t.cache.IncrWithExpire(ctx, seenKey(id), interval)
+	if err != nil || n > 1 {
+		return err
+	}
+	err = t.sessions.TouchSession(ctx, id, time.Now())
+	if errors.Is(err, repository.ErrSessionNotFound) {
+		// خانواده‌های قدیمی‌تر از جدول sessions رکورد ندارند
+		return nil
+	}
+	return err
+}
+
+// endFamily drops a refresh token family the service itself decided to end, and marks its
+// session revoked on a best-effort basis.
+func (t *TokenService) endFamily(ctx context.Context, userID, family string) {
+	ctx = context.WithoutCancel(ctx)
+	_ = t.cache.Delete(ctx, familyKey(family))
+	if t.sessions == nil {
+		return
+	}
+	err := t.sessions.RevokeSession(ctx, userID, family, time.Now())
+	if err != nil && !errors.Is(err, repository.ErrSessionNotFound) {
+		logging.FromContext(ctx).WarnContext(ctx, "failed to mark session revoked", "user_id", userID, "error", err)
+	}
+}
+
+func seenKey(session string) string { return "session_seen:" + session }
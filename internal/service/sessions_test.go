@@ -0,0 +1,158 @@
+package service_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+	"user-go/internal/audit"
+	"user-go/internal/cache"
+	"user-go/internal/repository"
+	"user-go/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSessionTokens(t *testing.T, opts ...service.TokenOption) (*service.TokenService, *repository.InMemoryUserRepository, *repository.User) {
+	users := repository.NewInMemoryUserRepository()
+	user, err := users.Create(context.Background(), "+989120000000")
+	require.NoError(t, err)
+	opts = append([]service.TokenOption{service.WithSessions(users)}, opts...)
+	return service.NewTokenService(cache.NewInMemoryCache(), "testsecret", opts...), users, user
+}
+
+func TestSessions_IssueRecordsClient(t *testing.T) {
+	ts, _, user := newSessionTokens(t)
+	ctx := audit.WithClient(context.Background(), audit.Client{IP: "203.0.113.7", UserAgent: "app/1.0"})
+	ctx = service.WithDevice(ctx, "  Pixel 8  ")
+
+	pair, err := ts.Issue(ctx, user)
+	require.NoError(t, err)
+
+	sessions, err := ts.Sessions(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, parseClaims(t, pair.AccessToken)["sid"], sessions[0].ID)
+	assert.Equal(t, "Pixel 8", sessions[0].Device)
+	assert.Equal(t, "203.0.113.7", sessions[0].IP)
+	assert.Equal(t, "app/1.0", sessions[0].UserAgent)
+
+	_, err = ts.Issue(context.Background(), &repository.User{ID: repository.NewID()})
+	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+}
+
+func TestSessions_DeviceNameTruncatedByRune(t *testing.T) {
+	ts, _, user := newSessionTokens(t)
+	long := strings.Repeat("گوشی", 20) + "ÿ"
+	_, err := ts.Issue(service.WithDevice(context.Background(), long), user)
+	require.NoError(t, err)
+
+	sessions, err := ts.Sessions(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.True(t, utf8.ValidString(sessions[0].Device))
+	assert.Equal(t, 64, utf8.RuneCountInString(sessions[0].Device))
+}
+
+func TestSessions_RevokeSession(t *testing.T) {
+	ts, _, user := newSessionTokens(t)
+	ctx := context.Background()
+	lost, err := ts.Issue(ctx, user)
+	require.NoError(t, err)
+	kept, err := ts.Issue(ctx, user)
+	require.NoError(t, err)
+	lostID := parseClaims(t, lost.AccessToken)["sid"].(string)
+
+	assert.ErrorIs(t, ts.RevokeSession(ctx, repository.NewID(), lostID), repository.ErrSessionNotFound)
+	require.NoError(t, ts.RevokeSession(ctx, user.ID, lostID))
+	assert.ErrorIs(t, ts.RevokeSession(ctx, user.ID, lostID), repository.ErrSessionNotFound)
+
+	revoked, err := ts.IsRevoked(ctx, parseClaims(t, lost.AccessToken))
+	require.NoError(t, err)
+	assert.True(t, revoked)
+	_, err = ts.Refresh(ctx, lost.RefreshToken)
+	assert.ErrorIs(t, err, service.ErrInvalidRefreshToken)
+
+	revoked, err = ts.IsRevoked(ctx, parseClaims(t, kept.AccessToken))
+	require.NoError(t, err)
+	assert.False(t, revoked)
+	sessions, _ := ts.Sessions(ctx, user.ID)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, parseClaims(t, kept.AccessToken)["sid"], sessions[0].ID)
+}
+
+func TestSessions_LostCacheFallsBackToStore(t *testing.T) {
+	ts, users, user := newSessionTokens(t)
+	ctx := context.Background()
+	pair, err := ts.Issue(ctx, user)
+	require.NoError(t, err)
+	claims := parseClaims(t, pair.AccessToken)
+
+	// همان سرویس پس از restart با cache خالی
+	restarted := service.NewTokenService(cache.NewInMemoryCache(), "testsecret", service.WithSessions(users))
+	revoked, err := restarted.IsRevoked(ctx, claims)
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	require.NoError(t, users.RevokeSession(ctx, user.ID, claims["sid"].(string), time.Now()))
+	revoked, err = restarted.IsRevoked(ctx, claims)
+	require.NoError(t, err)
+	assert.True(t, revoked)
+}
+
+func TestSessions_ReuseAndRevokeAllEndSessions(t *testing.T) {
+	ts, _, user := newSessionTokens(t)
+	ctx := context.Background()
+	first, err := ts.Issue(ctx, user)
+	require.NoError(t, err)
+	_, err = ts.Issue(ctx, user)
+	require.NoError(t, err)
+
+	_, err = ts.Refresh(ctx, first.RefreshToken)
+	require.NoError(t, err)
+	_, err = ts.Refresh(ctx, first.RefreshToken)
+	assert.ErrorIs(t, err, service.ErrRefreshTokenReused)
+	sessions, _ := ts.Sessions(ctx, user.ID)
+	assert.Len(t, sessions, 1)
+
+	require.NoError(t, ts.RevokeAll(ctx, user.ID))
+	sessions, _ = ts.Sessions(ctx, user.ID)
+	assert.Empty(t, sessions)
+}
+
+func TestSessions_TouchIsThrottled(t *testing.T) {
+	ts, _, user := newSessionTokens(t, service.WithSessionTouchInterval(time.Hour))
+	ctx := context.Background()
+	pair, err := ts.Issue(ctx, user)
+	require.NoError(t, err)
+	sid := parseClaims(t, pair.AccessToken)["sid"].(string)
+	sessions, _ := ts.Sessions(ctx, user.ID)
+	created := sessions[0].LastSeenAt
+
+	time.Sleep(5 * time.Millisecond)
+	require.NoError(t, ts.TouchSession(ctx, sid))
+	sessions, _ = ts.Sessions(ctx, user.ID)
+	touched := sessions[0].LastSeenAt
+	assert.True(t, touched.After(created))
+
+	time.Sleep(5 * time.Millisecond)
+	require.NoError(t, ts.TouchSession(ctx, sid))
+	sessions, _ = ts.Sessions(ctx, user.ID)
+	assert.Equal(t, touched, sessions[0].LastSeenAt)
+
+	// sessions نامعلوم، مثلاً خانواده‌های قدیمی، خطا نیستند
+	assert.NoError(t, ts.TouchSession(ctx, repository.NewID()))
+}
+
+func TestSessions_ExpiredAreHidden(t *testing.T) {
+	ts, _, user := newSessionTokens(t, service.WithRefreshTTL(10*time.Millisecond))
+	_, err := ts.Issue(context.Background(), user)
+	require.NoError(t, err)
+
+	time.Sleep(20 * time.Millisecond)
+	sessions, err := ts.Sessions(context.Background(), user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
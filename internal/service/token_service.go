@@ -0,0 +1,392 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+	"user-go/internal/apperr"
+	"user-go/internal/cache"
+	"user-go/internal/keys"
+	"user-go/internal/metrics"
+	"user-go/internal/repository"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrInvalidRefreshToken = apperr.New(apperr.Unauthorized, "invalid_refresh_token", "invalid or expired refresh token")
+	ErrRefreshTokenReused  = apperr.New(apperr.Unauthorized, "refresh_token_reused", "refresh token reuse detected, session revoked")
+)
+
+// TokenPair is what a successful login or refresh returns to the client.
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    time.Duration
+}
+
+// TokenService issues short-lived access tokens and rotating refresh tokens.
+//
+// Refresh tokens are opaque and stored server-side by hash, grouped in families: each
+// refresh rotates the token inside its family, and presenting an already-rotated token
+// revokes the whole family. Every user also has a token generation, keyed by user id; bumping
+// it (logout-all, user deletion) invalidates all access and refresh tokens issued before.
+//
+// A family is a login session: its id is the sid claim of the access tokens issued in it, and
+// those are rejected as soon as the family ends.
+type TokenService struct {
+	cache         cache.Cache
+	keys          *keys.Manager
+	accessTTL     time.Duration
+	refreshTTL    time.Duration
+	metrics       *metrics.Metrics
+	sessions      repository.SessionRepository
+	touchInterval time.Duration
+}
+
+type refreshRecord struct {
+	UserID     string          `json:"uid"`
+	Phone      string          `json:"phone"`
+	Role       repository.Role `json:"role"`
+	Family     string          `json:"family"`
+	Generation int             `json:"gen"`
+	Used       bool            `json:"used"`
+}
+
+// TokenOption configures a TokenService.
+type TokenOption func(*TokenService)
+
+// WithAccessTTL sets the access token lifetime. Defaults to 15 minutes.
+func WithAccessTTL(d time.Duration) TokenOption {
+	return func(t *TokenService) { t.accessTTL = d }
+}
+
+// WithKeyManager signs access tokens with km instead of the HMAC secret.
+func WithKeyManager(km *keys.Manager) TokenOption {
+	return func(t *TokenService) { t.keys = km }
+}
+
+// WithRefreshTTL sets the refresh token lifetime. Defaults to 30 days.
+func WithRefreshTTL(d time.Duration) TokenOption {
+	return func(t *TokenService) { t.refreshTTL = d }
+}
+
+// WithTokenMetrics counts issued token pairs and rejected refresh tokens.
+func WithTokenMetrics(m *metrics.Metrics) TokenOption {
+	return func(t *TokenService) { t.metrics = m }
+}
+
+func NewTokenService(c cache.Cache, secret string, opts ...TokenOption) *TokenService {
+	t := &TokenService{
+		cache:         c,
+		accessTTL:     15 * time.Minute,
+		refreshTTL:    30 * 24 * time.Hour,
+		touchInterval: 5 * time.Minute,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	if t.keys == nil {
+		t.keys = keys.NewHMACManager([]byte(secret))
+	}
+	return t
+}
+
+// Keys returns the key manager that signs access tokens.
+func (t *TokenService) Keys() *keys.Manager {
+	return t.keys
+}
+
+// Issue starts a new session, i.e. refresh token family, for user and returns the first token pair.
+// The id becomes the sub claim; phone and role are embedded too, so changing either
+// must be followed by RevokeAll.
+func (t *TokenService) Issue(ctx context.Context, user *repository.User) (*TokenPair, error) {
+	family := repository.NewID()
+	gen, err := t.generation(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	pair, err := t.issue(ctx, refreshRecord{UserID: user.ID, Phone: user.Phone, Role: user.Role, Family: family, Generation: gen}, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := t.startSession(ctx, user.ID, family); err != nil {
+		_ = t.cache.Delete(context.WithoutCancel(ctx), familyKey(family))
+		return nil, err
+	}
+	t.metrics.TokenIssued("login")
+	return pair, nil
+}
+
+// Refresh rotates refreshToken and returns a new pair in the same family.
+func (t *TokenService) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	pair, err := t.refresh(ctx, refreshToken)
+	switch {
+	case err == nil:
+		t.metrics.TokenIssued("refresh")
+	case errors.Is(err, ErrRefreshTokenReused):
+		t.metrics.TokenRejected("refresh_reused")
+	case errors.Is(err, ErrInvalidRefreshToken):
+		t.metrics.TokenRejected("refresh_invalid")
+	}
+	return pair, err
+}
+
+func (t *TokenService) refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	hash := hashToken(refreshToken)
+	rec, err := t.loadRefresh(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if rec.UserID == "" {
+		// توکن‌های صادرشده قبل از شناسه‌ی پایدار؛ کاربر باید دوباره وارد شود
+		return nil, ErrInvalidRefreshToken
+	}
+
+	current, err := t.cache.Get(ctx, familyKey(rec.Family))
+	if err != nil {
+		// خانواده قبلاً باطل شده (logout یا reuse)
+		return nil, ErrInvalidRefreshToken
+	}
+	if rec.Used || current != hash {
+		// توکنی که قبلاً چرخانده شده دوباره استفاده شده؛ احتمالاً دزدیده شده است
+		// ابطال خانواده نباید با قطع شدن اتصال کلاینت لغو شود
+		t.endFamily(ctx, rec.UserID, rec.Family)
+		return nil, ErrRefreshTokenReused
+	}
+
+	gen, err := t.generation(ctx, rec.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if rec.Generation < gen {
+		t.endFamily(ctx, rec.UserID, rec.Family)
+		return nil, ErrInvalidRefreshToken
+	}
+
+	pair, err := t.issue(ctx, rec, hash)
+	if errors.Is(err, errFamilyMoved) {
+		// درخواست هم‌زمان دیگری همین توکن را زودتر چرخانده است
+		if _, err := t.cache.Get(ctx, familyKey(rec.Family)); err != nil {
+			return nil, ErrInvalidRefreshToken
+		}
+		t.endFamily(ctx, rec.UserID, rec.Family)
+		return nil, ErrRefreshTokenReused
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rec.Used = true
+	if err := t.storeRefresh(ctx, hash, rec); err != nil {
+		return nil, err
+	}
+	_ = t.TouchSession(ctx, rec.Family)
+	return pair, nil
+}
+
+// Logout revokes the refresh token family of refreshToken (if given) and denies the access token jti until exp.
+func (t *TokenService) Logout(ctx context.Context, refreshToken, jti string, exp time.Time) error {
+	if jti != "" {
+		if ttl := int(time.Until(exp).Seconds()) + 1; ttl > 0 {
+			if err := t.cache.SetWithTTL(ctx, denyKey(jti), "1", ttl); err != nil {
+				return err
+			}
+		}
+	}
+	if refreshToken != "" {
+		rec, err := t.loadRefresh(ctx, hashToken(refreshToken))
+		if err != nil {
+			return err
+		}
+		return t.EndSession(ctx, rec.UserID, rec.Family)
+	}
+	return nil
+}
+
+// RevokeAll invalidates every access and refresh token issued to the user so far.
+func (t *TokenService) RevokeAll(ctx context.Context, userID string) error {
+	ttl := int(t.refreshTTL.Seconds())
+	gen, err := t.cache.IncrWithExpire(ctx, generationKey(userID), ttl)
+	if err != nil {
+		return err
+	}
+	// عمر کلید را تمدید می‌کنیم تا تا پایان عمر آخرین refresh token باقی بماند
+	if err := t.cache.SetWithTTL(ctx, generationKey(userID), strconv.Itoa(gen), ttl); err != nil {
+		return err
+	}
+	if t.sessions != nil {
+		return t.sessions.RevokeAllSessions(ctx, userID, time.Now())
+	}
+	return nil
+}
+
+// IsRevoked reports whether validly signed access token claims have been revoked.
+func (t *TokenService) IsRevoked(ctx context.Context, claims jwt.MapClaims) (bool, error) {
+	if jti, ok := claims["jti"].(string); ok && jti != "" {
+		if _, err := t.cache.Get(ctx, denyKey(jti)); err == nil {
+			return true, nil
+		}
+	}
+
+	userID, _ := claims["sub"].(string)
+	if userID == "" {
+		return true, nil
+	}
+	// توکن‌های صادرشده پیش از sessionها sid ندارند و تا exp معتبر می‌مانند
+	if sid, ok := claims["sid"].(string); ok && sid != "" {
+		ended, err := t.sessionEnded(ctx, sid)
+		if err != nil || ended {
+			return ended, err
+		}
+	}
+	gen, err := t.generation(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	tokenGen, _ := claims["gen"].(float64)
+	return int(tokenGen) < gen, nil
+}
+
+// sessionEnded reports whether session sid was ended. The refresh family key answers on the
+// hot path; when the cache no longer has it, after a restart or an eviction, the stored
+// session decides, so a lost key does not log the user out. Without a session store the
+// family key is all there is.
+func (t *TokenService) sessionEnded(ctx context.Context, sid string) (bool, error) {
+	_, err := t.cache.Get(ctx, familyKey(sid))
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, cache.ErrNotFound) {
+		return false, err
+	}
+	if t.sessions == nil {
+		// بدون جدول sessions کلید خانواده تنها رکورد session است
+		return true, nil
+	}
+	session, err := t.sessions.GetSession(ctx, sid)
+	if errors.Is(err, repository.ErrSessionNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return session.RevokedAt != nil, nil
+}
+
+// errFamilyMoved reports that a rotation lost the race for its family to another one.
+var errFamilyMoved = errors.New("refresh family moved on")
+
+// issue signs an access token and a new refresh token in rec's family. A login passes an empty
+// prev and starts the family; a refresh passes the hash of the token it rotates, and the family
+// moves to the new token only if it still points at prev, in one compare-and-swap, so two
+// requests racing with the same token cannot both get a new one. The loser gets errFamilyMoved.
+func (t *TokenService) issue(ctx context.Context, rec refreshRecord, prev string) (*TokenPair, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	access, err := t.keys.Sign(jwt.MapClaims{
+		"sub":   rec.UserID,
+		"phone": rec.Phone,
+		"role":  rec.Role,
+		"jti":   jti,
+		"gen":   rec.Generation,
+		"sid":   rec.Family,
+		"iat":   now.Unix(),
+		"exp":   now.Add(t.accessTTL).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	hash := hashToken(refresh)
+	if err := t.storeRefresh(ctx, hash, rec); err != nil {
+		return nil, err
+	}
+	ttl := int(t.refreshTTL.Seconds())
+	if prev == "" {
+		if err := t.cache.SetWithTTL(ctx, familyKey(rec.Family), hash, ttl); err != nil {
+			return nil, err
+		}
+	} else {
+		swapped, err := t.cache.CompareAndSwap(ctx, familyKey(rec.Family), prev, hash, ttl)
+		if err == nil && !swapped {
+			err = errFamilyMoved
+		}
+		if err != nil {
+			_ = t.cache.Delete(context.WithoutCancel(ctx), refreshKey(hash))
+			return nil, err
+		}
+	}
+
+	return &TokenPair{AccessToken: access, RefreshToken: refresh, ExpiresIn: t.accessTTL}, nil
+}
+
+func (t *TokenService) generation(ctx context.Context, userID string) (int, error) {
+	val, err := t.cache.Get(ctx, generationKey(userID))
+	if errors.Is(err, cache.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(val)
+}
+
+func (t *TokenService) loadRefresh(ctx context.Context, hash string) (refreshRecord, error) {
+	var rec refreshRecord
+	val, err := t.cache.Get(ctx, refreshKey(hash))
+	if err != nil {
+		return rec, ErrInvalidRefreshToken
+	}
+	if err := json.Unmarshal([]byte(val), &rec); err != nil {
+		return rec, ErrInvalidRefreshToken
+	}
+	return rec, nil
+}
+
+func (t *TokenService) storeRefresh(ctx context.Context, hash string, rec refreshRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return t.cache.SetWithTTL(ctx, refreshKey(hash), string(data), int(t.refreshTTL.Seconds()))
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// SecurityKeyPrefixes are the cache keys holding lockouts, revocations, sessions and block
+// status. Losing one clears a lockout or a revocation, or logs a user out, so a bounded
+// in-memory cache must never evict them; see cache.WithPinnedPrefixes.
+var SecurityKeyPrefixes = []string{
+	"otp_fail:", "otp_lock:", "otp_lockouts:", "phone_change_fail:",
+	"refresh:", "refresh_family:", "jti_deny:", "token_gen:", "user_status:",
+}
+
+func refreshKey(hash string) string      { return "refresh:" + hash }
+func familyKey(family string) string     { return "refresh_family:" + family }
+func denyKey(jti string) string          { return "jti_deny:" + jti }
+func generationKey(userID string) string { return "token_gen:" + userID }
@@ -0,0 +1,186 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"user-go/internal/cache"
+	"user-go/internal/keys"
+	"user-go/internal/repository"
+	"user-go/internal/service"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	userA = &repository.User{ID: repository.NewID(), Phone: "+111", Role: repository.RoleUser}
+	userB = &repository.User{ID: repository.NewID(), Phone: "+222", Role: repository.RoleUser}
+)
+
+func parseClaims(t *testing.T, token string) jwt.MapClaims {
+	parsed, err := jwt.Parse(token, func(*jwt.Token) (interface{}, error) { return []byte("testsecret"), nil })
+	require.NoError(t, err)
+	return parsed.Claims.(jwt.MapClaims)
+}
+
+func TestTokenService_IssueAndRefresh(t *testing.T) {
+	ts := service.NewTokenService(cache.NewInMemoryCache(), "testsecret", service.WithAccessTTL(5*time.Minute))
+
+	pair, err := ts.Issue(context.Background(), userA)
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, pair.ExpiresIn)
+
+	claims := parseClaims(t, pair.AccessToken)
+	assert.Equal(t, userA.ID, claims["sub"])
+	assert.Equal(t, "+111", claims["phone"])
+	assert.Equal(t, "user", claims["role"])
+	assert.NotEmpty(t, claims["jti"])
+
+	next, err := ts.Refresh(context.Background(), pair.RefreshToken)
+	require.NoError(t, err)
+	assert.NotEqual(t, pair.RefreshToken, next.RefreshToken)
+	assert.Equal(t, "user", parseClaims(t, next.AccessToken)["role"])
+	assert.Equal(t, "+111", parseClaims(t, next.AccessToken)["phone"])
+	assert.Equal(t, userA.ID, parseClaims(t, next.AccessToken)["sub"])
+}
+
+func TestTokenService_TokensWithoutSubjectAreRevoked(t *testing.T) {
+	ts := service.NewTokenService(cache.NewInMemoryCache(), "testsecret")
+
+	// توکن‌های قدیمی فقط claim phone داشتند
+	revoked, err := ts.IsRevoked(context.Background(), jwt.MapClaims{"phone": "+111", "gen": float64(0)})
+	require.NoError(t, err)
+	assert.True(t, revoked)
+}
+
+func TestTokenService_RefreshReuseRevokesFamily(t *testing.T) {
+	ts := service.NewTokenService(cache.NewInMemoryCache(), "testsecret")
+
+	pair, err := ts.Issue(context.Background(), userA)
+	require.NoError(t, err)
+	rotated, err := ts.Refresh(context.Background(), pair.RefreshToken)
+	require.NoError(t, err)
+
+	// استفاده‌ی دوباره از توکن چرخانده‌شده
+	_, err = ts.Refresh(context.Background(), pair.RefreshToken)
+	assert.ErrorIs(t, err, service.ErrRefreshTokenReused)
+
+	// کل خانواده باطل شده، حتی توکن جدید
+	_, err = ts.Refresh(context.Background(), rotated.RefreshToken)
+	assert.ErrorIs(t, err, service.ErrInvalidRefreshToken)
+}
+
+// slowCache delays reads like a networked cache, widening any window between a read and a write.
+type slowCache struct{ cache.Cache }
+
+func (c slowCache) Get(ctx context.Context, key string) (string, error) {
+	time.Sleep(time.Millisecond)
+	return c.Cache.Get(ctx, key)
+}
+
+func TestTokenService_ConcurrentRefreshRotatesOnce(t *testing.T) {
+	ts := service.NewTokenService(slowCache{cache.NewInMemoryCache()}, "testsecret")
+	pair, err := ts.Issue(context.Background(), userA)
+	require.NoError(t, err)
+
+	// یک توکن که هم‌زمان دو بار فرستاده شود فقط یک جفت جدید می‌گیرد
+	var wg sync.WaitGroup
+	var rotated atomic.Int32
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := ts.Refresh(context.Background(), pair.RefreshToken)
+			if err == nil {
+				rotated.Add(1)
+			} else if !errors.Is(err, service.ErrRefreshTokenReused) {
+				assert.ErrorIs(t, err, service.ErrInvalidRefreshToken)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), rotated.Load())
+}
+
+func TestTokenService_RefreshUnknownToken(t *testing.T) {
+	ts := service.NewTokenService(cache.NewInMemoryCache(), "testsecret")
+
+	_, err := ts.Refresh(context.Background(), "not-a-token")
+	assert.ErrorIs(t, err, service.ErrInvalidRefreshToken)
+}
+
+func TestTokenService_Logout(t *testing.T) {
+	ts := service.NewTokenService(cache.NewInMemoryCache(), "testsecret")
+
+	pair, err := ts.Issue(context.Background(), userA)
+	require.NoError(t, err)
+	claims := parseClaims(t, pair.AccessToken)
+
+	revoked, err := ts.IsRevoked(context.Background(), claims)
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	exp, err := claims.GetExpirationTime()
+	require.NoError(t, err)
+	require.NoError(t, ts.Logout(context.Background(), pair.RefreshToken, claims["jti"].(string), exp.Time))
+
+	revoked, err = ts.IsRevoked(context.Background(), claims)
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	_, err = ts.Refresh(context.Background(), pair.RefreshToken)
+	assert.ErrorIs(t, err, service.ErrInvalidRefreshToken)
+}
+
+func TestTokenService_RevokeAll(t *testing.T) {
+	ts := service.NewTokenService(cache.NewInMemoryCache(), "testsecret")
+
+	first, err := ts.Issue(context.Background(), userA)
+	require.NoError(t, err)
+	second, err := ts.Issue(context.Background(), userA)
+	require.NoError(t, err)
+	other, err := ts.Issue(context.Background(), userB)
+	require.NoError(t, err)
+
+	require.NoError(t, ts.RevokeAll(context.Background(), userA.ID))
+
+	for _, pair := range []*service.TokenPair{first, second} {
+		revoked, err := ts.IsRevoked(context.Background(), parseClaims(t, pair.AccessToken))
+		require.NoError(t, err)
+		assert.True(t, revoked)
+
+		_, err = ts.Refresh(context.Background(), pair.RefreshToken)
+		assert.ErrorIs(t, err, service.ErrInvalidRefreshToken)
+	}
+
+	// کاربر دیگر تحت تأثیر قرار نمی‌گیرد
+	revoked, err := ts.IsRevoked(context.Background(), parseClaims(t, other.AccessToken))
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	// ورود دوباره پس از logout-all کار می‌کند
+	fresh, err := ts.Issue(context.Background(), userA)
+	require.NoError(t, err)
+	revoked, err = ts.IsRevoked(context.Background(), parseClaims(t, fresh.AccessToken))
+	require.NoError(t, err)
+	assert.False(t, revoked)
+}
+
+func TestTokenService_AsymmetricKeys(t *testing.T) {
+	km, err := keys.NewManager(keys.EdDSA)
+	require.NoError(t, err)
+	ts := service.NewTokenService(cache.NewInMemoryCache(), "", service.WithKeyManager(km))
+
+	pair, err := ts.Issue(context.Background(), userA)
+	require.NoError(t, err)
+
+	parsed, err := jwt.Parse(pair.AccessToken, km.Keyfunc, jwt.WithValidMethods(km.ValidMethods()))
+	require.NoError(t, err)
+	assert.Equal(t, "EdDSA", parsed.Method.Alg())
+	assert.Equal(t, km.Keys()[0].ID, parsed.Header["kid"])
+}
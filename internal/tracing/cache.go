@@ -0,0 +1,94 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"user-go/internal/cache"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedCache opens a span around every call to the wrapped cache.
+type tracedCache struct {
+	next cache.Cache
+}
+
+// tracedBucketCache is a tracedCache that keeps the wrapped cache's cache.BucketTaker.
+type tracedBucketCache struct {
+	tracedCache
+	bucket cache.BucketTaker
+}
+
+// NewCache wraps c so each call gets its own span. Only the key prefix is recorded,
+// since keys embed phone numbers and tokens. The result is a cache.BucketTaker if c is.
+func NewCache(c cache.Cache) cache.Cache {
+	if b, ok := c.(cache.BucketTaker); ok {
+		return &tracedBucketCache{tracedCache: tracedCache{next: c}, bucket: b}
+	}
+	return &tracedCache{next: c}
+}
+
+func (c *tracedCache) IncrWithExpire(ctx context.Context, key string, expireSeconds int) (int, error) {
+	ctx, span := startCache(ctx, "IncrWithExpire", key)
+	n, err := c.next.IncrWithExpire(ctx, key, expireSeconds)
+	End(span, err)
+	return n, err
+}
+
+func (c *tracedCache) SetWithTTL(ctx context.Context, key string, value string, ttlSeconds int) error {
+	ctx, span := startCache(ctx, "SetWithTTL", key)
+	err := c.next.SetWithTTL(ctx, key, value, ttlSeconds)
+	End(span, err)
+	return err
+}
+
+func (c *tracedCache) Get(ctx context.Context, key string) (string, error) {
+	ctx, span := startCache(ctx, "Get", key)
+	v, err := c.next.Get(ctx, key)
+	// miss جزء رفتار عادی است و نباید span را خطا نشان دهد
+	span.SetAttributes(attribute.Bool("cache.hit", err == nil))
+	if errors.Is(err, cache.ErrNotFound) {
+		End(span, nil)
+	} else {
+		End(span, err)
+	}
+	return v, err
+}
+
+func (c *tracedCache) Delete(ctx context.Context, key string) error {
+	ctx, span := startCache(ctx, "Delete", key)
+	err := c.next.Delete(ctx, key)
+	End(span, err)
+	return err
+}
+
+func (c *tracedCache) CompareAndSwap(ctx context.Context, key, old, value string, ttlSeconds int) (bool, error) {
+	ctx, span := startCache(ctx, "CompareAndSwap", key)
+	swapped, err := c.next.CompareAndSwap(ctx, key, old, value, ttlSeconds)
+	span.SetAttributes(attribute.Bool("cache.swapped", swapped))
+	End(span, err)
+	return swapped, err
+}
+
+func (c *tracedBucketCache) TakeToken(ctx context.Context, key string, burst int, perSec float64, now time.Time) (float64, bool, error) {
+	ctx, span := startCache(ctx, "TakeToken", key)
+	tokens, taken, err := c.bucket.TakeToken(ctx, key, burst, perSec, now)
+	End(span, err)
+	return tokens, taken, err
+}
+
+func startCache(ctx context.Context, op, key string) (context.Context, trace.Span) {
+	return Start(ctx, "Cache."+op, attribute.String("cache.key_prefix", keyPrefix(key)))
+}
+
+// keyPrefix returns key up to and including its first colon, e.g. "otp:" for "otp:+98912...".
+func keyPrefix(key string) string {
+	if i := strings.IndexByte(key, ':'); i >= 0 {
+		return key[:i+1]
+	}
+	return key
+}
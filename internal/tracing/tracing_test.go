@@ -0,0 +1,128 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"user-go/internal/cache"
+	"user-go/internal/tracing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans routes spans to an in-memory recorder for the duration of the test.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return rec
+}
+
+func attr(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestSetup(t *testing.T) {
+	shutdown, err := tracing.Setup(context.Background(), tracing.Options{Exporter: "none"})
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	_, err = tracing.Setup(context.Background(), tracing.Options{Exporter: "zipkin"})
+	assert.ErrorContains(t, err, "zipkin")
+}
+
+func TestEnd_RecordsError(t *testing.T) {
+	rec := recordSpans(t)
+
+	_, span := tracing.Start(context.Background(), "ok")
+	tracing.End(span, nil)
+	_, span = tracing.Start(context.Background(), "failed")
+	tracing.End(span, errors.New("boom"))
+
+	spans := rec.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Equal(t, "boom", spans[1].Status().Description)
+}
+
+func TestNewCache(t *testing.T) {
+	rec := recordSpans(t)
+	c := tracing.NewCache(cache.NewInMemoryCache())
+
+	ctx, parent := tracing.Start(context.Background(), "parent")
+	require.NoError(t, c.SetWithTTL(ctx, "otp:+989120000000", "123456", 60))
+	_, err := c.Get(ctx, "otp:+989120000000")
+	require.NoError(t, err)
+	_, err = c.Get(ctx, "otp_req:+989120000000")
+	require.ErrorIs(t, err, cache.ErrNotFound)
+	parent.End()
+
+	spans := rec.Ended()
+	require.Len(t, spans, 4)
+	for _, span := range spans[:3] {
+		assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID(), span.Name())
+		for _, kv := range span.Attributes() {
+			assert.NotContains(t, kv.Value.Emit(), "+98912", "keys must not leak phone numbers")
+		}
+	}
+	assert.Equal(t, "Cache.SetWithTTL", spans[0].Name())
+	assert.Equal(t, "otp:", attr(spans[0], "cache.key_prefix").AsString())
+	assert.True(t, attr(spans[1], "cache.hit").AsBool())
+	// miss خطا حساب نمی‌شود
+	assert.Equal(t, "otp_req:", attr(spans[2], "cache.key_prefix").AsString())
+	assert.False(t, attr(spans[2], "cache.hit").AsBool())
+	assert.Equal(t, codes.Unset, spans[2].Status().Code)
+}
+
+func TestNewCache_KeepsBucketTaker(t *testing.T) {
+	_, ok := tracing.NewCache(cache.NewInMemoryCache()).(cache.BucketTaker)
+	assert.False(t, ok)
+
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	defer client.Close()
+	rec := recordSpans(t)
+	b, ok := tracing.NewCache(cache.NewRedisCache(client, "")).(cache.BucketTaker)
+	require.True(t, ok, "a traced Redis cache must still update buckets atomically")
+	tokens, taken, err := b.TakeToken(context.Background(), "ratelimit:api:ip:1", 3, 1, time.Now())
+	require.NoError(t, err)
+	assert.True(t, taken)
+	assert.Equal(t, 2.0, tokens)
+	require.Len(t, rec.Ended(), 1)
+	assert.Equal(t, "Cache.TakeToken", rec.Ended()[0].Name())
+}
+
+func TestPgxTracer(t *testing.T) {
+	rec := recordSpans(t)
+	var tracer tracing.PgxTracer
+
+	ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{
+		SQL: "SELECT id FROM users WHERE phone = $1", Args: []any{"+989120000000"},
+	})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: errors.New("conn closed")})
+
+	spans := rec.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "postgres SELECT", spans[0].Name())
+	assert.Equal(t, "SELECT id FROM users WHERE phone = $1", attr(spans[0], "db.statement").AsString())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	for _, kv := range spans[0].Attributes() {
+		assert.NotContains(t, kv.Value.Emit(), "+98912")
+	}
+}
@@ -2,67 +2,446 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
+	"user-go/internal/audit"
 	"user-go/internal/cache"
+	"user-go/internal/config"
 	"user-go/internal/handler"
+	"user-go/internal/keys"
+	"user-go/internal/logging"
+	"user-go/internal/metrics"
 	"user-go/internal/middleware"
+	"user-go/internal/migrations"
+	"user-go/internal/phone"
+	"user-go/internal/ratelimit"
 	"user-go/internal/repository"
+	"user-go/internal/sender"
 	"user-go/internal/service"
+	"user-go/internal/tracing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 )
 
 func main() {
-	dsn := os.Getenv("DATABASE_URL")
-	if dsn == "" {
-		log.Fatal("DATABASE_URL environment variable is not set")
+	// تا خواندن کانفیگ، سطح و قالب لاگ معلوم نیست
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		fatal(logger, "invalid configuration", err)
+	}
+	if logger, err = logging.New(os.Stderr, logging.Options{Level: cfg.Log.Level, Format: cfg.Log.Format}); err != nil {
+		fatal(slog.New(slog.NewJSONHandler(os.Stderr, nil)), "invalid log configuration", err)
 	}
+	// کتابخانه‌هایی که با پکیج log می‌نویسند هم از همین handler رد می‌شوند
+	slog.SetDefault(logger)
+	logging.SetPhoneHashKey([]byte(cfg.Log.PhoneHashSecret))
 
-	secretKey := os.Getenv("JWT_SECRET")
-	if secretKey == "" {
+	if cfg.JWT.Secret == config.InsecureDevSecret {
 		// fallback برای توسعه محلی — در production حتماً مقداردهی کن
-		secretKey = "mysecretjwtkey"
+		logger.Warn("JWT_SECRET is not set, using an insecure development secret")
+	}
+	if cfg.Log.PhoneHashSecret == config.InsecureDevPhoneHashSecret {
+		logger.Warn("PHONE_HASH_SECRET is not set, phone hashes use an insecure development secret")
+	}
+	if cfg.OTP.DevMode {
+		logger.Warn("OTP dev mode is on, generated codes are returned in API responses")
+	}
+	if cfg.Env == config.EnvProduction {
+		gin.SetMode(gin.ReleaseMode)
+	}
+	gin.DebugPrintFunc = func(format string, values ...any) {
+		logger.Debug(strings.TrimSpace(fmt.Sprintf(format, values...)), "component", "gin")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.OTLPEndpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		SampleRatio: cfg.Tracing.SampleRatio,
+		ServiceName: "user-go",
+	})
+	if err != nil {
+		fatal(logger, "failed to configure tracing", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error("failed to flush traces", "error", err)
+		}
+	}()
 
-	pool, err := pgxpool.New(ctx, dsn)
+	// SIGTERM هنگام deploy و SIGINT در توسعه، هر دو shutdown تدریجی را شروع می‌کنند
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	poolConfig, err := pgxpool.ParseConfig(cfg.Database.URL)
+	if err != nil {
+		fatal(logger, "invalid database url", err)
+	}
+	poolConfig.ConnConfig.Tracer = tracing.PgxTracer{}
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
-		log.Fatalf("unable to connect to db: %v", err)
+		fatal(logger, "unable to connect to db", err)
 	}
 	defer pool.Close()
+	// در deploy همزمان، دیتابیس ممکن است کمی دیرتر از اپ بالا بیاید
+	connectCtx, cancelConnect := context.WithTimeout(ctx, cfg.Database.ConnectTimeout)
+	err = repository.WaitForPostgres(connectCtx, pool, func(attempt int, err error, wait time.Duration) {
+		logger.Warn("database not reachable, retrying", "attempt", attempt, "retry_in", wait.String(), "error", err)
+	})
+	cancelConnect()
+	if err != nil {
+		fatal(logger, "unable to connect to db", err)
+	}
+
+	migrator, err := migrations.New(pool, migrations.WithLogger(logging.Printf(logger.With("component", "migrations"))))
+	if err != nil {
+		fatal(logger, "failed to load migrations", err)
+	}
+	if len(cfg.Args) > 0 {
+		if cfg.Args[0] != "migrate" {
+			fatal(logger, "unknown command", fmt.Errorf("unknown command %q", cfg.Args[0]))
+		}
+		if err := runMigrate(context.Background(), migrator, cfg.Args[1:], os.Stdout); err != nil {
+			fatal(logger, "migrate failed", err)
+		}
+		return
+	}
+	if cfg.Database.AutoMigrate {
+		if _, err := migrator.Up(context.Background()); err != nil {
+			fatal(logger, "failed to apply migrations", err)
+		}
+	}
+
+	otpSender, err := newOTPSender(cfg.OTP.Sender)
+	if err != nil {
+		fatal(logger, "failed to configure OTP sender", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	appMetrics := metrics.New(registry)
+
+	otpCache, err := newCache(cfg.Cache)
+	if err != nil {
+		fatal(logger, "failed to configure cache", err)
+	}
+	if closer, ok := otpCache.(io.Closer); ok {
+		defer closer.Close()
+	}
+	if stats, ok := otpCache.(metrics.CacheStats); ok {
+		registry.MustRegister(metrics.NewCacheCollector(cfg.Cache.Backend, stats))
+	}
+	// cache حافظه‌ای همیشه در دسترس است
+	pingCache := func(context.Context) error { return nil }
+	if pinger, ok := otpCache.(cache.Pinger); ok {
+		pingCache = pinger.Ping
+	}
+	// wrap بعد از ثبت closer و collector، چون decorator آن‌ها را پیاده نمی‌کند
+	otpCache = tracing.NewCache(otpCache)
+
+	keyManager, err := newKeyManager(cfg.JWT)
+	if err != nil {
+		fatal(logger, "failed to load signing keys", err)
+	}
+	keyManager.StartRotation(cfg.JWT.RotationInterval, func(err error) {
+		logger.Error("signing key rotation failed", "error", err)
+	})
+	defer keyManager.Close()
 
-	userRepo := repository.NewPostgresUserRepository(pool)
-	cache := cache.NewInMemoryCache()
-	otpService := service.NewOtpService(cache, userRepo, secretKey)
+	userRepo := repository.NewPostgresUserRepository(pool,
+		repository.WithQueryTimeout(cfg.Database.QueryTimeout),
+		repository.WithMetrics(appMetrics),
+	)
+	purger := service.NewPurger(userRepo, cfg.Users.Retention,
+		service.WithAuditRetention(userRepo, cfg.Users.AuditRetention),
+	)
+	purger.Start(cfg.Users.PurgeInterval, func(res service.PurgeResult, err error) {
+		if err != nil {
+			logger.Error("user purge failed", "error", err)
+		}
+		if res.Users > 0 {
+			logger.Info("purged deleted users", "count", res.Users)
+		}
+		if res.AuditEvents > 0 {
+			logger.Info("pruned audit events", "count", res.AuditEvents)
+		}
+	})
+	defer purger.Close()
+	tokenService := service.NewTokenService(otpCache, cfg.JWT.Secret,
+		service.WithTokenMetrics(appMetrics),
+		service.WithKeyManager(keyManager),
+		service.WithAccessTTL(cfg.JWT.TTL),
+		service.WithRefreshTTL(cfg.JWT.RefreshTTL),
+		service.WithSessions(userRepo),
+	)
+	auditRecorder := audit.NewRecorder(userRepo)
+	blockService := service.NewBlockService(otpCache, userRepo, userRepo, tokenService)
+	otpService := service.NewOtpService(otpCache, userRepo, cfg.JWT.Secret,
+		service.WithSender(otpSender),
+		service.WithMetrics(appMetrics),
+		service.WithAudit(auditRecorder),
+		service.WithBlockService(blockService),
+		service.WithTokenService(tokenService),
+		service.WithOTPTTL(cfg.OTP.TTL),
+		service.WithRequestLimit(cfg.OTP.MaxRequests, cfg.OTP.RequestWindow),
+		service.WithMaxValidateAttempts(cfg.OTP.MaxValidateAttempts),
+		service.WithLockout(cfg.OTP.LockoutBase, cfg.OTP.LockoutMax),
+		service.WithValidateIPLimit(cfg.OTP.ValidateIPLimit, cfg.OTP.ValidateIPWindow),
+	)
 
-	authHandler := handler.NewAuthHandler(otpService)
-	userHandler := handler.NewUserHandler(userRepo)
+	// Validate این region را بررسی کرده است
+	phones, _ := phone.NewParser(cfg.Phone.DefaultRegion)
+	authHandler := handler.NewAuthHandler(otpService, handler.WithDevMode(cfg.OTP.DevMode), handler.WithPhoneParser(phones))
+	userHandler := handler.NewUserHandler(userRepo, handler.WithTokenRevoker(tokenService), handler.WithUserPhoneParser(phones),
+		handler.WithUserAudit(auditRecorder),
+	)
+	blockHandler := handler.NewBlockHandler(blockService)
+	auditHandler := handler.NewAuditHandler(userRepo)
+	sessionHandler := handler.NewSessionHandler(tokenService)
+	jwksHandler := handler.NewJWKSHandler(keyManager)
+	healthHandler := handler.NewHealthHandler(
+		handler.WithHealthCheck("postgres", pool.Ping),
+		handler.WithHealthCheck("cache", pingCache),
+	)
 
-	r := gin.Default()
+	r := gin.New()
+	// probeها پیش از Use ثبت می‌شوند تا هر چند ثانیه لاگ، trace و متریک تولید نکنند
+	r.GET("/healthz", middleware.Recovery(), healthHandler.Healthz)
+	r.GET("/readyz", middleware.Recovery(), healthHandler.Readyz)
+	r.Use(middleware.RequestLogger(logger), middleware.Tracing(), middleware.HTTPMetrics(appMetrics), middleware.Recovery(),
+		middleware.AuditClient(), middleware.Errors(),
+	)
+	r.NoRoute(middleware.NotFound())
+
+	limits, err := newRateLimits(cfg.RateLimit, otpCache, phones, appMetrics)
+	if err != nil {
+		fatal(logger, "failed to configure rate limits", err)
+	}
 
 	// Public routes
-	r.POST("/auth/request-otp", authHandler.RequestOTP)
-	r.POST("/auth/validate-otp", authHandler.ValidateOTP)
+	public := r.Group("/auth", limits.public...)
+	{
+		public.POST("/request-otp", append(limits.otp, authHandler.RequestOTP)...)
+		public.POST("/validate-otp", append(limits.otp, authHandler.ValidateOTP)...)
+		public.POST("/refresh", authHandler.Refresh)
+	}
+	r.GET("/.well-known/jwks.json", jwksHandler.JWKS)
 
 	// Protected routes (با JWT middleware)
 	authGroup := r.Group("/")
-	authGroup.Use(middleware.JWTAuthMiddleware([]byte(secretKey)))
+	authGroup.Use(middleware.JWTAuthMiddlewareWithKeys(keyManager, middleware.WithRevocationCheck(tokenService), middleware.WithAccessCheck(blockService),
+		middleware.WithMetrics(appMetrics), middleware.WithSessionTouch(tokenService),
+	))
+	authGroup.Use(limits.api...)
 	{
+		authGroup.POST("/auth/logout", authHandler.Logout)
+		authGroup.POST("/auth/logout-all", authHandler.LogoutAll)
 		authGroup.GET("/profile", userHandler.GetProfile)
-		authGroup.GET("/users/:phone", userHandler.GetUser)
-		authGroup.GET("/users", userHandler.ListUsers)
-		authGroup.PUT("/users/:phone", userHandler.EditUser)
-		authGroup.DELETE("/users/:phone", userHandler.DeleteUser)
+		authGroup.PATCH("/profile", userHandler.UpdateProfile)
+		authGroup.POST("/profile/phone", authHandler.RequestPhoneChange)
+		authGroup.POST("/profile/phone/confirm", authHandler.ConfirmPhoneChange)
+		authGroup.GET("/profile/sessions", sessionHandler.ListSessions)
+		authGroup.DELETE("/profile/sessions/:id", sessionHandler.RevokeSession)
+		authGroup.GET("/users/:id", middleware.RequireSelfOrPermission("id", middleware.PermUsersRead), userHandler.GetUser)
+		authGroup.GET("/users", middleware.RequirePermission(middleware.PermUsersRead), userHandler.ListUsers)
+		// تغییر شماره بدون OTP فقط برای ادمین؛ کاربر از /profile/phone استفاده می‌کند
+		authGroup.PUT("/users/:id", middleware.RequirePermission(middleware.PermUsersWrite), userHandler.EditUser)
+		authGroup.GET("/users/:id/phone-history", middleware.RequireSelfOrPermission("id", middleware.PermUsersRead), userHandler.PhoneHistory)
+		authGroup.DELETE("/users/:id", middleware.RequireSelfOrPermission("id", middleware.PermUsersDelete), userHandler.DeleteUser)
+		authGroup.POST("/users/:id/restore", middleware.RequirePermission(middleware.PermUsersDelete), userHandler.RestoreUser)
+		authGroup.POST("/users/:id/purge", middleware.RequirePermission(middleware.PermUsersDelete), userHandler.PurgeUser)
+		authGroup.PUT("/users/:id/role", middleware.RequirePermission(middleware.PermRolesManage), userHandler.SetRole)
+		authGroup.POST("/users/:id/suspend", middleware.RequirePermission(middleware.PermUsersBlock), blockHandler.SuspendUser)
+		authGroup.POST("/users/:id/ban", middleware.RequirePermission(middleware.PermUsersBlock), blockHandler.BanUser)
+		authGroup.DELETE("/users/:id/block", middleware.RequirePermission(middleware.PermUsersBlock), blockHandler.UnblockUser)
+		authGroup.GET("/phone-bans", middleware.RequirePermission(middleware.PermUsersBlock), blockHandler.ListPhoneBans)
+		authGroup.POST("/phone-bans", middleware.RequirePermission(middleware.PermUsersBlock), blockHandler.BanPhonePrefix)
+		authGroup.DELETE("/phone-bans/:prefix", middleware.RequirePermission(middleware.PermUsersBlock), blockHandler.UnbanPhonePrefix)
+		authGroup.GET("/audit-events", middleware.RequirePermission(middleware.PermAuditRead), auditHandler.ListEvents)
+	}
+
+	servers := []*http.Server{{Addr: cfg.Addr(), Handler: r, ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout}}
+	if addr := cfg.AdminAddr(); addr != "" {
+		// /metrics احراز هویت ندارد و فقط روی پورت داخلی سرو می‌شود
+		admin := http.NewServeMux()
+		admin.Handle("GET /metrics", metrics.Handler(registry))
+		servers = append(servers, &http.Server{Addr: addr, Handler: admin, ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout})
+	}
+	if err := serve(ctx, servers, healthHandler, cfg.HTTP, logger.With("env", cfg.Env)); err != nil {
+		fatal(logger, "failed to run server", err)
+	}
+}
+
+// serve runs servers until ctx is done or one of them fails, then drains: readiness fails for
+// cfg.DrainDelay so load balancers stop routing here, and in-flight requests get
+// cfg.ShutdownTimeout to finish. Deferred cleanup in main runs after serve returns.
+func serve(ctx context.Context, servers []*http.Server, health *handler.HealthHandler, cfg config.HTTPConfig, logger *slog.Logger) error {
+	serveErr := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func() { serveErr <- srv.ListenAndServe() }()
+		logger.Info("server is running", "addr", srv.Addr)
+	}
+
+	running := len(servers)
+	var failed error
+	select {
+	case failed = <-serveErr:
+		// یک listener از کار افتاده؛ بقیه را هم می‌بندیم
+		running--
+	case <-ctx.Done():
+		logger.Info("shutdown signal received, draining", "drain_delay", cfg.DrainDelay.String())
+		health.Drain()
+		time.Sleep(cfg.DrainDelay)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	for _, srv := range servers {
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			// درخواست‌هایی که در مهلت تمام نشدند قطع می‌شوند
+			logger.Error("graceful shutdown timed out, closing open connections", "addr", srv.Addr, "error", err)
+			_ = srv.Close()
+		}
+	}
+	for range running {
+		if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) && failed == nil {
+			failed = err
+		}
+	}
+	if failed != nil {
+		return failed
+	}
+	logger.Info("server stopped")
+	return nil
+}
+
+// fatal logs err and exits, like log.Fatal; deferred calls do not run.
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// rateLimits is the rate limit middleware of each route group.
+type rateLimits struct {
+	public, otp, api []gin.HandlerFunc
+}
+
+// newRateLimits builds the middleware limiting the public /auth routes, the OTP routes within
+// them and the authenticated routes, each by its rule's key; all are empty when rate limiting
+// is disabled.
+func newRateLimits(cfg config.RateLimitConfig, c cache.Cache, phones *phone.Parser, m *metrics.Metrics) (rateLimits, error) {
+	var limits rateLimits
+	if !cfg.Enabled {
+		return limits, nil
+	}
+	build := func(name string, rule config.RateLimitRule) ([]gin.HandlerFunc, error) {
+		key, err := newRateLimitKey(rule.Key, phones)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		limiter, err := ratelimit.New(c, ratelimit.Rule{
+			Algorithm: ratelimit.Algorithm(rule.Algorithm), Limit: rule.Limit, Window: rule.Window, Burst: rule.Burst,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return []gin.HandlerFunc{middleware.RateLimit(name, limiter, key, middleware.WithRateLimitMetrics(m))}, nil
+	}
+	var err error
+	if limits.public, err = build("public", cfg.Public); err != nil {
+		return rateLimits{}, err
+	}
+	if limits.otp, err = build("otp", cfg.OTP); err != nil {
+		return rateLimits{}, err
+	}
+	if limits.api, err = build("api", cfg.API); err != nil {
+		return rateLimits{}, err
+	}
+	return limits, nil
+}
+
+// newRateLimitKey maps a configured rate limit key to what requests are counted against.
+func newRateLimitKey(kind string, phones *phone.Parser) (middleware.RateLimitKey, error) {
+	switch kind {
+	case "ip":
+		return middleware.ByIP(), nil
+	case "user":
+		return middleware.ByUser(), nil
+	case "phone":
+		return middleware.ByPhone("phone", phones), nil
+	case "route":
+		return middleware.ByRoute(), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit key %q", kind)
+	}
+}
+
+// newKeyManager builds the JWT signing keys. Retired keys stay valid for one access token lifetime.
+func newKeyManager(cfg config.JWTConfig) (*keys.Manager, error) {
+	if cfg.Algorithm == string(keys.HS256) {
+		return keys.NewHMACManager([]byte(cfg.Secret)), nil
+	}
+	opts := []keys.Option{keys.WithRetention(cfg.TTL)}
+	if cfg.KeyDir != "" {
+		opts = append(opts, keys.WithKeyDir(cfg.KeyDir))
 	}
+	return keys.NewManager(keys.Algorithm(cfg.Algorithm), opts...)
+}
+
+// newCache builds the configured cache backend (memory or redis).
+func newCache(cfg config.CacheConfig) (cache.Cache, error) {
+	switch cfg.Backend {
+	case "memory":
+		return cache.NewInMemoryCache(
+			cache.WithMaxEntries(cfg.MaxEntries),
+			cache.WithPinnedPrefixes(service.SecurityKeyPrefixes...),
+			cache.WithCleanupInterval(cfg.CleanupInterval),
+		), nil
+	case "redis":
+		return cache.NewRedisCacheFromURL(cache.RedisOptions{URL: cfg.RedisURL, PoolSize: cfg.RedisPoolSize, KeyPrefix: "user-go:", OpTimeout: cfg.OpTimeout})
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", cfg.Backend)
+	}
+}
 
-	log.Println("Server is running on :8080")
-	if err := r.Run(":8080"); err != nil {
-		log.Fatalf("failed to run server: %v", err)
+// newOTPSender builds the configured OTP transport (console, file, webhook or smpp).
+func newOTPSender(cfg config.SenderConfig) (sender.Sender, error) {
+	switch cfg.Kind {
+	case "console":
+		return sender.NewConsoleSender(os.Stdout), nil
+	case "file":
+		// فایل تا پایان عمر پروسه باز می‌ماند
+		s, _, err := sender.NewFileSender(cfg.FilePath)
+		return s, err
+	case "webhook":
+		headers := map[string]string{}
+		if cfg.WebhookToken != "" {
+			headers["Authorization"] = "Bearer " + cfg.WebhookToken
+		}
+		return sender.NewWebhookSender(cfg.WebhookURL, headers, nil), nil
+	case "smpp":
+		return sender.NewSMPPSender(sender.SMPPConfig{
+			Addr:       cfg.SMPP.Addr,
+			SystemID:   cfg.SMPP.SystemID,
+			Password:   cfg.SMPP.Password,
+			SourceAddr: cfg.SMPP.SourceAddr,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown OTP sender %q", cfg.Kind)
 	}
 }
 